@@ -0,0 +1,121 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package auth // import "github.com/wabarc/wayback/auth"
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/storage"
+)
+
+// prefix marks the secret of an API token, it helps secret scanners.
+const prefix = "wbk_"
+
+// AdminID is the id of the token from the admin token of configurations.
+const AdminID = "admin"
+
+var (
+	ErrInvalidToken = errors.New("invalid token")       // ErrInvalidToken the token is missing or does not exist
+	ErrUnknownScope = errors.New("unknown token scope") // ErrUnknownScope the scope is not one of entity.Scopes
+)
+
+// Issue creates an API token with the given scopes, and returns the secret
+// of it. The secret is shown only once, only its digest is kept.
+func Issue(store storage.Storage, name string, scopes []string) (string, *entity.Token, error) {
+	for _, scope := range scopes {
+		if !known(scope) {
+			return "", nil, errors.Wrap(ErrUnknownScope, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return "", nil, errors.New("requires at least one scope")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	secret := prefix + base64.RawURLEncoding.EncodeToString(b)
+	digest := digestOf(secret)
+	token := &entity.Token{
+		ID:        digest[:12],
+		Name:      name,
+		Digest:    digest,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if err := store.CreateToken(token); err != nil {
+		return "", nil, err
+	}
+
+	return secret, token, nil
+}
+
+// Authenticate returns the token of the given secret. The admin token of
+// configurations is granted all scopes.
+func Authenticate(store storage.Storage, secret string) (*entity.Token, error) {
+	if secret == "" {
+		return nil, ErrInvalidToken
+	}
+	if admin := config.Opts.AdminToken(); admin != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(admin)) == 1 {
+		return &entity.Token{ID: AdminID, Name: "WAYBACK_ADMIN_TOKEN", Scopes: entity.Scopes}, nil
+	}
+	if !strings.HasPrefix(secret, prefix) {
+		return nil, ErrInvalidToken
+	}
+
+	digest := digestOf(secret)
+	token, err := store.Token(digest[:12])
+	if errors.Is(err, storage.ErrTokenNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Digest), []byte(digest)) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	return token, nil
+}
+
+// ParseScopes parses the comma separated scopes.
+func ParseScopes(s string) ([]string, error) {
+	scopes := []string{}
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" {
+			continue
+		}
+		if !known(scope) {
+			return nil, errors.Wrap(ErrUnknownScope, scope)
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+func known(scope string) bool {
+	for _, s := range entity.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func digestOf(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
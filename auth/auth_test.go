@@ -0,0 +1,100 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package auth // import "github.com/wabarc/wayback/auth"
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestAuthenticate(t *testing.T) {
+	helper.Unsetenv("WAYBACK_ADMIN_TOKEN")
+	os.Setenv("WAYBACK_ADMIN_TOKEN", "foo")
+	defer helper.Unsetenv("WAYBACK_ADMIN_TOKEN")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	secret, token, err := Issue(store, "ci", []string{entity.ScopeArchive})
+	if err != nil {
+		t.Fatalf("Unexpected issue token: %v", err)
+	}
+	if !strings.HasPrefix(secret, prefix) || strings.Contains(token.Digest, secret) {
+		t.Fatalf("Unexpected token secret, got %s", secret)
+	}
+
+	var tests = []struct {
+		name   string
+		secret string
+		id     string
+		err    error
+	}{
+		{name: "empty", secret: "", err: ErrInvalidToken},
+		{name: "admin token", secret: "foo", id: AdminID},
+		{name: "issued token", secret: secret, id: token.ID},
+		{name: "unknown token", secret: prefix + "bar", err: ErrInvalidToken},
+		{name: "tampered token", secret: secret[:len(secret)-1] + "x", err: ErrInvalidToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Authenticate(store, test.secret)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Unexpected authenticate, got %v instead of %v", err, test.err)
+			}
+			if err == nil && got.ID != test.id {
+				t.Errorf("Unexpected token id, got %s instead of %s", got.ID, test.id)
+			}
+		})
+	}
+
+	if err := store.RemoveToken(token.ID); err != nil {
+		t.Fatalf("Unexpected revoke token: %v", err)
+	}
+	if _, err := Authenticate(store, secret); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Unexpected authenticate revoked token, got %v instead of %v", err, ErrInvalidToken)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	var tests = []struct {
+		scopes string
+		exp    int
+		err    error
+	}{
+		{scopes: "", exp: 0},
+		{scopes: "archive, Playback", exp: 2},
+		{scopes: "archive,foo", err: ErrUnknownScope},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scopes, func(t *testing.T) {
+			got, err := ParseScopes(test.scopes)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Unexpected parse scopes, got %v instead of %v", err, test.err)
+			}
+			if len(got) != test.exp {
+				t.Errorf("Unexpected scopes, got %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package auth issues and verifies the API tokens to access the HTTP server.
+*/
+package auth // import "github.com/wabarc/wayback/auth"
@@ -0,0 +1,242 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/storage"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the database",
+	Long: `Manage the database of the configured driver.
+
+The bolt database is locked by a running daemon service, stop it first.`,
+	Example: `  wayback db migrate --dry-run
+  wayback db migrate
+  wayback db backup /var/backups/wayback.db
+  wayback db export -o wayback.jsonl
+  wayback db import wayback.jsonl`,
+}
+
+func init() {
+	var dryRun bool
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the database schema to the latest version",
+		Long: `Migrate the database schema to the latest version.
+
+A snapshot of the database is saved next to it before migrating, the
+migrations run in a single transaction and leave the database untouched
+if any of them fails. The daemon service migrates on start as well.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := loadConfig(); err != nil {
+				return err
+			}
+			return migrate(cmd, dryRun)
+		},
+	}
+	migrateCmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "Show the pending migrations without applying them")
+
+	backupCmd := &cobra.Command{
+		Use:   "backup [file]",
+		Short: "Take a consistent backup of the database",
+		Long: `Take a consistent backup of the database, which can be used in place of it.
+
+The backup is written to the file, or to the standard output if it is "-",
+defaults to a file next to the database. The bolt database is locked by a
+running daemon service, use the admin API of the HTTP server to take a backup
+without stopping it.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := loadConfig(); err != nil {
+				return err
+			}
+			path := fmt.Sprintf("%s.%s.bak", config.Opts.DatabasePathname(), time.Now().Format("20060102150405"))
+			if len(args) > 0 {
+				path = args[0]
+			}
+			return backup(cmd, path)
+		},
+	}
+
+	var output string
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export all records of the database in JSON Lines",
+		Long: `Export all records of the database in JSON Lines, one record a line.
+
+The records are independent of the database driver, they can be imported into
+a database of any driver.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := loadConfig(); err != nil {
+				return err
+			}
+			return export(cmd, output)
+		},
+	}
+	exportCmd.Flags().StringVarP(&output, "output", "o", "-", "File to write, defaults to the standard output")
+
+	importCmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import records in JSON Lines into the database",
+		Long: `Import records in JSON Lines into the database, reads the standard input if
+the file is "-".
+
+The records keep their ids and replace the existing ones with the same ids,
+nothing is imported if any of them fails.`,
+		Args: cobra.ExactArgs(1),
+		RunE: withStorage(func(cmd *cobra.Command, store storage.Storage, args []string) error {
+			var r io.Reader = cmd.InOrStdin()
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			n, err := store.Import(r)
+			if err != nil {
+				return err
+			}
+			cmd.Printf("Imported %d records.\n", n)
+			return nil
+		}),
+	}
+
+	dbCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "Configuration file path, defaults: ./wayback.conf, ~/wayback.conf, /etc/wayback.conf")
+	dbCmd.AddCommand(migrateCmd, backupCmd, exportCmd, importCmd)
+	rootCmd.AddCommand(dbCmd)
+}
+
+func migrate(cmd *cobra.Command, dryRun bool) error {
+	path := config.Opts.DatabasePathname()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		cmd.Printf("Database %s does not exist, it will be created with schema version %d.\n", path, storage.SchemaVersion())
+		if dryRun {
+			return nil
+		}
+		return apply(cmd, path)
+	}
+
+	store, err := openReadOnly()
+	if err != nil {
+		return err
+	}
+	version, err := store.Version()
+	if err != nil {
+		store.Close()
+		return err
+	}
+	pending, err := store.Pending()
+	store.Close()
+	if err != nil {
+		return err
+	}
+
+	cmd.Printf("Database: %s\n", path)
+	cmd.Printf("Schema version: %d, latest: %d\n", version, storage.SchemaVersion())
+	if len(pending) == 0 {
+		cmd.Println("Nothing to migrate.")
+		return nil
+	}
+	for _, m := range pending {
+		cmd.Printf("  %d: %s\n", m.Version, m.Name)
+	}
+	if dryRun {
+		cmd.Printf("%d pending migrations, run without --dry-run to apply them.\n", len(pending))
+		return nil
+	}
+
+	return apply(cmd, path)
+}
+
+func apply(cmd *cobra.Command, path string) error {
+	store, err := storage.Open(path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	version, err := store.Version()
+	if err != nil {
+		return err
+	}
+	cmd.Printf("Migrated to schema version %d.\n", version)
+
+	return nil
+}
+
+func backup(cmd *cobra.Command, path string) error {
+	store, err := openReadOnly()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if path == "-" {
+		_, err = store.Backup(cmd.OutOrStdout())
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	n, err := store.Backup(f)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	cmd.PrintErrf("Backed up %d bytes to %s\n", n, path)
+
+	return nil
+}
+
+func export(cmd *cobra.Command, path string) error {
+	store, err := openReadOnly()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if path == "-" {
+		return store.Export(cmd.OutOrStdout())
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := store.Export(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// openReadOnly opens the configured database in read-only mode.
+func openReadOnly() (storage.Storage, error) {
+	store, err := storage.OpenReadOnly("")
+	if err != nil {
+		return nil, errors.Wrap(err, "open database failed, the bolt database may be locked by a running daemon service")
+	}
+	return store, nil
+}
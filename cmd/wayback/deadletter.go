@@ -0,0 +1,194 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/deadletter"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/storage"
+)
+
+var deadLetterCmd = &cobra.Command{
+	Use:   "deadletter",
+	Short: "Manage failed wayback requests",
+	Long: `Manage wayback requests that failed after exhausting retries.
+
+The bolt database is locked by a running daemon service, stop it first or
+use the admin API of the HTTP server instead. The SQLite database has no
+such limitation.`,
+	Example: `  wayback deadletter list
+  wayback deadletter show cfg9vlfm4bsj4sdsh2ng
+  wayback deadletter replay cfg9vlfm4bsj4sdsh2ng
+  wayback deadletter replay --all
+  wayback deadletter purge`,
+}
+
+func init() {
+	var all bool
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List failed wayback requests",
+		Args:  cobra.NoArgs,
+		RunE: withStorage(func(cmd *cobra.Command, store storage.Storage, _ []string) error {
+			dls, err := store.DeadLetters()
+			if err != nil {
+				return err
+			}
+			cmd.Println(prettyDeadLetters(dls))
+			return nil
+		}),
+	}
+	showCmd := &cobra.Command{
+		Use:   "show <id>...",
+		Short: "Show details of failed wayback requests",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: withStorage(func(cmd *cobra.Command, store storage.Storage, args []string) error {
+			for _, id := range args {
+				dl, err := store.DeadLetter(id)
+				if err != nil {
+					return errors.Wrap(err, id)
+				}
+				cmd.Println(prettyDeadLetter(dl))
+			}
+			return nil
+		}),
+	}
+	replayCmd := &cobra.Command{
+		Use:   "replay [<id>...]",
+		Short: "Replay failed wayback requests",
+		RunE: withStorage(func(cmd *cobra.Command, store storage.Storage, args []string) error {
+			if all {
+				dls, err := store.DeadLetters()
+				if err != nil {
+					return err
+				}
+				for _, dl := range dls {
+					args = append(args, dl.ID)
+				}
+			}
+			if len(args) == 0 {
+				return errors.New("requires IDs of dead letters or the --all flag")
+			}
+			return replayDeadLetters(cmd, store, args)
+		}),
+	}
+	replayCmd.Flags().BoolVarP(&all, "all", "", false, "Replay all failed wayback requests")
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <id>...",
+		Short: "Remove failed wayback requests",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: withStorage(func(cmd *cobra.Command, store storage.Storage, args []string) error {
+			for _, id := range args {
+				if err := store.RemoveDeadLetter(id); err != nil {
+					return errors.Wrap(err, id)
+				}
+				cmd.Println("Removed", id)
+			}
+			return nil
+		}),
+	}
+	purgeCmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Remove all failed wayback requests",
+		Args:  cobra.NoArgs,
+		RunE: withStorage(func(cmd *cobra.Command, store storage.Storage, _ []string) error {
+			return store.PurgeDeadLetters()
+		}),
+	}
+
+	deadLetterCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "Configuration file path, defaults: ./wayback.conf, ~/wayback.conf, /etc/wayback.conf")
+	deadLetterCmd.AddCommand(listCmd, showCmd, replayCmd, removeCmd, purgeCmd)
+	rootCmd.AddCommand(deadLetterCmd)
+}
+
+// loadConfig parses configurations for a subcommand.
+func loadConfig() error {
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseFile(configFile); err != nil {
+		return errors.Wrap(err, "parse configuration file failed")
+	}
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		return errors.Wrap(err, "parse environment variables failed")
+	}
+	logger.SetLogLevel(config.Opts.LogLevel())
+	return nil
+}
+
+// withStorage parses configurations and opens the storage for the run func of a subcommand.
+func withStorage(run func(*cobra.Command, storage.Storage, []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		store, err := storage.Open("")
+		if err != nil {
+			return errors.Wrap(err, "open storage failed")
+		}
+		defer store.Close()
+
+		return run(cmd, store, args)
+	}
+}
+
+func replayDeadLetters(cmd *cobra.Command, store storage.Storage, ids []string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := pooling.New(ctx, config.Opts.PoolingSize())
+	pool.OnFailed(deadletter.Record(store))
+	go pool.Roll()
+
+	for _, id := range ids {
+		if err := deadletter.Replay(store, pool, id); err != nil {
+			cmd.PrintErrln(errors.Wrap(err, id))
+		}
+	}
+	pool.Close()
+
+	for _, id := range ids {
+		if job, ok := pool.Job(id); ok {
+			cmd.Println(job)
+		}
+	}
+	return nil
+}
+
+func prettyDeadLetters(dls []entity.DeadLetter) string {
+	writer := table.NewWriter()
+	writer.AppendHeader(table.Row{"ID", "Service", "Created", "Attempts", "URLs"})
+	for _, dl := range dls {
+		writer.AppendRow(table.Row{dl.ID, dl.Service, dl.CreatedAt.Format(time.RFC3339), len(dl.Attempts), strings.Join(dl.URLs, "\n")})
+	}
+	writer.SetStyle(table.StyleRounded)
+
+	return writer.Render()
+}
+
+func prettyDeadLetter(dl *entity.DeadLetter) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ID: %s\nService: %s\nCreated: %s\nURLs:\n", dl.ID, dl.Service, dl.CreatedAt.Format(time.RFC3339))
+	for _, u := range dl.URLs {
+		fmt.Fprintf(&b, "  %s\n", u)
+	}
+	b.WriteString("Attempts:\n")
+	for i, a := range dl.Attempts {
+		fmt.Fprintf(&b, "  #%d %s (%s): %s\n", i+1, a.StartedAt.Format(time.RFC3339), a.FinishedAt.Sub(a.StartedAt).Round(time.Millisecond), a.Error)
+	}
+
+	return b.String()
+}
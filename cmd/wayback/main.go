@@ -59,6 +59,7 @@ var (
 		Run: func(cmd *cobra.Command, args []string) {
 			handle(cmd, args)
 		},
+		Args:    cobra.ArbitraryArgs,
 		Version: version.Version,
 	}
 )
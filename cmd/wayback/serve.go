@@ -12,6 +12,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/wabarc/logger"
 	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/deadletter"
 	"github.com/wabarc/wayback/pooling"
 	"github.com/wabarc/wayback/service"
 	"github.com/wabarc/wayback/service/discord"
@@ -30,8 +31,9 @@ import (
 var signalChan chan (os.Signal) = make(chan os.Signal, 1)
 
 type target struct {
-	call func()
-	name string
+	call   func()
+	reload func()
+	name   string
 }
 
 type services struct {
@@ -47,7 +49,10 @@ func serve(_ *cobra.Command, _ []string) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	pool := pooling.New(ctx, config.Opts.PoolingSize())
+	pool.OnFailed(deadletter.Record(store))
 	go pool.Roll()
+	go storage.SweepPlaybacks(ctx, store, config.Opts.PlaybackTTL())
+	go service.ScheduleWatches(ctx, store, pool)
 
 	if config.Opts.EnabledMeilisearch() {
 		endpoint := config.Opts.WaybackMeiliEndpoint()
@@ -78,7 +83,7 @@ func serve(_ *cobra.Command, _ []string) {
 }
 
 // nolint:gocyclo
-func (srv *services) run(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *services {
+func (srv *services) run(ctx context.Context, store storage.Storage, pool *pooling.Pool) *services {
 	size := len(daemon)
 	srv.targets = make([]target, 0, size)
 	for _, s := range daemon {
@@ -169,6 +174,11 @@ func (srv *services) run(ctx context.Context, store *storage.Storage, pool *pool
 			}()
 			srv.targets = append(srv.targets, target{
 				call: func() { h.Shutdown() }, // nolint:errcheck
+				reload: func() {
+					if err := h.Reload(); err != nil {
+						logger.Error("reload httpd service failed: %v", err)
+					}
+				},
 				name: s,
 			})
 		default:
@@ -191,8 +201,14 @@ func (srv *services) stop(pool *pooling.Pool, cancel context.CancelFunc) {
 		os.Interrupt,
 	)
 
-	// Receive output from signalChan.
+	// Receive output from signalChan, SIGHUP reloads the services
+	// that support it, e.g. the TLS certificate of the HTTP server.
 	sig := <-signalChan
+	for sig == syscall.SIGHUP {
+		logger.Info("signal %s is received, reloading...", sig)
+		srv.reload()
+		sig = <-signalChan
+	}
 	logger.Info("signal %s is received, exiting...", sig)
 
 	// Gracefully shutdown the server
@@ -202,6 +218,14 @@ func (srv *services) stop(pool *pooling.Pool, cancel context.CancelFunc) {
 	cancel()
 }
 
+func (srv *services) reload() {
+	for _, target := range srv.targets {
+		if target.reload != nil {
+			target.reload()
+		}
+	}
+}
+
 func (srv *services) shutdown() {
 	for _, target := range srv.targets {
 		logger.Info("stopping %s service...", target.name)
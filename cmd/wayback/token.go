@@ -0,0 +1,101 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"github.com/wabarc/wayback/auth"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/storage"
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage API tokens of the HTTP server",
+	Long: `Manage API tokens to access the HTTP server, sent as a Bearer token in the
+Authorization header or used to login the web UI.
+
+Scopes of a token are ` + strings.Join(entity.Scopes, ", ") + `, the admin scope is
+granted all scopes. The secret of a token is shown only once on creation.
+
+The bolt database is locked by a running daemon service, stop it first.
+The SQLite database has no such limitation.`,
+	Example: `  wayback token create --name ci --scope archive,playback
+  wayback token list
+  wayback token revoke 3f9a0c1d2b4e`,
+}
+
+func init() {
+	var name, scopes string
+
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an API token",
+		Args:  cobra.NoArgs,
+		RunE: withStorage(func(cmd *cobra.Command, store storage.Storage, _ []string) error {
+			list, err := auth.ParseScopes(scopes)
+			if err != nil {
+				return err
+			}
+			secret, token, err := auth.Issue(store, name, list)
+			if err != nil {
+				return errors.Wrap(err, "create token failed")
+			}
+			cmd.Printf("Created token %s with scopes: %s\n", token.ID, strings.Join(token.Scopes, ", "))
+			cmd.Println("Keep the secret below safe, it will not be shown again:")
+			cmd.Println(secret)
+			return nil
+		}),
+	}
+	createCmd.Flags().StringVarP(&name, "name", "n", "", "Name to identify the token")
+	createCmd.Flags().StringVarP(&scopes, "scope", "s", entity.ScopeArchive+","+entity.ScopePlayback, "Comma separated scopes of the token")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List API tokens",
+		Args:  cobra.NoArgs,
+		RunE: withStorage(func(cmd *cobra.Command, store storage.Storage, _ []string) error {
+			tokens, err := store.Tokens()
+			if err != nil {
+				return err
+			}
+			cmd.Println(prettyTokens(tokens))
+			return nil
+		}),
+	}
+	revokeCmd := &cobra.Command{
+		Use:   "revoke <id>...",
+		Short: "Revoke API tokens",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: withStorage(func(cmd *cobra.Command, store storage.Storage, args []string) error {
+			for _, id := range args {
+				if err := store.RemoveToken(id); err != nil {
+					return errors.Wrap(err, id)
+				}
+				cmd.Println("Revoked", id)
+			}
+			return nil
+		}),
+	}
+
+	tokenCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "Configuration file path, defaults: ./wayback.conf, ~/wayback.conf, /etc/wayback.conf")
+	tokenCmd.AddCommand(createCmd, listCmd, revokeCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
+
+func prettyTokens(tokens []entity.Token) string {
+	writer := table.NewWriter()
+	writer.AppendHeader(table.Row{"ID", "Name", "Scopes", "Created"})
+	for _, t := range tokens {
+		writer.AppendRow(table.Row{t.ID, t.Name, strings.Join(t.Scopes, ", "), t.CreatedAt.Format(time.RFC3339)})
+	}
+	writer.SetStyle(table.StyleRounded)
+
+	return writer.Render()
+}
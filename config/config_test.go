@@ -10,6 +10,7 @@ package config // import "github.com/wabarc/wayback/config"
 
 import (
 	"os"
+	"reflect"
 	"strconv"
 	"testing"
 	"time"
@@ -372,6 +373,34 @@ func TestIPFSSecret(t *testing.T) {
 	}
 }
 
+func TestIPFSGateway(t *testing.T) {
+	var tests = []struct {
+		gateway  string
+		expected string
+	}{
+		{gateway: "", expected: defIPFSGateway},
+		{gateway: "https://dweb.link/", expected: "https://dweb.link"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.gateway, func(t *testing.T) {
+			os.Clearenv()
+			os.Setenv("WAYBACK_IPFS_GATEWAY", test.gateway)
+
+			parser := NewParser()
+			opts, err := parser.ParseEnvironmentVariables()
+			if err != nil {
+				t.Fatalf(`Parsing environment variables failed: %v`, err)
+			}
+
+			got := opts.IPFSGateway()
+			if got != test.expected {
+				t.Fatalf(`Unexpected IPFS gateway, got %v instead of %s`, got, test.expected)
+			}
+		})
+	}
+}
+
 func TestOverTor(t *testing.T) {
 	os.Clearenv()
 	os.Setenv("WAYBACK_USE_TOR", "true")
@@ -518,6 +547,34 @@ func TestTelegramHelptext(t *testing.T) {
 	}
 }
 
+func TestTelegramWebhook(t *testing.T) {
+	os.Clearenv()
+
+	parser := NewParser()
+	opts, err := parser.ParseEnvironmentVariables()
+	if err != nil {
+		t.Fatalf(`Parsing environment variables failed: %v`, err)
+	}
+	if opts.EnabledTelegramWebhook() {
+		t.Fatalf(`Unexpected Telegram webhook enabled by default`)
+	}
+
+	os.Setenv("WAYBACK_TELEGRAM_WEBHOOK", "https://example.com/")
+	os.Setenv("WAYBACK_TELEGRAM_WEBHOOK_SECRET", "some-secret")
+	if opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf(`Parsing environment variables failed: %v`, err)
+	}
+	if !opts.EnabledTelegramWebhook() {
+		t.Fatalf(`Unexpected Telegram webhook disabled`)
+	}
+	if got, expected := opts.TelegramWebhook(), "https://example.com"; got != expected {
+		t.Fatalf(`Unexpected Telegram webhook, got %v instead of %s`, got, expected)
+	}
+	if got, expected := opts.TelegramWebhookSecret(), "some-secret"; got != expected {
+		t.Fatalf(`Unexpected Telegram webhook secret, got %v instead of %s`, got, expected)
+	}
+}
+
 func TestPublishToChannel(t *testing.T) {
 	os.Clearenv()
 	os.Setenv("WAYBACK_TELEGRAM_CHANNEL", "foo")
@@ -661,6 +718,188 @@ func TestListenAddr(t *testing.T) {
 	}
 }
 
+func TestAdminToken(t *testing.T) {
+	var tests = []struct {
+		token   string
+		enabled bool
+	}{
+		{
+			token:   "",
+			enabled: false,
+		},
+		{
+			token:   "foo",
+			enabled: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.token, func(t *testing.T) {
+			os.Clearenv()
+			os.Setenv("WAYBACK_ADMIN_TOKEN", test.token)
+
+			parser := NewParser()
+			opts, err := parser.ParseEnvironmentVariables()
+			if err != nil {
+				t.Fatalf(`Parsing failure: %v`, err)
+			}
+
+			if got := opts.AdminToken(); got != test.token {
+				t.Fatalf(`Unexpected ADMIN_TOKEN value, got %q instead of %q`, got, test.token)
+			}
+			if got := opts.EnabledAdmin(); got != test.enabled {
+				t.Fatalf(`Unexpected enabled admin, got %t instead of %t`, got, test.enabled)
+			}
+		})
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	var tests = []struct {
+		token string
+		login string
+		limit string
+		exp   [3]interface{}
+	}{
+		{exp: [3]interface{}{false, false, 0}},
+		{token: "true", login: "true", limit: "60", exp: [3]interface{}{true, true, 60}},
+		{token: "false", login: "on", limit: "foo", exp: [3]interface{}{false, true, 0}},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			os.Clearenv()
+			os.Setenv("WAYBACK_REQUIRE_TOKEN", test.token)
+			os.Setenv("WAYBACK_REQUIRE_LOGIN", test.login)
+			os.Setenv("WAYBACK_RATE_LIMIT", test.limit)
+
+			parser := NewParser()
+			opts, err := parser.ParseEnvironmentVariables()
+			if err != nil {
+				t.Fatalf(`Parsing failure: %v`, err)
+			}
+
+			got := [3]interface{}{opts.RequireToken(), opts.RequireLogin(), opts.RateLimit()}
+			if got != test.exp {
+				t.Fatalf(`Unexpected http auth options, got %v instead of %v`, got, test.exp)
+			}
+		})
+	}
+}
+
+func TestWebhookSecret(t *testing.T) {
+	var tests = []struct {
+		secret string
+		exp    string
+	}{
+		{secret: "", exp: defWebhookSecret},
+		{secret: "foo", exp: "foo"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.secret, func(t *testing.T) {
+			os.Clearenv()
+			os.Setenv("WAYBACK_WEBHOOK_SECRET", test.secret)
+
+			parser := NewParser()
+			opts, err := parser.ParseEnvironmentVariables()
+			if err != nil {
+				t.Fatalf(`Parsing failure: %v`, err)
+			}
+
+			if got := opts.WebhookSecret(); got != test.exp {
+				t.Fatalf(`Unexpected webhook secret, got %q instead of %q`, got, test.exp)
+			}
+		})
+	}
+}
+
+func TestHTTPListeners(t *testing.T) {
+	var tests = []struct {
+		name    string
+		socket  string
+		cert    string
+		key     string
+		timeout string
+		tls     bool
+		wait    time.Duration
+	}{
+		{name: "default", wait: defShutdownTimeout * time.Second},
+		{name: "socket", socket: "/run/wayback.sock", timeout: "5", wait: 5 * time.Second},
+		{name: "cert only", cert: "cert.pem", wait: defShutdownTimeout * time.Second},
+		{name: "tls", cert: "cert.pem", key: "key.pem", tls: true, wait: defShutdownTimeout * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Clearenv()
+			os.Setenv("WAYBACK_LISTEN_SOCKET", test.socket)
+			os.Setenv("WAYBACK_TLS_CERT_FILE", test.cert)
+			os.Setenv("WAYBACK_TLS_KEY_FILE", test.key)
+			os.Setenv("WAYBACK_SHUTDOWN_TIMEOUT", test.timeout)
+
+			parser := NewParser()
+			opts, err := parser.ParseEnvironmentVariables()
+			if err != nil {
+				t.Fatalf(`Parsing failure: %v`, err)
+			}
+
+			if got := opts.ListenSocket(); got != test.socket {
+				t.Fatalf(`Unexpected listen socket, got %q instead of %q`, got, test.socket)
+			}
+			if got := opts.TLSCertFile(); got != test.cert {
+				t.Fatalf(`Unexpected tls cert file, got %q instead of %q`, got, test.cert)
+			}
+			if got := opts.TLSKeyFile(); got != test.key {
+				t.Fatalf(`Unexpected tls key file, got %q instead of %q`, got, test.key)
+			}
+			if got := opts.EnabledTLS(); got != test.tls {
+				t.Fatalf(`Unexpected enabled tls, got %t instead of %t`, got, test.tls)
+			}
+			if got := opts.ShutdownTimeout(); got != test.wait {
+				t.Fatalf(`Unexpected shutdown timeout, got %s instead of %s`, got, test.wait)
+			}
+		})
+	}
+}
+
+func TestACL(t *testing.T) {
+	var tests = []struct {
+		allow  string
+		deny   string
+		admins string
+		exp    [3][]string
+	}{
+		{exp: [3][]string{{}, {}, {}}},
+		{
+			allow:  "telegram:user:1, telegram:chat:-100",
+			deny:   "matrix:server:example.org",
+			admins: "irc:mask:*!*@example.com\ndiscord:user:2",
+			exp:    [3][]string{{"telegram:user:1", "telegram:chat:-100"}, {"matrix:server:example.org"}, {"irc:mask:*!*@example.com", "discord:user:2"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.allow, func(t *testing.T) {
+			os.Clearenv()
+			os.Setenv("WAYBACK_ACL_ALLOW", test.allow)
+			os.Setenv("WAYBACK_ACL_DENY", test.deny)
+			os.Setenv("WAYBACK_ACL_ADMINS", test.admins)
+
+			parser := NewParser()
+			opts, err := parser.ParseEnvironmentVariables()
+			if err != nil {
+				t.Fatalf(`Parsing failure: %v`, err)
+			}
+
+			got := [3][]string{opts.ACLAllow(), opts.ACLDeny(), opts.ACLAdmins()}
+			if !reflect.DeepEqual(got, test.exp) {
+				t.Fatalf(`Unexpected acl options, got %q instead of %q`, got, test.exp)
+			}
+		})
+	}
+}
+
 func TestDefaultTorRemotePortsValue(t *testing.T) {
 	os.Clearenv()
 
@@ -1487,6 +1726,64 @@ func TestBoltPath(t *testing.T) {
 	}
 }
 
+func TestDatabaseDriver(t *testing.T) {
+	var tests = []struct {
+		driver string
+		path   string
+	}{
+		{driver: "", path: defBoltPathname},
+		{driver: "bolt", path: defBoltPathname},
+		{driver: "SQLite", path: defSQLitePathname},
+	}
+
+	for _, test := range tests {
+		t.Run(test.driver, func(t *testing.T) {
+			os.Clearenv()
+			os.Setenv("WAYBACK_DATABASE_DRIVER", test.driver)
+
+			parser := NewParser()
+			opts, err := parser.ParseEnvironmentVariables()
+			if err != nil {
+				t.Fatalf(`Parsing environment variables failed: %v`, err)
+			}
+
+			got := opts.DatabasePathname()
+			if got != test.path {
+				t.Fatalf(`Unexpected database file path got %s instead of %s`, got, test.path)
+			}
+		})
+	}
+}
+
+func TestPlaybackTTL(t *testing.T) {
+	var tests = []struct {
+		ttl string
+		exp time.Duration
+	}{
+		{ttl: "", exp: defPlaybackTTL * time.Hour},
+		{ttl: "0", exp: 0},
+		{ttl: "24", exp: 24 * time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ttl, func(t *testing.T) {
+			os.Clearenv()
+			os.Setenv("WAYBACK_PLAYBACK_TTL", test.ttl)
+
+			parser := NewParser()
+			opts, err := parser.ParseEnvironmentVariables()
+			if err != nil {
+				t.Fatalf(`Parsing environment variables failed: %v`, err)
+			}
+
+			got := opts.PlaybackTTL()
+			if got != test.exp {
+				t.Fatalf(`Unexpected playback ttl got %v instead of %v`, got, test.exp)
+			}
+		})
+	}
+}
+
 func TestStorageDir(t *testing.T) {
 	var tests = []struct {
 		dir string
@@ -1647,6 +1944,35 @@ func TestMaxMediaSize(t *testing.T) {
 	}
 }
 
+func TestMaxFileSize(t *testing.T) {
+	var tests = []struct {
+		size     string
+		expected uint64
+	}{
+		{size: "", expected: 20000000},
+		{size: "1MB", expected: 1000000},
+		{size: "invalid", expected: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.size, func(t *testing.T) {
+			os.Clearenv()
+			os.Setenv("WAYBACK_MAX_FILE_SIZE", test.size)
+
+			parser := NewParser()
+			opts, err := parser.ParseEnvironmentVariables()
+			if err != nil {
+				t.Fatalf(`Parsing environment variables failed: %v`, err)
+			}
+
+			got := opts.MaxFileSize()
+			if got != test.expected {
+				t.Fatalf(`Unexpected set max file size got %d instead of %d`, got, test.expected)
+			}
+		})
+	}
+}
+
 func TestMaxAttachSize(t *testing.T) {
 	parser := NewParser()
 	opts, _ := parser.ParseEnvironmentVariables()
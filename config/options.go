@@ -22,12 +22,13 @@ const (
 	defMetrics  = false
 	defOverTor  = false
 
-	defIPFSHost   = "127.0.0.1"
-	defIPFSPort   = 4001
-	defIPFSMode   = "pinner"
-	defIPFSTarget = ""
-	defIPFSApikey = ""
-	defIPFSSecret = ""
+	defIPFSHost    = "127.0.0.1"
+	defIPFSPort    = 4001
+	defIPFSMode    = "pinner"
+	defIPFSTarget  = ""
+	defIPFSApikey  = ""
+	defIPFSSecret  = ""
+	defIPFSGateway = "https://ipfs.io"
 
 	defEnabledIA = true
 	defEnabledIS = true
@@ -37,6 +38,8 @@ const (
 	defTelegramToken    = ""
 	defTelegramChannel  = ""
 	defTelegramHelptext = "Hi there."
+	defTelegramWebhook  = ""
+	defTelegramSecret   = ""
 	defGitHubToken      = ""
 	defGitHubOwner      = ""
 	defGitHubRepo       = ""
@@ -72,16 +75,29 @@ const (
 	defNostrRelayURL   = "wss://nostr.developer.li"
 	defNostrPrivateKey = ""
 
-	defTorPrivateKey = ""
-	defListenAddr    = "0.0.0.0:8964"
-	defTorLocalPort  = 8964
-	defTorrcFile     = "/etc/tor/torrc"
+	defTorPrivateKey   = ""
+	defListenAddr      = "0.0.0.0:8964"
+	defListenSocket    = ""
+	defTLSCertFile     = ""
+	defTLSKeyFile      = ""
+	defShutdownTimeout = 30
+	defAdminToken      = ""
+	defRequireToken    = false
+	defRequireLogin    = false
+	defRateLimit       = 0
+	defWebhookSecret   = ""
+	defTorLocalPort    = 8964
+	defTorrcFile       = "/etc/tor/torrc"
 
 	defChromeRemoteAddr    = ""
 	defEnabledChromeRemote = false
 	defBoltPathname        = "wayback.db"
+	defDatabaseDriver      = "bolt"
+	defPlaybackTTL         = 720
+	defSQLitePathname      = "wayback.sqlite"
 	defPoolingSize         = 3
 	defMaxMediaSize        = "512MB"
+	defMaxFileSize         = "20MB"
 	defWaybackTimeout      = 300
 	defWaybackMaxRetries   = 2
 	defWaybackUserAgent    = "WaybackArchiver/1.0"
@@ -102,6 +118,9 @@ var (
 
 	defStorageDir     = path.Join(os.TempDir(), "reduxer")
 	defTorRemotePorts = []int{80}
+	defACLAllow       = []string{}
+	defACLDeny        = []string{}
+	defACLAdmins      = []string{}
 )
 
 // Options represents a configuration options in the application.
@@ -127,12 +146,28 @@ type Options struct {
 	tor      *tor
 
 	listenAddr          string
+	listenSocket        string
+	tlsCertFile         string
+	tlsKeyFile          string
+	shutdownTimeout     int
+	adminToken          string
+	requireToken        bool
+	requireLogin        bool
+	rateLimit           int
+	webhookSecret       string
+	aclAllow            []string
+	aclDeny             []string
+	aclAdmins           []string
 	chromeRemoteAddr    string
 	enabledChromeRemote bool
 	boltPathname        string
+	databaseDriver      string
+	sqlitePathname      string
+	playbackTTL         int
 	poolingSize         int
 	storageDir          string
 	maxMediaSize        string
+	maxFileSize         string
 	waybackTimeout      int
 	waybackMaxRetries   int
 	waybackUserAgent    string
@@ -151,12 +186,16 @@ type ipfs struct {
 	target string
 	apikey string
 	secret string
+
+	gateway string
 }
 
 type telegram struct {
 	token    string
 	channel  string
 	helptext string
+	webhook  string
+	secret   string
 }
 
 type mastodon struct {
@@ -234,12 +273,28 @@ func NewOptions() *Options {
 		overTor:              defOverTor,
 		metrics:              defMetrics,
 		listenAddr:           defListenAddr,
+		listenSocket:         defListenSocket,
+		tlsCertFile:          defTLSCertFile,
+		tlsKeyFile:           defTLSKeyFile,
+		shutdownTimeout:      defShutdownTimeout,
+		adminToken:           defAdminToken,
+		requireToken:         defRequireToken,
+		requireLogin:         defRequireLogin,
+		rateLimit:            defRateLimit,
+		webhookSecret:        defWebhookSecret,
+		aclAllow:             defACLAllow,
+		aclDeny:              defACLDeny,
+		aclAdmins:            defACLAdmins,
 		chromeRemoteAddr:     defChromeRemoteAddr,
 		enabledChromeRemote:  defEnabledChromeRemote,
 		boltPathname:         defBoltPathname,
+		databaseDriver:       defDatabaseDriver,
+		sqlitePathname:       defSQLitePathname,
+		playbackTTL:          defPlaybackTTL,
 		poolingSize:          defPoolingSize,
 		storageDir:           defStorageDir,
 		maxMediaSize:         defMaxMediaSize,
+		maxFileSize:          defMaxFileSize,
 		waybackTimeout:       defWaybackTimeout,
 		waybackMaxRetries:    defWaybackMaxRetries,
 		waybackUserAgent:     defWaybackUserAgent,
@@ -254,6 +309,8 @@ func NewOptions() *Options {
 			target: defIPFSTarget,
 			apikey: defIPFSApikey,
 			secret: defIPFSSecret,
+
+			gateway: defIPFSGateway,
 		},
 		slots: map[string]bool{
 			SLOT_IA: defEnabledIA,
@@ -265,6 +322,8 @@ func NewOptions() *Options {
 			token:    defTelegramToken,
 			channel:  defTelegramChannel,
 			helptext: defTelegramHelptext,
+			webhook:  defTelegramWebhook,
+			secret:   defTelegramSecret,
 		},
 		mastodon: &mastodon{
 			server:       defMastodonServer,
@@ -396,6 +455,12 @@ func (o *Options) IPFSSecret() string {
 	return o.ipfs.secret
 }
 
+// IPFSGateway returns the URL of the IPFS gateway to link the pinned
+// webpages and files, without the trailing slash.
+func (o *Options) IPFSGateway() string {
+	return strings.TrimRight(o.ipfs.gateway, "/")
+}
+
 // UseTor returns whether to use the Tor proxy when snapshot webpage.
 func (o *Options) UseTor() bool {
 	return o.overTor
@@ -430,6 +495,22 @@ func (o *Options) TelegramHelptext() string {
 	return breakLine(o.telegram.helptext)
 }
 
+// TelegramWebhook returns the public URL of the HTTP server to receive the
+// Telegram updates, the updates are received by long polling if it is empty.
+func (o *Options) TelegramWebhook() string {
+	return strings.TrimRight(o.telegram.webhook, "/")
+}
+
+// TelegramWebhookSecret returns the secret token of the Telegram webhook.
+func (o *Options) TelegramWebhookSecret() string {
+	return o.telegram.secret
+}
+
+// EnabledTelegramWebhook returns whether to receive the Telegram updates by webhook.
+func (o *Options) EnabledTelegramWebhook() bool {
+	return o.telegram.webhook != ""
+}
+
 // PublishToChannel returns whether to publish results to Telegram Channel.
 func (o *Options) PublishToChannel() bool {
 	return o.telegram.token != "" && o.telegram.channel != ""
@@ -693,6 +774,86 @@ func (o *Options) ListenAddr() string {
 	return o.listenAddr
 }
 
+// ListenSocket returns the path of the Unix domain socket for the HTTP server
+// to listen on in addition to the listen address, e.g. for a reverse proxy.
+func (o *Options) ListenSocket() string {
+	return o.listenSocket
+}
+
+// TLSCertFile returns the path of the TLS certificate file of the HTTP server.
+func (o *Options) TLSCertFile() string {
+	return o.tlsCertFile
+}
+
+// TLSKeyFile returns the path of the TLS private key file of the HTTP server.
+func (o *Options) TLSKeyFile() string {
+	return o.tlsKeyFile
+}
+
+// EnabledTLS returns whether the HTTP server serves TLS on the listen address,
+// both of the certificate and key files are required.
+func (o *Options) EnabledTLS() bool {
+	return o.tlsCertFile != "" && o.tlsKeyFile != ""
+}
+
+// ShutdownTimeout returns the max time to wait for in-flight requests of the
+// HTTP server on shutdown.
+func (o *Options) ShutdownTimeout() time.Duration {
+	return time.Duration(o.shutdownTimeout) * time.Second
+}
+
+// AdminToken returns the token to access the admin API of the HTTP server,
+// it is granted all scopes as an API token.
+func (o *Options) AdminToken() string {
+	return o.adminToken
+}
+
+// EnabledAdmin returns whether the admin token is set.
+func (o *Options) EnabledAdmin() bool {
+	return o.adminToken != ""
+}
+
+// RequireToken returns whether the JSON API of the HTTP server requires an API token.
+func (o *Options) RequireToken() bool {
+	return o.requireToken
+}
+
+// RequireLogin returns whether the web UI of the HTTP server requires login with an API token.
+func (o *Options) RequireLogin() bool {
+	return o.requireLogin
+}
+
+// RateLimit returns the max number of archive and playback requests per minute
+// for each API token or client address, unlimited if it is zero.
+func (o *Options) RateLimit() int {
+	return o.rateLimit
+}
+
+// WebhookSecret returns the secret to sign the webhook payloads of async
+// archive jobs, webhooks are disabled if it is empty.
+func (o *Options) WebhookSecret() string {
+	return o.webhookSecret
+}
+
+// ACLAllow returns the rules of the bot users, chats, guilds, workspaces,
+// homeservers or hostmasks that are allowed to use the services, in the form
+// of "service:kind:pattern". A service is open to everyone if it has no rules.
+func (o *Options) ACLAllow() []string {
+	return o.aclAllow
+}
+
+// ACLDeny returns the rules of the bot users, chats, guilds, workspaces,
+// homeservers or hostmasks that are denied to use the services.
+func (o *Options) ACLDeny() []string {
+	return o.aclDeny
+}
+
+// ACLAdmins returns the rules of the bot users or hostmasks that have the
+// admin role of the services.
+func (o *Options) ACLAdmins() []string {
+	return o.aclAdmins
+}
+
 // EnabledChromeRemote returns whether enable Chrome/Chromium remote debugging
 // for screenshot
 func (o *Options) EnabledChromeRemote() bool {
@@ -709,6 +870,30 @@ func (o *Options) BoltPathname() string {
 	return o.boltPathname
 }
 
+// DatabaseDriver returns the driver of database, supported drivers are `bolt` and `sqlite`.
+func (o *Options) DatabaseDriver() string {
+	return o.databaseDriver
+}
+
+// SQLitePathname returns filename of SQLite database
+func (o *Options) SQLitePathname() string {
+	return o.sqlitePathname
+}
+
+// DatabasePathname returns filename of the database for the current driver.
+func (o *Options) DatabasePathname() string {
+	if o.databaseDriver == "sqlite" {
+		return o.sqlitePathname
+	}
+	return o.boltPathname
+}
+
+// PlaybackTTL returns the time to live of the playback callback data, which
+// never expires if it is zero.
+func (o *Options) PlaybackTTL() time.Duration {
+	return time.Duration(o.playbackTTL) * time.Hour
+}
+
 // PoolingSize returns the number of worker pool
 func (o *Options) PoolingSize() int {
 	return o.poolingSize
@@ -733,6 +918,15 @@ func (o *Options) MaxMediaSize() uint64 {
 	return size
 }
 
+// MaxFileSize returns max size to limit download files sent to the bots.
+func (o *Options) MaxFileSize() uint64 {
+	size, err := humanize.ParseBytes(o.maxFileSize)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
 // MaxAttachSize returns max attach size limits for several services.
 // scope: telegram
 func (o *Options) MaxAttachSize(scope string) int64 {
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 // Parser handles configuration parsing.
@@ -90,6 +91,30 @@ func (p *Parser) parseLines(lines []string) (err error) {
 			p.opts.metrics = parseBool(val, defMetrics)
 		case "HTTP_LISTEN_ADDR", "WAYBACK_LISTEN_ADDR":
 			p.opts.listenAddr = parseString(val, defListenAddr)
+		case "WAYBACK_LISTEN_SOCKET":
+			p.opts.listenSocket = parseString(val, defListenSocket)
+		case "WAYBACK_TLS_CERT_FILE":
+			p.opts.tlsCertFile = parseString(val, defTLSCertFile)
+		case "WAYBACK_TLS_KEY_FILE":
+			p.opts.tlsKeyFile = parseString(val, defTLSKeyFile)
+		case "WAYBACK_SHUTDOWN_TIMEOUT":
+			p.opts.shutdownTimeout = parseInt(val, defShutdownTimeout)
+		case "WAYBACK_ADMIN_TOKEN":
+			p.opts.adminToken = parseString(val, defAdminToken)
+		case "WAYBACK_REQUIRE_TOKEN":
+			p.opts.requireToken = parseBool(val, defRequireToken)
+		case "WAYBACK_REQUIRE_LOGIN":
+			p.opts.requireLogin = parseBool(val, defRequireLogin)
+		case "WAYBACK_RATE_LIMIT":
+			p.opts.rateLimit = parseInt(val, defRateLimit)
+		case "WAYBACK_WEBHOOK_SECRET":
+			p.opts.webhookSecret = parseString(val, defWebhookSecret)
+		case "WAYBACK_ACL_ALLOW":
+			p.opts.aclAllow = parseStringList(val, defACLAllow)
+		case "WAYBACK_ACL_DENY":
+			p.opts.aclDeny = parseStringList(val, defACLDeny)
+		case "WAYBACK_ACL_ADMINS":
+			p.opts.aclAdmins = parseStringList(val, defACLAdmins)
 		case "CHROME_REMOTE_ADDR":
 			p.opts.enabledChromeRemote = hasValue(val, defEnabledChromeRemote)
 			p.opts.chromeRemoteAddr = parseString(val, defChromeRemoteAddr)
@@ -105,6 +130,8 @@ func (p *Parser) parseLines(lines []string) (err error) {
 			p.opts.ipfs.apikey = parseString(val, defIPFSApikey)
 		case "WAYBACK_IPFS_SECRET":
 			p.opts.ipfs.secret = parseString(val, defIPFSSecret)
+		case "WAYBACK_IPFS_GATEWAY":
+			p.opts.ipfs.gateway = parseString(val, defIPFSGateway)
 		case "WAYBACK_USE_TOR":
 			p.opts.overTor = parseBool(val, defOverTor)
 		case "WAYBACK_ENABLE_IA":
@@ -121,6 +148,10 @@ func (p *Parser) parseLines(lines []string) (err error) {
 			p.opts.telegram.channel = parseString(val, defTelegramChannel)
 		case "WAYBACK_TELEGRAM_HELPTEXT":
 			p.opts.telegram.helptext = parseString(val, defTelegramHelptext)
+		case "WAYBACK_TELEGRAM_WEBHOOK":
+			p.opts.telegram.webhook = parseString(val, defTelegramWebhook)
+		case "WAYBACK_TELEGRAM_WEBHOOK_SECRET":
+			p.opts.telegram.secret = parseString(val, defTelegramSecret)
 		case "WAYBACK_MASTODON_SERVER":
 			p.opts.mastodon.server = parseString(val, defMastodonServer)
 		case "WAYBACK_MASTODON_KEY":
@@ -193,10 +224,18 @@ func (p *Parser) parseLines(lines []string) (err error) {
 			p.opts.poolingSize = parseInt(val, defPoolingSize)
 		case "WAYBACK_BOLT_PATH":
 			p.opts.boltPathname = parseString(val, defBoltPathname)
+		case "WAYBACK_DATABASE_DRIVER":
+			p.opts.databaseDriver = strings.ToLower(parseString(val, defDatabaseDriver))
+		case "WAYBACK_SQLITE_PATH":
+			p.opts.sqlitePathname = parseString(val, defSQLitePathname)
+		case "WAYBACK_PLAYBACK_TTL":
+			p.opts.playbackTTL = parseInt(val, defPlaybackTTL)
 		case "WAYBACK_STORAGE_DIR":
 			p.opts.storageDir = parseString(val, defStorageDir)
 		case "WAYBACK_MAX_MEDIA_SIZE":
 			p.opts.maxMediaSize = parseString(val, defMaxMediaSize)
+		case "WAYBACK_MAX_FILE_SIZE":
+			p.opts.maxFileSize = parseString(val, defMaxFileSize)
 		case "WAYBACK_TIMEOUT":
 			p.opts.waybackTimeout = parseInt(val, defWaybackTimeout)
 		case "WAYBACK_MAX_RETRIES":
@@ -276,6 +315,18 @@ func parseIntList(val string, fallback []int) []int {
 	return intList
 }
 
+// parseStringList parses a list of strings separated by commas or whitespaces.
+func parseStringList(val string, fallback []string) []string {
+	items := strings.FieldsFunc(val, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(items) == 0 {
+		return fallback
+	}
+
+	return items
+}
+
 func defaultFilenames() []string {
 	name := "wayback.conf"
 	home, _ := os.UserHomeDir() // nolint:errcheck
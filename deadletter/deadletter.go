@@ -0,0 +1,98 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package deadletter // import "github.com/wabarc/wayback/deadletter"
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/publish"
+	"github.com/wabarc/wayback/reduxer"
+	"github.com/wabarc/wayback/service"
+	"github.com/wabarc/wayback/storage"
+)
+
+var (
+	ErrNoURLs    = errors.New("dead letter has no URLs to replay") // ErrNoURLs dead letter has no URLs to replay
+	ErrReplaying = errors.New("dead letter is replaying")          // ErrReplaying dead letter is replaying
+)
+
+// Record returns a func that writes the failed job to the dead letter store,
+// it is intended to be registered with the OnFailed of a pool. The attempts
+// of a dead letter that failed again are appended to its error history.
+func Record(store storage.Storage) func(pooling.Job) {
+	return func(job pooling.Job) {
+		dl := &entity.DeadLetter{
+			ID:        job.ID,
+			Service:   job.Service,
+			URLs:      job.URLs,
+			CreatedAt: job.CreatedAt,
+		}
+		if prev, err := store.DeadLetter(job.ID); err == nil {
+			dl.Attempts = prev.Attempts
+			dl.CreatedAt = prev.CreatedAt
+		}
+		for _, a := range job.Attempts {
+			dl.Attempts = append(dl.Attempts, entity.Attempt{
+				StartedAt:  a.StartedAt,
+				FinishedAt: a.FinishedAt,
+				Error:      a.Error,
+			})
+		}
+
+		if err := store.CreateDeadLetter(dl); err != nil {
+			logger.Error("create dead letter for job %s failed: %v", job.ID, err)
+		}
+	}
+}
+
+// Replay puts the dead letter of the given id to the pool to archive again,
+// and publishes the results as the original service does. The dead letter is
+// removed once the replay succeeds, it is recorded again if the pool
+// registered Record and the replay fails.
+func Replay(store storage.Storage, pool *pooling.Pool, id string) error {
+	dl, err := store.DeadLetter(id)
+	if err != nil {
+		return err
+	}
+	if job, ok := pool.Job(id); ok && !job.State.Finished() {
+		return ErrReplaying
+	}
+
+	urls := make([]*url.URL, 0, len(dl.URLs))
+	for _, s := range dl.URLs {
+		u, err := url.Parse(s)
+		if err != nil {
+			logger.Warn("parse url %s of dead letter %s failed: %v", s, id, err)
+			continue
+		}
+		urls = append(urls, u)
+	}
+	if len(urls) == 0 {
+		return ErrNoURLs
+	}
+
+	bucket := pooling.Bucket{
+		ID:      dl.ID,
+		Service: dl.Service,
+		URLs:    urls,
+		Request: func(ctx context.Context) error {
+			do := func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
+				ctx = context.WithValue(ctx, publish.PubBundle{}, rdx)
+				publish.To(ctx, cols, dl.Service)
+				return store.RemoveDeadLetter(dl.ID)
+			}
+			return service.Wayback(ctx, urls, do)
+		},
+	}
+	pool.Put(bucket)
+
+	return nil
+}
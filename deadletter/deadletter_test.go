@@ -0,0 +1,107 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package deadletter // import "github.com/wabarc/wayback/deadletter"
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/storage"
+)
+
+func openStorage(t *testing.T) storage.Storage {
+	dbpath := filepath.Join(t.TempDir(), helper.RandString(5, "lower"))
+	store, err := storage.Open(dbpath)
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+		os.Remove(dbpath)
+	})
+	return store
+}
+
+func TestRecord(t *testing.T) {
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+	logger.SetLogLevel(logger.LevelFatal)
+
+	store := openStorage(t)
+	pool := pooling.New(context.Background(), 1)
+	pool.OnFailed(Record(store))
+	go pool.Roll()
+
+	u, _ := url.Parse("https://example.com")
+	bucket := pooling.Bucket{
+		Service: "telegram",
+		URLs:    []*url.URL{u},
+		Request: func(_ context.Context) error {
+			return errors.Permanent(errors.New("some error"))
+		},
+	}
+	id := pool.Put(bucket)
+	pool.Close()
+
+	dl, err := store.DeadLetter(id)
+	if err != nil {
+		t.Fatalf("Unexpected query dead letter: %v", err)
+	}
+	if dl.Service != bucket.Service {
+		t.Errorf("Unexpected dead letter service, got %s instead of %s", dl.Service, bucket.Service)
+	}
+	if len(dl.URLs) != 1 || dl.URLs[0] != u.String() {
+		t.Errorf("Unexpected dead letter urls, got %v instead of %s", dl.URLs, u)
+	}
+	if len(dl.Attempts) != 1 || dl.Attempts[0].Error != "some error" {
+		t.Errorf("Unexpected dead letter attempts, got %#v", dl.Attempts)
+	}
+
+	// Record a job with the same id again appends the error history.
+	job, _ := pool.Job(id)
+	Record(store)(job)
+	if dl, _ = store.DeadLetter(id); len(dl.Attempts) != 2 {
+		t.Errorf("Unexpected dead letter attempts, got %d instead of 2", len(dl.Attempts))
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+	logger.SetLogLevel(logger.LevelFatal)
+
+	store := openStorage(t)
+	pool := pooling.New(context.Background(), 1)
+	go pool.Roll()
+	defer pool.Close()
+
+	if err := Replay(store, pool, "foo"); !errors.Is(err, storage.ErrDeadLetterNotFound) {
+		t.Errorf("Unexpected replay, got %v instead of %v", err, storage.ErrDeadLetterNotFound)
+	}
+
+	dl := &entity.DeadLetter{ID: "foo", Service: "matrix", CreatedAt: time.Now()}
+	if err := store.CreateDeadLetter(dl); err != nil {
+		t.Fatalf("Unexpected create dead letter: %v", err)
+	}
+	if err := Replay(store, pool, "foo"); !errors.Is(err, ErrNoURLs) {
+		t.Errorf("Unexpected replay, got %v instead of %v", err, ErrNoURLs)
+	}
+}
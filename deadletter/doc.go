@@ -0,0 +1,8 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package deadletter keeps the failed wayback requests, and replays them later.
+*/
+package deadletter // import "github.com/wabarc/wayback/deadletter"
@@ -0,0 +1,55 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package entity // import "github.com/wabarc/entity"
+
+import (
+	"net/url"
+	"time"
+)
+
+// EntityArchive represents a keyword for archive entity.
+const EntityArchive = "archive"
+
+// Archive represents a wayback run of a URL in the application.
+type Archive struct {
+	ID        int        `json:"id"`
+	Source    string     `json:"source"`
+	URL       string     `json:"url"`
+	Domain    string     `json:"domain"`
+	Title     string     `json:"title,omitempty"`
+	Results   []Result   `json:"results"`
+	Artifacts []Artifact `json:"artifacts"`
+	Service   string     `json:"service"`
+	User      string     `json:"user,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Text is the article text of the webpage for full-text search, it is
+	// stored along with the archive but not loaded by the queries.
+	Text string `json:"-"`
+}
+
+// Result represents the result of an archive slot.
+type Result struct {
+	Slot string `json:"slot"`
+	Dst  string `json:"dst"`
+}
+
+// Succeeded reports whether the slot archived the webpage, the destination
+// is the error message otherwise.
+func (r Result) Succeeded() bool {
+	u, err := url.Parse(r.Dst)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Artifact represents a file of the archived webpage on the local disk and
+// the remote servers.
+type Artifact struct {
+	Kind    string   `json:"kind"`
+	Local   string   `json:"local,omitempty"`
+	Remotes []string `json:"remotes,omitempty"`
+	// Hash is the hex encoded SHA-256 digest of the file, it is only set
+	// for the files sent to the bots.
+	Hash string `json:"hash,omitempty"`
+}
@@ -0,0 +1,26 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package entity // import "github.com/wabarc/entity"
+
+import "time"
+
+// EntityDeadLetter represents a keyword for dead letter entity.
+const EntityDeadLetter = "dead-letter"
+
+// DeadLetter represents a failed wayback request in the application.
+type DeadLetter struct {
+	ID        string    `json:"id"`
+	Service   string    `json:"service"`
+	URLs      []string  `json:"urls"`
+	Attempts  []Attempt `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Attempt represents a single execution of a failed wayback request.
+type Attempt struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      string    `json:"error,omitempty"`
+}
@@ -4,11 +4,20 @@
 
 package entity // import "github.com/wabarc/entity"
 
+import "time"
+
 // EntityPlayback represents a keyword for playback entity.
 const EntityPlayback = "playback"
 
 // Playback represents a Playback in the application.
 type Playback struct {
-	ID     int
-	Source string
+	ID        int       `json:"id"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Expired reports whether the playback is older than the given TTL,
+// it never expires if the TTL is not positive.
+func (pb *Playback) Expired(ttl time.Duration) bool {
+	return ttl > 0 && time.Since(pb.CreatedAt) > ttl
 }
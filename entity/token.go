@@ -0,0 +1,42 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package entity // import "github.com/wabarc/entity"
+
+import "time"
+
+// EntityToken represents a keyword for API token entity.
+const EntityToken = "token"
+
+// Scopes of API tokens.
+const (
+	ScopeArchive  = "archive"
+	ScopePlayback = "playback"
+	ScopePublish  = "publish"
+	ScopeAdmin    = "admin"
+)
+
+// Scopes lists all scopes of API tokens.
+var Scopes = []string{ScopeArchive, ScopePlayback, ScopePublish, ScopeAdmin}
+
+// Token represents an API token to access the HTTP server, only the
+// digest of the secret is kept.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Digest    string    `json:"digest"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Allows reports whether the token is granted the scope, the admin scope
+// is granted all scopes.
+func (t *Token) Allows(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package entity // import "github.com/wabarc/entity"
+
+import "time"
+
+// EntityWatch represents a keyword for URL watch entity.
+const EntityWatch = "watch"
+
+// Watch represents a subscription to re-archive a URL on an interval, the
+// subscriber is alerted in the chat when the webpage changed or went dead.
+type Watch struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Interval is the interval between two checks in seconds.
+	Interval int64  `json:"interval"`
+	Service  string `json:"service"`
+	User     string `json:"user,omitempty"`
+	// Chat is where the alerts are sent to, e.g. the chat id of Telegram,
+	// the channel id of Discord and Slack, or the webhook of the API.
+	Chat string `json:"chat,omitempty"`
+
+	// Digest is the SHA-256 digest of the content of the last check.
+	Digest string `json:"digest,omitempty"`
+	// Status is the HTTP status code of the last check, it is zero if the
+	// webpage was unreachable.
+	Status    int       `json:"status,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Every returns the interval between two checks.
+func (w *Watch) Every() time.Duration {
+	return time.Duration(w.Interval) * time.Second
+}
+
+// Checked reports whether the URL has been checked.
+func (w *Watch) Checked() bool {
+	return !w.CheckedAt.IsZero()
+}
+
+// Due reports whether the URL should be checked at the given time.
+func (w *Watch) Due(now time.Time) bool {
+	return !now.Before(w.CheckedAt.Add(w.Every()))
+}
+
+// Alive reports whether the webpage was alive at the last check.
+func (w *Watch) Alive() bool {
+	return w.Status >= 200 && w.Status < 400
+}
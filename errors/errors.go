@@ -5,7 +5,15 @@
 package errors // import "github.com/wabarc/wayback/errors"
 
 import (
+	"context"
+	"crypto/x509"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -35,3 +43,171 @@ func Wrap(err error, message string) error {
 func Is(err, target error) bool {
 	return errors.Is(err, target)
 }
+
+// As finds the first error in err's chain that matches target, and if so, sets
+// target to that error value and returns true.
+func As(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
+
+// classified represents an error that is classified as retryable or permanent.
+type classified struct {
+	err       error
+	retryable bool
+}
+
+// Error returns the message of the underlying error.
+func (e *classified) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *classified) Unwrap() error {
+	return e.err
+}
+
+// Retryable returns an error annotating err as transient, the operation
+// that caused it may succeed if retried.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classified{err: err, retryable: true}
+}
+
+// Permanent returns an error annotating err as permanent, the operation
+// that caused it should not be retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classified{err: err, retryable: false}
+}
+
+// IsPermanent reports whether the outermost classification in err's chain is permanent.
+func IsPermanent(err error) bool {
+	var c *classified
+	if errors.As(err, &c) {
+		return !c.retryable
+	}
+	return false
+}
+
+// IsRetryable reports whether err is worth retrying, errors that have
+// not been classified are considered retryable.
+func IsRetryable(err error) bool {
+	return err != nil && !IsPermanent(err)
+}
+
+// StatusError represents an error caused by an unexpected HTTP status.
+type StatusError struct {
+	Code int
+	err  error
+}
+
+// Error returns the message of the underlying error.
+func (e *StatusError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *StatusError) Unwrap() error {
+	return e.err
+}
+
+// Status returns an error annotating err with the HTTP status code of the
+// response that caused it.
+func Status(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StatusError{Code: code, err: err}
+}
+
+var statusPattern = regexp.MustCompile(`\b[1-5][0-9]{2}\b`)
+
+// statusPrefixes are the texts that precede the status codes in the messages
+// of the upstream services.
+var statusPrefixes = []string{"status code error: ", "status code: ", "status: "}
+
+// ParseStatus annotates err with the HTTP status code reported in its message,
+// either following a status prefix, e.g. "status code error: 404", or as
+// the status line, e.g. "404 Not Found". It returns err as is if there is none.
+func ParseStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return err
+	}
+
+	msg := err.Error()
+	for _, loc := range statusPattern.FindAllStringIndex(msg, -1) {
+		code, _ := strconv.Atoi(msg[loc[0]:loc[1]])
+		if text := http.StatusText(code); text != "" && strings.HasPrefix(msg[loc[1]:], " "+text) {
+			return Status(code, err)
+		}
+		for _, prefix := range statusPrefixes {
+			if strings.HasSuffix(msg[:loc[0]], prefix) {
+				return Status(code, err)
+			}
+		}
+	}
+	return err
+}
+
+// Classify classifies err by inspecting its chain, it returns err as is
+// if it has been classified already. Unknown errors are classified as retryable.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var c *classified
+	if errors.As(err, &c) {
+		return err
+	}
+
+	// The client errors are permanent except the request timeout and
+	// too many requests, which may succeed later.
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch code := statusErr.Code; {
+		case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+			return Retryable(err)
+		case code >= http.StatusBadRequest && code < http.StatusInternalServerError:
+			return Permanent(err)
+		}
+		return Retryable(err)
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return Permanent(err)
+		}
+		return Retryable(err)
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.Op == "parse" {
+		return Permanent(err)
+	}
+
+	var (
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	if errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return Permanent(err)
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return Permanent(err)
+	}
+
+	return Retryable(err)
+}
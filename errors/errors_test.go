@@ -0,0 +1,142 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package errors // import "github.com/wabarc/wayback/errors"
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	var tests = []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{
+			name:      "unknown error",
+			err:       New("some error"),
+			retryable: true,
+		},
+		{
+			name:      "deadline exceeded",
+			err:       Wrap(context.DeadlineExceeded, "wayback"),
+			retryable: true,
+		},
+		{
+			name:      "canceled",
+			err:       context.Canceled,
+			retryable: false,
+		},
+		{
+			name:      "no such host",
+			err:       &url.Error{Op: "Get", URL: "https://example.invalid", Err: &net.DNSError{Err: "no such host", IsNotFound: true}},
+			retryable: false,
+		},
+		{
+			name:      "dns timeout",
+			err:       &net.DNSError{Err: "i/o timeout", IsTimeout: true},
+			retryable: true,
+		},
+		{
+			name:      "invalid url",
+			err:       &url.Error{Op: "parse", URL: "::", Err: New("missing protocol scheme")},
+			retryable: false,
+		},
+		{
+			name:      "not found",
+			err:       Status(http.StatusNotFound, New("404 Not Found")),
+			retryable: false,
+		},
+		{
+			name:      "forbidden in chain",
+			err:       Wrap(Status(http.StatusForbidden, New("403 Forbidden")), "wayback"),
+			retryable: false,
+		},
+		{
+			name:      "request timeout",
+			err:       Status(http.StatusRequestTimeout, New("408 Request Timeout")),
+			retryable: true,
+		},
+		{
+			name:      "too many requests",
+			err:       Status(http.StatusTooManyRequests, New("429 Too Many Requests")),
+			retryable: true,
+		},
+		{
+			name:      "service unavailable",
+			err:       Status(http.StatusServiceUnavailable, New("503 Service Unavailable")),
+			retryable: true,
+		},
+		{
+			name:      "classified permanent",
+			err:       Wrap(Permanent(New("blocked")), "archives failed"),
+			retryable: false,
+		},
+		{
+			name:      "classified retryable",
+			err:       Retryable(&net.DNSError{Err: "no such host", IsNotFound: true}),
+			retryable: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Classify(test.err)
+			if got := IsRetryable(err); got != test.retryable {
+				t.Errorf("Unexpected retryable got %t instead of %t", got, test.retryable)
+			}
+			if got := IsPermanent(err); got == test.retryable {
+				t.Errorf("Unexpected permanent got %t instead of %t", got, !test.retryable)
+			}
+			if err.Error() != test.err.Error() {
+				t.Errorf("Unexpected message got %s instead of %s", err, test.err)
+			}
+		})
+	}
+
+	if Classify(nil) != nil || IsRetryable(nil) || IsPermanent(nil) {
+		t.Error("Unexpected classification of nil error")
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	var tests = []struct {
+		name string
+		err  error
+		code int
+	}{
+		{name: "status code error", err: New("status code error: 404"), code: http.StatusNotFound},
+		{name: "status line", err: Wrap(New("401 Unauthorized"), "pin file failed"), code: http.StatusUnauthorized},
+		{name: "status code", err: New("unexpected status code: 503"), code: http.StatusServiceUnavailable},
+		{name: "annotated already", err: Status(http.StatusGone, New("status code error: 404")), code: http.StatusGone},
+		{name: "number only", err: New("retried 404 times"), code: 0},
+		{name: "no status", err: New("some error"), code: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ParseStatus(test.err)
+			var code int
+			var statusErr *StatusError
+			if As(err, &statusErr) {
+				code = statusErr.Code
+			}
+			if code != test.code {
+				t.Errorf("Unexpected status code got %d instead of %d", code, test.code)
+			}
+			if err.Error() != test.err.Error() {
+				t.Errorf("Unexpected message got %s instead of %s", err, test.err)
+			}
+		})
+	}
+
+	if ParseStatus(nil) != nil || Status(http.StatusNotFound, nil) != nil {
+		t.Error("Unexpected status of nil error")
+	}
+}
@@ -39,6 +39,10 @@ const (
 	StatusRequest = "request"
 	StatusSuccess = "success"
 	StatusFailure = "failure"
+	StatusDenied  = "denied" // Request refused by the access control lists
+
+	InlinePlayback = "playback" // Chosen inline result of playback
+	InlineArchive  = "archive"  // Chosen inline result of archiving
 )
 
 // Prometheus Metrics
@@ -55,6 +59,12 @@ var (
 		Help:      "Total number of playback requests from configured services",
 	}, []string{"from", "status"})
 
+	inlineGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "wayback",
+		Name:      "inline",
+		Help:      "Total number of inline results chosen from configured services",
+	}, []string{"from", "result"})
+
 	publishGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "wayback",
 		Name:      "publish",
@@ -85,6 +95,11 @@ func IncrementPlayback(from, status string) {
 	playbackGauge.With(prometheus.Labels{"from": from, "status": status}).Inc()
 }
 
+// IncrementInline increments the chosen inline results counter
+func IncrementInline(from, result string) {
+	inlineGauge.With(prometheus.Labels{"from": from, "result": result}).Inc()
+}
+
 // IncrementPublish increments the publish counter
 func IncrementPublish(desc, status string) {
 	publishGauge.With(prometheus.Labels{"desc": desc, "status": status}).Inc()
@@ -98,6 +113,9 @@ type Collector struct {
 	// PlaybackPgs reports the playback result for configured services
 	PlaybackPgs prometheus.GaugeVec
 
+	// InlinePgs reports the chosen inline results for configured services
+	InlinePgs prometheus.GaugeVec
+
 	// PublishPgs reports the publish result for configured services
 	PublishPgs prometheus.GaugeVec
 
@@ -110,6 +128,7 @@ func NewCollector() *Collector {
 	collector := &Collector{
 		WaybackPgs:  *waybackGauge,
 		PlaybackPgs: *playbackGauge,
+		InlinePgs:   *inlineGauge,
 		PublishPgs:  *publishGauge,
 		uptimeDesc: prometheus.NewDesc(
 			"wayback_uptime",
@@ -126,6 +145,7 @@ func (c *Collector) metricsList() []prometheus.GaugeVec {
 	return []prometheus.GaugeVec{
 		c.WaybackPgs,
 		c.PlaybackPgs,
+		c.InlinePgs,
 		c.PublishPgs,
 	}
 }
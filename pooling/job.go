@@ -0,0 +1,271 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package pooling // import "github.com/wabarc/wayback/pooling"
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/wabarc/wayback/errors"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")        // ErrJobNotFound job not found
+	ErrJobFinished = errors.New("job already finished") // ErrJobFinished job already finished
+
+	// Finished jobs are kept in memory for querying within this duration.
+	jobRetention = 24 * time.Hour
+)
+
+// State represents the lifecycle state of a job.
+type State int
+
+const (
+	StateQueued State = iota
+	StateRunning
+	StateRetrying
+	StateSucceeded
+	StateFailed
+	StateCancelled
+)
+
+// String returns description of state.
+func (s State) String() string {
+	switch s {
+	case StateQueued:
+		return "queued"
+	case StateRunning:
+		return "running"
+	case StateRetrying:
+		return "retrying"
+	case StateSucceeded:
+		return "succeeded"
+	case StateFailed:
+		return "failed"
+	case StateCancelled:
+		return "cancelled"
+	}
+
+	return "unknown"
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *State) UnmarshalText(text []byte) error {
+	for state := StateQueued; state <= StateCancelled; state++ {
+		if state.String() == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return errors.New("unknown job state %q", text)
+}
+
+// Finished reports whether the state is terminal.
+func (s State) Finished() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCancelled
+}
+
+// Attempt represents a single execution of a job.
+type Attempt struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Job represents a snapshot of a bucket tracked by the pool.
+type Job struct {
+	ID         string    `json:"id"`
+	Service    string    `json:"service,omitempty"`
+	User       string    `json:"-"`
+	URLs       []string  `json:"urls"`
+	State      State     `json:"state"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Attempts   []Attempt `json:"attempts"`
+}
+
+// String returns a human-readable summary of the job.
+func (j Job) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Job %s is %s.", j.ID, j.State)
+	if n := len(j.Attempts); n > 0 {
+		fmt.Fprintf(&b, " Attempts: %d.", n)
+		if last := j.Attempts[n-1]; last.Error != "" {
+			fmt.Fprintf(&b, " Last error: %s.", last.Error)
+		}
+	}
+	return b.String()
+}
+
+// job holds the mutable state of a bucket, it is shared by all copies of the bucket.
+type job struct {
+	mu sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	data   Job
+}
+
+// NewID returns a unique identifier for a bucket.
+func NewID() string {
+	return xid.New().String()
+}
+
+func newJob(ctx context.Context, b Bucket) *job {
+	urls := make([]string, 0, len(b.URLs))
+	for _, u := range b.URLs {
+		urls = append(urls, u.String())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return &job{
+		ctx:    ctx,
+		cancel: cancel,
+		data: Job{
+			ID:        b.ID,
+			Service:   b.Service,
+			User:      b.User,
+			URLs:      urls,
+			State:     StateQueued,
+			CreatedAt: time.Now(),
+			Attempts:  []Attempt{},
+		},
+	}
+}
+
+func (j *job) snapshot() Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data := j.data
+	data.URLs = append([]string{}, j.data.URLs...)
+	data.Attempts = append([]Attempt{}, j.data.Attempts...)
+	return data
+}
+
+func (j *job) state() State {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.data.State
+}
+
+// begin marks the job as running, or retrying if it has been attempted before.
+func (j *job) begin() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.data.State.Finished() {
+		return false
+	}
+
+	now := time.Now()
+	if len(j.data.Attempts) == 0 {
+		j.data.State = StateRunning
+		j.data.StartedAt = now
+	} else {
+		j.data.State = StateRetrying
+	}
+	j.data.Attempts = append(j.data.Attempts, Attempt{StartedAt: now})
+	return true
+}
+
+// end records the result of the latest attempt.
+func (j *job) end(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	n := len(j.data.Attempts)
+	if n == 0 {
+		return
+	}
+	j.data.Attempts[n-1].FinishedAt = time.Now()
+	if err != nil {
+		j.data.Attempts[n-1].Error = err.Error()
+	}
+}
+
+// finish transitions the job to a terminal state, it is a no-op for a finished job.
+func (j *job) finish(s State) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.data.State.Finished() {
+		return
+	}
+	j.data.State = s
+	j.data.FinishedAt = time.Now()
+	j.cancel()
+}
+
+// Job returns a snapshot of the job for the given id.
+func (p *Pool) Job(id string) (Job, bool) {
+	p.jobsMu.RLock()
+	j, ok := p.jobs[id]
+	p.jobsMu.RUnlock()
+	if !ok {
+		return Job{}, false
+	}
+	return j.snapshot(), true
+}
+
+// Jobs returns snapshots of all tracked jobs, the most recent first.
+func (p *Pool) Jobs() []Job {
+	p.jobsMu.RLock()
+	jobs := make([]Job, 0, len(p.jobs))
+	for _, j := range p.jobs {
+		jobs = append(jobs, j.snapshot())
+	}
+	p.jobsMu.RUnlock()
+
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].CreatedAt.After(jobs[k].CreatedAt)
+	})
+	return jobs
+}
+
+// Cancel cancels the job for the given id, and stops the running request by
+// canceling its context.
+func (p *Pool) Cancel(id string) error {
+	p.jobsMu.RLock()
+	j, ok := p.jobs[id]
+	p.jobsMu.RUnlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+	if j.state().Finished() {
+		return ErrJobFinished
+	}
+	j.finish(StateCancelled)
+	return nil
+}
+
+func (p *Pool) track(j *job) {
+	p.jobsMu.Lock()
+	defer p.jobsMu.Unlock()
+
+	if p.jobs == nil {
+		p.jobs = make(map[string]*job)
+	}
+	// Evict jobs that finished a long time ago.
+	for id, old := range p.jobs {
+		data := old.snapshot()
+		if data.State.Finished() && time.Since(data.FinishedAt) > jobRetention {
+			delete(p.jobs, id)
+		}
+	}
+	p.jobs[j.data.ID] = j
+}
@@ -6,6 +6,8 @@ package pooling // import "github.com/wabarc/wayback/pooling"
 
 import (
 	"context"
+	"math/rand"
+	"net/url"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -21,6 +23,7 @@ var (
 
 	errRollTimeout = errors.New("roll bucket timeout")
 	errElapsed     = errors.New("retried to reach maximum times")
+	errCancelled   = errors.New("bucket cancelled")
 )
 
 type resource struct {
@@ -41,21 +44,52 @@ type Pool struct {
 	processing int32
 	maxRetries uint64
 	multiplier float64
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	jobsMu sync.RWMutex
+	jobs   map[string]*job
+
+	// Called with the job of a bucket that failed eventually.
+	failed func(Job)
 }
 
 // A Bucket represents a wayback request is sent by a service.
 type Bucket struct {
+	// ID is the unique identifier of the bucket, it will be generated
+	// if it is empty when putting the bucket to the pool.
+	ID string
+
+	// Service is the name of the service that sent the bucket.
+	Service string
+
+	// User is the identifier of the user who sent the bucket in the service,
+	// it is empty for the buckets that are not requested by a user.
+	User string
+
+	// URLs are the requested URLs of the bucket.
+	URLs []*url.URL
+
 	// Request is the main func for handling wayback requests.
 	Request func(context.Context) error
 
-	// Fallback defines an optional func to return a failure response for the Request func.
-	Fallback func(context.Context) error
+	// Fallback defines an optional func to return a failure response for the Request func,
+	// it is called with the error of the last attempt once retries are exhausted,
+	// or the Request func returns a permanent error.
+	Fallback func(context.Context, error) error
+
+	// Done defines an optional func called with the job once it reaches a
+	// terminal state, whether it succeeded, failed or was cancelled.
+	Done func(Job)
 
 	// Count of retried attempts
 	elapsed uint64
 
 	// An object that will perform exactly one action.
 	once *sync.Once
+
+	// The lifecycle state of the bucket.
+	job *job
 }
 
 func newResource(id int) *resource {
@@ -81,7 +115,10 @@ func New(ctx context.Context, capacity int) *Pool {
 	p.timeout = config.Opts.WaybackTimeout()
 	p.maxRetries = config.Opts.WaybackMaxRetries() + 1
 	p.multiplier = 0.75
+	p.minBackoff = time.Second
+	p.maxBackoff = time.Minute
 	p.context = ctx
+	p.jobs = make(map[string]*job)
 
 	return p
 }
@@ -111,13 +148,22 @@ func (p *Pool) Roll() {
 	}
 }
 
-// Pub puts wayback requests to the resource pool
-func (p *Pool) Put(b Bucket) {
+// Put puts wayback requests to the resource pool, and returns the
+// identifier of the bucket for tracking its job.
+func (p *Pool) Put(b Bucket) string {
+	if b.ID == "" {
+		b.ID = NewID()
+	}
+	b.job = newJob(p.context, b)
+	p.track(b.job)
+
 	// Inserts a new bucket at the front of queue.
 	p.mutex.Lock()
 	p.staging.PushFront(b)
 	p.mutex.Unlock()
 	atomic.AddInt32(&p.waiting, 1)
+
+	return b.ID
 }
 
 // Close closes the worker pool, and it is blocked until all workers are idle.
@@ -151,6 +197,9 @@ func (p *Pool) push(r *resource) error {
 func (p *Pool) do(b Bucket) error {
 	atomic.AddInt32(&p.processing, 1)
 	defer func() {
+		if b.Done != nil {
+			b.Done(b.job.snapshot())
+		}
 		atomic.AddInt32(&p.waiting, -1)
 		atomic.AddInt32(&p.processing, -1)
 	}()
@@ -158,19 +207,14 @@ func (p *Pool) do(b Bucket) error {
 	action := func() error {
 		interval := float64(b.elapsed) * p.multiplier
 		timeout := p.timeout + p.timeout*time.Duration(interval)
-		ctx, cancel := context.WithTimeout(p.context, timeout)
+		ctx, cancel := context.WithTimeout(b.job.ctx, timeout)
 		defer cancel()
 
 		r := p.pull()
-		defer func() {
-			p.push(r) // nolint:errcheck
-			if b.elapsed >= p.maxRetries {
-				if b.Fallback != nil {
-					// nolint:errcheck
-					b.Fallback(ctx)
-				}
-			}
-		}()
+		defer p.push(r) // nolint:errcheck
+		if !b.job.begin() {
+			return errCancelled
+		}
 
 		ch := make(chan error, 1)
 		go func() {
@@ -184,26 +228,95 @@ func (p *Pool) do(b Bucket) error {
 			if err != nil {
 				atomic.AddUint64(&b.elapsed, 1)
 			}
+			b.job.end(err)
 			close(ch)
 			return err
 		case <-ctx.Done():
+			if b.job.ctx.Err() != nil {
+				b.job.end(errCancelled)
+				return errCancelled
+			}
 			atomic.AddUint64(&b.elapsed, 1)
+			b.job.end(errRollTimeout)
 			return errRollTimeout
 		}
 	}
 
-	ran := uint64(1)
-	max := p.maxRetries
-	for ; ran <= max; ran++ {
-		err := action()
-		switch err {
-		case nil, errElapsed:
+	fail := func(err error) {
+		if b.Fallback != nil {
+			// nolint:errcheck
+			b.Fallback(b.job.ctx, err)
+		}
+		b.job.finish(StateFailed)
+		if p.failed != nil {
+			p.failed(b.job.snapshot())
+		}
+	}
+
+	var err error
+	for ran := uint64(1); ran <= p.maxRetries; ran++ {
+		err = action()
+		switch {
+		case err == nil:
+			b.job.finish(StateSucceeded)
+			return nil
+		case err == errCancelled:
+			b.job.finish(StateCancelled)
 			return err
-		case errRollTimeout:
+		case errors.IsPermanent(err):
+			// Permanent failures are reported at once.
+			fail(err)
+			return err
+		}
+		if ran < p.maxRetries && !p.sleep(b.job.ctx, p.backoff(ran)) {
+			b.job.finish(StateCancelled)
+			return errCancelled
 		}
 	}
+	fail(err)
 
-	return nil
+	return errElapsed
+}
+
+// backoff returns the delay before the next attempt, it grows exponentially
+// with the number of attempts, and is randomized to avoid thundering herds.
+func (p *Pool) backoff(attempt uint64) time.Duration {
+	delay := p.minBackoff
+	for i := uint64(1); i < attempt && delay < p.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.maxBackoff {
+		delay = p.maxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Equal jitter in the range [delay/2, delay].
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// sleep waits for the given duration, it returns false if the context is done.
+func (p *Pool) sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// OnFailed registers a func to be called with the job of a bucket that failed
+// after exhausting its retries or with a permanent error, such as for storing
+// it to replay later.
+func (p *Pool) OnFailed(fn func(Job)) {
+	p.failed = fn
 }
 
 func (p *Pool) bucket() (b Bucket, ok bool) {
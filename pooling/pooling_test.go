@@ -6,7 +6,7 @@ package pooling // import "github.com/wabarc/wayback/pooling"
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -14,6 +14,7 @@ import (
 	"github.com/wabarc/helper"
 	"github.com/wabarc/logger"
 	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/errors"
 )
 
 func TestRoll(t *testing.T) {
@@ -45,7 +46,7 @@ func TestRoll(t *testing.T) {
 					time.Sleep(time.Millisecond)
 					return nil
 				},
-				Fallback: func(_ context.Context) error {
+				Fallback: func(_ context.Context, _ error) error {
 					return nil
 				},
 			}
@@ -93,7 +94,7 @@ func TestTimeout(t *testing.T) {
 					time.Sleep(10 * time.Millisecond)
 					return nil
 				},
-				Fallback: func(_ context.Context) error {
+				Fallback: func(_ context.Context, _ error) error {
 					return nil
 				},
 			}
@@ -129,7 +130,7 @@ func TestMaxRetries(t *testing.T) {
 			atomic.AddUint64(&elapsed, 1)
 			return errors.New("process request failed")
 		},
-		Fallback: func(_ context.Context) error {
+		Fallback: func(_ context.Context, _ error) error {
 			return nil
 		},
 	}
@@ -138,6 +139,7 @@ func TestMaxRetries(t *testing.T) {
 	p := New(context.Background(), 1)
 	p.timeout = time.Second
 	p.maxRetries = maxRetries
+	p.minBackoff = time.Millisecond
 	go p.Roll()
 	p.Put(bucket)
 	p.Close()
@@ -162,7 +164,7 @@ func TestFallback(t *testing.T) {
 		Request: func(_ context.Context) error {
 			return errors.New("some error")
 		},
-		Fallback: func(_ context.Context) error {
+		Fallback: func(_ context.Context, _ error) error {
 			fall = want
 			return nil
 		},
@@ -257,3 +259,244 @@ func TestStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestJob(t *testing.T) {
+	defer helper.CheckTest(t)
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+	logger.SetLogLevel(logger.LevelFatal)
+
+	tests := []struct {
+		name    string
+		request func(context.Context) error
+		state   State
+		retries int
+	}{
+		{
+			name:    "succeeded",
+			request: func(_ context.Context) error { return nil },
+			state:   StateSucceeded,
+			retries: 1,
+		},
+		{
+			name:    "failed",
+			request: func(_ context.Context) error { return errors.New("some error") },
+			state:   StateFailed,
+			retries: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := New(context.Background(), 1)
+			p.timeout = time.Second
+			p.maxRetries = 2
+			p.minBackoff = time.Millisecond
+			go p.Roll()
+
+			id := p.Put(Bucket{Request: test.request})
+			if id == "" {
+				t.Fatal("Unexpected empty job id")
+			}
+			p.Close()
+
+			job, ok := p.Job(id)
+			if !ok {
+				t.Fatalf("Unexpected job not found: %s", id)
+			}
+			if job.State != test.state {
+				t.Errorf("Unexpected job state, got %v instead of %v", job.State, test.state)
+			}
+			if len(job.Attempts) != test.retries {
+				t.Errorf("Unexpected job attempts, got %d instead of %d", len(job.Attempts), test.retries)
+			}
+			if len(p.Jobs()) != 1 {
+				t.Errorf("Unexpected jobs, got %d instead of 1", len(p.Jobs()))
+			}
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	defer helper.CheckTest(t)
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+	logger.SetLogLevel(logger.LevelFatal)
+
+	var fallback int32
+	started := make(chan struct{})
+	bucket := Bucket{
+		Request: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		Fallback: func(_ context.Context, _ error) error {
+			atomic.AddInt32(&fallback, 1)
+			return nil
+		},
+	}
+
+	p := New(context.Background(), 1)
+	p.timeout = time.Minute
+	go p.Roll()
+
+	id := p.Put(bucket)
+	<-started
+	if err := p.Cancel(id); err != nil {
+		t.Fatalf("Unexpected cancel job: %v", err)
+	}
+	p.Close()
+
+	job, _ := p.Job(id)
+	if job.State != StateCancelled {
+		t.Errorf("Unexpected job state, got %v instead of %v", job.State, StateCancelled)
+	}
+	if atomic.LoadInt32(&fallback) != 0 {
+		t.Errorf("Unexpected fallback for a cancelled job")
+	}
+	if err := p.Cancel(id); err != ErrJobFinished {
+		t.Errorf("Unexpected cancel a finished job, got %v instead of %v", err, ErrJobFinished)
+	}
+	if err := p.Cancel("foo"); err != ErrJobNotFound {
+		t.Errorf("Unexpected cancel a nonexistent job, got %v instead of %v", err, ErrJobNotFound)
+	}
+}
+
+func TestPermanentFailure(t *testing.T) {
+	defer helper.CheckTest(t)
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+	logger.SetLogLevel(logger.LevelFatal)
+
+	var elapsed uint64
+	var fallback error
+	want := errors.Permanent(errors.New("no such host"))
+	bucket := Bucket{
+		Request: func(_ context.Context) error {
+			atomic.AddUint64(&elapsed, 1)
+			return want
+		},
+		Fallback: func(_ context.Context, err error) error {
+			fallback = err
+			return nil
+		},
+	}
+
+	p := New(context.Background(), 1)
+	p.timeout = time.Second
+	p.maxRetries = 3
+	go p.Roll()
+	id := p.Put(bucket)
+	p.Close()
+
+	if elapsed != 1 {
+		t.Errorf("Unexpected attempts got %d instead of 1", elapsed)
+	}
+	if fallback != want {
+		t.Errorf("Unexpected fallback error got %v instead of %v", fallback, want)
+	}
+	if job, _ := p.Job(id); job.State != StateFailed {
+		t.Errorf("Unexpected job state, got %v instead of %v", job.State, StateFailed)
+	}
+}
+
+func TestDone(t *testing.T) {
+	defer helper.CheckTest(t)
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+	logger.SetLogLevel(logger.LevelFatal)
+
+	var tests = []struct {
+		name  string
+		err   error
+		state State
+	}{
+		{name: "succeeded", err: nil, state: StateSucceeded},
+		{name: "failed", err: errors.Permanent(errors.New("no such host")), state: StateFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var done []Job
+			bucket := Bucket{
+				Request: func(_ context.Context) error {
+					return test.err
+				},
+				Done: func(job Job) {
+					done = append(done, job)
+				},
+			}
+
+			p := New(context.Background(), 1)
+			go p.Roll()
+			id := p.Put(bucket)
+			p.Close()
+
+			if len(done) != 1 {
+				t.Fatalf("Unexpected done calls, got %d instead of 1", len(done))
+			}
+			if done[0].ID != id || done[0].State != test.state {
+				t.Errorf("Unexpected done job, got %v instead of %s %v", done[0], id, test.state)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := &Pool{minBackoff: time.Second, maxBackoff: 10 * time.Second}
+
+	tests := []struct {
+		attempt uint64
+		max     time.Duration
+	}{
+		{attempt: 1, max: time.Second},
+		{attempt: 2, max: 2 * time.Second},
+		{attempt: 3, max: 4 * time.Second},
+		{attempt: 4, max: 8 * time.Second},
+		{attempt: 5, max: 10 * time.Second},
+		{attempt: 100, max: 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.attempt), func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				got := p.backoff(test.attempt)
+				if got < test.max/2 || got > test.max {
+					t.Fatalf("Unexpected backoff got %v instead of between %v and %v", got, test.max/2, test.max)
+				}
+			}
+		})
+	}
+}
+
+func TestStateText(t *testing.T) {
+	for state := StateQueued; state <= StateCancelled; state++ {
+		text, _ := state.MarshalText()
+		var got State
+		if err := got.UnmarshalText(text); err != nil || got != state {
+			t.Errorf("Unexpected unmarshal state %s, got %v, error: %v", text, got, err)
+		}
+	}
+
+	var s State
+	if err := s.UnmarshalText([]byte("foo")); err == nil {
+		t.Errorf("Unexpected unmarshal unknown state without error")
+	}
+}
@@ -0,0 +1,9 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package progress reports the progress events of a wayback request, such as
+a reduxed URL or an archived slot, to the reporter carried by the context.
+*/
+package progress // import "github.com/wabarc/wayback/progress"
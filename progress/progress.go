@@ -0,0 +1,56 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package progress // import "github.com/wabarc/wayback/progress"
+
+import (
+	"context"
+	"time"
+)
+
+// Kind is the kind of a progress event.
+type Kind string
+
+// Kinds of progress events, in the order of a wayback request.
+const (
+	Queued    Kind = "queued"    // Queued the request is queued
+	Reduxed   Kind = "reduxed"   // Reduxed the webpage of a URL is captured
+	Archived  Kind = "archived"  // Archived a URL is archived to a slot
+	Published Kind = "published" // Published the results are published
+	Done      Kind = "done"      // Done the request is finished
+)
+
+// Event represents a progress event of a wayback request.
+type Event struct {
+	Kind  Kind      `json:"kind"`
+	Src   string    `json:"src,omitempty"`
+	Slot  string    `json:"slot,omitempty"`
+	Dst   string    `json:"dst,omitempty"`
+	State string    `json:"state,omitempty"`
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// Reporter receives the progress events, it must not block.
+type Reporter func(Event)
+
+type reporterKey struct{}
+
+// WithReporter returns a copy of the context which carries the reporter.
+func WithReporter(ctx context.Context, fn Reporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, fn)
+}
+
+// Report sends the event to the reporter carried by the context, it does
+// nothing if the context has no reporter.
+func Report(ctx context.Context, e Event) {
+	fn, ok := ctx.Value(reporterKey{}).(Reporter)
+	if !ok || fn == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	fn(e)
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package progress // import "github.com/wabarc/wayback/progress"
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	// Reporting without a reporter must not panic.
+	Report(context.Background(), Event{Kind: Queued})
+
+	var got []Event
+	ctx := WithReporter(context.Background(), func(e Event) {
+		got = append(got, e)
+	})
+	Report(ctx, Event{Kind: Archived, Src: "https://example.com", Slot: "ia", Dst: "https://web.archive.org/"})
+
+	if len(got) != 1 {
+		t.Fatalf("Unexpected reported events, got %d instead of 1", len(got))
+	}
+	if got[0].Kind != Archived {
+		t.Errorf("Unexpected event kind, got %s instead of %s", got[0].Kind, Archived)
+	}
+	if got[0].Time.IsZero() {
+		t.Errorf("Unexpected event time, got zero time")
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/wabarc/wayback"
 	"github.com/wabarc/wayback/config"
 	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/progress"
 	"github.com/wabarc/wayback/reduxer"
 	"golang.org/x/sync/errgroup"
 
@@ -263,6 +264,7 @@ func To(ctx context.Context, cols []wayback.Collect, args ...string) {
 	if err := g.Wait(); err != nil {
 		logger.Error("[%s] process failed: %v", f, err)
 	}
+	progress.Report(ctx, progress.Event{Kind: progress.Published})
 }
 
 func extract(ctx context.Context, cols []wayback.Collect) (rdx reduxer.Reduxer, art reduxer.Artifact, err error) {
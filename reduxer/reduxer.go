@@ -34,6 +34,7 @@ import (
 	"github.com/wabarc/warcraft"
 	"github.com/wabarc/wayback/config"
 	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/progress"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -154,12 +155,12 @@ func Do(ctx context.Context, urls ...*url.URL) (Reduxer, error) {
 	var err error
 
 	if !config.Opts.EnabledReduxer() {
-		return bs, errors.New("Specify directory to environment `WAYBACK_STORAGE_DIR` to enable reduxer")
+		return bs, errors.Permanent(errors.New("Specify directory to environment `WAYBACK_STORAGE_DIR` to enable reduxer"))
 	}
 
 	dir, err := createDir(config.Opts.StorageDir())
 	if err != nil {
-		return bs, errors.Wrap(err, "create storage directory failed")
+		return bs, errors.Permanent(errors.Wrap(err, "create storage directory failed"))
 	}
 
 	var warc = &warcraft.Warcraft{BasePath: dir, UserAgent: config.Opts.WaybackUserAgent()}
@@ -182,7 +183,8 @@ func Do(ctx context.Context, urls ...*url.URL) (Reduxer, error) {
 
 			shot, er := capture(ctx, uri, dir)
 			if er != nil {
-				return errors.Wrap(er, "capture failed")
+				progress.Report(ctx, progress.Event{Kind: progress.Reduxed, Src: uri.String(), Error: er.Error()})
+				return errors.Classify(errors.ParseStatus(errors.Wrap(er, "capture failed")))
 			}
 
 			artifact := &Artifact{
@@ -219,6 +221,7 @@ func Do(ctx context.Context, urls ...*url.URL) (Reduxer, error) {
 			}
 			bundle := &bundle{shots: shot, artifact: *artifact, article: article}
 			bs.Store(Src(shot.URL), bundle)
+			progress.Report(ctx, progress.Event{Kind: progress.Reduxed, Src: uri.String()})
 			return nil
 		})
 	}
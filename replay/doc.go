@@ -0,0 +1,9 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package replay reads the WARC files written by the reduxer, indexes them as
+CDXJ and rewrites the archived resources to be replayed in the browser.
+*/
+package replay // import "github.com/wabarc/wayback/replay"
@@ -0,0 +1,314 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package replay // import "github.com/wabarc/wayback/replay"
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/errors"
+)
+
+// timestampLayout is the layout of the 14-digit timestamps of CDXJ.
+const timestampLayout = "20060102150405"
+
+// indexExt is the extension of the CDXJ index file next to a WARC file.
+const indexExt = ".cdxj"
+
+// ErrNotArchived is returned if a URL is not in the index.
+var ErrNotArchived = errors.New("url is not archived")
+
+// Entry represents a line of a CDXJ index, which locates a record of a URL.
+type Entry struct {
+	Key    string    `json:"-"`
+	Time   time.Time `json:"-"`
+	URL    string    `json:"url"`
+	Mime   string    `json:"mime,omitempty"`
+	Status string    `json:"status,omitempty"`
+	Digest string    `json:"digest,omitempty"`
+	Length int64     `json:"length,string"`
+	Offset int64     `json:"offset,string"`
+	File   string    `json:"filename"`
+}
+
+// String returns the CDXJ line of the entry.
+func (e Entry) String() string {
+	buf, _ := json.Marshal(e)
+	return fmt.Sprintf("%s %s %s", e.Key, e.Time.UTC().Format(timestampLayout), buf)
+}
+
+// Index represents the CDXJ index of a WARC file, the entries are sorted
+// by the key and time.
+type Index struct {
+	path    string
+	modTime time.Time
+	entries []Entry
+}
+
+// Open returns the index of the WARC file, it loads the CDXJ file next to
+// the WARC file, or builds and writes it if not present or outdated.
+func Open(path string) (*Index, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	idx := &Index{path: path, modTime: info.ModTime()}
+
+	cdxj := path + indexExt
+	if ci, err := os.Stat(cdxj); err == nil && !ci.ModTime().Before(info.ModTime()) {
+		if err = idx.load(cdxj); err == nil {
+			return idx, nil
+		}
+		logger.Warn("load index %s failed, rebuilding: %v", cdxj, err)
+	}
+
+	if err := idx.build(); err != nil {
+		return nil, errors.Wrap(err, "index warc failed")
+	}
+	if err := idx.save(cdxj); err != nil {
+		// The index still works in memory, e.g. the storage is read-only.
+		logger.Warn("write index %s failed: %v", cdxj, err)
+	}
+
+	return idx, nil
+}
+
+// Path returns the path of the WARC file.
+func (idx *Index) Path() string {
+	return idx.path
+}
+
+// ModTime returns the modification time of the WARC file when indexed.
+func (idx *Index) ModTime() time.Time {
+	return idx.modTime
+}
+
+// Entries returns the entries of the index.
+func (idx *Index) Entries() []Entry {
+	return idx.entries
+}
+
+// Lookup returns the entry of the URL, the successful responses are
+// preferred and then the latest ones.
+func (idx *Index) Lookup(uri string) (Entry, error) {
+	key := Key(uri)
+	i := sort.Search(len(idx.entries), func(i int) bool {
+		return idx.entries[i].Key >= key
+	})
+
+	var found *Entry
+	for ; i < len(idx.entries) && idx.entries[i].Key == key; i++ {
+		e := &idx.entries[i]
+		if found == nil || rank(e) >= rank(found) {
+			found = e
+		}
+	}
+	if found == nil {
+		return Entry{}, errors.Wrap(ErrNotArchived, uri)
+	}
+
+	return *found, nil
+}
+
+// rank ranks the successful responses over the redirects and the errors.
+func rank(e *Entry) int {
+	switch {
+	case strings.HasPrefix(e.Status, "2"):
+		return 2
+	case strings.HasPrefix(e.Status, "3"):
+		return 1
+	}
+	return 0
+}
+
+// Record reads the record of the entry, the caller must close the record.
+func (idx *Index) Record(e Entry) (*Record, error) {
+	return ReadAt(idx.path, e.Offset)
+}
+
+func (idx *Index) build() error {
+	f, err := os.Open(idx.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	name := filepath.Base(idx.path)
+	entries := []Entry{}
+	offsets := []int64{}
+	r := NewReader(f, gzipped(idx.path), 0)
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offsets = append(offsets, rec.Offset)
+
+		uri := rec.TargetURI()
+		if uri == "" || (rec.Type() != "response" && rec.Type() != "resource") {
+			continue
+		}
+		e := Entry{
+			Key:    Key(uri),
+			Time:   rec.Date(),
+			URL:    uri,
+			Digest: rec.Header.Get("WARC-Payload-Digest"),
+			Offset: rec.Offset,
+			File:   name,
+			Status: "200",
+			Mime:   mediaType(rec.Header.Get("Content-Type")),
+		}
+		if rec.Type() == "response" {
+			resp, err := http.ReadResponse(bufio.NewReader(rec.Body), nil)
+			if err != nil {
+				logger.Debug("parse response of %s failed: %v", uri, err)
+				continue
+			}
+			e.Status = strconv.Itoa(resp.StatusCode)
+			e.Mime = mediaType(resp.Header.Get("Content-Type"))
+		}
+		entries = append(entries, e)
+	}
+
+	// The length of a record is up to the next one.
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		j := sort.Search(len(offsets), func(j int) bool { return offsets[j] > entries[i].Offset })
+		end := info.Size()
+		if j < len(offsets) {
+			end = offsets[j]
+		}
+		entries[i].Length = end - entries[i].Offset
+	}
+	idx.sort(entries)
+
+	return nil
+}
+
+func (idx *Index) sort(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
+		}
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	idx.entries = entries
+}
+
+func (idx *Index) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "!") {
+			continue
+		}
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) != 3 {
+			return errors.New("invalid cdxj line: %q", line)
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(parts[2]), &e); err != nil {
+			return err
+		}
+		e.Key = parts[0]
+		if e.Time, err = time.Parse(timestampLayout, parts[1]); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	idx.sort(entries)
+
+	return nil
+}
+
+func (idx *Index) save(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "!OpenWayback-CDXJ 1.0")
+	for _, e := range idx.entries {
+		fmt.Fprintln(w, e.String())
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func mediaType(ctype string) string {
+	mt, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+// Key returns the SURT form of the URL used to sort and look up the index,
+// e.g. "com,example)/foo?a=1&b=2" for "https://www.Example.com/foo?b=2&a=1".
+func Key(uri string) string {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || u.Host == "" {
+		return strings.ToLower(uri)
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	labels := strings.Split(host, ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	key := strings.Join(labels, ",")
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		key += ":" + port
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	key += ")" + strings.ToLower(path)
+	if u.RawQuery != "" {
+		key += "?" + strings.ToLower(u.Query().Encode())
+	}
+
+	return key
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package replay // import "github.com/wabarc/wayback/replay"
+
+import (
+	"os"
+	"testing"
+
+	"github.com/wabarc/wayback/errors"
+)
+
+func TestKey(t *testing.T) {
+	var tests = []struct {
+		uri  string
+		want string
+	}{
+		{uri: "https://example.com", want: "com,example)/"},
+		{uri: "https://www.Example.com/Foo?b=2&a=1", want: "com,example)/foo?a=1&b=2"},
+		{uri: "http://example.com:80/", want: "com,example)/"},
+		{uri: "http://example.com:8080/", want: "com,example:8080)/"},
+		{uri: "https://sub.example.co.uk/a#b", want: "uk,co,example,sub)/a"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			if got := Key(test.uri); got != test.want {
+				t.Errorf("Unexpected key, got %s instead of %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIndex(t *testing.T) {
+	for _, name := range []string{"example.warc", "example.warc.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := writeWARC(t, t.TempDir(), name)
+			idx, err := Open(path)
+			if err != nil {
+				t.Fatalf("Unexpected open index: %v", err)
+			}
+			if n := len(idx.Entries()); n != 3 {
+				t.Fatalf("Unexpected entries, got %d instead of 3", n)
+			}
+			if _, err := os.Stat(path + indexExt); err != nil {
+				t.Errorf("Unexpected index file not written: %v", err)
+			}
+
+			// Load the written index file.
+			loaded, err := Open(path)
+			if err != nil {
+				t.Fatalf("Unexpected load index: %v", err)
+			}
+			for i, e := range loaded.Entries() {
+				if e != idx.Entries()[i] {
+					t.Errorf("Unexpected loaded entry, got %v instead of %v", e, idx.Entries()[i])
+				}
+			}
+
+			e, err := loaded.Lookup("https://www.example.com/style.css")
+			if err != nil {
+				t.Fatalf("Unexpected lookup: %v", err)
+			}
+			if e.Mime != "text/css" || e.Status != "200" || e.Length <= 0 {
+				t.Errorf("Unexpected entry, got %#v", e)
+			}
+			if e, _ := loaded.Lookup("https://example.com/old"); e.Status != "301" {
+				t.Errorf("Unexpected entry status, got %s instead of 301", e.Status)
+			}
+			if _, err := loaded.Lookup("https://example.com/missing"); !errors.Is(err, ErrNotArchived) {
+				t.Errorf("Unexpected lookup error, got %v instead of %v", err, ErrNotArchived)
+			}
+
+			rec, err := loaded.Record(e)
+			if err != nil {
+				t.Fatalf("Unexpected read record: %v", err)
+			}
+			defer rec.Close()
+			if rec.TargetURI() != "https://example.com/style.css" {
+				t.Errorf("Unexpected record, got %s", rec.TargetURI())
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package replay // import "github.com/wabarc/wayback/replay"
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	cssURL    = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^)\s]*))\s*\)`)
+	cssImport = regexp.MustCompile(`(?i)@import\s+(?:"([^"]*)"|'([^']*)')`)
+	refresh   = regexp.MustCompile(`(?i)^(\s*\d+\s*;\s*url\s*=\s*)(.+)$`)
+)
+
+// urlAttrs are the attributes of HTML elements which hold a URL.
+var urlAttrs = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"formaction": true,
+	"poster":     true,
+	"background": true,
+	"data":       true,
+}
+
+// Rewriter rewrites the URLs of an archived resource to the URLs of the
+// archived copies, in the form of prefix, scheme, host and path, e.g.
+// "/archives/1/replay/https/example.com/foo?bar".
+type Rewriter struct {
+	Base   *url.URL // Base is the URL of the resource
+	Prefix string   // Prefix is the path prefix of replay URLs, with a trailing slash
+}
+
+// URL returns the replay URL of a reference of the resource, references
+// other than HTTP(S) URLs are kept as is.
+func (rw *Rewriter) URL(ref string) string {
+	trimmed := strings.TrimSpace(ref)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return ref
+	}
+	u, err := rw.Base.Parse(trimmed)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ref
+	}
+
+	return Path(rw.Prefix, u)
+}
+
+// Path returns the replay URL of the URL under the prefix.
+func Path(prefix string, u *url.URL) string {
+	s := prefix + u.Scheme + "/" + u.Host + u.EscapedPath()
+	if u.RawQuery != "" || u.ForceQuery {
+		s += "?" + u.RawQuery
+	}
+	if u.Fragment != "" {
+		s += "#" + u.EscapedFragment()
+	}
+	return s
+}
+
+// CSS rewrites the URLs of a stylesheet.
+func (rw *Rewriter) CSS(css string) string {
+	replace := func(re *regexp.Regexp, format func(string) string) func(string) string {
+		return func(m string) string {
+			sub := re.FindStringSubmatch(m)
+			for _, ref := range sub[1:] {
+				if ref != "" {
+					return format(rw.URL(ref))
+				}
+			}
+			return m
+		}
+	}
+	css = cssURL.ReplaceAllStringFunc(css, replace(cssURL, func(s string) string {
+		return `url("` + s + `")`
+	}))
+	css = cssImport.ReplaceAllStringFunc(css, replace(cssImport, func(s string) string {
+		return `@import "` + s + `"`
+	}))
+
+	return css
+}
+
+// srcset rewrites the URLs of a srcset attribute, which is a comma
+// separated list of a URL and an optional descriptor.
+func (rw *Rewriter) srcset(value string) string {
+	candidates := strings.Split(value, ",")
+	for i, c := range candidates {
+		fields := strings.Fields(c)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = rw.URL(fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// HTML rewrites the URLs of an HTML document from r to w, and inserts the
+// banner at the start of the body.
+func (rw *Rewriter) HTML(w io.Writer, r io.Reader, banner string) error {
+	z := html.NewTokenizer(r)
+	inStyle, inserted := false, false
+	write := func(s string) error {
+		_, err := io.WriteString(w, s)
+		return err
+	}
+
+	for {
+		tt := z.Next()
+		raw := string(z.Raw())
+		var err error
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				return z.Err()
+			}
+			if !inserted {
+				return write(banner)
+			}
+			return nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			rw.element(&tok)
+			err = write(tok.String())
+			if tok.Data == "style" && tt == html.StartTagToken {
+				inStyle = true
+			}
+			if tok.Data == "body" && !inserted {
+				inserted = true
+				err = write(banner)
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "style" {
+				inStyle = false
+			}
+			err = write(raw)
+		case html.TextToken:
+			if inStyle {
+				raw = rw.CSS(raw)
+			}
+			err = write(raw)
+		default:
+			err = write(raw)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// element rewrites the attributes of an element.
+func (rw *Rewriter) element(tok *html.Token) {
+	attrs := tok.Attr[:0]
+	for _, a := range tok.Attr {
+		key := strings.ToLower(a.Key)
+		switch {
+		case key == "integrity":
+			// The digest no longer matches the rewritten resource.
+			continue
+		case key == "href" && tok.Data == "base":
+			// The following relative URLs are resolved against the base.
+			if u, err := rw.Base.Parse(strings.TrimSpace(a.Val)); err == nil {
+				a.Val = rw.URL(a.Val)
+				rw.Base = u
+			}
+		case urlAttrs[key]:
+			a.Val = rw.URL(a.Val)
+		case key == "srcset":
+			a.Val = rw.srcset(a.Val)
+		case key == "style":
+			a.Val = rw.CSS(a.Val)
+		case key == "content" && tok.Data == "meta":
+			if m := refresh.FindStringSubmatch(a.Val); m != nil {
+				a.Val = m[1] + rw.URL(strings.Trim(m[2], `'"`))
+			}
+		}
+		attrs = append(attrs, a)
+	}
+	tok.Attr = attrs
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package replay // import "github.com/wabarc/wayback/replay"
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const prefix = "/archives/1/replay/"
+
+func newRewriter(t *testing.T) *Rewriter {
+	base, err := url.Parse("https://example.com/foo/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Rewriter{Base: base, Prefix: prefix}
+}
+
+func TestRewriteURL(t *testing.T) {
+	var tests = []struct {
+		ref  string
+		want string
+	}{
+		{ref: "bar.html", want: prefix + "https/example.com/foo/bar.html"},
+		{ref: "/a?b=1#c", want: prefix + "https/example.com/a?b=1#c"},
+		{ref: "//cdn.example.org/x.js", want: prefix + "https/cdn.example.org/x.js"},
+		{ref: "http://example.org", want: prefix + "http/example.org"},
+		{ref: "#top", want: "#top"},
+		{ref: "data:image/png;base64,AAAA", want: "data:image/png;base64,AAAA"},
+		{ref: "mailto:foo@example.com", want: "mailto:foo@example.com"},
+		{ref: "javascript:void(0)", want: "javascript:void(0)"},
+	}
+
+	rw := newRewriter(t)
+	for _, test := range tests {
+		t.Run(test.ref, func(t *testing.T) {
+			if got := rw.URL(test.ref); got != test.want {
+				t.Errorf("Unexpected rewrite url, got %s instead of %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRewriteCSS(t *testing.T) {
+	css := `@import "print.css"; body { background: url( 'bg.png' ) } i { src: url(/font.woff) } b { src: url(data:font/woff;base64,AA) }`
+	want := `@import "` + prefix + `https/example.com/foo/print.css"; body { background: url("` + prefix + `https/example.com/foo/bg.png") } ` +
+		`i { src: url("` + prefix + `https/example.com/font.woff") } b { src: url("data:font/woff;base64,AA") }`
+
+	if got := newRewriter(t).CSS(css); got != want {
+		t.Errorf("Unexpected rewrite css, got %s instead of %s", got, want)
+	}
+}
+
+func TestRewriteHTML(t *testing.T) {
+	doc := `<!DOCTYPE html><html><head><base href="/base/">` +
+		`<meta http-equiv="refresh" content="5; url=next.html">` +
+		`<link rel="stylesheet" href="style.css" integrity="sha384-foo">` +
+		`<style>p { background: url(p.png) }</style></head>` +
+		`<body class="x"><a href="a.html">a &amp; b</a><img srcset="a.png 1x, /b.png 2x" style="background: url(c.png)">` +
+		`<script>var s = "<a href='x'>";</script></body></html>`
+
+	var b strings.Builder
+	if err := newRewriter(t).HTML(&b, strings.NewReader(doc), `<div id="banner"></div>`); err != nil {
+		t.Fatalf("Unexpected rewrite html: %v", err)
+	}
+	got := b.String()
+
+	for _, want := range []string{
+		`<base href="` + prefix + `https/example.com/base/">`,
+		`content="5; url=` + prefix + `https/example.com/base/next.html"`,
+		`<link rel="stylesheet" href="` + prefix + `https/example.com/base/style.css">`,
+		`<style>p { background: url("` + prefix + `https/example.com/base/p.png") }</style>`,
+		`<body class="x"><div id="banner"></div>`,
+		`<a href="` + prefix + `https/example.com/base/a.html">a &amp; b</a>`,
+		`srcset="` + prefix + `https/example.com/base/a.png 1x, ` + prefix + `https/example.com/b.png 2x"`,
+		`<script>var s = "<a href='x'>";</script>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Unexpected rewrite html, %q not found in %q", want, got)
+		}
+	}
+	if strings.Contains(got, "integrity") {
+		t.Errorf("Unexpected integrity attribute in %q", got)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package replay // import "github.com/wabarc/wayback/replay"
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wabarc/wayback/errors"
+)
+
+// ErrMalformed is returned if a WARC record is malformed.
+var ErrMalformed = errors.New("malformed warc record")
+
+// Record represents a record of a WARC file.
+type Record struct {
+	Header textproto.MIMEHeader // Header is the WARC named fields of the record
+	Offset int64                // Offset is the offset of the record in the file
+	Body   io.Reader            // Body is the content block of the record
+
+	closer io.Closer
+}
+
+// Type returns the WARC-Type of the record.
+func (r *Record) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+// TargetURI returns the WARC-Target-URI of the record.
+func (r *Record) TargetURI() string {
+	// The URI is wrapped in angle brackets by WARC 1.0 writers.
+	return strings.Trim(r.Header.Get("WARC-Target-URI"), "<>")
+}
+
+// Date returns the WARC-Date of the record.
+func (r *Record) Date() time.Time {
+	t, _ := time.Parse(time.RFC3339, r.Header.Get("WARC-Date"))
+	return t
+}
+
+// Close closes the file of a record returned by ReadAt.
+func (r *Record) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// countReader counts the bytes consumed from a buffered reader, it is a
+// flate.Reader thus gzip does not read ahead of a member.
+type countReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// Reader reads records from a WARC file, the file is either plain or
+// compressed by a gzip member per record.
+type Reader struct {
+	gzipped bool
+	src     *countReader
+	zr      *gzip.Reader
+	body    io.Reader
+	base    int64
+	pos     int64 // pos is the bytes consumed of a plain file
+}
+
+// NewReader returns a reader of the WARC records of r, which starts at the
+// offset of the file.
+func NewReader(r io.Reader, gzipped bool, offset int64) *Reader {
+	return &Reader{
+		gzipped: gzipped,
+		src:     &countReader{r: bufio.NewReader(r)},
+		base:    offset,
+	}
+}
+
+// Next returns the next record, the body of the previous record is no
+// longer valid. It returns io.EOF if there are no more records.
+func (r *Reader) Next() (*Record, error) {
+	if r.body != nil {
+		if _, err := io.Copy(io.Discard, r.body); err != nil {
+			return nil, err
+		}
+		r.body = nil
+	}
+
+	if !r.gzipped {
+		rec, n, err := parse(r.src.r, r.base+r.pos)
+		if err != nil {
+			return nil, err
+		}
+		r.pos += n
+		r.body = rec.Body
+		return rec, nil
+	}
+
+	// Drain the trailing bytes of the previous member.
+	if r.zr != nil {
+		if _, err := io.Copy(io.Discard, r.zr); err != nil {
+			return nil, err
+		}
+	}
+	offset := r.base + r.src.n
+	var err error
+	if r.zr == nil {
+		r.zr, err = gzip.NewReader(r.src)
+	} else {
+		err = r.zr.Reset(r.src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.zr.Multistream(false)
+	rec, _, err := parse(bufio.NewReader(r.zr), offset)
+	if err != nil {
+		return nil, err
+	}
+	// A gzip member holds a single record, the offset is where it starts.
+	rec.Offset = offset
+	r.body = rec.Body
+
+	return rec, nil
+}
+
+// parse reads a record from br which starts at the offset of the file, it
+// returns the record and the bytes of it, including the blank lines before
+// and the content block.
+func parse(br *bufio.Reader, offset int64) (*Record, int64, error) {
+	var n int64
+	var line string
+	// Skip the blank lines between records.
+	for strings.TrimSpace(line) == "" {
+		var err error
+		line, err = br.ReadString('\n')
+		n += int64(len(line))
+		if err != nil {
+			if err == io.EOF && strings.TrimSpace(line) == "" {
+				return nil, n, io.EOF
+			}
+			return nil, n, errors.Wrap(ErrMalformed, err.Error())
+		}
+	}
+	start := offset + n - int64(len(line))
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, n, errors.Wrap(ErrMalformed, "unexpected "+strconv.Quote(strings.TrimSpace(line)))
+	}
+
+	header := textproto.MIMEHeader{}
+	var key string
+	for {
+		line, err := br.ReadString('\n')
+		n += int64(len(line))
+		if err != nil {
+			return nil, n, errors.Wrap(ErrMalformed, err.Error())
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && key != "" {
+			values := header[key]
+			values[len(values)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, n, errors.Wrap(ErrMalformed, "invalid field "+strconv.Quote(line))
+		}
+		key = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(line[:i]))
+		header.Add(key, strings.TrimSpace(line[i+1:]))
+	}
+
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return nil, n, errors.Wrap(ErrMalformed, "invalid Content-Length")
+	}
+	rec := &Record{Header: header, Offset: start, Body: io.LimitReader(br, length)}
+
+	return rec, n + length, nil
+}
+
+// ReadAt reads the record at the offset of the WARC file, the caller must
+// close the record.
+func ReadAt(path string, offset int64) (*Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	rec, err := NewReader(f, gzipped(path), offset).Next()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	rec.closer = f
+
+	return rec, nil
+}
+
+func gzipped(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".gz")
+}
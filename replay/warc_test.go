@@ -0,0 +1,115 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package replay // import "github.com/wabarc/wayback/replay"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fixture struct {
+	typ, uri, date, block string
+}
+
+var fixtures = []fixture{
+	{typ: "warcinfo", date: "2023-01-02T03:04:05Z", block: "software: Wget/1.21\r\n"},
+	{typ: "request", uri: "https://example.com/", date: "2023-01-02T03:04:05Z", block: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+	{
+		typ: "response", uri: "<https://example.com/>", date: "2023-01-02T03:04:05Z",
+		block: "HTTP/1.1 200 OK\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" +
+			`<html><head><link rel="stylesheet" href="/style.css" integrity="sha384-foo"></head><body><a href="foo?b=2#top">foo</a><img src="https://cdn.example.org/a.png"></body></html>`,
+	},
+	{
+		typ: "response", uri: "https://example.com/style.css", date: "2023-01-02T03:04:06Z",
+		block: "HTTP/1.1 200 OK\r\nContent-Type: text/css\r\n\r\nbody { background: url('bg.png'); }",
+	},
+	{
+		typ: "response", uri: "https://example.com/old", date: "2023-01-02T03:04:07Z",
+		block: "HTTP/1.1 301 Moved Permanently\r\nLocation: /\r\nContent-Length: 0\r\n\r\n",
+	},
+}
+
+func (f fixture) String() string {
+	s := "WARC/1.0\r\nWARC-Type: " + f.typ + "\r\nWARC-Date: " + f.date + "\r\n"
+	if f.uri != "" {
+		s += "WARC-Target-URI: " + f.uri + "\r\n"
+	}
+	return s + fmt.Sprintf("Content-Length: %d\r\n\r\n%s\r\n\r\n", len(f.block), f.block)
+}
+
+// writeWARC writes the fixtures to a WARC file in the directory, compressed
+// by a gzip member per record if the name ends with .gz.
+func writeWARC(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for _, f := range fixtures {
+		if !gzipped(name) {
+			buf.WriteString(f.String())
+			continue
+		}
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(f.String())) // nolint:errcheck
+		zw.Close()
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReader(t *testing.T) {
+	for _, name := range []string{"example.warc", "example.warc.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := writeWARC(t, t.TempDir(), name)
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			var records []*Record
+			r := NewReader(f, gzipped(name), 0)
+			for {
+				rec, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Unexpected read record: %v", err)
+				}
+				records = append(records, rec)
+			}
+			if len(records) != len(fixtures) {
+				t.Fatalf("Unexpected records, got %d instead of %d", len(records), len(fixtures))
+			}
+			if uri := records[2].TargetURI(); uri != "https://example.com/" {
+				t.Errorf("Unexpected target uri, got %s", uri)
+			}
+
+			// Every record is read back at its offset.
+			for i, rec := range records {
+				got, err := ReadAt(path, rec.Offset)
+				if err != nil {
+					t.Fatalf("Unexpected read record at %d: %v", rec.Offset, err)
+				}
+				block, _ := io.ReadAll(got.Body)
+				got.Close()
+				if string(block) != fixtures[i].block {
+					t.Errorf("Unexpected block of record %d, got %q instead of %q", i, block, fixtures[i].block)
+				}
+				if got.Type() != fixtures[i].typ {
+					t.Errorf("Unexpected type of record %d, got %s instead of %s", i, got.Type(), fixtures[i].typ)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"path"
+	"strings"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+)
+
+// MsgUnauthorized is the reply text for a request that is refused by the access control lists.
+const MsgUnauthorized = "Sorry, you are not allowed to use this service. Please contact the administrator if you think this is a mistake."
+
+// Kinds of the subjects in the rules of the access control lists.
+const (
+	KindUser   = "user"   // User ID, e.g. Telegram user ID, Matrix user ID or IRC nick
+	KindChat   = "chat"   // Chat, channel or room ID
+	KindGuild  = "guild"  // Discord guild ID
+	KindTeam   = "team"   // Slack workspace ID
+	KindServer = "server" // Matrix homeserver or Mastodon instance
+	KindMask   = "mask"   // IRC hostmask, e.g. nick!user@host
+)
+
+// Subject represents the sender of a request to a service, the fields that
+// do not apply to the service are empty.
+type Subject struct {
+	Service string
+	User    string
+	Chat    string
+	Guild   string
+	Team    string
+	Server  string
+	Mask    string
+}
+
+func (s Subject) value(kind string) string {
+	switch kind {
+	case KindUser:
+		return s.User
+	case KindChat:
+		return s.Chat
+	case KindGuild:
+		return s.Guild
+	case KindTeam:
+		return s.Team
+	case KindServer:
+		return s.Server
+	case KindMask:
+		return s.Mask
+	}
+	return ""
+}
+
+// rule represents a rule of the access control lists, in the form of
+// "service:kind:pattern". The pattern is matched by path.Match, e.g.
+// "irc:mask:*!*@example.com".
+type rule struct {
+	service string
+	kind    string
+	pattern string
+}
+
+func parseRule(s string) (rule, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return rule{}, errors.New("invalid acl rule %q, must be in the form of service:kind:pattern", s)
+	}
+	r := rule{service: strings.ToLower(parts[0]), kind: strings.ToLower(parts[1]), pattern: parts[2]}
+	switch r.service {
+	case metrics.ServiceTelegram, metrics.ServiceDiscord, metrics.ServiceSlack, metrics.ServiceMatrix,
+		metrics.ServiceMastodon, metrics.ServiceIRC, metrics.ServiceTwitter:
+	default:
+		return rule{}, errors.New("invalid acl rule %q, unknown service %s", s, r.service)
+	}
+	switch r.kind {
+	case KindUser, KindChat, KindGuild, KindTeam:
+	case KindServer, KindMask:
+		// Hostnames are case-insensitive.
+		r.pattern = strings.ToLower(r.pattern)
+	default:
+		return rule{}, errors.New("invalid acl rule %q, unknown kind %s", s, r.kind)
+	}
+	if _, err := path.Match(r.pattern, ""); err != nil {
+		return rule{}, errors.New("invalid acl rule %q, malformed pattern", s)
+	}
+	return r, nil
+}
+
+func (r rule) match(s Subject) bool {
+	if r.service != s.Service {
+		return false
+	}
+	v := s.value(r.kind)
+	if v == "" {
+		return false
+	}
+	if r.kind == KindServer || r.kind == KindMask {
+		v = strings.ToLower(v)
+	}
+	ok, _ := path.Match(r.pattern, v)
+	return ok
+}
+
+// ACL represents the access control lists of the services. A nil ACL
+// allows everyone.
+type ACL struct {
+	allow  []rule
+	deny   []rule
+	admins []rule
+}
+
+// NewACL returns the access control lists of the given rules.
+func NewACL(allow, deny, admins []string) (*ACL, error) {
+	acl := &ACL{}
+	for _, list := range []struct {
+		rules []string
+		dst   *[]rule
+	}{{allow, &acl.allow}, {deny, &acl.deny}, {admins, &acl.admins}} {
+		for _, s := range list.rules {
+			r, err := parseRule(s)
+			if err != nil {
+				return nil, err
+			}
+			*list.dst = append(*list.dst, r)
+		}
+	}
+	return acl, nil
+}
+
+// ConfiguredACL returns the access control lists of the configuration.
+func ConfiguredACL() (*ACL, error) {
+	return NewACL(config.Opts.ACLAllow(), config.Opts.ACLDeny(), config.Opts.ACLAdmins())
+}
+
+// Authorize returns the role of the subject and whether it is allowed to use
+// the service. The admins are always allowed; otherwise the subject must not
+// match any deny rule, and must match an allow rule if the service has any.
+// If the service has no admin rules, every allowed subject is an admin. The
+// refused requests are counted in the metrics.
+func (acl *ACL) Authorize(s Subject) (Role, bool) {
+	if acl == nil {
+		return RoleAdmin, true
+	}
+	if matchRules(acl.admins, s) {
+		return RoleAdmin, true
+	}
+	allowed := !matchRules(acl.deny, s) && (!hasRules(acl.allow, s.Service) || matchRules(acl.allow, s))
+	if !allowed {
+		logger.Warn("%s request from %+v is refused by acl", s.Service, s)
+		metrics.IncrementWayback(s.Service, metrics.StatusDenied)
+		return RoleUser, false
+	}
+	if !hasRules(acl.admins, s.Service) {
+		return RoleAdmin, true
+	}
+	return RoleUser, true
+}
+
+// HasAdmins reports whether the service has admin rules, otherwise every
+// allowed subject of it is an admin.
+func (acl *ACL) HasAdmins(service string) bool {
+	return acl != nil && hasRules(acl.admins, service)
+}
+
+func matchRules(rules []rule, s Subject) bool {
+	for _, r := range rules {
+		if r.match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRules(rules []rule, service string) bool {
+	for _, r := range rules {
+		if r.service == service {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"testing"
+
+	"github.com/wabarc/wayback/metrics"
+)
+
+func TestNewACL(t *testing.T) {
+	var tests = []struct {
+		rule  string
+		valid bool
+	}{
+		{rule: "telegram:user:123", valid: true},
+		{rule: "Discord:Guild:4567*", valid: true},
+		{rule: "irc:mask:*!*@Example.com", valid: true},
+		{rule: "telegram:user"},
+		{rule: "telegram:user:"},
+		{rule: "foo:user:123"},
+		{rule: "telegram:foo:123"},
+		{rule: "telegram:user:[123"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			_, err := NewACL([]string{test.rule}, nil, nil)
+			if (err == nil) != test.valid {
+				t.Errorf("Unexpected parse rule %q, got error %v", test.rule, err)
+			}
+		})
+	}
+}
+
+func TestACLAuthorize(t *testing.T) {
+	acl, err := NewACL(
+		[]string{"telegram:chat:-100*", "matrix:server:example.org", "irc:mask:*!*@*.example.com"},
+		[]string{"telegram:user:666", "discord:guild:13", "matrix:user:@spam:example.org"},
+		[]string{"telegram:user:42", "irc:mask:admin!*@*"},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected new acl: %v", err)
+	}
+
+	var tests = []struct {
+		name    string
+		subject Subject
+		role    Role
+		allowed bool
+	}{
+		{name: "telegram admin", subject: Subject{Service: metrics.ServiceTelegram, User: "42"}, role: RoleAdmin, allowed: true},
+		{name: "telegram allowed chat", subject: Subject{Service: metrics.ServiceTelegram, User: "1", Chat: "-1001"}, role: RoleUser, allowed: true},
+		{name: "telegram denied user in allowed chat", subject: Subject{Service: metrics.ServiceTelegram, User: "666", Chat: "-1001"}},
+		{name: "telegram chat not allowed", subject: Subject{Service: metrics.ServiceTelegram, User: "1", Chat: "1"}},
+		{name: "discord denied guild", subject: Subject{Service: metrics.ServiceDiscord, User: "1", Guild: "13"}},
+		{name: "discord without allow rules", subject: Subject{Service: metrics.ServiceDiscord, User: "1", Guild: "14"}, role: RoleAdmin, allowed: true},
+		{name: "matrix allowed server", subject: Subject{Service: metrics.ServiceMatrix, User: "@foo:example.org", Server: "Example.org"}, role: RoleAdmin, allowed: true},
+		{name: "matrix denied user", subject: Subject{Service: metrics.ServiceMatrix, User: "@spam:example.org", Server: "example.org"}},
+		{name: "matrix server not allowed", subject: Subject{Service: metrics.ServiceMatrix, User: "@foo:example.com", Server: "example.com"}},
+		{name: "irc admin", subject: Subject{Service: metrics.ServiceIRC, User: "admin", Mask: "admin!~admin@other.net"}, role: RoleAdmin, allowed: true},
+		{name: "irc allowed mask", subject: Subject{Service: metrics.ServiceIRC, User: "foo", Mask: "foo!~foo@irc.example.com"}, role: RoleUser, allowed: true},
+		{name: "irc mask not allowed", subject: Subject{Service: metrics.ServiceIRC, User: "foo", Mask: "foo!~foo@other.net"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			role, allowed := acl.Authorize(test.subject)
+			if allowed != test.allowed {
+				t.Fatalf("Unexpected authorize, got %t instead of %t", allowed, test.allowed)
+			}
+			if allowed && role != test.role {
+				t.Errorf("Unexpected role, got %d instead of %d", role, test.role)
+			}
+		})
+	}
+
+	var nilACL *ACL
+	if role, ok := nilACL.Authorize(Subject{Service: metrics.ServiceSlack, User: "U1"}); !ok || role != RoleAdmin {
+		t.Errorf("Unexpected authorize with nil acl, got %d %t instead of %d true", role, ok, RoleAdmin)
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/wabarc/wayback"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+)
+
+// Names of the commands shared by the services.
+const (
+	CommandHelp     = "help"
+	CommandPlayback = "playback"
+	CommandStatus   = "status"
+	CommandCancel   = "cancel"
+	CommandMetrics  = "metrics"
+	CommandWatch    = "watch"
+	CommandUnwatch  = "unwatch"
+	CommandWatches  = "watches"
+	CommandHistory  = "history"
+)
+
+// MsgPermissionDenied is the reply text for a command that the sender is not allowed to use.
+const MsgPermissionDenied = "Sorry, you are not allowed to use this command."
+
+// MsgWatchUnsupported is the reply text for a watch command sent from where alerts can not be sent to.
+const MsgWatchUnsupported = "Sorry, URL watches are not supported here."
+
+// Role represents the permission level of a command sender.
+type Role int
+
+const (
+	// RoleUser is the role of everyone who can use the service.
+	RoleUser Role = iota
+	// RoleAdmin is the role of the administrators of the service.
+	RoleAdmin
+)
+
+// Arg represents an argument of a command.
+type Arg struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// Request represents a command sent to a service.
+type Request struct {
+	// Service is the name of the service that receives the command, see metrics.Service*.
+	Service string
+	// User is the identifier of the sender.
+	User string
+	// Chat is the identifier of the chat that the command is sent from, the
+	// alerts of the watches go there. It is empty if the service can not
+	// send messages to the chat later.
+	Chat string
+	// Role is the permission level of the sender.
+	Role Role
+	// Prefix is the prefix of the commands in the service, e.g. "/".
+	Prefix string
+	// Args is the text after the command name.
+	Args string
+}
+
+// Fields returns the arguments of the request split around whitespace.
+func (r *Request) Fields() []string {
+	return strings.Fields(r.Args)
+}
+
+// Handler handles a command request and returns the reply text, nothing is
+// replied if the text is empty.
+type Handler func(ctx context.Context, req *Request) (string, error)
+
+// Command represents a bot command. The services adapt it to their native
+// form, e.g. Telegram bot commands, Discord and Slack slash commands, or
+// messages with a prefix in IRC and Matrix.
+type Command struct {
+	Name        string
+	Aliases     []string
+	Description string
+	Args        []Arg
+	// Role is the minimum role of the sender to use the command.
+	Role    Role
+	Handler Handler
+}
+
+// Usage returns the usage of the command, e.g. "/status <id>".
+func (c *Command) Usage(prefix string) string {
+	usage := prefix + c.Name
+	for _, arg := range c.Args {
+		if arg.Required {
+			usage += " <" + arg.Name + ">"
+		} else {
+			usage += " [" + arg.Name + "]"
+		}
+	}
+	return usage
+}
+
+// Commands is a registry of the bot commands, in the order of registration.
+type Commands struct {
+	list []*Command
+}
+
+// NewCommands returns a registry with the given commands.
+func NewCommands(cmds ...*Command) *Commands {
+	c := &Commands{}
+	for _, cmd := range cmds {
+		c.Register(cmd)
+	}
+	return c
+}
+
+// Register adds a command to the registry, it replaces the command with the
+// same name if there is one.
+func (c *Commands) Register(cmd *Command) {
+	for i, old := range c.list {
+		if old.Name == cmd.Name {
+			c.list[i] = cmd
+			return
+		}
+	}
+	c.list = append(c.list, cmd)
+}
+
+// Lookup returns the command of the given name or alias, the name is case-insensitive.
+func (c *Commands) Lookup(name string) (*Command, bool) {
+	name = strings.ToLower(name)
+	for _, cmd := range c.list {
+		if cmd.Name == name {
+			return cmd, true
+		}
+		for _, alias := range cmd.Aliases {
+			if alias == name {
+				return cmd, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// List returns the registered commands.
+func (c *Commands) List() []*Command {
+	return c.list
+}
+
+// Help returns the list of the commands with their usage and description.
+func (c *Commands) Help(prefix string) string {
+	var b strings.Builder
+	for _, cmd := range c.list {
+		fmt.Fprintf(&b, "%s - %s\n", cmd.Usage(prefix), cmd.Description)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// Run checks the role of the sender and the required arguments of the
+// command, and calls the handler of the command.
+func (c *Commands) Run(ctx context.Context, cmd *Command, req *Request) (string, error) {
+	if req.Role < cmd.Role {
+		return MsgPermissionDenied, nil
+	}
+	fields := req.Fields()
+	for i, arg := range cmd.Args {
+		if arg.Required && len(fields) <= i {
+			return "Usage: " + cmd.Usage(req.Prefix), nil
+		}
+	}
+	if cmd.Handler == nil {
+		return "", errors.New("command %s has no handler", cmd.Name)
+	}
+	return cmd.Handler(ctx, req)
+}
+
+// ParseCommand returns the name and arguments of the first command in the
+// text, a command is a word with the prefix at the beginning of a line,
+// e.g. "/playback https://example.com". A bot username suffix of the name
+// is removed, e.g. "/help@wayback_bot". The name is empty if there is no
+// command in the text.
+func ParseCommand(prefix, text string) (name, args string) {
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		line = line[len(prefix):]
+		end := strings.IndexFunc(line, unicode.IsSpace)
+		if end < 0 {
+			end = len(line)
+		}
+		name = line[:end]
+		if at := strings.Index(name, "@"); at > 0 {
+			name = name[:at]
+		}
+		if !isCommandName(name) {
+			continue
+		}
+		rest := line[end:] + strings.Join(lines[i+1:], "")
+		return strings.ToLower(name), strings.TrimSpace(rest)
+	}
+	return "", ""
+}
+
+func isCommandName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultCommands returns the registry of the commands shared by the services,
+// the help command replies the helptext, or the list of commands if it is empty.
+func DefaultCommands(pool *pooling.Pool, helptext string) *Commands {
+	c := NewCommands()
+	c.Register(&Command{
+		Name:        CommandHelp,
+		Aliases:     []string{"start"},
+		Description: "Show help information",
+		Handler: func(_ context.Context, req *Request) (string, error) {
+			if helptext != "" {
+				return helptext, nil
+			}
+			return c.Help(req.Prefix), nil
+		},
+	})
+	c.Register(&Command{
+		Name:        CommandPlayback,
+		Description: "Playback archived url",
+		Args:        []Arg{{Name: "urls", Description: "Send me URLs to playback...", Required: true}},
+		Handler:     playbackHandler,
+	})
+	c.Register(&Command{
+		Name:        CommandStatus,
+		Description: "Show status of a wayback job",
+		Args:        []Arg{{Name: "id", Description: "Job ID", Required: true}},
+		Handler: func(_ context.Context, req *Request) (string, error) {
+			return JobStatus(pool, req), nil
+		},
+	})
+	c.Register(&Command{
+		Name:        CommandCancel,
+		Description: "Cancel a wayback job",
+		Args:        []Arg{{Name: "id", Description: "Job ID", Required: true}},
+		Handler: func(_ context.Context, req *Request) (string, error) {
+			return CancelJob(pool, req), nil
+		},
+	})
+	if config.Opts.EnabledMetrics() {
+		c.Register(&Command{
+			Name:        CommandMetrics,
+			Description: "Show service metrics",
+			Role:        RoleAdmin,
+			Handler: func(_ context.Context, _ *Request) (string, error) {
+				return metrics.Gather.Export("wayback"), nil
+			},
+		})
+	}
+	return c
+}
+
+// playbackHandler replies the playback results in plain text, the services
+// that have a richer form of playback handle it natively.
+func playbackHandler(ctx context.Context, req *Request) (string, error) {
+	urls := MatchURL(req.Args)
+	if len(urls) == 0 {
+		return "Please send me URLs to playback...", nil
+	}
+	metrics.IncrementPlayback(req.Service, metrics.StatusRequest)
+	cols, err := wayback.Playback(ctx, urls...)
+	if err != nil {
+		metrics.IncrementPlayback(req.Service, metrics.StatusFailure)
+		return "", errors.Wrap(err, "playback failed")
+	}
+	metrics.IncrementPlayback(req.Service, metrics.StatusSuccess)
+
+	lines := make([]string, 0, len(cols))
+	for _, col := range cols {
+		lines = append(lines, fmt.Sprintf("%s: %s", config.SlotName(col.Arc), col.Dst))
+	}
+	return strings.Join(lines, "\n"), nil
+}
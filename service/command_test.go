@@ -0,0 +1,207 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+)
+
+func TestParseCommand(t *testing.T) {
+	var tests = []struct {
+		prefix string
+		text   string
+		name   string
+		args   string
+	}{
+		{prefix: "/", text: "/help", name: "help"},
+		{prefix: "/", text: "/Status@wayback_bot  foo ", name: "status", args: "foo"},
+		{prefix: "/", text: "/playback https://example.com\nhttps://example.org", name: "playback", args: "https://example.com\nhttps://example.org"},
+		{prefix: "/", text: "> quoted\n /playback https://example.com", name: "playback", args: "https://example.com"},
+		{prefix: "/", text: "https://example.com/playback"},
+		{prefix: "/", text: "/path/to/file"},
+		{prefix: "/", text: "/"},
+		{prefix: "!", text: "!cancel foo", name: "cancel", args: "foo"},
+		{prefix: "!", text: "/cancel foo"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			name, args := ParseCommand(test.prefix, test.text)
+			if name != test.name || args != test.args {
+				t.Errorf("Unexpected parse command, got %q %q instead of %q %q", name, args, test.name, test.args)
+			}
+		})
+	}
+}
+
+func TestCommands(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ENABLE_METRICS", "true")
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	ctx := context.Background()
+	c := DefaultCommands(pooling.New(ctx, 1), "")
+	c.Register(&Command{
+		Name:        "secret",
+		Description: "Admin only",
+		Role:        RoleAdmin,
+		Handler:     func(_ context.Context, _ *Request) (string, error) { return "granted", nil },
+	})
+
+	var tests = []struct {
+		name string
+		req  *Request
+		want string
+	}{
+		{name: "start", req: &Request{Prefix: "/"}, want: "/help - Show help information\n/playback <urls> - Playback archived url\n" +
+			"/status <id> - Show status of a wayback job\n/cancel <id> - Cancel a wayback job\n/metrics - Show service metrics\n/secret - Admin only"},
+		{name: "status", req: &Request{Prefix: "!"}, want: "Usage: !status <id>"},
+		{name: "status", req: &Request{Prefix: "/", Args: "foo"}, want: MsgJobNotFound},
+		{name: "cancel", req: &Request{Prefix: "/", Args: "foo"}, want: MsgJobNotFound},
+		{name: "playback", req: &Request{Prefix: "/", Args: "no urls"}, want: "Please send me URLs to playback..."},
+		{name: "secret", req: &Request{Prefix: "/"}, want: MsgPermissionDenied},
+		{name: "secret", req: &Request{Prefix: "/", Role: RoleAdmin}, want: "granted"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd, ok := c.Lookup(test.name)
+			if !ok {
+				t.Fatalf("Unexpected lookup command %s, not found", test.name)
+			}
+			got, err := c.Run(ctx, cmd, test.req)
+			if err != nil {
+				t.Fatalf("Unexpected run command: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Unexpected reply, got %q instead of %q", got, test.want)
+			}
+		})
+	}
+
+	if _, ok := c.Lookup("unknown"); ok {
+		t.Errorf("Unexpected lookup unknown command, got a command")
+	}
+}
+
+func TestDefaultCommandsWithoutMetrics(t *testing.T) {
+	os.Clearenv()
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	c := DefaultCommands(pooling.New(context.Background(), 1), "Hi there.")
+	if _, ok := c.Lookup(CommandMetrics); ok {
+		t.Errorf("Unexpected metrics command, metrics are disabled")
+	}
+	cmd, _ := c.Lookup(CommandHelp)
+	if got, _ := c.Run(context.Background(), cmd, &Request{Prefix: "/"}); got != "Hi there." {
+		t.Errorf("Unexpected help, got %q instead of %q", got, "Hi there.")
+	}
+}
+
+func TestJobCommandsOwnership(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("WAYBACK_ACL_ADMINS", "slack:user:baz")
+	defer os.Unsetenv("WAYBACK_ACL_ADMINS")
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	ctx := context.Background()
+	pool := pooling.New(ctx, 1)
+	c := DefaultCommands(pool, "")
+	id := pool.Put(pooling.Bucket{Service: "telegram", User: "foo"})
+	internal := pool.Put(pooling.Bucket{Service: "telegram"})
+
+	var tests = []struct {
+		name string
+		req  *Request
+		want string
+	}{
+		{name: CommandStatus, req: &Request{Service: "telegram", User: "bar", Args: id}, want: MsgJobNotFound},
+		{name: CommandStatus, req: &Request{Service: "discord", User: "foo", Args: id}, want: MsgJobNotFound},
+		{name: CommandStatus, req: &Request{Service: "telegram", User: "foo", Args: id}, want: "Job " + id + " is queued."},
+		// Every allowed sender is an admin of a service without admin rules.
+		{name: CommandStatus, req: &Request{Service: "telegram", User: "bar", Role: RoleAdmin, Args: id}, want: MsgJobNotFound},
+		{name: CommandCancel, req: &Request{Service: "telegram", User: "bar", Role: RoleAdmin, Args: id}, want: MsgJobNotFound},
+		{name: CommandCancel, req: &Request{Service: "telegram", User: "bar", Args: id}, want: MsgJobNotFound},
+		{name: CommandCancel, req: &Request{Service: "telegram", User: "foo", Args: id}, want: "Job " + id + " cancelled."},
+		{name: CommandStatus, req: &Request{Service: "telegram", User: "", Args: internal}, want: MsgJobNotFound},
+		{name: CommandCancel, req: &Request{Service: "telegram", User: "foo", Args: internal}, want: MsgJobNotFound},
+		{name: CommandCancel, req: &Request{Service: "slack", User: "baz", Role: RoleAdmin, Args: internal}, want: "Job " + internal + " cancelled."},
+	}
+
+	for _, test := range tests {
+		cmd, _ := c.Lookup(test.name)
+		got, err := c.Run(ctx, cmd, test.req)
+		if err != nil {
+			t.Fatalf("Unexpected run command: %v", err)
+		}
+		if got != test.want {
+			t.Errorf("Unexpected reply of %s by %s %q, got %q instead of %q", test.name, test.req.Service, test.req.User, got, test.want)
+		}
+	}
+}
+
+func TestMetricsCommandRole(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ENABLE_METRICS", "true")
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	c := DefaultCommands(pooling.New(context.Background(), 1), "")
+	cmd, ok := c.Lookup(CommandMetrics)
+	if !ok {
+		t.Fatalf("Unexpected lookup of %s, metrics are enabled", CommandMetrics)
+	}
+	acl, err := NewACL(nil, nil, []string{"telegram:user:42"})
+	if err != nil {
+		t.Fatalf("Unexpected new acl: %v", err)
+	}
+
+	// The role of a request must come from the access control lists, so a
+	// service without admin rules keeps /metrics usable by its users.
+	var tests = []struct {
+		name    string
+		subject Subject
+		denied  bool
+	}{
+		{name: "telegram admin", subject: Subject{Service: metrics.ServiceTelegram, User: "42"}},
+		{name: "telegram user", subject: Subject{Service: metrics.ServiceTelegram, User: "1"}, denied: true},
+		{name: "discord without admin rules", subject: Subject{Service: metrics.ServiceDiscord, User: "1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			role, _ := acl.Authorize(test.subject)
+			req := &Request{Service: test.subject.Service, User: test.subject.User, Role: role, Prefix: "/"}
+			got, err := c.Run(context.Background(), cmd, req)
+			if err != nil {
+				t.Fatalf("Unexpected run command: %v", err)
+			}
+			if denied := got == MsgPermissionDenied; denied != test.denied {
+				t.Errorf("Unexpected permission of %s, got denied %t instead of %t", CommandMetrics, denied, test.denied)
+			}
+		})
+	}
+}
@@ -32,17 +32,24 @@ import (
 // ErrServiceClosed is returned by the Service's Serve method after a call to Shutdown.
 var ErrServiceClosed = errors.New("discord: Service closed")
 
+// messageFlagsEphemeral is the flag of the interaction responses that only
+// the user of the interaction can see, the same as MessageFlagsEphemeral of
+// the later releases of discordgo.
+const messageFlagsEphemeral = 1 << 6
+
 // Discord represents a discord service in the application.
 type Discord struct {
 	ctx context.Context
 
-	bot   *discord.Session
-	store *storage.Storage
-	pool  *pooling.Pool
+	bot      *discord.Session
+	store    storage.Storage
+	pool     *pooling.Pool
+	commands *service.Commands
+	acl      *service.ACL
 }
 
 // New returns a Discord struct.
-func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Discord {
+func New(ctx context.Context, store storage.Storage, pool *pooling.Pool) *Discord {
 	if config.Opts.DiscordBotToken() == "" {
 		logger.Fatal("missing required environment variable")
 	}
@@ -61,15 +68,26 @@ func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Disco
 	//     bot.LogLevel = discord.LogDebug
 	// }
 
+	acl, err := service.ConfiguredACL()
+	if err != nil {
+		logger.Fatal("parse acl failed: %v", err)
+	}
+
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
+	commands := service.DefaultCommands(pool, config.Opts.DiscordHelptext())
+	service.RegisterWatchCommands(commands, store)
+	service.RegisterHistoryCommand(commands, store)
+
 	return &Discord{
-		ctx:   ctx,
-		bot:   bot,
-		store: store,
-		pool:  pool,
+		ctx:      ctx,
+		bot:      bot,
+		store:    store,
+		pool:     pool,
+		commands: commands,
+		acl:      acl,
 	}
 }
 
@@ -87,20 +105,37 @@ func (d *Discord) Serve() (err error) {
 		logger.Info("channel name: %s, channel id: %s", color.BlueString(channel.Name), color.BlueString(channel.ID))
 	}
 
+	service.RegisterNotifier(metrics.ServiceDiscord, service.NotifierFunc(d.notify))
+
 	commandHandlers := d.commandHandlers()
 	buttonHandlers := d.buttonHandlers()
 	d.bot.AddHandler(func(s *discord.Session, i *discord.InteractionCreate) {
+		role, ok := d.acl.Authorize(service.Subject{Service: metrics.ServiceDiscord, User: interactionUser(i), Chat: i.ChannelID, Guild: i.GuildID})
+		if !ok {
+			// nolint:errcheck
+			s.InteractionRespond(i.Interaction, &discord.InteractionResponse{
+				Type: discord.InteractionResponseChannelMessageWithSource,
+				Data: &discord.InteractionResponseData{
+					Content: service.MsgUnauthorized,
+					Flags:   messageFlagsEphemeral,
+				},
+			})
+			return
+		}
 		switch i.Type {
 		case discord.InteractionMessageComponent:
 			// Type for button press will be always InteractionButton (3)
-			// For playback
-			if h, ok := buttonHandlers["playback"]; ok {
+			name := "playback"
+			if strings.HasPrefix(i.MessageComponentData().CustomID, service.HistoryPrefix) {
+				name = service.CommandHistory
+			}
+			if h, ok := buttonHandlers[name]; ok {
 				h(s, i)
 			}
 		case discord.InteractionApplicationCommand:
 			// Handle command
 			if h, ok := commandHandlers[i.ApplicationCommandData().Name]; ok {
-				h(s, i)
+				h(s, i, role)
 			}
 		default:
 			logger.Warn("skip %v", i.Type)
@@ -114,6 +149,14 @@ func (d *Discord) Serve() (err error) {
 		if m.Author.ID == s.State.User.ID {
 			return
 		}
+		// Ignore messages from channels without mention
+		if m.GuildID != "" && !d.isMention(m.Content) {
+			return
+		}
+		if _, ok := d.acl.Authorize(service.Subject{Service: metrics.ServiceDiscord, User: author(m), Chat: m.ChannelID, Guild: m.GuildID}); !ok {
+			d.reply(m, service.MsgUnauthorized) // nolint:errcheck
+			return
+		}
 		// Reply message and mention bot on the channel
 		ref := m.Message.MessageReference
 		if ref != nil {
@@ -163,34 +206,44 @@ func (d *Discord) Shutdown() error {
 	return nil
 }
 
-func (d *Discord) commandHandlers() map[string]func(*discord.Session, *discord.InteractionCreate) {
-	return map[string]func(s *discord.Session, i *discord.InteractionCreate){
-		"help": func(s *discord.Session, i *discord.InteractionCreate) {
-			// nolint:errcheck
-			s.InteractionRespond(i.Interaction, &discord.InteractionResponse{
-				Type: discord.InteractionResponseChannelMessageWithSource,
-				Data: &discord.InteractionResponseData{
-					Content: config.Opts.DiscordHelptext(),
-				},
-			})
-		},
-		"playback": func(s *discord.Session, i *discord.InteractionCreate) {
-			d.playback(s, i) // nolint:errcheck
-		},
-		"metrics": func(s *discord.Session, i *discord.InteractionCreate) {
-			stats := metrics.Gather.Export("wayback")
-			if !config.Opts.EnabledMetrics() || stats == "" {
+func (d *Discord) commandHandlers() map[string]func(*discord.Session, *discord.InteractionCreate, service.Role) {
+	handlers := make(map[string]func(*discord.Session, *discord.InteractionCreate, service.Role))
+	for _, cmd := range d.commands.List() {
+		cmd := cmd
+		if cmd.Name == service.CommandPlayback {
+			handlers[cmd.Name] = func(s *discord.Session, i *discord.InteractionCreate, _ service.Role) {
+				d.playback(s, i) // nolint:errcheck
+			}
+			continue
+		}
+		if cmd.Name == service.CommandHistory {
+			handlers[cmd.Name] = func(s *discord.Session, i *discord.InteractionCreate, _ service.Role) {
+				if err := d.history(s, i, optionValues(i)); err != nil {
+					logger.Error("run command %s failed: %v", cmd.Name, err)
+				}
+			}
+			continue
+		}
+		handlers[cmd.Name] = func(s *discord.Session, i *discord.InteractionCreate, role service.Role) {
+			req := &service.Request{Service: metrics.ServiceDiscord, User: interactionUser(i), Chat: i.ChannelID, Role: role, Prefix: "/", Args: optionValues(i)}
+			text, err := d.commands.Run(d.ctx, cmd, req)
+			if err != nil {
+				logger.Error("run command %s failed: %v", cmd.Name, err)
+				return
+			}
+			if text == "" {
 				return
 			}
 			// nolint:errcheck
 			s.InteractionRespond(i.Interaction, &discord.InteractionResponse{
 				Type: discord.InteractionResponseChannelMessageWithSource,
 				Data: &discord.InteractionResponseData{
-					Content: stats,
+					Content: text,
 				},
 			})
-		},
+		}
 	}
+	return handlers
 }
 
 func (d *Discord) buttonHandlers() map[string]func(*discord.Session, *discord.InteractionCreate) {
@@ -204,7 +257,19 @@ func (d *Discord) buttonHandlers() map[string]func(*discord.Session, *discord.In
 			}
 
 			// Query playback callback data from database
-			pb, err := d.store.Playback(id)
+			pb, err := service.Playback(d.store, id)
+			if errors.Is(err, service.ErrPlaybackExpired) {
+				logger.Debug("playback %d expired", id)
+				// nolint:errcheck
+				s.InteractionRespond(i.Interaction, &discord.InteractionResponse{
+					Type: discord.InteractionResponseChannelMessageWithSource,
+					Data: &discord.InteractionResponseData{
+						Content: service.MsgPlaybackExpired,
+						Flags:   messageFlagsEphemeral,
+					},
+				})
+				return
+			}
 			if err != nil {
 				logger.Error("query playback data failed: %v", err)
 				metrics.IncrementWayback(metrics.ServiceDiscord, metrics.StatusFailure)
@@ -230,10 +295,22 @@ func (d *Discord) buttonHandlers() map[string]func(*discord.Session, *discord.In
 			// nolint:errcheck
 			s.ChannelTyping(i.Message.ChannelID)
 
-			i.Message.Content = helper.Byte2String(data)
-			d.process(&discord.MessageCreate{Message: i.Message})       // nolint:errcheck
+			// The message of the button is sent by the bot, process it on
+			// behalf of the user who pressed the button.
+			m := *i.Message
+			m.Content = helper.Byte2String(data)
+			if u := interactionAuthor(i); u != nil {
+				m.Author = u
+			}
+			d.process(&discord.MessageCreate{Message: &m})              // nolint:errcheck
 			s.InteractionResponseDelete(s.State.User.ID, i.Interaction) // nolint:errcheck
 		},
+		service.CommandHistory: func(s *discord.Session, i *discord.InteractionCreate) {
+			args := strings.TrimPrefix(i.MessageComponentData().CustomID, service.HistoryPrefix)
+			if err := d.history(s, i, args); err != nil {
+				logger.Error("handle history button failed: %v", err)
+			}
+		},
 	}
 }
 
@@ -243,46 +320,70 @@ func (d *Discord) process(m *discord.MessageCreate) (err error) {
 	logger.Debug("content: %s", content)
 
 	urls := service.MatchURL(content)
+	files := d.files(m)
 
 	switch {
 	case m.GuildID != "" && !d.isMention(content):
 		// don't process message from channel and without mention
 		logger.Debug("message from channel and without mention, skipped")
+	case len(files) > 0:
+		// The URLs in the content of the files are archived as well.
+		if err := d.archiveFiles(m, files); err != nil || len(urls) == 0 {
+			return err
+		}
+		return d.archiveURLs(m, urls)
 	case len(urls) == 0:
 		logger.Warn("archives failure, URL no found.")
 		metrics.IncrementWayback(metrics.ServiceDiscord, metrics.StatusRequest)
 		d.reply(m, "URL no found.") // nolint:errcheck
 	default:
-		metrics.IncrementWayback(metrics.ServiceDiscord, metrics.StatusRequest)
-		if m, err = d.reply(m, "Queue..."); err != nil {
-			logger.Error("reply queue failed: %v", err)
-			return
-		}
-		bucket := pooling.Bucket{
-			Request: func(ctx context.Context) error {
-				logger.Debug("content: %v", urls)
-				if err := d.wayback(ctx, m, urls); err != nil {
-					logger.Error("archives failed: %v", err)
+		return d.archiveURLs(m, urls)
+	}
+	return nil
+}
+
+// archiveURLs enqueues a job that archives the URLs of the message, and
+// replies with the results.
+func (d *Discord) archiveURLs(m *discord.MessageCreate, urls []*url.URL) error {
+	metrics.IncrementWayback(metrics.ServiceDiscord, metrics.StatusRequest)
+	id := pooling.NewID()
+	// The message is replaced by the reply, keep the sender of it.
+	user := author(m)
+	m, err := d.reply(m, service.MsgWaybackQueued(id))
+	if err != nil {
+		logger.Error("reply queue failed: %v", err)
+		return err
+	}
+	bucket := pooling.Bucket{
+		ID:      id,
+		Service: metrics.ServiceDiscord,
+		User:    user,
+		URLs:    urls,
+		Request: func(ctx context.Context) error {
+			logger.Debug("content: %v", urls)
+			if err := d.wayback(ctx, m, user, urls); err != nil {
+				logger.Error("archives failed: %v", err)
+				if errors.IsRetryable(err) {
 					// nolint:errcheck
 					d.reply(m, service.MsgWaybackRetrying)
-					return err
 				}
-				metrics.IncrementWayback(metrics.ServiceDiscord, metrics.StatusSuccess)
-				return nil
-			},
-			Fallback: func(_ context.Context) error {
-				// nolint:errcheck
-				d.reply(m, service.MsgWaybackTimeout)
-				metrics.IncrementWayback(metrics.ServiceDiscord, metrics.StatusFailure)
-				return nil
-			},
-		}
-		d.pool.Put(bucket)
+				return err
+			}
+			metrics.IncrementWayback(metrics.ServiceDiscord, metrics.StatusSuccess)
+			return nil
+		},
+		Fallback: func(_ context.Context, err error) error {
+			// nolint:errcheck
+			d.reply(m, service.MsgWaybackFailed(err))
+			metrics.IncrementWayback(metrics.ServiceDiscord, metrics.StatusFailure)
+			return nil
+		},
 	}
+	d.pool.Put(bucket)
 	return nil
 }
 
-func (d *Discord) wayback(ctx context.Context, m *discord.MessageCreate, urls []*url.URL) error {
+func (d *Discord) wayback(ctx context.Context, m *discord.MessageCreate, user string, urls []*url.URL) error {
 	stage, err := d.edit(m, "Archiving...")
 	if err != nil {
 		logger.Error("send archiving message failed: %v", err)
@@ -291,6 +392,7 @@ func (d *Discord) wayback(ctx context.Context, m *discord.MessageCreate, urls []
 	logger.Debug("send archiving message result: %#v", stage)
 
 	do := func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
+		service.Record(d.store, cols, rdx, metrics.ServiceDiscord, user)
 		replyText := render.ForReply(&render.Discord{Cols: cols}).String()
 		logger.Debug("reply text, %s", replyText)
 
@@ -420,7 +522,7 @@ func (d *Discord) edit(m *discord.MessageCreate, text string) (*discord.MessageC
 }
 
 func (d *Discord) setCommands(guild string) (err error) {
-	if _, err = d.bot.ApplicationCommandBulkOverwrite(d.bot.State.User.ID, guild, requires()); err != nil {
+	if _, err = d.bot.ApplicationCommandBulkOverwrite(d.bot.State.User.ID, guild, d.requires()); err != nil {
 		logger.Error("overwrite commands failed: %v", err)
 		return err
 	}
@@ -429,35 +531,73 @@ func (d *Discord) setCommands(guild string) (err error) {
 	return nil
 }
 
-func requires() (commands []*discord.ApplicationCommand) {
-	if config.Opts.DiscordHelptext() != "" {
-		commands = append(commands, &discord.ApplicationCommand{
-			Name:        "help",
-			Description: "Show help information",
-		})
-	}
-	if config.Opts.EnabledMetrics() {
-		commands = append(commands, &discord.ApplicationCommand{
-			Name:        "metrics",
-			Description: "Show service metrics",
-		})
-	}
-	commands = append(commands, &discord.ApplicationCommand{
-		Name:        "playback",
-		Description: "Playback archived url",
-		Options: []*discord.ApplicationCommandOption{
-			{
+// requires returns the application commands of the registered commands,
+// the arguments are string options.
+func (d *Discord) requires() (commands []*discord.ApplicationCommand) {
+	for _, cmd := range d.commands.List() {
+		command := &discord.ApplicationCommand{
+			Name:        cmd.Name,
+			Description: cmd.Description,
+		}
+		for _, arg := range cmd.Args {
+			command.Options = append(command.Options, &discord.ApplicationCommandOption{
 				Type:        discord.ApplicationCommandOptionString,
-				Name:        "urls",
-				Description: "Send me URLs to playback...",
-				Required:    true,
-			},
-		},
-	})
+				Name:        arg.Name,
+				Description: arg.Description,
+				Required:    arg.Required,
+			})
+		}
+		commands = append(commands, command)
+	}
 
 	return commands
 }
 
+// optionValues returns the values of the options of an application command,
+// separated by spaces.
+func optionValues(i *discord.InteractionCreate) string {
+	options := i.ApplicationCommandData().Options
+	values := make([]string, 0, len(options))
+	for _, option := range options {
+		values = append(values, option.StringValue())
+	}
+	return strings.Join(values, " ")
+}
+
+// interactionUser returns the identifier of the user who triggered the interaction.
+func interactionUser(i *discord.InteractionCreate) string {
+	if u := interactionAuthor(i); u != nil {
+		return u.ID
+	}
+	return ""
+}
+
+// interactionAuthor returns the user who triggered the interaction, it is the
+// member in guilds, or the user in direct messages.
+func interactionAuthor(i *discord.InteractionCreate) *discord.User {
+	switch {
+	case i.Member != nil && i.Member.User != nil:
+		return i.Member.User
+	case i.User != nil:
+		return i.User
+	}
+	return nil
+}
+
+// notify sends the alert of a watched URL to the channel of the watch.
+func (d *Discord) notify(_ context.Context, w *entity.Watch, text string) error {
+	_, err := d.bot.ChannelMessageSend(w.Chat, text)
+	return err
+}
+
+// author returns the identifier of the user who sent the message.
+func author(m *discord.MessageCreate) string {
+	if m == nil || m.Author == nil {
+		return ""
+	}
+	return m.Author.ID
+}
+
 func (d *Discord) isMention(content string) bool {
 	prefix := "<@!" + d.bot.State.User.ID + ">"
 	return strings.HasPrefix(content, prefix)
@@ -22,6 +22,7 @@ import (
 	"github.com/wabarc/helper"
 	"github.com/wabarc/wayback/config"
 	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/service"
 	"github.com/wabarc/wayback/storage"
 
 	discord "github.com/bwmarrin/discordgo"
@@ -189,7 +190,7 @@ func TestServe(t *testing.T) {
 	pool := pooling.New(ctx, config.Opts.PoolingSize())
 	go pool.Roll()
 
-	d := &Discord{ctx: ctx, bot: bot, pool: pool}
+	d := &Discord{ctx: ctx, bot: bot, pool: pool, commands: service.DefaultCommands(pool, "")}
 	time.AfterFunc(3*time.Second, func() {
 		// TODO: find a better way to avoid deadlock
 		go d.Shutdown()
@@ -258,3 +259,25 @@ func TestProcess(t *testing.T) {
 	time.Sleep(time.Second)
 	pool.Close()
 }
+
+func TestInteractionAuthor(t *testing.T) {
+	member, user := &discord.User{ID: "1"}, &discord.User{ID: "2"}
+	var tests = []struct {
+		name        string
+		interaction *discord.Interaction
+		want        string
+	}{
+		{name: "guild", interaction: &discord.Interaction{Member: &discord.Member{User: member}}, want: "1"},
+		{name: "direct message", interaction: &discord.Interaction{User: user}, want: "2"},
+		{name: "unknown", interaction: &discord.Interaction{}, want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := interactionUser(&discord.InteractionCreate{Interaction: test.interaction})
+			if got != test.want {
+				t.Errorf("Unexpected interaction user, got %q instead of %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package discord // import "github.com/wabarc/wayback/service/discord"
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/service"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// files returns the files attached to the message, which are downloaded
+// from the Discord CDN on demand.
+func (d *Discord) files(m *discord.MessageCreate) []service.File {
+	if m.Message == nil {
+		return nil
+	}
+	files := make([]service.File, 0, len(m.Attachments))
+	for _, a := range m.Attachments {
+		link := a.URL
+		files = append(files, service.File{
+			Name: a.Filename,
+			Size: int64(a.Size),
+			Open: func(ctx context.Context) (io.ReadCloser, error) {
+				return d.download(ctx, link)
+			},
+		})
+	}
+	return files
+}
+
+func (d *Discord) download(ctx context.Context, link string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := http.DefaultClient
+	if d.bot != nil && d.bot.Client != nil {
+		client = d.bot.Client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New("discord: download attachment failed, status: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// archiveFiles enqueues a job that archives the files of the message, and
+// replies with the digests and the IPFS links of them.
+func (d *Discord) archiveFiles(m *discord.MessageCreate, files []service.File) error {
+	metrics.IncrementWayback(metrics.ServiceDiscord, metrics.StatusRequest)
+	// The message is replaced by the reply below.
+	user := author(m)
+	id := pooling.NewID()
+	m, err := d.reply(m, service.MsgWaybackQueued(id))
+	if err != nil {
+		logger.Error("reply queue failed: %v", err)
+		return err
+	}
+	bucket := pooling.Bucket{
+		ID:      id,
+		Service: metrics.ServiceDiscord,
+		User:    user,
+		Request: func(ctx context.Context) error {
+			archived := service.ArchiveFiles(ctx, d.store, files, metrics.ServiceDiscord, user)
+			if _, err := d.edit(m, service.MsgArchivedFiles(archived)); err != nil {
+				return errors.Wrap(err, "discord: update message failed")
+			}
+			metrics.IncrementWayback(metrics.ServiceDiscord, metrics.StatusSuccess)
+			return nil
+		},
+		Fallback: func(_ context.Context, err error) error {
+			d.reply(m, service.MsgWaybackFailed(err)) // nolint:errcheck
+			metrics.IncrementWayback(metrics.ServiceDiscord, metrics.StatusFailure)
+			return nil
+		},
+	}
+	d.pool.Put(bucket)
+
+	return nil
+}
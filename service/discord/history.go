@@ -0,0 +1,99 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package discord // import "github.com/wabarc/wayback/service/discord"
+
+import (
+	"fmt"
+	"strconv"
+
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/service"
+	"github.com/wabarc/wayback/storage"
+)
+
+// history responds with a page of the archive history of the user, along
+// with the buttons to resend an archive and to show more, or resends the
+// archive of the item.
+func (d *Discord) history(s *discord.Session, i *discord.InteractionCreate, args string) error {
+	h, err := service.ParseHistoryArgs(args)
+	if err != nil {
+		return respond(s, i, fmt.Sprintf("Sorry, %v.", err), nil)
+	}
+	if h.Item > 0 {
+		return d.historyItem(s, i, h.Item)
+	}
+
+	page, err := service.History(d.store, metrics.ServiceDiscord, interactionUser(i), h)
+	if err != nil {
+		return errors.Wrap(err, "discord: query history failed")
+	}
+
+	var components []discord.MessageComponent
+	items := []discord.MessageComponent{}
+	for _, a := range page.Archives {
+		items = append(items, discord.Button{
+			Label:    "#" + strconv.Itoa(a.ID),
+			Style:    discord.SecondaryButton,
+			CustomID: service.HistoryPrefix + service.HistoryArgs{Item: a.ID}.String(),
+		})
+	}
+	if len(items) > 0 {
+		components = append(components, discord.ActionsRow{Components: items})
+	}
+	if page.Next > 0 {
+		components = append(components, discord.ActionsRow{
+			Components: []discord.MessageComponent{
+				discord.Button{
+					Label:    "More »",
+					Style:    discord.PrimaryButton,
+					CustomID: service.HistoryPrefix + page.NextArgs().String(),
+				},
+			},
+		})
+	}
+	return respond(s, i, service.MsgHistory(page), components)
+}
+
+// historyItem resends the results of the archive, and the artifacts of it
+// that are still on the local disk.
+func (d *Discord) historyItem(s *discord.Session, i *discord.InteractionCreate, id int) error {
+	a, err := service.HistoryItem(d.store, metrics.ServiceDiscord, interactionUser(i), id)
+	if errors.Is(err, storage.ErrArchiveNotFound) {
+		return respond(s, i, "Archive not found.", nil)
+	}
+	if err != nil {
+		return errors.Wrap(err, "discord: query archive failed")
+	}
+	if err := respond(s, i, service.MsgHistoryItem(a), nil); err != nil {
+		return err
+	}
+
+	files := service.UploadToDiscord(service.HistoryArtifact(a))
+	if len(files) == 0 {
+		logger.Debug("no artifacts of archive %d to send", a.ID)
+		return nil
+	}
+	if _, err := d.bot.ChannelMessageSendComplex(i.ChannelID, &discord.MessageSend{Files: files}); err != nil {
+		return errors.Wrap(err, "discord: send artifacts failed")
+	}
+	return nil
+}
+
+func respond(s *discord.Session, i *discord.InteractionCreate, text string, components []discord.MessageComponent) error {
+	err := s.InteractionRespond(i.Interaction, &discord.InteractionResponse{
+		Type: discord.InteractionResponseChannelMessageWithSource,
+		Data: &discord.InteractionResponseData{
+			Content:    text,
+			Components: components,
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "discord: respond interaction failed")
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/storage"
+)
+
+// ArtifactFile is the kind of the artifact of a file sent to the bots.
+const ArtifactFile = "file"
+
+// File represents a file sent to a bot, e.g. a document, an image or a video.
+type File struct {
+	// Name is the name of the file, the local file is named after it.
+	Name string
+	// Size is the size in bytes reported by the chat platform, zero if unknown.
+	Size int64
+	// Open returns the content of the file, it is usually downloaded from
+	// the chat platform.
+	Open func(ctx context.Context) (io.ReadCloser, error)
+}
+
+// ArchivedFile represents the result of archiving a file sent to a bot.
+type ArchivedFile struct {
+	Name string
+	Size int64
+	// Hash is the hex encoded SHA-256 digest of the file.
+	Hash string
+	// Local is the path of the file in the storage directory, empty if the
+	// storage directory is not configured.
+	Local string
+	// IPFS is the URL of the file on the IPFS gateway, empty if the IP slot
+	// is disabled or pinning failed.
+	IPFS string
+	// Err is the reason why the file is not archived.
+	Err error
+}
+
+// ArchiveFiles downloads the files within the size limit, stores them in the
+// storage directory and pins them to IPFS if the IP slot is enabled, then
+// records the archived files to the archive history.
+func ArchiveFiles(ctx context.Context, store storage.Storage, files []File, svc, user string) []ArchivedFile {
+	results := make([]ArchivedFile, 0, len(files))
+	for _, f := range files {
+		res := archiveFile(ctx, f)
+		if res.Err != nil {
+			logger.Error("archive file %s failed: %v", res.Name, res.Err)
+		} else {
+			recordFile(store, res, svc, user)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func archiveFile(ctx context.Context, f File) ArchivedFile {
+	res := ArchivedFile{Name: fileName(f.Name)}
+	limit := int64(config.Opts.MaxFileSize())
+	if f.Size > limit {
+		res.Err = errors.New("file size exceeds the limit of %s", humanize.Bytes(uint64(limit)))
+		return res
+	}
+
+	keep := config.Opts.EnabledReduxer()
+	dir := os.TempDir()
+	if keep {
+		dir = filepath.Join(config.Opts.StorageDir(), "files")
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			res.Err = errors.Wrap(err, "create storage directory failed")
+			return res
+		}
+	}
+
+	path, err := download(ctx, f, dir, limit, &res)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if keep {
+		// Files are stored by their digests, the same file sent twice is
+		// stored once.
+		dst := filepath.Join(dir, res.Hash, res.Name)
+		if err = os.MkdirAll(filepath.Dir(dst), 0o700); err == nil {
+			err = os.Rename(path, dst)
+		}
+		if err != nil {
+			os.Remove(path) // nolint:errcheck
+			res.Err = errors.Wrap(err, "store file failed")
+			return res
+		}
+		path, res.Local = dst, dst
+	} else {
+		defer os.Remove(path) // nolint:errcheck
+	}
+
+	if config.Opts.Slots()[config.SLOT_IP] {
+		// PinFile logs the error, the file is archived without IPFS.
+		res.IPFS, _ = wayback.PinFile(path)
+	}
+	return res
+}
+
+// download writes the content of the file to a temporary file in dir and
+// fills the size and the digest of res, it fails if the file exceeds limit.
+func download(ctx context.Context, f File, dir string, limit int64, res *ArchivedFile) (string, error) {
+	rc, err := f.Open(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "download file failed")
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp(dir, "file-*")
+	if err != nil {
+		return "", errors.Wrap(err, "create file failed")
+	}
+	defer tmp.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(rc, limit+1))
+	if err == nil && n > limit {
+		err = errors.New("file size exceeds the limit of %s", humanize.Bytes(uint64(limit)))
+	}
+	if err != nil {
+		os.Remove(tmp.Name()) // nolint:errcheck
+		return "", err
+	}
+
+	res.Size = n
+	res.Hash = hex.EncodeToString(h.Sum(nil))
+	return tmp.Name(), nil
+}
+
+func recordFile(store storage.Storage, f ArchivedFile, svc, user string) {
+	if store == nil {
+		return
+	}
+
+	art := entity.Artifact{Kind: ArtifactFile, Local: f.Local, Hash: f.Hash}
+	results := []entity.Result{}
+	if f.IPFS != "" {
+		art.Remotes = []string{f.IPFS}
+		results = append(results, entity.Result{Slot: config.SLOT_IP, Dst: f.IPFS})
+	}
+	a := &entity.Archive{
+		Source:    "urn:sha256:" + f.Hash,
+		Title:     f.Name,
+		Results:   results,
+		Artifacts: []entity.Artifact{art},
+		Service:   svc,
+		User:      user,
+		CreatedAt: time.Now(),
+	}
+	if err := store.CreateArchive(a); err != nil {
+		logger.Error("record archive history for file %s failed: %v", f.Name, err)
+	}
+}
+
+// fileName returns the base name of the file, since the name is given by the
+// sender and it may contain path separators.
+func fileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." || name == "" {
+		return "file"
+	}
+	return name
+}
+
+// MsgArchivedFiles returns the reply text of the archived files.
+func MsgArchivedFiles(files []ArchivedFile) string {
+	var b strings.Builder
+	for i, f := range files {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		if f.Err != nil {
+			fmt.Fprintf(&b, "%s: %v", f.Name, f.Err)
+			continue
+		}
+		fmt.Fprintf(&b, "%s (%s)\nSHA-256: %s", f.Name, humanize.Bytes(uint64(f.Size)), f.Hash)
+		if f.IPFS != "" {
+			fmt.Fprintf(&b, "\nIPFS: %s", f.IPFS)
+		}
+	}
+	return b.String()
+}
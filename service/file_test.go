@@ -0,0 +1,130 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestArchiveFiles(t *testing.T) {
+	dir := t.TempDir()
+	helper.Unsetenv("WAYBACK_ENABLE_IP", "WAYBACK_STORAGE_DIR", "WAYBACK_MAX_FILE_SIZE")
+	os.Setenv("WAYBACK_ENABLE_IP", "false")
+	os.Setenv("WAYBACK_STORAGE_DIR", dir)
+	os.Setenv("WAYBACK_MAX_FILE_SIZE", "16B")
+	defer helper.Unsetenv("WAYBACK_ENABLE_IP", "WAYBACK_STORAGE_DIR", "WAYBACK_MAX_FILE_SIZE")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	content := func(s string) func(context.Context) (io.ReadCloser, error) {
+		return func(context.Context) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(s)), nil
+		}
+	}
+	sum := sha256.Sum256([]byte("hello, world"))
+	hash := hex.EncodeToString(sum[:])
+
+	files := []File{
+		{Name: "../../hello.txt", Size: 12, Open: content("hello, world")},
+		{Name: "large.pdf", Size: 17, Open: content(strings.Repeat("x", 17))},
+		{Name: "unknown.pdf", Open: content(strings.Repeat("x", 17))},
+	}
+	archived := ArchiveFiles(context.Background(), store, files, "telegram", "foo")
+	if len(archived) != len(files) {
+		t.Fatalf("Unexpected archived files, got %d instead of %d", len(archived), len(files))
+	}
+
+	got := archived[0]
+	if got.Err != nil {
+		t.Fatalf("Unexpected archive file: %v", got.Err)
+	}
+	if got.Name != "hello.txt" || got.Size != 12 || got.Hash != hash || got.IPFS != "" {
+		t.Errorf("Unexpected archived file, got %#v", got)
+	}
+	if want := filepath.Join(dir, "files", hash, "hello.txt"); got.Local != want {
+		t.Errorf("Unexpected local file, got %s instead of %s", got.Local, want)
+	}
+	if b, err := os.ReadFile(got.Local); err != nil || string(b) != "hello, world" {
+		t.Errorf("Unexpected content of local file, got %q, error: %v", b, err)
+	}
+	for _, f := range archived[1:] {
+		if f.Err == nil {
+			t.Errorf("Unexpected archive file %s exceeds the size limit, got nil error", f.Name)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "files", "file-*")); len(matches) != 0 {
+		t.Errorf("Unexpected temporary files left, got %v", matches)
+	}
+
+	archives, err := store.ArchivesByUser("telegram", "foo", 0)
+	if err != nil {
+		t.Fatalf("Unexpected query archives: %v", err)
+	}
+	if len(archives) != 1 {
+		t.Fatalf("Unexpected archives, got %d instead of 1", len(archives))
+	}
+	a := archives[0]
+	if a.Source != "urn:sha256:"+hash || a.Title != "hello.txt" {
+		t.Errorf("Unexpected archive, got source %s title %s", a.Source, a.Title)
+	}
+	if len(a.Artifacts) != 1 || a.Artifacts[0].Kind != ArtifactFile || a.Artifacts[0].Hash != hash {
+		t.Errorf("Unexpected artifacts, got %#v", a.Artifacts)
+	}
+
+	text := MsgArchivedFiles(archived)
+	if !strings.Contains(text, "SHA-256: "+hash) || !strings.Contains(text, "large.pdf: file size exceeds") {
+		t.Errorf("Unexpected reply text, got %q", text)
+	}
+}
+
+func TestArchiveFilesPinFailed(t *testing.T) {
+	helper.Unsetenv("WAYBACK_ENABLE_IP", "WAYBACK_STORAGE_DIR", "WAYBACK_IPFS_MODE", "WAYBACK_IPFS_PORT")
+	os.Setenv("WAYBACK_ENABLE_IP", "true")
+	os.Setenv("WAYBACK_IPFS_MODE", "daemon")
+	os.Setenv("WAYBACK_IPFS_PORT", "1")
+	os.Setenv("WAYBACK_STORAGE_DIR", t.TempDir())
+	defer helper.Unsetenv("WAYBACK_ENABLE_IP", "WAYBACK_STORAGE_DIR", "WAYBACK_IPFS_MODE", "WAYBACK_IPFS_PORT")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	files := []File{{Name: "hello.txt", Open: func(context.Context) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("hello, world")), nil
+	}}}
+	archived := ArchiveFiles(context.Background(), nil, files, "telegram", "foo")
+	if len(archived) != 1 || archived[0].Err != nil {
+		t.Fatalf("Unexpected archived files, got %#v", archived)
+	}
+	if archived[0].IPFS != "" {
+		t.Errorf("Unexpected IPFS of the file failed to pin, got %q", archived[0].IPFS)
+	}
+	if text := MsgArchivedFiles(archived); strings.Contains(text, "IPFS:") {
+		t.Errorf("Unexpected IPFS line of the file failed to pin, got %q", text)
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/reduxer"
+	"github.com/wabarc/wayback/storage"
+)
+
+// Record writes the results of a wayback run to the archive history, one entry
+// for each source URL. The svc and user identify the requester, user may be
+// empty if the service does not identify its users.
+func Record(store storage.Storage, cols []wayback.Collect, rdx reduxer.Reduxer, svc, user string) {
+	if store == nil {
+		return
+	}
+
+	now := time.Now()
+	archives := make(map[string]*entity.Archive)
+	sources := []string{}
+	for _, col := range cols {
+		a, ok := archives[col.Src]
+		if !ok {
+			title, text := article(rdx, col.Src)
+			a = &entity.Archive{
+				Source:    col.Src,
+				Title:     title,
+				Text:      text,
+				Results:   []entity.Result{},
+				Artifacts: artifacts(rdx, col.Src),
+				Service:   svc,
+				User:      user,
+				CreatedAt: now,
+			}
+			archives[col.Src] = a
+			sources = append(sources, col.Src)
+		}
+		a.Results = append(a.Results, entity.Result{Slot: col.Arc, Dst: col.Dst})
+	}
+
+	for _, src := range sources {
+		if err := store.CreateArchive(archives[src]); err != nil {
+			logger.Error("record archive history for %s failed: %v", src, err)
+		}
+	}
+}
+
+// article returns the title and the text content of the webpage.
+func article(rdx reduxer.Reduxer, src string) (title, text string) {
+	if rdx == nil {
+		return "", ""
+	}
+	if bundle, ok := rdx.Load(reduxer.Src(src)); ok {
+		art := bundle.Article()
+		return art.Title, art.TextContent
+	}
+	return "", ""
+}
+
+func artifacts(rdx reduxer.Reduxer, src string) []entity.Artifact {
+	arts := []entity.Artifact{}
+	if rdx == nil {
+		return arts
+	}
+	bundle, ok := rdx.Load(reduxer.Src(src))
+	if !ok {
+		return arts
+	}
+
+	art := bundle.Artifact()
+	assets := []struct {
+		kind  string
+		asset reduxer.Asset
+	}{
+		{"img", art.Img},
+		{"pdf", art.PDF},
+		{"raw", art.Raw},
+		{"txt", art.Txt},
+		{"har", art.HAR},
+		{"htm", art.HTM},
+		{"warc", art.WARC},
+		{"media", art.Media},
+	}
+	for _, a := range assets {
+		remotes := []string{}
+		for _, r := range []string{a.asset.Remote.Anonfile, a.asset.Remote.Catbox} {
+			if r != "" {
+				remotes = append(remotes, r)
+			}
+		}
+		if a.asset.Local == "" && len(remotes) == 0 {
+			continue
+		}
+		arts = append(arts, entity.Artifact{Kind: a.kind, Local: a.asset.Local, Remotes: remotes})
+	}
+
+	return arts
+}
+
+const (
+	// HistoryPrefix is the prefix of the data of the history buttons, it is
+	// followed by the arguments of the history command.
+	HistoryPrefix = "history:"
+
+	// historyLimit is the number of archives in a page of the history.
+	historyLimit = 5
+	// maxHistoryQuery is the maximum length of the query in bytes, so that
+	// the arguments fit into the data of buttons, e.g. 64 bytes of Telegram.
+	maxHistoryQuery = 32
+)
+
+// MsgHistoryEmpty is the reply text for a history command without archives.
+const MsgHistoryEmpty = "No archives found."
+
+// ErrHistoryQueryTooLong is returned if the query of the history command is too long.
+var ErrHistoryQueryTooLong = errors.New("query is longer than %d bytes", maxHistoryQuery)
+
+// HistoryArgs represents the arguments of the history command, it lists the
+// archives that match the query before the cursor, or resends the archive
+// of the item.
+type HistoryArgs struct {
+	// Query matches the words of the titles or the article texts, or the
+	// domain if it is a URL.
+	Query  string
+	Before int
+	Item   int
+}
+
+// ParseHistoryArgs parses the arguments of the history command, e.g. "foo bar",
+// "before:42 foo bar" for the next page, or "#42" to resend the archive 42.
+func ParseHistoryArgs(args string) (HistoryArgs, error) {
+	var h HistoryArgs
+	words := []string{}
+	for _, f := range strings.Fields(args) {
+		switch {
+		case strings.HasPrefix(f, "#"):
+			if n, err := strconv.Atoi(f[1:]); err == nil && n > 0 {
+				h.Item = n
+				continue
+			}
+		case strings.HasPrefix(f, "before:"):
+			if n, err := strconv.Atoi(strings.TrimPrefix(f, "before:")); err == nil && n > 0 {
+				h.Before = n
+				continue
+			}
+		}
+		words = append(words, f)
+	}
+	h.Query = strings.Join(words, " ")
+	if len(h.Query) > maxHistoryQuery {
+		return h, ErrHistoryQueryTooLong
+	}
+	return h, nil
+}
+
+// String returns the arguments of the history command, it is the reverse of ParseHistoryArgs.
+func (h HistoryArgs) String() string {
+	switch {
+	case h.Item > 0:
+		return "#" + strconv.Itoa(h.Item)
+	case h.Before > 0:
+		return strings.TrimSpace(fmt.Sprintf("before:%d %s", h.Before, h.Query))
+	default:
+		return h.Query
+	}
+}
+
+// HistoryPage represents a page of the archive history of a user.
+type HistoryPage struct {
+	Query    string
+	Archives []entity.Archive
+	// Next is the cursor of the next page, it is zero if there are no more archives.
+	Next int
+}
+
+// NextArgs returns the arguments of the history command of the next page.
+func (p *HistoryPage) NextArgs() HistoryArgs {
+	return HistoryArgs{Query: p.Query, Before: p.Next}
+}
+
+// History returns a page of the archives requested by the user of the
+// service, the most recent first.
+func History(store storage.Storage, svc, user string, args HistoryArgs) (*HistoryPage, error) {
+	if user == "" {
+		return nil, errors.New("history of anonymous users is not supported")
+	}
+	q := storage.ArchiveQuery{Service: svc, User: user, Text: args.Query, Before: args.Before, Limit: historyLimit + 1}
+	if urls := MatchURL(args.Query); len(urls) > 0 {
+		q.Domain, q.Text = urls[0].Hostname(), ""
+	}
+	archives, err := store.SearchArchives(q)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &HistoryPage{Query: args.Query, Archives: archives}
+	if len(archives) > historyLimit {
+		page.Archives = archives[:historyLimit]
+		page.Next = page.Archives[historyLimit-1].ID
+	}
+	return page, nil
+}
+
+// HistoryItem returns the archive of the id if it is requested by the user
+// of the service, or storage.ErrArchiveNotFound otherwise.
+func HistoryItem(store storage.Storage, svc, user string, id int) (*entity.Archive, error) {
+	a, err := store.Archive(id)
+	if err != nil {
+		return nil, err
+	}
+	if user == "" || a.Service != svc || a.User != user {
+		return nil, storage.ErrArchiveNotFound
+	}
+	return a, nil
+}
+
+// MsgHistory returns the text of the page of the history, one archive per
+// entry along with its id, date, title and source.
+func MsgHistory(page *HistoryPage) string {
+	if len(page.Archives) == 0 {
+		return MsgHistoryEmpty
+	}
+	entries := make([]string, 0, len(page.Archives))
+	for _, a := range page.Archives {
+		head := fmt.Sprintf("#%d %s", a.ID, a.CreatedAt.UTC().Format("2006-01-02"))
+		if a.Title != "" {
+			head += " " + a.Title
+		}
+		entries = append(entries, head+"\n"+a.Source)
+	}
+	return strings.Join(entries, "\n\n")
+}
+
+// MsgHistoryItem returns the text of the results and the remote artifacts of the archive.
+func MsgHistoryItem(a *entity.Archive) string {
+	lines := []string{fmt.Sprintf("#%d %s", a.ID, a.Source)}
+	if a.Title != "" {
+		lines = append(lines, a.Title)
+	}
+	for _, r := range a.Results {
+		lines = append(lines, fmt.Sprintf("%s: %s", config.SlotName(r.Slot), r.Dst))
+	}
+	for _, art := range a.Artifacts {
+		if art.Hash != "" {
+			lines = append(lines, "SHA-256: "+art.Hash)
+		}
+		for _, r := range art.Remotes {
+			lines = append(lines, fmt.Sprintf("%s: %s", art.Kind, r))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HistoryArtifact returns the artifact of the archive to resend the files
+// on the local disk, the files sent to the bots are not included.
+func HistoryArtifact(a *entity.Archive) reduxer.Artifact {
+	var art reduxer.Artifact
+	assets := map[string]*reduxer.Asset{
+		"img":   &art.Img,
+		"pdf":   &art.PDF,
+		"raw":   &art.Raw,
+		"txt":   &art.Txt,
+		"har":   &art.HAR,
+		"htm":   &art.HTM,
+		"warc":  &art.WARC,
+		"media": &art.Media,
+	}
+	for _, f := range a.Artifacts {
+		if asset, ok := assets[f.Kind]; ok {
+			asset.Local = f.Local
+		}
+	}
+	return art
+}
+
+// RegisterHistoryCommand registers the command to list the archive history
+// of the sender, and to resend the results of an archive by its id. The
+// services with buttons handle the command on their own.
+func RegisterHistoryCommand(c *Commands, store storage.Storage) {
+	if store == nil {
+		return
+	}
+	c.Register(&Command{
+		Name:        CommandHistory,
+		Description: "List your recent archives",
+		Args:        []Arg{{Name: "query", Description: "Words of the titles, a URL, or #id to resend an archive"}},
+		Handler: func(_ context.Context, req *Request) (string, error) {
+			args, err := ParseHistoryArgs(req.Args)
+			if err != nil {
+				return fmt.Sprintf("Sorry, %v.", err), nil
+			}
+			if args.Item > 0 {
+				a, err := HistoryItem(store, req.Service, req.User, args.Item)
+				if errors.Is(err, storage.ErrArchiveNotFound) {
+					return "Archive not found.", nil
+				}
+				if err != nil {
+					return "", errors.Wrap(err, "query archive failed")
+				}
+				return MsgHistoryItem(a), nil
+			}
+
+			page, err := History(store, req.Service, req.User, args)
+			if err != nil {
+				return "", errors.Wrap(err, "query history failed")
+			}
+			text := MsgHistory(page)
+			if len(page.Archives) > 0 {
+				text += fmt.Sprintf("\n\nSend %s%s #<id> to resend an archive.", req.Prefix, CommandHistory)
+			}
+			if page.Next > 0 {
+				text += fmt.Sprintf("\nSend %s%s %s for more.", req.Prefix, CommandHistory, page.NextArgs())
+			}
+			return text, nil
+		},
+	})
+}
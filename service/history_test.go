@@ -0,0 +1,178 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wabarc/wayback"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/reduxer"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestRecord(t *testing.T) {
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	src := "https://example.com/"
+	cols := []wayback.Collect{
+		{Arc: "ia", Dst: "https://web.archive.org/web/20211000000001/https://example.com/", Src: src, Ext: "ia"},
+		{Arc: "is", Dst: "http://archive.today/abcdE", Src: src, Ext: "is"},
+		{Arc: "ia", Dst: "https://web.archive.org/web/20211000000001/https://example.org/", Src: "https://example.org/", Ext: "ia"},
+	}
+	Record(store, cols, reduxer.BundleExample(), "telegram", "foo")
+	Record(nil, cols, nil, "telegram", "foo")
+
+	archives, err := store.ArchivesByUser("telegram", "foo", 0)
+	if err != nil {
+		t.Fatalf("Unexpected query archives: %v", err)
+	}
+	if len(archives) != 2 {
+		t.Fatalf("Unexpected archives, got %d instead of 2", len(archives))
+	}
+
+	archives, err = store.ArchivesByURL(src, 0)
+	if err != nil {
+		t.Fatalf("Unexpected query archives: %v", err)
+	}
+	if len(archives) != 1 {
+		t.Fatalf("Unexpected archives, got %d instead of 1", len(archives))
+	}
+	if len(archives[0].Results) != 2 {
+		t.Errorf("Unexpected results, got %d instead of 2", len(archives[0].Results))
+	}
+	if len(archives[0].Artifacts) == 0 {
+		t.Error("Unexpected empty artifacts")
+	}
+}
+
+func TestParseHistoryArgs(t *testing.T) {
+	var tests = []struct {
+		args string
+		want HistoryArgs
+		fail bool
+	}{
+		{args: "", want: HistoryArgs{}},
+		{args: " foo  bar ", want: HistoryArgs{Query: "foo bar"}},
+		{args: "before:42 foo", want: HistoryArgs{Query: "foo", Before: 42}},
+		{args: "#42", want: HistoryArgs{Item: 42}},
+		{args: "#foo before:bar", want: HistoryArgs{Query: "#foo before:bar"}},
+		{args: strings.Repeat("x", maxHistoryQuery+1), fail: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.args, func(t *testing.T) {
+			got, err := ParseHistoryArgs(test.args)
+			if (err != nil) != test.fail {
+				t.Fatalf("Unexpected parse history args error: %v", err)
+			}
+			if test.fail {
+				return
+			}
+			if got != test.want {
+				t.Errorf("Unexpected history args, got %#v instead of %#v", got, test.want)
+			}
+			if again, _ := ParseHistoryArgs(got.String()); again != got {
+				t.Errorf("Unexpected history args of %q, got %#v instead of %#v", got.String(), again, got)
+			}
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	os.Clearenv()
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	for i := 1; i <= historyLimit+2; i++ {
+		a := &entity.Archive{
+			Source:    fmt.Sprintf("https://example.com/%d", i),
+			Title:     fmt.Sprintf("Page %d", i),
+			Results:   []entity.Result{{Slot: config.SLOT_IA, Dst: "https://web.archive.org/web/https://example.com/"}},
+			Service:   "telegram",
+			User:      "foo",
+			CreatedAt: time.Now(),
+		}
+		if err := store.CreateArchive(a); err != nil {
+			t.Fatalf("Unexpected create archive: %v", err)
+		}
+	}
+	other := &entity.Archive{Source: "https://example.org", Service: "telegram", User: "bar", CreatedAt: time.Now()}
+	if err := store.CreateArchive(other); err != nil {
+		t.Fatalf("Unexpected create archive: %v", err)
+	}
+
+	page, err := History(store, "telegram", "foo", HistoryArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected query history: %v", err)
+	}
+	if len(page.Archives) != historyLimit || page.Next == 0 {
+		t.Fatalf("Unexpected first page, got %d archives and next %d", len(page.Archives), page.Next)
+	}
+	page, err = History(store, "telegram", "foo", page.NextArgs())
+	if err != nil {
+		t.Fatalf("Unexpected query history: %v", err)
+	}
+	if len(page.Archives) != 2 || page.Next != 0 {
+		t.Fatalf("Unexpected last page, got %d archives and next %d", len(page.Archives), page.Next)
+	}
+	if _, err := History(store, "telegram", "", HistoryArgs{}); err == nil {
+		t.Errorf("Unexpected history of anonymous user, got nil error")
+	}
+
+	ctx := context.Background()
+	c := DefaultCommands(pooling.New(ctx, 1), "")
+	RegisterHistoryCommand(c, store)
+	cmd, ok := c.Lookup(CommandHistory)
+	if !ok {
+		t.Fatalf("Unexpected lookup command %s, not found", CommandHistory)
+	}
+
+	var tests = []struct {
+		args     string
+		user     string
+		contains []string
+	}{
+		{args: "", user: "foo", contains: []string{"Page 7", "Send /history #<id> to resend an archive.", "for more."}},
+		{args: "page 1", user: "foo", contains: []string{"https://example.com/1"}},
+		{args: "#1", user: "foo", contains: []string{"#1 https://example.com/1", "Page 1", "Internet Archive: https://web.archive.org/"}},
+		{args: fmt.Sprintf("#%d", other.ID), user: "foo", contains: []string{"Archive not found."}},
+		{args: "", user: "baz", contains: []string{MsgHistoryEmpty}},
+	}
+
+	for _, test := range tests {
+		req := &Request{Service: "telegram", User: test.user, Prefix: "/", Args: test.args}
+		got, err := c.Run(ctx, cmd, req)
+		if err != nil {
+			t.Fatalf("Unexpected run command: %v", err)
+		}
+		for _, want := range test.contains {
+			if !strings.Contains(got, want) {
+				t.Errorf("Unexpected reply of %q, got %q without %q", test.args, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/deadletter"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/storage"
+)
+
+func (web *web) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("access dead letters")
+
+	dls, err := web.store.DeadLetters()
+	if err != nil {
+		logger.Error("list dead letters failed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, dls)
+}
+
+func (web *web) showDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+	logger.Debug("access dead letter %s", id)
+
+	dl, err := web.store.DeadLetter(id)
+	if err != nil {
+		writeDeadLetterError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, dl)
+}
+
+func (web *web) replayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+	logger.Info("replay dead letter %s", id)
+
+	if err := deadletter.Replay(web.store, web.pool, id); err != nil {
+		writeDeadLetterError(w, err)
+		return
+	}
+
+	job, _ := web.pool.Job(id)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (web *web) removeDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+	logger.Info("remove dead letter %s", id)
+
+	if err := web.store.RemoveDeadLetter(id); err != nil {
+		writeDeadLetterError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (web *web) purgeDeadLetters(w http.ResponseWriter, r *http.Request) {
+	logger.Info("purge dead letters")
+
+	if err := web.store.PurgeDeadLetters(); err != nil {
+		writeDeadLetterError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (web *web) backup(w http.ResponseWriter, r *http.Request) {
+	logger.Info("backup database")
+
+	filename := fmt.Sprintf("wayback-%s.db", time.Now().Format("20060102150405"))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if _, err := web.store.Backup(w); err != nil {
+		// It is too late to change the status code.
+		logger.Error("backup database failed: %v", err)
+	}
+}
+
+func (web *web) export(w http.ResponseWriter, r *http.Request) {
+	logger.Info("export database")
+
+	filename := fmt.Sprintf("wayback-%s.jsonl", time.Now().Format("20060102150405"))
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if err := web.store.Export(w); err != nil {
+		logger.Error("export database failed: %v", err)
+	}
+}
+
+func writeDeadLetterError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, storage.ErrDeadLetterNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, deadletter.ErrReplaying):
+		status = http.StatusConflict
+	case errors.Is(err, deadletter.ErrNoURLs):
+		status = http.StatusUnprocessableEntity
+	default:
+		logger.Error("dead letter operation failed: %v", err)
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestDeadLetters(t *testing.T) {
+	helper.Unsetenv("WAYBACK_ADMIN_TOKEN")
+	os.Setenv("WAYBACK_ADMIN_TOKEN", "foo")
+	defer helper.Unsetenv("WAYBACK_ADMIN_TOKEN")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	dl := &entity.DeadLetter{ID: "bar", Service: "telegram", CreatedAt: time.Now()}
+	if err := store.CreateDeadLetter(dl); err != nil {
+		t.Fatalf("Unexpected create dead letter: %v", err)
+	}
+
+	ctx := context.Background()
+	pool := pooling.New(ctx, 1)
+	go pool.Roll()
+	defer pool.Close()
+
+	server := httptest.NewServer(newWeb(ctx, store, pool).handle())
+	defer server.Close()
+
+	var tests = []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{name: "unauthorized", method: http.MethodGet, path: "/admin/dead-letters", token: "", status: http.StatusUnauthorized},
+		{name: "invalid token", method: http.MethodGet, path: "/admin/dead-letters", token: "bar", status: http.StatusUnauthorized},
+		{name: "list dead letters", method: http.MethodGet, path: "/admin/dead-letters", token: "foo", status: http.StatusOK},
+		{name: "show dead letter", method: http.MethodGet, path: "/admin/dead-letters/bar", token: "foo", status: http.StatusOK},
+		{name: "show nonexistent dead letter", method: http.MethodGet, path: "/admin/dead-letters/foo", token: "foo", status: http.StatusNotFound},
+		{name: "replay dead letter without urls", method: http.MethodPost, path: "/admin/dead-letters/bar/replay", token: "foo", status: http.StatusUnprocessableEntity},
+		{name: "remove dead letter", method: http.MethodDelete, path: "/admin/dead-letters/bar", token: "foo", status: http.StatusNoContent},
+		{name: "remove nonexistent dead letter", method: http.MethodDelete, path: "/admin/dead-letters/bar", token: "foo", status: http.StatusNotFound},
+		{name: "purge dead letters", method: http.MethodDelete, path: "/admin/dead-letters", token: "foo", status: http.StatusNoContent},
+		{name: "backup unauthorized", method: http.MethodGet, path: "/admin/backup", token: "", status: http.StatusUnauthorized},
+		{name: "backup", method: http.MethodGet, path: "/admin/backup", token: "foo", status: http.StatusOK},
+		{name: "export", method: http.MethodGet, path: "/admin/export", token: "foo", status: http.StatusOK},
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, server.URL+test.path, nil)
+			if err != nil {
+				t.Fatalf("Unexpected new request: %v", err)
+			}
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected response: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != test.status {
+				t.Errorf("Unexpected response code got %d instead of %d", resp.StatusCode, test.status)
+			}
+		})
+	}
+}
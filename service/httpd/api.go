@@ -0,0 +1,312 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	_ "embed" // for openapi.json
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/publish"
+	"github.com/wabarc/wayback/reduxer"
+	"github.com/wabarc/wayback/service"
+	"github.com/wabarc/wayback/storage"
+	"github.com/wabarc/wayback/template"
+)
+
+// apiPrefix is the path prefix of the current version of the JSON API.
+const apiPrefix = "/api/v1"
+
+const (
+	maxRequestSize  = 1 << 20
+	defHistoryLimit = 20
+	maxHistoryLimit = 100
+)
+
+// Codes of the API errors, they are part of the contract along with the HTTP status codes.
+const (
+	codeInvalidRequest   = "invalid_request"
+	codeUnsupportedMedia = "unsupported_media_type"
+	codeInvalidURL       = "invalid_url"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeRateLimited      = "rate_limited"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeTimeout          = "timeout"
+	codeArchiveFailed    = "archive_failed"
+	codePlaybackFailed   = "playback_failed"
+	codeInternal         = "internal_error"
+)
+
+// openapi is the OpenAPI document of the JSON API.
+//
+//go:embed openapi.json
+var openapi []byte
+
+// apiError represents an error object of the API.
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// urlsRequest represents the request body to archive or playback webpages.
+type urlsRequest struct {
+	URLs []string `json:"urls"`
+
+	// Async and Webhook are only for archiving, an async request returns
+	// the job at once, and the results are posted to the webhook if given.
+	Async   bool   `json:"async,omitempty"`
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// resultsResponse represents the response body of archiving or playback webpages.
+type resultsResponse struct {
+	Results template.Collector `json:"results"`
+}
+
+// archivesResponse represents the response body of the archive history.
+type archivesResponse struct {
+	Archives []entity.Archive `json:"archives"`
+
+	// Next is the cursor of the next page for the before parameter, it is
+	// omitted if there are no more archives.
+	Next int `json:"next,omitempty"`
+}
+
+// jobsResponse represents the response body of the jobs.
+type jobsResponse struct {
+	Jobs []pooling.Job `json:"jobs"`
+}
+
+func (web *web) handleAPI() {
+	api := web.router.PathPrefix(apiPrefix).Subrouter()
+	api.HandleFunc("/openapi.json", web.showOpenAPI).Methods(http.MethodGet)
+	api.Handle("/archives", web.requireAPI(entity.ScopeArchive, web.throttle(web.apiArchive))).Methods(http.MethodPost)
+	api.Handle("/archives", web.requireAPI(entity.ScopePlayback, web.apiListArchives)).Methods(http.MethodGet)
+	api.Handle("/archives/{id:[0-9]+}", web.requireAPI(entity.ScopePlayback, web.apiShowArchive)).Methods(http.MethodGet)
+	api.Handle("/playback", web.requireAPI(entity.ScopePlayback, web.throttle(web.apiPlayback))).Methods(http.MethodPost)
+	api.Handle("/batches", web.requireAPI(entity.ScopeArchive, web.throttle(web.apiCreateBatch))).Methods(http.MethodPost)
+	api.Handle("/batches/{id}", web.requireAPI(entity.ScopeArchive, web.apiShowBatch)).Methods(http.MethodGet)
+	api.Handle("/jobs", web.requireAPI(entity.ScopeArchive, web.apiListJobs)).Methods(http.MethodGet)
+	api.Handle("/jobs/{id}", web.requireAPI(entity.ScopeArchive, web.apiShowJob)).Methods(http.MethodGet)
+	api.Handle("/jobs/{id}/events", web.requireAPI(entity.ScopeArchive, web.apiJobEvents)).Methods(http.MethodGet)
+	api.Handle("/jobs/{id}/cancel", web.requireAPI(entity.ScopeArchive, web.apiCancelJob)).Methods(http.MethodPost)
+	api.Handle("/watches", web.requireAPI(entity.ScopeArchive, web.apiCreateWatch)).Methods(http.MethodPost)
+	api.Handle("/watches", web.requireAPI(entity.ScopeArchive, web.apiListWatches)).Methods(http.MethodGet)
+	api.Handle("/watches/{id}", web.requireAPI(entity.ScopeArchive, web.apiRemoveWatch)).Methods(http.MethodDelete)
+	api.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, codeNotFound, "resource not found")
+	})
+	api.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, codeInvalidRequest, "method not allowed")
+	})
+}
+
+func (web *web) showOpenAPI(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("access openapi document")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapi) // nolint:errcheck
+}
+
+func (web *web) apiArchive(w http.ResponseWriter, r *http.Request) {
+	logger.Info("api archive request start...")
+	metrics.IncrementWayback(metrics.ServiceWeb, metrics.StatusRequest)
+
+	var req urlsRequest
+	urls, ok := decodeURLs(w, r, &req)
+	if !ok || !validWebhook(w, req.Webhook) {
+		metrics.IncrementWayback(metrics.ServiceWeb, metrics.StatusFailure)
+		return
+	}
+	if req.Async || req.Webhook != "" {
+		web.archiveAsync(w, r, urls, req.Webhook)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(web.ctx, config.Opts.WaybackTimeout())
+	defer cancel()
+
+	do := func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
+		service.Record(web.store, cols, rdx, metrics.ServiceWeb, "")
+		metrics.IncrementWayback(metrics.ServiceWeb, metrics.StatusSuccess)
+		writeJSON(w, http.StatusOK, resultsResponse{Results: transform(cols)})
+
+		if canPublish(r) {
+			ctx := context.WithValue(context.Background(), publish.PubBundle{}, rdx)
+			go publish.To(ctx, cols, "web")
+		}
+		return nil
+	}
+
+	err := service.Wayback(ctx, urls, do)
+	if err == nil {
+		return
+	}
+	metrics.IncrementWayback(metrics.ServiceWeb, metrics.StatusFailure)
+	logger.Error("api archive failed: %v", err)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, codeTimeout, "wayback timeout, please try later")
+	case errors.IsPermanent(err):
+		writeError(w, http.StatusUnprocessableEntity, codeArchiveFailed, err.Error())
+	default:
+		writeError(w, http.StatusBadGateway, codeArchiveFailed, err.Error())
+	}
+}
+
+func (web *web) apiPlayback(w http.ResponseWriter, r *http.Request) {
+	logger.Info("api playback request start...")
+	metrics.IncrementPlayback(metrics.ServiceWeb, metrics.StatusRequest)
+
+	urls, ok := decodeURLs(w, r, &urlsRequest{})
+	if !ok {
+		metrics.IncrementPlayback(metrics.ServiceWeb, metrics.StatusFailure)
+		return
+	}
+
+	cols, err := wayback.Playback(r.Context(), urls...)
+	if err != nil {
+		metrics.IncrementPlayback(metrics.ServiceWeb, metrics.StatusFailure)
+		logger.Error("api playback failed: %v", err)
+		writeError(w, http.StatusBadGateway, codePlaybackFailed, err.Error())
+		return
+	}
+	metrics.IncrementPlayback(metrics.ServiceWeb, metrics.StatusSuccess)
+	writeJSON(w, http.StatusOK, resultsResponse{Results: transform(cols)})
+}
+
+func (web *web) apiListArchives(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("api access archives")
+
+	q, err := parseArchiveQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	archives, err := web.store.SearchArchives(q)
+	if err != nil {
+		logger.Error("query archives failed: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	for i := range archives {
+		redact(r, &archives[i])
+	}
+	writeJSON(w, http.StatusOK, archivesResponse{Archives: archives, Next: nextPage(q, archives)})
+}
+
+func (web *web) apiShowArchive(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(routeParam(r, "id"))
+	logger.Debug("api access archive %d", id)
+
+	a, err := web.store.Archive(id)
+	switch {
+	case errors.Is(err, storage.ErrArchiveNotFound):
+		writeError(w, http.StatusNotFound, codeNotFound, err.Error())
+	case err != nil:
+		logger.Error("query archive failed: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+	default:
+		redact(r, a)
+		writeJSON(w, http.StatusOK, a)
+	}
+}
+
+func (web *web) apiListJobs(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("api access jobs")
+	writeJSON(w, http.StatusOK, jobsResponse{Jobs: web.jobs(r)})
+}
+
+func (web *web) apiShowJob(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+	logger.Debug("api access job %s", id)
+
+	job, ok := web.job(r, id)
+	if !ok {
+		writeError(w, http.StatusNotFound, codeNotFound, pooling.ErrJobNotFound.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, web.jobResponse(job))
+}
+
+func (web *web) apiCancelJob(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+	logger.Info("api cancel job %s", id)
+
+	if _, ok := web.job(r, id); !ok {
+		writeError(w, http.StatusNotFound, codeNotFound, pooling.ErrJobNotFound.Error())
+		return
+	}
+	err := web.pool.Cancel(id)
+	switch {
+	case errors.Is(err, pooling.ErrJobNotFound):
+		writeError(w, http.StatusNotFound, codeNotFound, err.Error())
+		return
+	case errors.Is(err, pooling.ErrJobFinished):
+		writeError(w, http.StatusConflict, codeConflict, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	job, _ := web.pool.Job(id)
+	writeJSON(w, http.StatusOK, job)
+}
+
+// decodeURLs decodes the URLs from the JSON request body, it writes the error
+// response and returns false if the request is invalid.
+func decodeURLs(w http.ResponseWriter, r *http.Request, req *urlsRequest) ([]*url.URL, bool) {
+	if !decodeJSON(w, r, req) {
+		return nil, false
+	}
+	if len(req.URLs) == 0 {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidURL, "urls is required")
+		return nil, false
+	}
+
+	urls := make([]*url.URL, 0, len(req.URLs))
+	for _, s := range req.URLs {
+		u, err := url.Parse(strings.TrimSpace(s))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeError(w, http.StatusUnprocessableEntity, codeInvalidURL, fmt.Sprintf("invalid url: %q", s))
+			return nil, false
+		}
+		urls = append(urls, u)
+	}
+	return urls, true
+}
+
+// decodeJSON decodes the JSON request body into v, it writes the error
+// response and returns false if the request is invalid.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "content type must be application/json")
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]apiError{"error": {Code: code, Message: message}})
+}
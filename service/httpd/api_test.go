@@ -0,0 +1,196 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestAPI(t *testing.T) {
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	a := &entity.Archive{Source: "https://example.com", Service: "telegram", User: "42"}
+	if err := store.CreateArchive(a); err != nil {
+		t.Fatalf("Unexpected create archive: %v", err)
+	}
+
+	ctx := context.Background()
+	pool := pooling.New(ctx, 1)
+	go pool.Roll()
+	defer pool.Close()
+
+	server := httptest.NewServer(newWeb(ctx, store, pool).handle())
+	defer server.Close()
+
+	var tests = []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		{name: "openapi document", method: http.MethodGet, path: "/openapi.json", status: http.StatusOK},
+		{name: "unknown path", method: http.MethodGet, path: "/foo", status: http.StatusNotFound, code: codeNotFound},
+		{name: "method not allowed", method: http.MethodDelete, path: "/archives", status: http.StatusMethodNotAllowed, code: codeInvalidRequest},
+		{name: "archive without json", method: http.MethodPost, path: "/archives", contentType: "text/plain", body: "https://example.com", status: http.StatusUnsupportedMediaType, code: codeUnsupportedMedia},
+		{name: "archive malformed json", method: http.MethodPost, path: "/archives", contentType: "application/json", body: `{"urls":`, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "archive without urls", method: http.MethodPost, path: "/archives", contentType: "application/json", body: `{"urls":[]}`, status: http.StatusUnprocessableEntity, code: codeInvalidURL},
+		{name: "archive invalid url", method: http.MethodPost, path: "/archives", contentType: "application/json", body: `{"urls":["ftp://example.com"]}`, status: http.StatusUnprocessableEntity, code: codeInvalidURL},
+		{name: "archive webhook disabled", method: http.MethodPost, path: "/archives", contentType: "application/json", body: `{"urls":["https://example.com"],"webhook":"https://example.org"}`, status: http.StatusUnprocessableEntity, code: codeInvalidRequest},
+		{name: "playback invalid url", method: http.MethodPost, path: "/playback", contentType: "application/json", body: `{"urls":["example"]}`, status: http.StatusUnprocessableEntity, code: codeInvalidURL},
+		{name: "list archives", method: http.MethodGet, path: "/archives", status: http.StatusOK},
+		{name: "list archives by service", method: http.MethodGet, path: "/archives?service=telegram", status: http.StatusOK},
+		{name: "list archives invalid limit", method: http.MethodGet, path: "/archives?limit=0", status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "list archives invalid time", method: http.MethodGet, path: "/archives?from=yesterday", status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "show archive", method: http.MethodGet, path: "/archives/1", status: http.StatusOK},
+		{name: "show nonexistent archive", method: http.MethodGet, path: "/archives/2", status: http.StatusNotFound, code: codeNotFound},
+		{name: "list jobs", method: http.MethodGet, path: "/jobs", status: http.StatusOK},
+		{name: "show nonexistent job", method: http.MethodGet, path: "/jobs/foo", status: http.StatusNotFound, code: codeNotFound},
+		{name: "cancel nonexistent job", method: http.MethodPost, path: "/jobs/foo/cancel", status: http.StatusNotFound, code: codeNotFound},
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, server.URL+apiPrefix+test.path, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatalf("Unexpected new request: %v", err)
+			}
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != test.status {
+				t.Fatalf("Unexpected status code, got %d instead of %d", resp.StatusCode, test.status)
+			}
+			if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("Unexpected content type, got %s instead of application/json", ct)
+			}
+
+			var body struct {
+				Error *apiError `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("Unexpected decode response: %v", err)
+			}
+			switch {
+			case test.code == "" && body.Error != nil:
+				t.Errorf("Unexpected error, got %#v", body.Error)
+			case test.code != "" && (body.Error == nil || body.Error.Code != test.code):
+				t.Errorf("Unexpected error, got %#v instead of code %s", body.Error, test.code)
+			}
+		})
+	}
+}
+
+func TestAPIRedactUser(t *testing.T) {
+	helper.Unsetenv("WAYBACK_ADMIN_TOKEN", "WAYBACK_REQUIRE_TOKEN")
+	os.Setenv("WAYBACK_ADMIN_TOKEN", "foo")
+	defer helper.Unsetenv("WAYBACK_ADMIN_TOKEN")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	a := &entity.Archive{Source: "https://example.com", Service: "telegram", User: "42"}
+	if err := store.CreateArchive(a); err != nil {
+		t.Fatalf("Unexpected create archive: %v", err)
+	}
+
+	ctx := context.Background()
+	pool := pooling.New(ctx, 1)
+	go pool.Roll()
+	defer pool.Close()
+
+	server := httptest.NewServer(newWeb(ctx, store, pool).handle())
+	defer server.Close()
+
+	var tests = []struct {
+		name  string
+		path  string
+		token string
+		user  string
+	}{
+		{name: "list archives anonymously", path: "/archives"},
+		{name: "show archive anonymously", path: "/archives/1"},
+		{name: "list archives as admin", path: "/archives", token: "foo", user: "42"},
+		{name: "show archive as admin", path: "/archives/1", token: "foo", user: "42"},
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+apiPrefix+test.path, nil)
+			if err != nil {
+				t.Fatalf("Unexpected new request: %v", err)
+			}
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			var body archivesResponse
+			if strings.HasSuffix(test.path, "/1") {
+				body.Archives = make([]entity.Archive, 1)
+				err = json.NewDecoder(resp.Body).Decode(&body.Archives[0])
+			} else {
+				err = json.NewDecoder(resp.Body).Decode(&body)
+			}
+			if err != nil {
+				t.Fatalf("Unexpected decode response: %v", err)
+			}
+			archives := body.Archives
+			if len(archives) != 1 {
+				t.Fatalf("Unexpected archives, got %d instead of 1", len(archives))
+			}
+			if archives[0].User != test.user {
+				t.Errorf("Unexpected user, got %q instead of %q", archives[0].User, test.user)
+			}
+		})
+	}
+}
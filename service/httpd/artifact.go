@@ -0,0 +1,223 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/storage"
+	"github.com/wabarc/wayback/template"
+)
+
+// ErrOutsideStorage is returned if an artifact is not stored within the storage directory.
+var ErrOutsideStorage = errors.New("artifact is outside the storage directory")
+
+// artifactNames are the human-readable names of the artifact kinds.
+var artifactNames = map[string]string{
+	"img":   "Screenshot",
+	"pdf":   "PDF",
+	"raw":   "HTML",
+	"txt":   "Text",
+	"har":   "HAR",
+	"htm":   "Single file HTML",
+	"warc":  "WARC",
+	"media": "Media",
+	"file":  "File",
+}
+
+// archiveView represents the data of the capture detail page.
+type archiveView struct {
+	*entity.Archive
+	Created   string
+	Replay    string
+	Timeline  string
+	Artifacts []artifactView
+}
+
+// artifactView represents an artifact on the capture detail page.
+type artifactView struct {
+	Kind    string
+	Name    string
+	Size    string
+	URL     string
+	Hash    string
+	Remotes []string
+}
+
+// resolveArtifact returns the absolute path of the local file of an artifact,
+// it must be a regular file within the storage directory after resolving
+// the symbolic links.
+func resolveArtifact(local string) (string, error) {
+	if !config.Opts.EnabledReduxer() || local == "" {
+		return "", os.ErrNotExist
+	}
+	root, err := filepath.Abs(config.Opts.StorageDir())
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", err
+	}
+	path, err := filepath.Abs(local)
+	if err != nil {
+		return "", err
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", ErrOutsideStorage
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", os.ErrNotExist
+	}
+
+	return path, nil
+}
+
+func findArtifact(a *entity.Archive, kind string) (entity.Artifact, bool) {
+	for _, art := range a.Artifacts {
+		if art.Kind == kind {
+			return art, true
+		}
+	}
+	return entity.Artifact{}, false
+}
+
+// loadArchive returns the archive of the id in the route, it writes the
+// error response if not found.
+func (web *web) loadArchive(w http.ResponseWriter, r *http.Request) (*entity.Archive, bool) {
+	id, _ := strconv.Atoi(routeParam(r, "id"))
+	a, err := web.store.Archive(id)
+	switch {
+	case errors.Is(err, storage.ErrArchiveNotFound):
+		http.NotFound(w, r)
+		return nil, false
+	case err != nil:
+		logger.Error("query archive %d failed: %v", id, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return a, true
+}
+
+// showArchive renders the capture detail page of an archive.
+func (web *web) showArchive(w http.ResponseWriter, r *http.Request) {
+	a, ok := web.loadArchive(w, r)
+	if !ok {
+		return
+	}
+	logger.Debug("access archive %d", a.ID)
+
+	view := archiveView{
+		Archive:  a,
+		Created:  a.CreatedAt.Format(time.RFC1123),
+		Timeline: template.Path(web.router, "timeline") + "?" + url.Values{"url": {a.URL}}.Encode(),
+	}
+	for _, art := range a.Artifacts {
+		v := artifactView{Kind: art.Kind, Name: artifactNames[art.Kind], Hash: art.Hash, Remotes: art.Remotes}
+		if v.Name == "" {
+			v.Name = art.Kind
+		}
+		if path, err := resolveArtifact(art.Local); err == nil {
+			if info, err := os.Stat(path); err == nil {
+				v.Size = humanize.Bytes(uint64(info.Size()))
+			}
+			v.URL = template.Path(web.router, "artifact", "id", strconv.Itoa(a.ID), "kind", art.Kind)
+		}
+		if v.URL == "" && len(v.Remotes) == 0 {
+			continue
+		}
+		view.Artifacts = append(view.Artifacts, v)
+	}
+
+	if _, err := web.warcIndex(a); err == nil {
+		view.Replay = template.Path(web.router, "replay", "id", strconv.Itoa(a.ID))
+	}
+
+	html, ok := web.template.Render("archive", view)
+	if !ok {
+		logger.Error("render template for archive %d failed", a.ID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(html) // nolint:errcheck
+}
+
+// serveArtifact serves the local file of an artifact, with the support of
+// range requests. The artifact is downloaded as an attachment if the query
+// download is given.
+func (web *web) serveArtifact(w http.ResponseWriter, r *http.Request) {
+	a, ok := web.loadArchive(w, r)
+	if !ok {
+		return
+	}
+	kind := routeParam(r, "kind")
+	logger.Debug("access artifact %s of archive %d", kind, a.ID)
+
+	art, ok := findArtifact(a, kind)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	path, err := resolveArtifact(art.Local)
+	if err != nil {
+		if errors.Is(err, ErrOutsideStorage) {
+			logger.Warn("refuse to serve artifact %s of archive %d: %v", kind, a.ID, err)
+		}
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	ctype := mime.TypeByExtension(filepath.Ext(path))
+	if ctype == "" {
+		if mt, err := mimetype.DetectFile(path); err == nil {
+			ctype = mt.String()
+		}
+	}
+	disposition := "inline"
+	if _, ok := r.URL.Query()["download"]; ok {
+		disposition = "attachment"
+	}
+	if ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filepath.Base(path)}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// The captured webpages are served in a sandbox, away from the origin.
+	w.Header().Set("Content-Security-Policy", "sandbox")
+
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), f)
+}
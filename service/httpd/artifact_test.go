@@ -0,0 +1,182 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestResolveArtifact(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	os.Setenv("WAYBACK_STORAGE_DIR", root)
+	defer helper.Unsetenv("WAYBACK_STORAGE_DIR")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	inside := filepath.Join(root, "202301", "foo.png")
+	secret := filepath.Join(outside, "secret.txt")
+	for _, fp := range []string{inside, secret} {
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte("foo"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(secret, filepath.Join(root, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name  string
+		local string
+		err   error
+	}{
+		{name: "inside", local: inside},
+		{name: "traversal", local: filepath.Join(root, "..", filepath.Base(outside), "secret.txt"), err: ErrOutsideStorage},
+		{name: "outside", local: secret, err: ErrOutsideStorage},
+		{name: "symlink to outside", local: filepath.Join(root, "link.txt"), err: ErrOutsideStorage},
+		{name: "directory", local: filepath.Join(root, "202301"), err: os.ErrNotExist},
+		{name: "not exists", local: filepath.Join(root, "bar.png"), err: os.ErrNotExist},
+		{name: "empty", local: "", err: os.ErrNotExist},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := resolveArtifact(test.local)
+			if test.err == nil && err != nil {
+				t.Errorf("Unexpected resolve artifact: %v", err)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Errorf("Unexpected resolve artifact error, got %v instead of %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestServeArtifact(t *testing.T) {
+	root := t.TempDir()
+	os.Setenv("WAYBACK_STORAGE_DIR", root)
+	defer helper.Unsetenv("WAYBACK_STORAGE_DIR")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	pdf := filepath.Join(root, "example.pdf")
+	if err := os.WriteFile(pdf, []byte("%PDF-1.4 example"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	archive := &entity.Archive{
+		Source:  "https://example.com/",
+		Title:   "Example <Domain>",
+		Results: []entity.Result{{Slot: config.SLOT_IA, Dst: "https://web.archive.org/web/https://example.com/"}},
+		Artifacts: []entity.Artifact{
+			{Kind: "pdf", Local: pdf},
+			{Kind: "txt", Local: "/etc/passwd"},
+			{Kind: "img", Remotes: []string{"https://files.catbox.moe/foo.png"}},
+		},
+		Service: "web",
+	}
+	if err := store.CreateArchive(archive); err != nil {
+		t.Fatalf("Unexpected create archive: %v", err)
+	}
+
+	ctx := context.Background()
+	server := httptest.NewServer(newWeb(ctx, store, pooling.New(ctx, 1)).handle())
+	defer server.Close()
+
+	var tests = []struct {
+		name   string
+		path   string
+		rng    string
+		status int
+		ctype  string
+		want   string
+		skip   string
+	}{
+		{
+			name:   "detail page",
+			path:   "/archives/1",
+			status: http.StatusOK,
+			ctype:  "text/html; charset=utf-8",
+			want:   "Example &lt;Domain&gt;",
+			skip:   "/archives/1/artifacts/txt",
+		},
+		{
+			name:   "artifact",
+			path:   "/archives/1/artifacts/pdf",
+			status: http.StatusOK,
+			ctype:  "application/pdf",
+			want:   "%PDF-1.4 example",
+		},
+		{
+			name:   "range request",
+			path:   "/archives/1/artifacts/pdf",
+			rng:    "bytes=9-15",
+			status: http.StatusPartialContent,
+			ctype:  "application/pdf",
+			want:   "example",
+		},
+		{name: "outside storage", path: "/archives/1/artifacts/txt", status: http.StatusNotFound},
+		{name: "remote only", path: "/archives/1/artifacts/img", status: http.StatusNotFound},
+		{name: "unknown kind", path: "/archives/1/artifacts/foo", status: http.StatusNotFound},
+		{name: "unknown archive", path: "/archives/2", status: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, server.URL+test.path, nil)
+			if test.rng != "" {
+				req.Header.Set("Range", test.rng)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Fatalf("Unexpected status code, got %d instead of %d", resp.StatusCode, test.status)
+			}
+			if test.ctype != "" && resp.Header.Get("Content-Type") != test.ctype {
+				t.Errorf("Unexpected content type, got %s instead of %s", resp.Header.Get("Content-Type"), test.ctype)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if test.want != "" && !strings.Contains(string(body), test.want) {
+				t.Errorf("Unexpected body, %q not found in %q", test.want, body)
+			}
+			if test.skip != "" && strings.Contains(string(body), test.skip) {
+				t.Errorf("Unexpected body, %q found in %q", test.skip, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/progress"
+	"github.com/wabarc/wayback/publish"
+	"github.com/wabarc/wayback/reduxer"
+	"github.com/wabarc/wayback/service"
+	"github.com/wabarc/wayback/template"
+)
+
+// jobResponse represents a job along with the results of an async archive request.
+type jobResponse struct {
+	pooling.Job
+	Results template.Collector `json:"results,omitempty"`
+}
+
+// outputs keeps the results of async jobs for polling, until the jobs are
+// evicted from the pool.
+type outputs struct {
+	mu      sync.Mutex
+	results map[string]template.Collector
+}
+
+func newOutputs() *outputs {
+	return &outputs{results: make(map[string]template.Collector)}
+}
+
+func (o *outputs) put(pool *pooling.Pool, id string, results template.Collector) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for k := range o.results {
+		if _, ok := pool.Job(k); !ok {
+			delete(o.results, k)
+		}
+	}
+	o.results[id] = results
+}
+
+func (o *outputs) get(id string) template.Collector {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.results[id]
+}
+
+func (web *web) jobResponse(job pooling.Job) jobResponse {
+	return jobResponse{Job: job, Results: web.outputs.get(job.ID)}
+}
+
+// validWebhook checks the webhook URL of an async request, it writes the
+// error response and returns false if it is invalid.
+func validWebhook(w http.ResponseWriter, hook string) bool {
+	if hook == "" {
+		return true
+	}
+	if config.Opts.WebhookSecret() == "" {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidRequest, "webhooks are disabled, WAYBACK_WEBHOOK_SECRET is not set")
+		return false
+	}
+	u, err := url.Parse(hook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidURL, fmt.Sprintf("invalid webhook: %q", hook))
+		return false
+	}
+	// The addresses of the host names are checked once they are resolved
+	// at delivery, see webhookClient.
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !allowWebhookIP(ip) {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidURL, fmt.Sprintf("webhook address is not allowed: %q", hook))
+		return false
+	}
+	return true
+}
+
+// archiveAsync puts the archive request to the pool and responds with the
+// job at once. The results are posted to the webhook if given once the job
+// finished.
+func (web *web) archiveAsync(w http.ResponseWriter, r *http.Request, urls []*url.URL, hook string) {
+	var done func(pooling.Job)
+	if hook != "" {
+		done = func(job pooling.Job) {
+			go func() {
+				payload := webhookPayload{Event: webhookEvent, Job: web.jobResponse(job)}
+				if err := deliver(web.ctx, hook, webhookEvent, job.ID, payload); err != nil {
+					logger.Error("deliver webhook of job %s failed: %v", job.ID, err)
+				}
+			}()
+		}
+	}
+	id := web.enqueue(urls, owner(r), canPublish(r), done)
+	logger.Info("queued async archive job %s", id)
+
+	job, _ := web.pool.Job(id)
+	w.Header().Set("Location", apiPrefix+"/jobs/"+id)
+	writeJSON(w, http.StatusAccepted, web.jobResponse(job))
+}
+
+// enqueue puts an archive request of the URLs to the pool on behalf of the
+// user, i.e. the owner of the request, and returns the id of the job. The
+// results are kept for polling, the progress events are streamed, and the
+// done func is called with the job once it finished if given.
+func (web *web) enqueue(urls []*url.URL, user string, publishable bool, done func(pooling.Job)) string {
+	id := pooling.NewID()
+	web.streams.open(id)
+	report := web.streams.reporter(id)
+	bucket := pooling.Bucket{
+		ID:      id,
+		Service: metrics.ServiceWeb,
+		User:    user,
+		URLs:    urls,
+		Request: func(ctx context.Context) error {
+			ctx = progress.WithReporter(ctx, report)
+			return service.Wayback(ctx, urls, func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
+				service.Record(web.store, cols, rdx, metrics.ServiceWeb, "")
+				web.outputs.put(web.pool, id, transform(cols))
+				metrics.IncrementWayback(metrics.ServiceWeb, metrics.StatusSuccess)
+
+				if publishable {
+					ctx := context.WithValue(context.Background(), publish.PubBundle{}, rdx)
+					ctx = progress.WithReporter(ctx, report)
+					web.streams.hold(id)
+					go func() {
+						defer web.streams.release(id)
+						publish.To(ctx, cols, "web")
+					}()
+				}
+				return nil
+			})
+		},
+		Fallback: func(_ context.Context, _ error) error {
+			metrics.IncrementWayback(metrics.ServiceWeb, metrics.StatusFailure)
+			return nil
+		},
+		Done: func(job pooling.Job) {
+			ev := progress.Event{Kind: progress.Done, State: job.State.String(), Time: time.Now()}
+			if n := len(job.Attempts); n > 0 && job.State != pooling.StateSucceeded {
+				ev.Error = job.Attempts[n-1].Error
+			}
+			report(ev)
+			web.streams.release(id)
+			if done != nil {
+				done(job)
+			}
+		},
+	}
+	report(progress.Event{Kind: progress.Queued, Time: time.Now()})
+	web.pool.Put(bucket)
+
+	return id
+}
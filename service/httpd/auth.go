@@ -0,0 +1,214 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/auth"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+)
+
+const (
+	tokenCookie = "wayback_token"
+	loginMaxAge = 30 * 24 * time.Hour
+)
+
+type tokenKey struct{}
+
+// credential returns the secret of the API token from the Authorization
+// header, or from the login cookie of the web UI.
+func credential(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	if c, err := r.Cookie(tokenCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// authorize authenticates the request and checks whether the token is
+// granted the scope, any valid token is accepted if the scope is empty.
+// It returns the request with the token attached, or the status to reject
+// it. Anonymous requests are passed if not required.
+func (web *web) authorize(r *http.Request, scope string, required bool) (*http.Request, int) {
+	secret := credential(r)
+	if secret == "" && !required {
+		return r, 0
+	}
+
+	token, err := auth.Authenticate(web.store, secret)
+	if err != nil {
+		if !errors.Is(err, auth.ErrInvalidToken) {
+			logger.Error("authenticate failed: %v", err)
+		}
+		logger.Warn("unauthorized access to %s from %s", r.URL.Path, r.RemoteAddr)
+		return r, http.StatusUnauthorized
+	}
+	if scope != "" && !token.Allows(scope) {
+		logger.Warn("token %s is not granted the %s scope", token.ID, scope)
+		return r, http.StatusForbidden
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), tokenKey{}, token)), 0
+}
+
+// tokenRequired reports whether the API requires a token, it is implied by
+// the login of the web UI that the service can be exposed publicly.
+func tokenRequired() bool {
+	return config.Opts.RequireToken() || config.Opts.RequireLogin()
+}
+
+// requireAPI guards a handler of the JSON API with the scope.
+func (web *web) requireAPI(scope string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, status := web.authorize(r, scope, tokenRequired())
+		switch status {
+		case http.StatusUnauthorized:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="wayback"`)
+			writeError(w, status, codeUnauthorized, "missing or invalid token")
+		case http.StatusForbidden:
+			writeError(w, status, codeForbidden, "token is not granted the "+scope+" scope")
+		default:
+			next(w, r)
+		}
+	})
+}
+
+// requireJSON guards a handler of the unversioned JSON endpoints with the scope.
+func (web *web) requireJSON(scope string, required bool, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, status := web.authorize(r, scope, required)
+		if status != 0 {
+			writeJSON(w, status, map[string]string{"error": http.StatusText(status)})
+			return
+		}
+		next(w, r)
+	})
+}
+
+// requireAdmin rejects requests without a token granted the admin scope.
+func (web *web) requireAdmin(next http.Handler) http.Handler {
+	return web.requireJSON(entity.ScopeAdmin, true, next.ServeHTTP)
+}
+
+// requireLogin guards a handler of the web UI with the scope, it redirects
+// to the login page if the token is missing.
+func (web *web) requireLogin(scope string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, status := web.authorize(r, scope, config.Opts.RequireLogin())
+		switch {
+		case status == http.StatusUnauthorized && r.Method == http.MethodGet:
+			login := "/login"
+			if r.URL.Path != "/" {
+				login += "?" + url.Values{"next": {r.URL.RequestURI()}}.Encode()
+			}
+			http.Redirect(w, r, login, http.StatusFound)
+		case status != 0:
+			http.Error(w, http.StatusText(status), status)
+		default:
+			next(w, r)
+		}
+	})
+}
+
+// canPublish reports whether the request is allowed to publish the results,
+// anonymous requests are passed only if the token is not required.
+func canPublish(r *http.Request) bool {
+	token, ok := r.Context().Value(tokenKey{}).(*entity.Token)
+	return !ok || token.Allows(entity.ScopePublish)
+}
+
+// isAdmin reports whether the request is authenticated by a token granted
+// the admin scope.
+func isAdmin(r *http.Request) bool {
+	token, ok := r.Context().Value(tokenKey{}).(*entity.Token)
+	return ok && token.Allows(entity.ScopeAdmin)
+}
+
+// identity returns the key to rate limit the request, it is the token if
+// authenticated, or the client address.
+func identity(r *http.Request) string {
+	if token, ok := r.Context().Value(tokenKey{}).(*entity.Token); ok {
+		return "token:" + token.ID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+func (web *web) showLogin(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("access login")
+	web.renderLogin(w, http.StatusOK, "", r.URL.Query().Get("next"))
+}
+
+func (web *web) login(w http.ResponseWriter, r *http.Request) {
+	secret := strings.TrimSpace(r.PostFormValue("token"))
+	token, err := auth.Authenticate(web.store, secret)
+	if err != nil {
+		logger.Warn("login failed from %s: %v", r.RemoteAddr, err)
+		web.renderLogin(w, http.StatusUnauthorized, "Invalid token", r.PostFormValue("next"))
+		return
+	}
+	logger.Info("login with token %s from %s", token.ID, r.RemoteAddr)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    secret,
+		Path:     "/",
+		MaxAge:   int(loginMaxAge.Seconds()),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	next := r.PostFormValue("next")
+	if !localPath(next) {
+		next = "/"
+	}
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+func (web *web) logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+// localPath reports whether the path is on this server, that it is safe to
+// redirect to.
+func localPath(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") && !strings.HasPrefix(path, "/\\")
+}
+
+func (web *web) renderLogin(w http.ResponseWriter, status int, message, next string) {
+	if !localPath(next) {
+		next = ""
+	}
+	html, ok := web.template.Render("login", map[string]string{"Error": message, "Next": next})
+	if !ok {
+		logger.Error("render template for login request failed")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(html) // nolint:errcheck
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/auth"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestAuthorization(t *testing.T) {
+	helper.Unsetenv("WAYBACK_ADMIN_TOKEN")
+	os.Setenv("WAYBACK_REQUIRE_LOGIN", "true")
+	os.Setenv("WAYBACK_RATE_LIMIT", "2")
+	defer helper.Unsetenv("WAYBACK_REQUIRE_LOGIN", "WAYBACK_RATE_LIMIT")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	secrets := map[string]string{}
+	for _, scope := range entity.Scopes {
+		secret, _, err := auth.Issue(store, scope, []string{scope})
+		if err != nil {
+			t.Fatalf("Unexpected issue token: %v", err)
+		}
+		secrets[scope] = secret
+	}
+
+	ctx := context.Background()
+	pool := pooling.New(ctx, 1)
+	go pool.Roll()
+	defer pool.Close()
+
+	server := httptest.NewServer(newWeb(ctx, store, pool).handle())
+	defer server.Close()
+
+	var tests = []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		cookie   string
+		form     url.Values
+		body     string
+		status   int
+		location string
+	}{
+		{name: "home without login", method: http.MethodGet, path: "/", status: http.StatusFound},
+		{name: "home with login", method: http.MethodGet, path: "/", cookie: secrets[entity.ScopePlayback], status: http.StatusOK},
+		{name: "login page", method: http.MethodGet, path: "/login", status: http.StatusOK},
+		{name: "login with invalid token", method: http.MethodPost, path: "/login", form: url.Values{"token": {"foo"}}, status: http.StatusUnauthorized},
+		{name: "login", method: http.MethodPost, path: "/login", form: url.Values{"token": {secrets[entity.ScopeArchive]}}, status: http.StatusFound},
+		{name: "share without login", method: http.MethodGet, path: "/share?url=https%3A%2F%2Fexample.com", status: http.StatusFound, location: "/login?next=%2Fshare%3Furl%3Dhttps%253A%252F%252Fexample.com"},
+		{name: "login with next", method: http.MethodPost, path: "/login", form: url.Values{"token": {secrets[entity.ScopeArchive]}, "next": {"/share?url=x"}}, status: http.StatusFound, location: "/share?url=x"},
+		{name: "login with external next", method: http.MethodPost, path: "/login", form: url.Values{"token": {secrets[entity.ScopeArchive]}, "next": {"//example.com"}}, status: http.StatusFound, location: "/"},
+		{name: "wayback without login", method: http.MethodPost, path: "/wayback", form: url.Values{"text": {"foo"}}, status: http.StatusUnauthorized},
+		{name: "wayback without scope", method: http.MethodPost, path: "/wayback", cookie: secrets[entity.ScopePlayback], form: url.Values{"text": {"foo"}}, status: http.StatusForbidden},
+		{name: "api without token", method: http.MethodGet, path: "/api/v1/archives", status: http.StatusUnauthorized},
+		{name: "api with invalid token", method: http.MethodGet, path: "/api/v1/archives", token: "foo", status: http.StatusUnauthorized},
+		{name: "api without scope", method: http.MethodGet, path: "/api/v1/archives", token: secrets[entity.ScopeArchive], status: http.StatusForbidden},
+		{name: "api with scope", method: http.MethodGet, path: "/api/v1/archives", token: secrets[entity.ScopePlayback], status: http.StatusOK},
+		{name: "api with admin scope", method: http.MethodGet, path: "/api/v1/archives", token: secrets[entity.ScopeAdmin], status: http.StatusOK},
+		{name: "openapi without token", method: http.MethodGet, path: "/api/v1/openapi.json", status: http.StatusOK},
+		{name: "jobs without token", method: http.MethodGet, path: "/jobs", status: http.StatusUnauthorized},
+		{name: "admin without scope", method: http.MethodGet, path: "/admin/dead-letters", token: secrets[entity.ScopePublish], status: http.StatusForbidden},
+		{name: "admin with scope", method: http.MethodGet, path: "/admin/dead-letters", token: secrets[entity.ScopeAdmin], status: http.StatusOK},
+		{name: "rate limit first", method: http.MethodPost, path: "/api/v1/playback", token: secrets[entity.ScopePlayback], body: `{"urls":[]}`, status: http.StatusUnprocessableEntity},
+		{name: "rate limit second", method: http.MethodPost, path: "/api/v1/playback", token: secrets[entity.ScopePlayback], body: `{"urls":[]}`, status: http.StatusUnprocessableEntity},
+		{name: "rate limit exceeded", method: http.MethodPost, path: "/api/v1/playback", token: secrets[entity.ScopePlayback], body: `{"urls":[]}`, status: http.StatusTooManyRequests},
+		{name: "rate limit another token", method: http.MethodPost, path: "/api/v1/playback", token: secrets[entity.ScopeAdmin], body: `{"urls":[]}`, status: http.StatusUnprocessableEntity},
+	}
+
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, contentType := test.body, "application/json"
+			if test.form != nil {
+				body, contentType = test.form.Encode(), "application/x-www-form-urlencoded"
+			}
+			req, err := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Unexpected new request: %v", err)
+			}
+			req.Header.Set("Content-Type", contentType)
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			if test.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: tokenCookie, Value: test.cookie})
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != test.status {
+				t.Errorf("Unexpected status code, got %d instead of %d", resp.StatusCode, test.status)
+			}
+			if loc := resp.Header.Get("Location"); test.location != "" && loc != test.location {
+				t.Errorf("Unexpected location, got %s instead of %s", loc, test.location)
+			}
+		})
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	var tests = []struct {
+		path string
+		exp  bool
+	}{
+		{path: "/", exp: true},
+		{path: "/share?url=https://example.com", exp: true},
+		{path: "", exp: false},
+		{path: "https://example.com/", exp: false},
+		{path: "//example.com/", exp: false},
+		{path: "/\\example.com/", exp: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if got := localPath(test.path); got != test.exp {
+				t.Errorf("Unexpected local path, got %t instead of %t", got, test.exp)
+			}
+		})
+	}
+}
+
+func TestCanPublish(t *testing.T) {
+	var tests = []struct {
+		name  string
+		token *entity.Token
+		exp   bool
+	}{
+		{name: "anonymous", exp: true},
+		{name: "without scope", token: &entity.Token{Scopes: []string{entity.ScopeArchive}}, exp: false},
+		{name: "with scope", token: &entity.Token{Scopes: []string{entity.ScopeArchive, entity.ScopePublish}}, exp: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			if test.token != nil {
+				r = r.WithContext(context.WithValue(r.Context(), tokenKey{}, test.token))
+			}
+			if got := canPublish(r); got != test.exp {
+				t.Errorf("Unexpected can publish, got %t instead of %t", got, test.exp)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"encoding/csv"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/template"
+)
+
+// batch represents a list of URLs submitted at once, every URL is archived
+// by a job of its own.
+type batch struct {
+	ID        string
+	CreatedAt time.Time
+	Jobs      []batchJob
+}
+
+// batchJob represents the job of an URL in a batch.
+type batchJob struct {
+	ID  string
+	URL string
+}
+
+// batches keeps the batches until all of their jobs are evicted from the pool.
+type batches struct {
+	mu      sync.Mutex
+	entries map[string]*batch
+}
+
+func newBatches() *batches {
+	return &batches{entries: make(map[string]*batch)}
+}
+
+func (b *batches) put(pool *pooling.Pool, bt *batch) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, old := range b.entries {
+		evicted := true
+		for _, job := range old.Jobs {
+			if _, ok := pool.Job(job.ID); ok {
+				evicted = false
+				break
+			}
+		}
+		if evicted {
+			delete(b.entries, id)
+		}
+	}
+	b.entries[bt.ID] = bt
+}
+
+func (b *batches) get(id string) (*batch, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bt, ok := b.entries[id]
+	return bt, ok
+}
+
+// batchResponse represents a batch along with the states and results of its jobs.
+type batchResponse struct {
+	ID        string         `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	Total     int            `json:"total"`
+	Finished  int            `json:"finished"`
+	States    map[string]int `json:"states"`
+	Jobs      []batchItem    `json:"jobs"`
+}
+
+// batchItem represents the job of an URL in the batch response.
+type batchItem struct {
+	Job     string             `json:"job"`
+	URL     string             `json:"url"`
+	State   string             `json:"state"`
+	Error   string             `json:"error,omitempty"`
+	Results template.Collector `json:"results,omitempty"`
+}
+
+// batchView represents the data of the batch progress page.
+type batchView struct {
+	batchResponse
+	Done    bool
+	Percent int
+	JSON    string
+	CSV     string
+	API     string
+}
+
+func (web *web) batchResponse(bt *batch) batchResponse {
+	resp := batchResponse{ID: bt.ID, CreatedAt: bt.CreatedAt, Total: len(bt.Jobs), States: make(map[string]int), Jobs: []batchItem{}}
+	for _, bj := range bt.Jobs {
+		item := batchItem{Job: bj.ID, URL: bj.URL, State: "unknown"}
+		if job, ok := web.pool.Job(bj.ID); ok {
+			item.State = job.State.String()
+			if job.State.Finished() {
+				resp.Finished++
+			}
+			if n := len(job.Attempts); n > 0 && job.State != pooling.StateSucceeded {
+				item.Error = job.Attempts[n-1].Error
+			}
+			item.Results = web.outputs.get(job.ID)
+		}
+		resp.States[item.State]++
+		resp.Jobs = append(resp.Jobs, item)
+	}
+	return resp
+}
+
+// readList reads the URL list of a batch request, from the file or text
+// field of a form, or the request body.
+func readList(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxListSize)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxListSize); err != nil {
+			return nil, err
+		}
+		if f, _, err := r.FormFile("file"); err == nil {
+			defer f.Close()
+			return io.ReadAll(f)
+		}
+		return []byte(r.PostFormValue("text")), nil
+	case "application/x-www-form-urlencoded":
+		return []byte(r.PostFormValue("text")), nil
+	}
+	return io.ReadAll(r.Body)
+}
+
+// createBatch reads the URL list of the request, and puts a job to the
+// pool for each URL in it.
+func (web *web) createBatch(w http.ResponseWriter, r *http.Request) (*batch, error) {
+	data, err := readList(w, r)
+	if err != nil {
+		return nil, err
+	}
+	urls, err := parseList(data)
+	if err != nil {
+		return nil, err
+	}
+
+	publishable, user := canPublish(r), owner(r)
+	bt := &batch{ID: pooling.NewID(), CreatedAt: time.Now()}
+	for _, u := range urls {
+		metrics.IncrementWayback(metrics.ServiceWeb, metrics.StatusRequest)
+		id := web.enqueue([]*url.URL{u}, user, publishable, nil)
+		bt.Jobs = append(bt.Jobs, batchJob{ID: id, URL: u.String()})
+	}
+	web.batches.put(web.pool, bt)
+	logger.Info("queued batch %s of %d urls", bt.ID, len(bt.Jobs))
+
+	return bt, nil
+}
+
+// batchStatus returns the status code of the error of creating a batch.
+func batchStatus(err error) int {
+	if errors.Is(err, ErrNoURLs) || errors.Is(err, ErrTooManyURLs) || errors.Is(err, ErrSitemapIndex) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusBadRequest
+}
+
+// showBatchForm renders the page to submit a list of URLs.
+func (web *web) showBatchForm(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("access batch form")
+	web.render(w, http.StatusOK, "batches", map[string]interface{}{"MaxURLs": maxBatchURLs})
+}
+
+// submitBatch creates a batch from the submitted form, and redirects to
+// its progress page.
+func (web *web) submitBatch(w http.ResponseWriter, r *http.Request) {
+	bt, err := web.createBatch(w, r)
+	if err != nil {
+		logger.Warn("create batch failed: %v", err)
+		web.render(w, batchStatus(err), "batches", map[string]interface{}{"MaxURLs": maxBatchURLs, "Error": err.Error()})
+		return
+	}
+	http.Redirect(w, r, template.Path(web.router, "batch", "id", bt.ID), http.StatusSeeOther)
+}
+
+// showBatch renders the progress page of a batch, it is refreshed until
+// all of the jobs finished.
+func (web *web) showBatch(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+	logger.Debug("access batch %s", id)
+
+	bt, ok := web.batches.get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	view := batchView{
+		batchResponse: web.batchResponse(bt),
+		JSON:          template.Path(web.router, "report", "id", id, "format", "json"),
+		CSV:           template.Path(web.router, "report", "id", id, "format", "csv"),
+		API:           apiPrefix + "/batches/" + id,
+	}
+	view.Done = view.Finished == view.Total
+	if view.Total > 0 {
+		view.Percent = view.Finished * 100 / view.Total
+	}
+	web.render(w, http.StatusOK, "batch", view)
+}
+
+// downloadReport writes the report of a batch as an attachment in CSV or
+// JSON, the CSV has a row for each result.
+func (web *web) downloadReport(w http.ResponseWriter, r *http.Request) {
+	id, format := routeParam(r, "id"), routeParam(r, "format")
+	logger.Debug("download %s report of batch %s", format, id)
+
+	bt, ok := web.batches.get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	resp := web.batchResponse(bt)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "batch-" + id + "." + format}))
+	if format == "json" {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"job", "url", "state", "slot", "dst", "error"}) // nolint:errcheck
+	for _, item := range resp.Jobs {
+		if len(item.Results) == 0 {
+			cw.Write([]string{item.Job, item.URL, item.State, "", "", item.Error}) // nolint:errcheck
+			continue
+		}
+		for _, res := range item.Results {
+			cw.Write([]string{item.Job, item.URL, item.State, res.Slot, res.Dst, item.Error}) // nolint:errcheck
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		logger.Error("write report of batch %s failed: %v", id, err)
+	}
+}
+
+func (web *web) apiCreateBatch(w http.ResponseWriter, r *http.Request) {
+	logger.Info("api batch request start...")
+
+	bt, err := web.createBatch(w, r)
+	if err != nil {
+		status := batchStatus(err)
+		code := codeInvalidRequest
+		if status == http.StatusUnprocessableEntity {
+			code = codeInvalidURL
+		}
+		writeError(w, status, code, err.Error())
+		return
+	}
+	w.Header().Set("Location", apiPrefix+"/batches/"+bt.ID)
+	writeJSON(w, http.StatusAccepted, web.batchResponse(bt))
+}
+
+func (web *web) apiShowBatch(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+	logger.Debug("api access batch %s", id)
+
+	bt, ok := web.batches.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, codeNotFound, "batch not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, web.batchResponse(bt))
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestBatch(t *testing.T) {
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	// The pool is not rolled, the jobs stay queued.
+	ctx := context.Background()
+	server := httptest.NewServer(newWeb(ctx, store, pooling.New(ctx, 1)).handle())
+	defer server.Close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	t.Run("api", func(t *testing.T) {
+		resp, err := client.Post(server.URL+apiPrefix+"/batches", "text/csv", strings.NewReader("url\nhttps://example.com/\nhttps://example.org/\n"))
+		if err != nil {
+			t.Fatalf("Unexpected request: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("Unexpected status code, got %d instead of %d", resp.StatusCode, http.StatusAccepted)
+		}
+		var got batchResponse
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("Unexpected decode response: %v", err)
+		}
+		if got.Total != 2 || got.States["queued"] != 2 || got.Jobs[1].URL != "https://example.org/" {
+			t.Errorf("Unexpected batch, got %+v", got)
+		}
+		if loc := resp.Header.Get("Location"); loc != apiPrefix+"/batches/"+got.ID {
+			t.Errorf("Unexpected location, got %s instead of %s", loc, apiPrefix+"/batches/"+got.ID)
+		}
+
+		resp, err = client.Get(server.URL + "/batches/" + got.ID + "/report.csv")
+		if err != nil {
+			t.Fatalf("Unexpected request: %v", err)
+		}
+		defer resp.Body.Close()
+		records, err := csv.NewReader(resp.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("Unexpected read csv report: %v", err)
+		}
+		if len(records) != 3 || records[1][1] != "https://example.com/" || records[1][2] != "queued" {
+			t.Errorf("Unexpected csv report, got %v", records)
+		}
+		if cd := resp.Header.Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") {
+			t.Errorf("Unexpected content disposition, got %s", cd)
+		}
+	})
+
+	t.Run("api errors", func(t *testing.T) {
+		var tests = []struct {
+			body   string
+			status int
+			code   string
+		}{
+			{body: "no urls here", status: http.StatusUnprocessableEntity, code: codeInvalidURL},
+			{body: `<sitemapindex><sitemap><loc>https://example.com/s.xml</loc></sitemap></sitemapindex>`, status: http.StatusUnprocessableEntity, code: codeInvalidURL},
+			{body: `<?xml version="1.0"?><urlset><url><loc>`, status: http.StatusBadRequest, code: codeInvalidRequest},
+		}
+		for _, test := range tests {
+			resp, err := client.Post(server.URL+apiPrefix+"/batches", "application/xml", strings.NewReader(test.body))
+			if err != nil {
+				t.Fatalf("Unexpected request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Errorf("Unexpected status code of %q, got %d instead of %d", test.body, resp.StatusCode, test.status)
+			}
+		}
+
+		resp, err := client.Get(server.URL + apiPrefix + "/batches/unknown")
+		if err != nil {
+			t.Fatalf("Unexpected request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Unexpected status code, got %d instead of %d", resp.StatusCode, http.StatusNotFound)
+		}
+	})
+
+	t.Run("web", func(t *testing.T) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "bookmarks.html")
+		fw.Write([]byte(`<DL><DT><A HREF="https://example.com/?a=1&amp;b=2">Example</A></DL>`)) // nolint:errcheck
+		mw.Close()
+
+		resp, err := client.Post(server.URL+"/batches", mw.FormDataContentType(), &body)
+		if err != nil {
+			t.Fatalf("Unexpected request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Fatalf("Unexpected status code, got %d instead of %d", resp.StatusCode, http.StatusSeeOther)
+		}
+		loc := resp.Header.Get("Location")
+		if !strings.HasPrefix(loc, "/batches/") {
+			t.Fatalf("Unexpected location, got %s", loc)
+		}
+
+		resp, err = client.Get(server.URL + loc)
+		if err != nil {
+			t.Fatalf("Unexpected request: %v", err)
+		}
+		defer resp.Body.Close()
+		page, _ := io.ReadAll(resp.Body)
+		for _, want := range []string{`<meta http-equiv="refresh"`, "0 of 1 finished", "https://example.com/?a=1&amp;b=2", loc + "/report.csv"} {
+			if !strings.Contains(string(page), want) {
+				t.Errorf("Unexpected batch page, %q not found in %q", want, page)
+			}
+		}
+
+		resp, err = client.PostForm(server.URL+"/batches", map[string][]string{"text": {"nothing"}})
+		if err != nil {
+			t.Fatalf("Unexpected request: %v", err)
+		}
+		defer resp.Body.Close()
+		page, _ = io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(string(page), ErrNoURLs.Error()) {
+			t.Errorf("Unexpected response, got %d: %s", resp.StatusCode, page)
+		}
+	})
+}
@@ -0,0 +1,241 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/progress"
+)
+
+const (
+	// streamRetention is how long the events of a finished job are kept for
+	// the clients subscribed late.
+	streamRetention = 10 * time.Minute
+
+	// subscriberBuffer is the number of events buffered for a subscriber,
+	// a subscriber that falls behind it is dropped.
+	subscriberBuffer = 64
+
+	heartbeatInterval = 15 * time.Second
+
+	// endEvent is the last event of a stream, it tells the client not to
+	// reconnect.
+	endEvent = "event: end\ndata: {}\n\n"
+)
+
+// streams fans out the progress events of async jobs to the subscribers.
+type streams struct {
+	mu   sync.Mutex
+	jobs map[string]*stream
+}
+
+type stream struct {
+	events []progress.Event
+	subs   map[chan progress.Event]struct{}
+	refs   int
+	closed bool
+}
+
+func newStreams() *streams {
+	return &streams{jobs: make(map[string]*stream)}
+}
+
+// open creates the stream of the job, held once by the job itself.
+func (s *streams) open(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[id] = &stream{subs: make(map[chan progress.Event]struct{}), refs: 1}
+}
+
+// hold keeps the stream of the job open until it is released, for the work
+// that continues after the job, e.g. publishing.
+func (s *streams) hold(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st, ok := s.jobs[id]; ok && !st.closed {
+		st.refs++
+	}
+}
+
+// release closes the stream of the job once it is no longer held, and
+// removes it after the retention.
+func (s *streams) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.jobs[id]
+	if !ok || st.closed {
+		return
+	}
+	if st.refs--; st.refs > 0 {
+		return
+	}
+	st.closed = true
+	for ch := range st.subs {
+		close(ch)
+	}
+	st.subs = nil
+	time.AfterFunc(streamRetention, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.jobs, id)
+	})
+}
+
+// reporter returns the progress reporter which appends events to the stream of the job.
+func (s *streams) reporter(id string) progress.Reporter {
+	return func(e progress.Event) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		st, ok := s.jobs[id]
+		if !ok || st.closed {
+			return
+		}
+		st.events = append(st.events, e)
+		for ch := range st.subs {
+			select {
+			case ch <- e:
+			default:
+				logger.Warn("drop slow subscriber of job %s", id)
+				delete(st.subs, ch)
+				close(ch)
+			}
+		}
+	}
+}
+
+// subscribe returns the past events of the job and the channel of the
+// events to come, the channel is closed once the stream closed, or nil if
+// the stream is closed already.
+func (s *streams) subscribe(id string) ([]progress.Event, <-chan progress.Event, func(), bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.jobs[id]
+	if !ok {
+		return nil, nil, nil, false
+	}
+	past := append([]progress.Event(nil), st.events...)
+	if st.closed {
+		return past, nil, func() {}, true
+	}
+	ch := make(chan progress.Event, subscriberBuffer)
+	st.subs[ch] = struct{}{}
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := st.subs[ch]; ok {
+			delete(st.subs, ch)
+			close(ch)
+		}
+	}
+
+	return past, ch, cancel, true
+}
+
+// apiJobEvents streams the progress events of an async job as Server-Sent
+// Events, the id of an event is its sequence number in the stream. The stream
+// ends with an end event once the job and its publishing finished.
+func (web *web) apiJobEvents(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+	logger.Debug("api access events of job %s", id)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, codeInternal, "streaming unsupported")
+		return
+	}
+	if job, ok := web.pool.Job(id); ok && !ownsJob(r, job) {
+		writeError(w, http.StatusNotFound, codeNotFound, "no events of job "+id)
+		return
+	}
+	past, ch, cancel, ok := web.streams.subscribe(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, codeNotFound, "no events of job "+id)
+		return
+	}
+	defer cancel()
+
+	// Skip the events already received by a reconnecting client.
+	seq, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	if seq < 0 || seq > len(past) {
+		seq = 0
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(e progress.Event) bool {
+		seq++
+		data, err := json.Marshal(e)
+		if err != nil {
+			return false
+		}
+		if _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", seq, e.Kind, data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	// replay writes the events not received yet, and the end event if the
+	// stream is closed.
+	replay := func(past []progress.Event, closed bool) bool {
+		for _, e := range past[seq:] {
+			if !write(e) {
+				return false
+			}
+		}
+		if closed {
+			fmt.Fprint(w, endEvent) // nolint:errcheck
+		}
+		flusher.Flush()
+		return !closed
+	}
+	if !replay(past, ch == nil) {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e, ok := <-ch:
+			if !ok {
+				// A dropped subscriber reconnects to resume from the last
+				// event, or catches up the events missed if the stream closed.
+				if past, ch, cancel, ok := web.streams.subscribe(id); ok {
+					cancel()
+					if ch == nil && seq <= len(past) {
+						replay(past, true)
+					}
+				}
+				return
+			}
+			if !write(e) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/progress"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestStreams(t *testing.T) {
+	s := newStreams()
+	s.open("foo")
+	report := s.reporter("foo")
+	report(progress.Event{Kind: progress.Queued})
+
+	past, ch, cancel, ok := s.subscribe("foo")
+	if !ok || ch == nil {
+		t.Fatal("Unexpected subscribe an open stream failed")
+	}
+	defer cancel()
+	if len(past) != 1 || past[0].Kind != progress.Queued {
+		t.Errorf("Unexpected past events, got %v", past)
+	}
+
+	// Held by the publishing, the stream stays open after the job is done.
+	s.hold("foo")
+	report(progress.Event{Kind: progress.Done})
+	s.release("foo")
+	report(progress.Event{Kind: progress.Published})
+	s.release("foo")
+
+	var kinds []progress.Kind
+	for e := range ch {
+		kinds = append(kinds, e.Kind)
+	}
+	if len(kinds) != 2 || kinds[0] != progress.Done || kinds[1] != progress.Published {
+		t.Errorf("Unexpected streamed events, got %v", kinds)
+	}
+
+	if _, ch, _, ok := s.subscribe("foo"); !ok || ch != nil {
+		t.Errorf("Unexpected subscribe a closed stream, got channel %v", ch)
+	}
+	if _, _, _, ok := s.subscribe("bar"); ok {
+		t.Errorf("Unexpected subscribe an unknown stream")
+	}
+}
+
+func TestJobEvents(t *testing.T) {
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	web := newWeb(ctx, store, pooling.New(ctx, 1))
+	web.streams.open("foo")
+	report := web.streams.reporter("foo")
+	report(progress.Event{Kind: progress.Queued})
+	report(progress.Event{Kind: progress.Archived, Src: "https://example.com", Slot: config.SLOT_IA, Dst: "https://web.archive.org/"})
+	report(progress.Event{Kind: progress.Done, State: pooling.StateSucceeded.String()})
+	web.streams.release("foo")
+
+	server := httptest.NewServer(web.handle())
+	defer server.Close()
+
+	var tests = []struct {
+		name   string
+		id     string
+		last   string
+		status int
+		want   []string
+		skip   []string
+	}{
+		{
+			name:   "all events",
+			id:     "foo",
+			status: http.StatusOK,
+			want:   []string{"id: 1\nevent: queued\n", "id: 2\nevent: archived\n", `"dst":"https://web.archive.org/"`, "id: 3\nevent: done\n", `"state":"succeeded"`, endEvent},
+		},
+		{
+			name:   "resume from last event",
+			id:     "foo",
+			last:   "2",
+			status: http.StatusOK,
+			want:   []string{"id: 3\nevent: done\n", endEvent},
+			skip:   []string{"event: queued", "event: archived"},
+		},
+		{
+			name:   "unknown job",
+			id:     "bar",
+			status: http.StatusNotFound,
+			want:   []string{codeNotFound},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, server.URL+apiPrefix+"/jobs/"+test.id+"/events", nil)
+			if test.last != "" {
+				req.Header.Set("Last-Event-ID", test.last)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Fatalf("Unexpected status code, got %d instead of %d", resp.StatusCode, test.status)
+			}
+			if test.status == http.StatusOK && resp.Header.Get("Content-Type") != "text/event-stream" {
+				t.Errorf("Unexpected content type, got %s", resp.Header.Get("Content-Type"))
+			}
+			body, _ := io.ReadAll(resp.Body)
+			for _, want := range test.want {
+				if !strings.Contains(string(body), want) {
+					t.Errorf("Unexpected events, %q not found in %q", want, body)
+				}
+			}
+			for _, skip := range test.skip {
+				if strings.Contains(string(body), skip) {
+					t.Errorf("Unexpected events, %q found in %q", skip, body)
+				}
+			}
+		})
+	}
+}
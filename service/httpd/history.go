@@ -0,0 +1,246 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/storage"
+	"github.com/wabarc/wayback/template"
+)
+
+// dateLayout is the layout of the date inputs of the history page.
+const dateLayout = "2006-01-02"
+
+// historyFilters are the query parameters of the archive history, they are
+// kept across the pages.
+var historyFilters = []string{"q", "url", "domain", "service", "from", "to", "slot", "status", "limit"}
+
+// historyView represents the data of the history page.
+type historyView struct {
+	Query    url.Values
+	Error    string
+	Archives []archiveItem
+	Next     string
+	JSON     string
+}
+
+// timelineView represents the data of the timeline page of a URL.
+type timelineView struct {
+	URL    string
+	Months []timelineMonth
+	JSON   string
+}
+
+// timelineMonth represents the captures of a URL within a month.
+type timelineMonth struct {
+	Name     string
+	Archives []archiveItem
+}
+
+// archiveItem represents an archive in the lists.
+type archiveItem struct {
+	ID       int
+	Title    string
+	Source   string
+	Domain   string
+	Service  string
+	Created  string
+	Detail   string
+	Timeline string
+	Results  []resultItem
+}
+
+// resultItem represents the result of a slot in the lists.
+type resultItem struct {
+	Slot      string
+	Dst       string
+	Succeeded bool
+}
+
+// parseArchiveQuery parses the filters of the archive history from the
+// query parameters. The time range is in RFC 3339 or a date, the date of
+// to is inclusive.
+func parseArchiveQuery(query url.Values) (storage.ArchiveQuery, error) {
+	q := storage.ArchiveQuery{
+		URL:     query.Get("url"),
+		Domain:  query.Get("domain"),
+		Service: query.Get("service"),
+		Slot:    query.Get("slot"),
+		Status:  query.Get("status"),
+		Text:    query.Get("q"),
+		Limit:   defHistoryLimit,
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxHistoryLimit {
+			return q, errors.New("limit must be between 1 and %d", maxHistoryLimit)
+		}
+		q.Limit = n
+	}
+	if v := query.Get("before"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return q, errors.New("before must be a positive archive id")
+		}
+		q.Before = n
+	}
+	var err error
+	if q.From, err = parseTime(query.Get("from"), false); err != nil {
+		return q, errors.New("from must be in RFC 3339 or a date")
+	}
+	if q.To, err = parseTime(query.Get("to"), true); err != nil {
+		return q, errors.New("to must be in RFC 3339 or a date")
+	}
+	switch q.Status {
+	case "", storage.ArchiveSucceeded, storage.ArchiveFailed:
+	default:
+		return q, errors.New("status must be %s or %s", storage.ArchiveSucceeded, storage.ArchiveFailed)
+	}
+	return q, nil
+}
+
+// parseTime parses a time in RFC 3339 or a date, the end of the date is
+// returned if end is true. It returns the zero time if s is empty.
+func parseTime(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(dateLayout, s, time.Local)
+	if err == nil && end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, err
+}
+
+// nextPage returns the cursor of the next page, it is zero if there are no more archives.
+func nextPage(q storage.ArchiveQuery, archives []entity.Archive) int {
+	if len(archives) == 0 || len(archives) < q.Limit {
+		return 0
+	}
+	return archives[len(archives)-1].ID
+}
+
+// redact removes the requesters of the archives unless the request is by an
+// admin, they are the users of the chat services.
+func redact(r *http.Request, archives ...*entity.Archive) {
+	if isAdmin(r) {
+		return
+	}
+	for _, a := range archives {
+		a.User = ""
+	}
+}
+
+// filters returns the non-empty history filters of the query parameters.
+func filters(query url.Values) url.Values {
+	values := url.Values{}
+	for _, k := range historyFilters {
+		if v := query.Get(k); v != "" {
+			values.Set(k, v)
+		}
+	}
+	return values
+}
+
+func (web *web) archiveItems(archives []entity.Archive) []archiveItem {
+	items := make([]archiveItem, 0, len(archives))
+	for _, a := range archives {
+		item := archiveItem{
+			ID:       a.ID,
+			Title:    a.Title,
+			Source:   a.Source,
+			Domain:   a.Domain,
+			Service:  a.Service,
+			Created:  a.CreatedAt.Format(time.RFC1123),
+			Detail:   template.Path(web.router, "archive", "id", strconv.Itoa(a.ID)),
+			Timeline: template.Path(web.router, "timeline") + "?" + url.Values{"url": {a.URL}}.Encode(),
+		}
+		for _, r := range a.Results {
+			item.Results = append(item.Results, resultItem{Slot: r.Slot, Dst: r.Dst, Succeeded: r.Succeeded()})
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// showHistory renders the archive history, filtered by the query parameters.
+func (web *web) showHistory(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("access archive history")
+
+	query := filters(r.URL.Query())
+	view := historyView{Query: query, JSON: apiPrefix + "/archives"}
+	if len(query) > 0 {
+		view.JSON += "?" + query.Encode()
+	}
+
+	status := http.StatusOK
+	q, err := parseArchiveQuery(r.URL.Query())
+	if err != nil {
+		status, view.Error = http.StatusBadRequest, err.Error()
+	} else if archives, err := web.store.SearchArchives(q); err != nil {
+		logger.Error("query archives failed: %v", err)
+		status, view.Error = http.StatusInternalServerError, "Query archives failed."
+	} else {
+		view.Archives = web.archiveItems(archives)
+		if next := nextPage(q, archives); next > 0 {
+			query.Set("before", strconv.Itoa(next))
+			view.Next = template.Path(web.router, "history") + "?" + query.Encode()
+		}
+	}
+
+	web.render(w, status, "history", view)
+}
+
+// showTimeline renders the captures of a URL, grouped by month.
+func (web *web) showTimeline(w http.ResponseWriter, r *http.Request) {
+	uri := r.URL.Query().Get("url")
+	logger.Debug("access timeline of %s", uri)
+
+	if uri == "" {
+		http.Redirect(w, r, template.Path(web.router, "history"), http.StatusFound)
+		return
+	}
+	archives, err := web.store.ArchivesByURL(uri, 0)
+	if err != nil {
+		logger.Error("query archives of %s failed: %v", uri, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	view := timelineView{URL: uri, JSON: apiPrefix + "/archives?" + url.Values{"url": {uri}}.Encode()}
+	for i, item := range web.archiveItems(archives) {
+		month := archives[i].CreatedAt.Format("January 2006")
+		if n := len(view.Months); n == 0 || view.Months[n-1].Name != month {
+			view.Months = append(view.Months, timelineMonth{Name: month})
+		}
+		m := &view.Months[len(view.Months)-1]
+		m.Archives = append(m.Archives, item)
+	}
+
+	web.render(w, http.StatusOK, "timeline", view)
+}
+
+// render writes the HTML of the template with the status code.
+func (web *web) render(w http.ResponseWriter, status int, name string, data interface{}) {
+	html, ok := web.template.Render(name, data)
+	if !ok {
+		logger.Error("render template %s failed", name)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(html) // nolint:errcheck
+}
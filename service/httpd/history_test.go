@@ -0,0 +1,184 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestParseArchiveQuery(t *testing.T) {
+	var tests = []struct {
+		query string
+		fail  bool
+		check func(q storage.ArchiveQuery) bool
+	}{
+		{query: "", check: func(q storage.ArchiveQuery) bool {
+			return q.Limit == defHistoryLimit && q.From.IsZero() && q.To.IsZero()
+		}},
+		{query: "q=foo+bar&slot=ia&status=failed", check: func(q storage.ArchiveQuery) bool {
+			return q.Text == "foo bar" && q.Slot == "ia" && q.Status == "failed"
+		}},
+		{query: "service=telegram&user=42", check: func(q storage.ArchiveQuery) bool { return q.Service == "telegram" && q.User == "" }},
+		{query: "limit=5&before=10", check: func(q storage.ArchiveQuery) bool { return q.Limit == 5 && q.Before == 10 }},
+		{query: "from=2023-01-02T03:04:05Z", check: func(q storage.ArchiveQuery) bool { return q.From.Equal(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)) }},
+		{query: "from=2023-01-02&to=2023-01-02", check: func(q storage.ArchiveQuery) bool { return q.To.Sub(q.From) == 24*time.Hour-time.Nanosecond }},
+		{query: "limit=0", fail: true},
+		{query: "limit=1000", fail: true},
+		{query: "before=foo", fail: true},
+		{query: "from=yesterday", fail: true},
+		{query: "to=2023-13-01", fail: true},
+		{query: "status=unknown", fail: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			values, _ := url.ParseQuery(test.query)
+			q, err := parseArchiveQuery(values)
+			if test.fail {
+				if err == nil {
+					t.Errorf("Unexpected parse archive query, got nil instead of an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected parse archive query: %v", err)
+			}
+			if !test.check(q) {
+				t.Errorf("Unexpected archive query, got %+v", q)
+			}
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	fixtures := []*entity.Archive{
+		{Source: "https://example.com/", Title: "Example Domain", Service: "telegram", CreatedAt: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+			Results: []entity.Result{{Slot: "ia", Dst: "https://web.archive.org/web/example.com"}}},
+		{Source: "https://example.org/", Title: "<b>Example</b> News", Text: "breaking story", Service: "httpd", CreatedAt: time.Date(2023, 2, 3, 0, 0, 0, 0, time.UTC),
+			Results: []entity.Result{{Slot: "is", Dst: "timeout"}}},
+		{Source: "https://example.com/", Title: "Example Domain", Service: "discord", CreatedAt: time.Date(2023, 2, 4, 0, 0, 0, 0, time.UTC),
+			Results: []entity.Result{{Slot: "ia", Dst: "https://web.archive.org/web/2/example.com"}}},
+	}
+	for _, a := range fixtures {
+		if err := store.CreateArchive(a); err != nil {
+			t.Fatalf("Unexpected create archive: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	server := httptest.NewServer(newWeb(ctx, store, pooling.New(ctx, 1)).handle())
+	defer server.Close()
+
+	var tests = []struct {
+		name    string
+		path    string
+		status  int
+		want    []string
+		notWant []string
+	}{
+		{
+			name:   "recent",
+			path:   "/history",
+			status: http.StatusOK,
+			want:   []string{`href="/archives/3"`, `href="/archives/2"`, `href="/archives/1"`, `&lt;b&gt;Example&lt;/b&gt; News`, `class="slot failed"`, `href="/api/v1/archives"`},
+		},
+		{
+			name:    "paging",
+			path:    "/history?limit=2",
+			status:  http.StatusOK,
+			want:    []string{`href="/archives/3"`, `href="/history?before=2&amp;limit=2"`},
+			notWant: []string{`href="/archives/1"`},
+		},
+		{
+			name:    "search",
+			path:    "/history?q=breaking",
+			status:  http.StatusOK,
+			want:    []string{`href="/archives/2"`, `value="breaking"`, `href="/api/v1/archives?q=breaking"`},
+			notWant: []string{`href="/archives/1"`, `href="/archives/3"`},
+		},
+		{
+			name:    "filters",
+			path:    "/history?domain=example.com&status=succeeded&from=2023-02-01",
+			status:  http.StatusOK,
+			want:    []string{`href="/archives/3"`, `value="succeeded" selected`},
+			notWant: []string{`href="/archives/1"`, `href="/archives/2"`},
+		},
+		{name: "invalid filter", path: "/history?status=unknown", status: http.StatusBadRequest, want: []string{"status must be"}},
+		{
+			name:    "timeline",
+			path:    "/history/timeline?url=https://example.com",
+			status:  http.StatusOK,
+			want:    []string{"February 2023", "January 2023", `href="/archives/3"`, `href="/archives/1"`},
+			notWant: []string{`href="/archives/2"`},
+		},
+		{name: "timeline without url", path: "/history/timeline", status: http.StatusOK, want: []string{"<h1>History</h1>"}},
+		{name: "detail page", path: "/archives/1", status: http.StatusOK, want: []string{`href="/history/timeline?url=https%3A%2F%2Fexample.com"`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + test.path)
+			if err != nil {
+				t.Fatalf("Unexpected request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Fatalf("Unexpected status code, got %d instead of %d", resp.StatusCode, test.status)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			for _, want := range test.want {
+				if !strings.Contains(string(body), want) {
+					t.Errorf("Unexpected body, %q not found in %q", want, body)
+				}
+			}
+			for _, s := range test.notWant {
+				if strings.Contains(string(body), s) {
+					t.Errorf("Unexpected body, %q found in %q", s, body)
+				}
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/api/v1/archives?domain=example.com&limit=1")
+		if err != nil {
+			t.Fatalf("Unexpected request: %v", err)
+		}
+		defer resp.Body.Close()
+		var got archivesResponse
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("Unexpected decode response: %v", err)
+		}
+		if len(got.Archives) != 1 || got.Archives[0].ID != 3 || got.Next != 3 {
+			t.Errorf("Unexpected archives, got %+v", got)
+		}
+	})
+}
@@ -18,12 +18,14 @@ import (
 	"github.com/wabarc/logger"
 	"github.com/wabarc/wayback"
 	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
 	"github.com/wabarc/wayback/errors"
 	"github.com/wabarc/wayback/metrics"
 	"github.com/wabarc/wayback/pooling"
 	"github.com/wabarc/wayback/publish"
 	"github.com/wabarc/wayback/reduxer"
 	"github.com/wabarc/wayback/service"
+	"github.com/wabarc/wayback/storage"
 	"github.com/wabarc/wayback/template"
 	"github.com/wabarc/wayback/version"
 )
@@ -32,45 +34,95 @@ type web struct {
 	ctx context.Context
 
 	pool     *pooling.Pool
+	store    storage.Storage
 	router   *mux.Router
+	limiter  *limiter
+	outputs  *outputs
+	batches  *batches
+	streams  *streams
+	indexes  *indexes
 	template *template.Template
 }
 
-func newWeb(ctx context.Context, pool *pooling.Pool) *web {
+func newWeb(ctx context.Context, store storage.Storage, pool *pooling.Pool) *web {
 	router := mux.NewRouter()
 	web := &web{
 		ctx:      ctx,
 		pool:     pool,
+		store:    store,
 		router:   router,
+		outputs:  newOutputs(),
+		batches:  newBatches(),
+		streams:  newStreams(),
+		indexes:  newIndexes(),
 		template: template.New(router),
 	}
+	if limit := config.Opts.RateLimit(); limit > 0 {
+		web.limiter = newLimiter(limit)
+	}
 	if err := web.template.ParseTemplates(); err != nil {
 		logger.Fatal("unable to parse templates: %v", err)
 	}
 	if err := template.GenerateJavascriptBundles(); err != nil {
 		logger.Fatal("unable to generate JavaScript bundles: %v", err)
 	}
+	service.RegisterNotifier(metrics.ServiceWeb, service.NotifierFunc(web.notify))
 	return web
 }
 
 func (web *web) handle() http.Handler {
-	web.router.HandleFunc("/", web.home)
+	web.router.Handle("/", web.requireLogin("", web.home))
+	web.router.HandleFunc("/login", web.showLogin).Methods(http.MethodGet)
+	web.router.HandleFunc("/login", web.login).Methods(http.MethodPost)
+	web.router.HandleFunc("/logout", web.logout).Methods(http.MethodPost)
 	web.router.HandleFunc("/{name}.js", web.showJavascript).Name("javascript").Methods(http.MethodGet)
 	web.router.HandleFunc("/favicon.ico", web.showFavicon).Name("favicon").Methods(http.MethodGet)
 	web.router.HandleFunc("/icon/{filename}", web.showAppIcon).Name("icon").Methods(http.MethodGet)
 	web.router.HandleFunc("/manifest.json", web.showWebManifest).Name("manifest").Methods(http.MethodGet)
 	web.router.HandleFunc("/offline.html", web.showOfflinePage).Methods(http.MethodGet)
 
-	web.router.HandleFunc("/wayback", func(w http.ResponseWriter, r *http.Request) {
+	web.router.Handle("/wayback", web.requireLogin(entity.ScopeArchive, web.throttle(func(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(web.ctx, config.Opts.WaybackTimeout())
 		defer cancel()
 
-		if err := web.process(ctx, w, r); err != nil {
+		if err := web.process(ctx, w, r, "layout"); err != nil {
 			logger.Error("httpd: process retrying: %v", err)
 		}
-	}).Methods(http.MethodPost)
-
-	web.router.HandleFunc("/playback", web.playback).Methods(http.MethodPost)
+	}))).Methods(http.MethodPost)
+
+	web.router.Handle("/share", web.requireLogin(entity.ScopeArchive, web.showShare)).Name("share").Methods(http.MethodGet)
+	web.router.Handle("/share", web.requireLogin(entity.ScopeArchive, web.throttle(web.share))).Methods(http.MethodPost)
+	web.router.Handle("/bookmarklet", web.requireLogin("", web.showBookmarklet)).Name("bookmarklet").Methods(http.MethodGet)
+	web.router.Handle("/playback", web.requireLogin(entity.ScopePlayback, web.throttle(web.playback))).Methods(http.MethodPost)
+	web.router.Handle("/batches", web.requireLogin(entity.ScopeArchive, web.showBatchForm)).Name("batches").Methods(http.MethodGet)
+	web.router.Handle("/batches", web.requireLogin(entity.ScopeArchive, web.throttle(web.submitBatch))).Methods(http.MethodPost)
+	web.router.Handle("/batches/{id}", web.requireLogin(entity.ScopeArchive, web.showBatch)).Name("batch").Methods(http.MethodGet)
+	web.router.Handle("/batches/{id}/report.{format:csv|json}", web.requireLogin(entity.ScopeArchive, web.downloadReport)).Name("report").Methods(http.MethodGet)
+	web.router.Handle("/history", web.requireLogin(entity.ScopePlayback, web.showHistory)).Name("history").Methods(http.MethodGet)
+	web.router.Handle("/history/timeline", web.requireLogin(entity.ScopePlayback, web.showTimeline)).Name("timeline").Methods(http.MethodGet)
+	web.router.Handle("/archives/{id:[0-9]+}", web.requireLogin(entity.ScopePlayback, web.showArchive)).Name("archive").Methods(http.MethodGet)
+	web.router.Handle("/archives/{id:[0-9]+}/artifacts/{kind}", web.requireLogin(entity.ScopePlayback, web.serveArtifact)).Name("artifact").Methods(http.MethodGet, http.MethodHead)
+	web.router.Handle("/archives/{id:[0-9]+}/replay", web.requireLogin(entity.ScopePlayback, web.replayArchive)).Name("replay").Methods(http.MethodGet)
+	web.router.Handle("/archives/{id:[0-9]+}/replay/{scheme:https?}/{rest:.+}", web.requireLogin(entity.ScopePlayback, web.serveReplay)).Methods(http.MethodGet, http.MethodHead)
+
+	web.handleAPI()
+
+	web.router.Handle("/jobs", web.requireJSON(entity.ScopeArchive, tokenRequired(), web.listJobs)).Name("jobs").Methods(http.MethodGet)
+	web.router.Handle("/jobs/{id}", web.requireJSON(entity.ScopeArchive, tokenRequired(), web.showJob)).Name("job").Methods(http.MethodGet)
+	web.router.Handle("/jobs/{id}/cancel", web.requireJSON(entity.ScopeArchive, tokenRequired(), web.cancelJob)).Methods(http.MethodPost)
+
+	admin := web.router.PathPrefix("/admin").Subrouter()
+	admin.Use(web.requireAdmin)
+	admin.HandleFunc("/dead-letters", web.listDeadLetters).Methods(http.MethodGet)
+	admin.HandleFunc("/dead-letters", web.purgeDeadLetters).Methods(http.MethodDelete)
+	admin.HandleFunc("/dead-letters/{id}", web.showDeadLetter).Methods(http.MethodGet)
+	admin.HandleFunc("/dead-letters/{id}", web.removeDeadLetter).Methods(http.MethodDelete)
+	admin.HandleFunc("/dead-letters/{id}/replay", web.replayDeadLetter).Methods(http.MethodPost)
+	admin.HandleFunc("/backup", web.backup).Methods(http.MethodGet)
+	admin.HandleFunc("/export", web.export).Methods(http.MethodGet)
+
+	// The chat services register the webhooks to receive updates through the HTTP server.
+	web.router.PathPrefix(service.WebhookPrefix).HandlerFunc(web.serveWebhook).Methods(http.MethodPost)
 
 	web.router.HandleFunc("/healthcheck", func(w http.ResponseWriter, r *http.Request) {
 		w.Write(helper.String2Byte("OK")) // nolint:errcheck
@@ -96,6 +148,15 @@ func (web *web) handle() http.Handler {
 	return web.router
 }
 
+func (web *web) serveWebhook(w http.ResponseWriter, r *http.Request) {
+	handler, ok := service.Webhook(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
 func (web *web) home(w http.ResponseWriter, r *http.Request) {
 	logger.Debug("access home")
 	w.Header().Set("Cache-Control", "max-age=2592000")
@@ -128,6 +189,18 @@ func (web *web) showWebManifest(w http.ResponseWriter, r *http.Request) {
 		Type   string `json:"type"`
 	}
 
+	type webShareParams struct {
+		Title string `json:"title"`
+		Text  string `json:"text"`
+		URL   string `json:"url"`
+	}
+
+	type webShareTarget struct {
+		Action string         `json:"action"`
+		Method string         `json:"method"`
+		Params webShareParams `json:"params"`
+	}
+
 	type webManifest struct {
 		Name        string            `json:"name"`
 		Description string            `json:"description"`
@@ -136,6 +209,7 @@ func (web *web) showWebManifest(w http.ResponseWriter, r *http.Request) {
 		Icons       []webManifestIcon `json:"icons"`
 		Display     string            `json:"display"`
 		ThemeColor  string            `json:"theme_color"`
+		ShareTarget webShareTarget    `json:"share_target"`
 	}
 
 	manifest := &webManifest{
@@ -150,6 +224,12 @@ func (web *web) showWebManifest(w http.ResponseWriter, r *http.Request) {
 			{Source: template.Path(web.router, "icon", "filename", "icon-192.png"), Sizes: "192x192", Type: "image/png"},
 			{Source: template.Path(web.router, "icon", "filename", "icon-512.png"), Sizes: "512x512", Type: "image/png"},
 		},
+		// The shared data is confirmed before archiving, see showShare.
+		ShareTarget: webShareTarget{
+			Action: template.Path(web.router, "share"),
+			Method: http.MethodGet,
+			Params: webShareParams{Title: "title", Text: "text", URL: "url"},
+		},
 	}
 
 	w.Header().Set("Cache-Control", "max-age=259200")
@@ -201,8 +281,9 @@ func (web *web) showJavascript(w http.ResponseWriter, r *http.Request) {
 	w.Write(contents) // nolint:errcheck
 }
 
-func (web *web) process(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	// TODO: rate limit https://pkg.go.dev/golang.org/x/time/rate
+// process archives the URLs in the text of the form, and renders the results
+// with the view template unless JSON is requested.
+func (web *web) process(ctx context.Context, w http.ResponseWriter, r *http.Request, view string) error {
 	logger.Info("process request start...")
 	metrics.IncrementWayback(metrics.ServiceWeb, metrics.StatusRequest)
 
@@ -229,7 +310,18 @@ func (web *web) process(ctx context.Context, w http.ResponseWriter, r *http.Requ
 		logger.Warn("url no found.")
 	}
 
+	if hook := r.PostFormValue("webhook"); r.PostFormValue("async") == "true" || hook != "" {
+		switch {
+		case len(urls) == 0:
+			writeError(w, http.StatusUnprocessableEntity, codeInvalidURL, "url no found")
+		case validWebhook(w, hook):
+			web.archiveAsync(w, r, urls, hook)
+		}
+		return nil
+	}
+
 	do := func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
+		service.Record(web.store, cols, rdx, metrics.ServiceWeb, "")
 		collector := transform(cols)
 		ctx = context.WithValue(ctx, publish.PubBundle{}, rdx)
 		switch r.PostFormValue("data-type") {
@@ -242,17 +334,21 @@ func (web *web) process(ctx context.Context, w http.ResponseWriter, r *http.Requ
 			} else {
 				if len(urls) > 0 {
 					metrics.IncrementWayback(metrics.ServiceWeb, metrics.StatusSuccess)
-					go publish.To(context.Background(), cols, "web")
+					if canPublish(r) {
+						go publish.To(context.Background(), cols, "web")
+					}
 				}
 				w.Write(data) // nolint:errcheck
 			}
 		default:
 			w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-			if html, ok := web.template.Render("layout", collector); ok {
+			if html, ok := web.template.Render(view, collector); ok {
 				if len(urls) > 0 {
 					metrics.IncrementWayback(metrics.ServiceWeb, metrics.StatusSuccess)
-					go publish.To(context.Background(), cols, "web")
+					if canPublish(r) {
+						go publish.To(context.Background(), cols, "web")
+					}
 				}
 				w.Write(html) // nolint:errcheck
 			} else {
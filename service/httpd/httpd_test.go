@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"strings"
@@ -57,7 +58,7 @@ func TestProcessRespStatus(t *testing.T) {
 	defer pool.Close()
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		newWeb(ctx, pool).process(context.Background(), w, r)
+		newWeb(ctx, nil, pool).process(context.Background(), w, r, "layout")
 	})
 
 	var tests = []struct {
@@ -110,13 +111,13 @@ func TestProcessContentType(t *testing.T) {
 	pool := pooling.New(ctx, config.Opts.PoolingSize())
 	go pool.Roll()
 	defer pool.Close()
-	web := newWeb(ctx, pool)
+	web := newWeb(ctx, nil, pool)
 
 	web.handle()
 	httpClient, mux, server := helper.MockServer()
 	defer server.Close()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		web.process(ctx, w, r)
+		web.process(ctx, w, r, "layout")
 	})
 
 	var tests = []struct {
@@ -164,3 +165,41 @@ func TestProcessContentType(t *testing.T) {
 		}
 	}
 }
+
+func TestServeWebhook(t *testing.T) {
+	os.Clearenv()
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	ctx := context.Background()
+	pool := pooling.New(ctx, config.Opts.PoolingSize())
+	handler := newWeb(ctx, nil, pool).handle()
+
+	path := service.WebhookPrefix + "testing/secret"
+	service.RegisterWebhook(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer service.UnregisterWebhook(path)
+
+	var tests = []struct {
+		method string
+		path   string
+		status int
+	}{
+		{method: http.MethodPost, path: path, status: http.StatusAccepted},
+		{method: http.MethodPost, path: service.WebhookPrefix + "testing/wrong", status: http.StatusNotFound},
+		{method: http.MethodGet, path: path, status: http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader("{}"))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("Unexpected %s %s, got status %d instead of %d", test.method, test.path, w.Code, test.status)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+)
+
+// ownsJob reports whether the request is allowed to access the job, it is
+// a job of the HTTP server sent by the same token, or anonymously by an
+// anonymous request. The admins access all of the jobs.
+func ownsJob(r *http.Request, job pooling.Job) bool {
+	return isAdmin(r) || (job.Service == metrics.ServiceWeb && job.User == owner(r))
+}
+
+// jobs returns the jobs that the request is allowed to access.
+func (web *web) jobs(r *http.Request) []pooling.Job {
+	jobs := []pooling.Job{}
+	for _, job := range web.pool.Jobs() {
+		if ownsJob(r, job) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// job returns the job of the id if the request is allowed to access it.
+func (web *web) job(r *http.Request, id string) (pooling.Job, bool) {
+	job, ok := web.pool.Job(id)
+	if !ok || !ownsJob(r, job) {
+		return pooling.Job{}, false
+	}
+	return job, true
+}
+
+func (web *web) listJobs(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("access jobs")
+	writeJSON(w, http.StatusOK, web.jobs(r))
+}
+
+func (web *web) showJob(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+	logger.Debug("access job %s", id)
+
+	job, ok := web.job(r, id)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": pooling.ErrJobNotFound.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (web *web) cancelJob(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+	logger.Info("cancel job %s", id)
+
+	if _, ok := web.job(r, id); !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": pooling.ErrJobNotFound.Error()})
+		return
+	}
+	err := web.pool.Cancel(id)
+	switch {
+	case errors.Is(err, pooling.ErrJobNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	case errors.Is(err, pooling.ErrJobFinished):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	job, _ := web.pool.Job(id)
+	writeJSON(w, http.StatusOK, job)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("encode for response failed, %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data) // nolint:errcheck
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+)
+
+func TestJobs(t *testing.T) {
+	helper.Unsetenv("WAYBACK_ADMIN_TOKEN", "WAYBACK_REQUIRE_TOKEN")
+	os.Setenv("WAYBACK_ADMIN_TOKEN", "foo")
+	defer helper.Unsetenv("WAYBACK_ADMIN_TOKEN")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	ctx := context.Background()
+	pool := pooling.New(ctx, 1)
+	go pool.Roll()
+	defer pool.Close()
+
+	started := make(chan struct{})
+	id := pool.Put(pooling.Bucket{
+		Service: metrics.ServiceWeb,
+		Request: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	<-started
+	// The job of a bot user is queued behind the running one.
+	other := pool.Put(pooling.Bucket{
+		Service: metrics.ServiceTelegram,
+		User:    "42",
+		Request: func(context.Context) error { return nil },
+	})
+
+	server := httptest.NewServer(newWeb(ctx, nil, pool).handle())
+	defer server.Close()
+
+	var tests = []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+		state  pooling.State
+	}{
+		{name: "list jobs", method: http.MethodGet, path: "/jobs", status: http.StatusOK},
+		{name: "show job", method: http.MethodGet, path: "/jobs/" + id, status: http.StatusOK, state: pooling.StateRunning},
+		{name: "show nonexistent job", method: http.MethodGet, path: "/jobs/foo", status: http.StatusNotFound},
+		{name: "cancel job", method: http.MethodPost, path: "/jobs/" + id + "/cancel", status: http.StatusOK, state: pooling.StateCancelled},
+		{name: "cancel finished job", method: http.MethodPost, path: "/jobs/" + id + "/cancel", status: http.StatusConflict},
+		{name: "cancel nonexistent job", method: http.MethodPost, path: "/jobs/foo/cancel", status: http.StatusNotFound},
+		{name: "show job of others", method: http.MethodGet, path: "/jobs/" + other, status: http.StatusNotFound},
+		{name: "cancel job of others", method: http.MethodPost, path: "/jobs/" + other + "/cancel", status: http.StatusNotFound},
+		{name: "show job of others by admin", method: http.MethodGet, path: "/jobs/" + other, token: "foo", status: http.StatusOK},
+		{name: "show job of others by api", method: http.MethodGet, path: "/api/v1/jobs/" + other, status: http.StatusNotFound},
+		{name: "cancel job of others by api", method: http.MethodPost, path: "/api/v1/jobs/" + other + "/cancel", status: http.StatusNotFound},
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, server.URL+test.path, nil)
+			if err != nil {
+				t.Fatalf("Unexpected new request: %v", err)
+			}
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected response: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != test.status {
+				t.Fatalf("Unexpected response code got %d instead of %d", resp.StatusCode, test.status)
+			}
+			if test.state == pooling.StateQueued {
+				return
+			}
+			var job struct {
+				ID    string `json:"id"`
+				State string `json:"state"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+				t.Fatalf("Unexpected decode response: %v", err)
+			}
+			if job.ID != id || job.State != test.state.String() {
+				t.Errorf("Unexpected job got %s (%s) instead of %s (%s)", job.ID, job.State, id, test.state)
+			}
+		})
+	}
+
+	// The jobs of others are listed for the admins only, without the users.
+	for token, want := range map[string]string{"": "[" + id + "]", "foo": "[" + other + " " + id + "]"} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/jobs", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected response: %v", err)
+		}
+		var list struct {
+			Jobs []map[string]interface{} `json:"jobs"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Unexpected decode response: %v", err)
+		}
+		got := []string{}
+		for _, job := range list.Jobs {
+			if _, ok := job["user"]; ok {
+				t.Errorf("Unexpected user of job %v", job["id"])
+			}
+			got = append(got, fmt.Sprint(job["id"]))
+		}
+		if fmt.Sprint(got) != want {
+			t.Errorf("Unexpected jobs listed by %q, got %v instead of %s", token, got, want)
+		}
+	}
+	pool.Cancel(other) // nolint:errcheck
+}
@@ -0,0 +1,177 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/storage"
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxListSize is the maximum size of an uploaded URL list, after decompressing.
+	maxListSize = 10 << 20
+
+	// maxBatchURLs is the maximum number of URLs in a batch.
+	maxBatchURLs = 1000
+
+	// sitemapNS is the namespace of the sitemap protocol.
+	sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+var (
+	// ErrNoURLs is returned if an URL list does not contain any URL.
+	ErrNoURLs = errors.New("no urls found in the list")
+	// ErrTooManyURLs is returned if an URL list contains too many URLs.
+	ErrTooManyURLs = errors.New("too many urls, a batch is limited to %d urls", maxBatchURLs)
+	// ErrSitemapIndex is returned if a sitemap index is uploaded, the
+	// sitemaps it refers to are not fetched.
+	ErrSitemapIndex = errors.New("sitemap index is not supported, please upload the sitemaps instead")
+)
+
+// parseList returns the unique URLs in a list, the format of the list is
+// detected from the content. It can be a plain text or CSV list, a Netscape
+// bookmarks HTML export, or a sitemap that may be gzipped.
+func parseList(data []byte) ([]*url.URL, error) {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(io.LimitReader(zr, maxListSize+1)); err != nil {
+			return nil, err
+		}
+		if len(data) > maxListSize {
+			return nil, errors.New("list is larger than %d bytes", maxListSize)
+		}
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var links []string
+	var err error
+	head := strings.ToLower(string(bytes.TrimSpace(data[:min(len(data), 512)])))
+	switch {
+	case strings.HasPrefix(head, "<?xml") || strings.HasPrefix(head, "<urlset") || strings.HasPrefix(head, "<sitemapindex"):
+		links, err = sitemapLinks(data)
+	case strings.HasPrefix(head, "<"):
+		links = bookmarkLinks(data)
+	default:
+		links = textLinks(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	urls := []*url.URL{}
+	for _, link := range links {
+		u, err := url.Parse(strings.TrimSpace(link))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		key := storage.NormalizeURL(u.String())
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		urls = append(urls, u)
+	}
+	switch {
+	case len(urls) == 0:
+		return nil, ErrNoURLs
+	case len(urls) > maxBatchURLs:
+		return nil, ErrTooManyURLs
+	}
+	return urls, nil
+}
+
+// sitemapLinks returns the locations of the URLs in a sitemap.
+func sitemapLinks(data []byte) (links []string, err error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return links, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "parse sitemap failed")
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch {
+		case se.Name.Local == "sitemapindex":
+			return nil, ErrSitemapIndex
+		case se.Name.Local == "loc" && (se.Name.Space == "" || se.Name.Space == sitemapNS):
+			var loc string
+			if err := dec.DecodeElement(&loc, &se); err != nil {
+				return nil, errors.Wrap(err, "parse sitemap failed")
+			}
+			links = append(links, loc)
+		}
+	}
+}
+
+// bookmarkLinks returns the links of an HTML document, e.g. a Netscape
+// bookmarks export of the browsers.
+func bookmarkLinks(data []byte) (links []string) {
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != "a" {
+				continue
+			}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) == "href" {
+					links = append(links, string(val))
+				}
+			}
+		}
+	}
+}
+
+// textLinks returns the fields of a plain text or CSV list that may be URLs.
+func textLinks(data []byte) (links []string) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+	r.ReuseRecord = true
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return links
+		}
+		if err != nil {
+			// Not a valid CSV, take it as plain text.
+			return strings.Fields(string(data))
+		}
+		for _, field := range record {
+			links = append(links, strings.Fields(field)...)
+		}
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
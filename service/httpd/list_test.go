@@ -0,0 +1,91 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/wabarc/wayback/errors"
+)
+
+func TestParseList(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(`<urlset><url><loc>https://example.com/gz</loc></url></urlset>`)) // nolint:errcheck
+	zw.Close()
+
+	var tests = []struct {
+		name string
+		data string
+		want []string
+		err  error
+	}{
+		{
+			name: "plain text",
+			data: "https://example.com/\nhttps://example.org/foo https://example.com\n\nftp://example.net\n",
+			want: []string{"https://example.com/", "https://example.org/foo"},
+		},
+		{
+			name: "csv",
+			data: "\xef\xbb\xbfurl,note\n\"https://example.com/?a=1,2\",first\nhttps://example.org/,\"second, with comma\"\n",
+			want: []string{"https://example.com/?a=1,2", "https://example.org/"},
+		},
+		{
+			name: "bookmarks",
+			data: `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<DL><p>
+    <DT><H3>Folder</H3>
+    <DL><p>
+        <DT><A HREF="https://example.com/" ADD_DATE="1672531200">Example</A>
+        <DT><A HREF="javascript:void(0)">Bookmarklet</A>
+    </DL><p>
+    <DT><A HREF="https://example.org/&amp;x">Example Org</A>
+</DL><p>`,
+			want: []string{"https://example.com/", "https://example.org/&x"},
+		},
+		{
+			name: "sitemap",
+			data: `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:image="http://www.google.com/schemas/sitemap-image/1.1">
+  <url><loc>https://example.com/a</loc><image:image><image:loc>https://example.com/a.png</image:loc></image:image></url>
+  <url><loc> https://example.com/b?x=1&amp;y=2 </loc></url>
+</urlset>`,
+			want: []string{"https://example.com/a", "https://example.com/b?x=1&y=2"},
+		},
+		{name: "gzipped sitemap", data: gz.String(), want: []string{"https://example.com/gz"}},
+		{name: "sitemap index", data: `<sitemapindex><sitemap><loc>https://example.com/s.xml</loc></sitemap></sitemapindex>`, err: ErrSitemapIndex},
+		{name: "no urls", data: "foo, bar\n", err: ErrNoURLs},
+		{name: "too many urls", data: manyURLs(maxBatchURLs + 1), err: ErrTooManyURLs},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			urls, err := parseList([]byte(test.data))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Unexpected parse list, got error %v instead of %v", err, test.err)
+			}
+			got := []string{}
+			for _, u := range urls {
+				got = append(got, u.String())
+			}
+			if test.err == nil && fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("Unexpected urls, got %v instead of %v", got, test.want)
+			}
+		})
+	}
+}
+
+func manyURLs(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "https://example.com/%d\n", i)
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/wabarc/wayback/errors"
+)
+
+// certificate keeps the TLS certificate of the server, it is loaded from the
+// certificate and key files and can be reloaded without restarting.
+type certificate struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+
+	certFile string
+	keyFile  string
+}
+
+func newCertificate(certFile, keyFile string) (*certificate, error) {
+	c := &certificate{certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload loads the certificate from the files again, the current certificate
+// is kept if it fails.
+func (c *certificate) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "load tls certificate failed")
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+
+	return nil
+}
+
+// getCertificate implements the GetCertificate of tls.Config.
+func (c *certificate) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
+
+func (c *certificate) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.getCertificate,
+	}
+}
+
+// listenUnix listens on the Unix domain socket, the socket file left over by
+// the previous process is removed.
+func listenUnix(path string) (net.Listener, error) {
+	path = filepath.Clean(path)
+	if fi, err := os.Stat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, errors.Wrap(err, "remove stale socket failed")
+		}
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,228 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/storage"
+)
+
+func writeCertificate(t *testing.T, dir string, serial int64) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unexpected create certificate: %v", err)
+	}
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Unexpected marshal key: %v", err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Unexpected write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0o600); err != nil {
+		t.Fatalf("Unexpected write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func serialNumber(t *testing.T, c *certificate) int64 {
+	t.Helper()
+
+	cert, err := c.getCertificate(nil)
+	if err != nil {
+		t.Fatalf("Unexpected get certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Unexpected parse certificate: %v", err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, 1)
+
+	if _, err := newCertificate(certFile, filepath.Join(dir, "missing.pem")); err == nil {
+		t.Fatalf("Unexpected load certificate without key, got nil instead of an error")
+	}
+
+	c, err := newCertificate(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Unexpected load certificate: %v", err)
+	}
+	if got := serialNumber(t, c); got != 1 {
+		t.Fatalf("Unexpected serial number, got %d instead of 1", got)
+	}
+
+	writeCertificate(t, dir, 2)
+	if err := c.reload(); err != nil {
+		t.Fatalf("Unexpected reload certificate: %v", err)
+	}
+	if got := serialNumber(t, c); got != 2 {
+		t.Fatalf("Unexpected serial number, got %d instead of 2", got)
+	}
+
+	// A broken certificate does not replace the current one.
+	if err := os.WriteFile(certFile, []byte("broken"), 0o600); err != nil {
+		t.Fatalf("Unexpected write certificate: %v", err)
+	}
+	if err := c.reload(); err == nil {
+		t.Fatalf("Unexpected reload broken certificate, got nil instead of an error")
+	}
+	if got := serialNumber(t, c); got != 2 {
+		t.Fatalf("Unexpected serial number, got %d instead of 2", got)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir, err := os.MkdirTemp("", "wayback")
+	if err != nil {
+		t.Fatalf("Unexpected create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatalf("Unexpected write file: %v", err)
+	}
+	if _, err := listenUnix(file); err == nil {
+		t.Fatalf("Unexpected listen on a regular file, got nil instead of an error")
+	}
+
+	path := filepath.Join(dir, "wayback.sock")
+	ln, err := listenUnix(path)
+	if err != nil {
+		t.Fatalf("Unexpected listen unix socket: %v", err)
+	}
+	// Leave the socket file behind like a killed process.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	ln, err = listenUnix(path)
+	if err != nil {
+		t.Fatalf("Unexpected listen on stale unix socket: %v", err)
+	}
+	ln.Close()
+}
+
+func TestServe(t *testing.T) {
+	dir, err := os.MkdirTemp("", "wayback")
+	if err != nil {
+		t.Fatalf("Unexpected create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Pick a free port for the listen address.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	socket := filepath.Join(dir, "wayback.sock")
+	certFile, keyFile := writeCertificate(t, dir, 1)
+	os.Clearenv()
+	os.Setenv("WAYBACK_LISTEN_ADDR", addr)
+	os.Setenv("WAYBACK_LISTEN_SOCKET", socket)
+	os.Setenv("WAYBACK_TLS_CERT_FILE", certFile)
+	os.Setenv("WAYBACK_TLS_KEY_FILE", keyFile)
+	os.Setenv("WAYBACK_TORRC", "")
+	os.Setenv("WAYBACK_SHUTDOWN_TIMEOUT", "1")
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := New(ctx, store, pooling.New(ctx, 1))
+	go srv.Serve() // nolint:errcheck
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get("http://unix/healthcheck"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected request over unix socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status code, got %d instead of %d", resp.StatusCode, http.StatusOK)
+	}
+
+	serial := func() int64 {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true}) // nolint:gosec
+		if err != nil {
+			t.Fatalf("Unexpected dial tls: %v", err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+	if got := serial(); got != 1 {
+		t.Fatalf("Unexpected serial number, got %d instead of 1", got)
+	}
+	writeCertificate(t, dir, 2)
+	if err := srv.Reload(); err != nil {
+		t.Fatalf("Unexpected reload: %v", err)
+	}
+	if got := serial(); got != 2 {
+		t.Fatalf("Unexpected serial number after reload, got %d instead of 2", got)
+	}
+	if err := srv.Shutdown(); err != nil {
+		t.Fatalf("Unexpected shutdown: %v", err)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("Unexpected unix socket after shutdown, got %v instead of not exist", err)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wabarc/logger"
+)
+
+// limiter is a token bucket for each identity, which allows bursts of the
+// rate and refills the rate per minute.
+type limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(perMinute int) *limiter {
+	return &limiter{
+		rate:    float64(perMinute),
+		buckets: make(map[string]*bucket),
+		swept:   time.Now(),
+	}
+}
+
+// allow takes a token from the bucket of the identity, it returns the time
+// to wait for the next token if the bucket is empty.
+func (l *limiter) allow(id string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Buckets untouched for a minute are full, they are the same as new ones.
+	if now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > time.Minute {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[id]
+	if !ok {
+		b = &bucket{tokens: l.rate, last: now}
+		l.buckets[id] = b
+	}
+	b.tokens = math.Min(l.rate, b.tokens+now.Sub(b.last).Minutes()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Minute)), false
+	}
+	b.tokens--
+
+	return 0, true
+}
+
+// throttle rejects the request if the identity of it exceeds the rate limit,
+// it must be behind the authorization to identify the token.
+func (web *web) throttle(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if web.limiter == nil {
+			next(w, r)
+			return
+		}
+		id := identity(r)
+		if wait, ok := web.limiter.allow(id, time.Now()); !ok {
+			logger.Warn("rate limit exceeded by %s", id)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded, please try later")
+			return
+		}
+		next(w, r)
+	}
+}
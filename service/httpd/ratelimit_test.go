@@ -0,0 +1,38 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(2)
+	now := time.Now()
+
+	var tests = []struct {
+		id    string
+		after time.Duration
+		exp   bool
+	}{
+		{id: "foo", exp: true},
+		{id: "foo", exp: true},
+		{id: "foo", exp: false},
+		{id: "bar", exp: true},
+		{id: "foo", after: 30 * time.Second, exp: true},
+		{id: "foo", after: 30 * time.Second, exp: false},
+	}
+
+	for i, test := range tests {
+		wait, ok := l.allow(test.id, now.Add(test.after))
+		if ok != test.exp {
+			t.Fatalf("Unexpected allow #%d, got %t instead of %t", i, ok, test.exp)
+		}
+		if !ok && wait <= 0 {
+			t.Errorf("Unexpected wait #%d, got %v", i, wait)
+		}
+	}
+}
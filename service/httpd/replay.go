@@ -0,0 +1,223 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/replay"
+	"github.com/wabarc/wayback/template"
+)
+
+// maxIndexes is the number of WARC indexes kept in memory.
+const maxIndexes = 32
+
+// replayPolicy keeps the replayed pages offline and away from the origin,
+// the archived scripts do not run.
+const replayPolicy = "default-src 'self' data: blob: 'unsafe-inline'; script-src 'none'; object-src 'none'; form-action 'none'; frame-ancestors 'self'"
+
+// indexes caches the indexes of WARC files, an index is reloaded if the
+// WARC file changed.
+type indexes struct {
+	mu      sync.Mutex
+	entries map[string]*replay.Index
+}
+
+func newIndexes() *indexes {
+	return &indexes{entries: make(map[string]*replay.Index)}
+}
+
+func (c *indexes) open(path string) (*replay.Index, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if idx, ok := c.entries[path]; ok && idx.ModTime().Equal(info.ModTime()) {
+		return idx, nil
+	}
+	idx, err := replay.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.entries) >= maxIndexes {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[path] = idx
+
+	return idx, nil
+}
+
+// replayPrefix returns the path prefix of the replay URLs of the archive.
+func (web *web) replayPrefix(a *entity.Archive) string {
+	return template.Path(web.router, "replay", "id", strconv.Itoa(a.ID)) + "/"
+}
+
+// warcIndex returns the index of the WARC artifact of the archive.
+func (web *web) warcIndex(a *entity.Archive) (*replay.Index, error) {
+	art, ok := findArtifact(a, "warc")
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	path, err := resolveArtifact(art.Local)
+	if err != nil {
+		return nil, err
+	}
+	return web.indexes.open(path)
+}
+
+// replayArchive redirects to the replay of the source URL of the archive.
+func (web *web) replayArchive(w http.ResponseWriter, r *http.Request) {
+	a, ok := web.loadArchive(w, r)
+	if !ok {
+		return
+	}
+	u, err := url.Parse(a.Source)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.Redirect(w, r, replay.Path(web.replayPrefix(a), u), http.StatusFound)
+}
+
+// serveReplay replays a URL from the WARC artifact of the archive, the URLs
+// of the archived pages and stylesheets are rewritten to the archived copies.
+func (web *web) serveReplay(w http.ResponseWriter, r *http.Request) {
+	a, ok := web.loadArchive(w, r)
+	if !ok {
+		return
+	}
+	target := routeParam(r, "scheme") + "://" + routeParam(r, "rest")
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	logger.Debug("replay %s of archive %d", target, a.ID)
+
+	idx, err := web.warcIndex(a)
+	if err != nil {
+		logger.Debug("open warc of archive %d failed: %v", a.ID, err)
+		http.NotFound(w, r)
+		return
+	}
+	entry, err := idx.Lookup(target)
+	if err != nil {
+		http.Error(w, "Not archived: "+target, http.StatusNotFound)
+		return
+	}
+	rec, err := idx.Record(entry)
+	if err != nil {
+		logger.Error("read warc record of %s failed: %v", target, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer rec.Close()
+
+	base, _ := url.Parse(entry.URL)
+	rw := &replay.Rewriter{Base: base, Prefix: web.replayPrefix(a)}
+	status, header, body := http.StatusOK, http.Header{"Content-Type": {rec.Header.Get("Content-Type")}}, rec.Body
+	if rec.Type() == "response" {
+		resp, err := http.ReadResponse(bufio.NewReader(rec.Body), nil)
+		if err != nil {
+			logger.Error("parse archived response of %s failed: %v", target, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer resp.Body.Close()
+		status, header, body = resp.StatusCode, resp.Header, resp.Body
+	}
+
+	body, encoding, err := decode(body, header.Get("Content-Encoding"))
+	if err != nil {
+		logger.Error("decode archived response of %s failed: %v", target, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	if loc := header.Get("Location"); loc != "" {
+		w.Header().Set("Location", rw.URL(loc))
+	}
+	ctype := header.Get("Content-Type")
+	if ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.Header().Set("Content-Security-Policy", replayPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Memento-Datetime", entry.Time.UTC().Format(http.TimeFormat))
+	w.Header().Set("Link", "<"+entry.URL+`>; rel="original"`)
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	mt, _, _ := mime.ParseMediaType(ctype)
+	switch {
+	case encoding != "":
+		// The encoding is not supported to rewrite, e.g. brotli.
+		_, err = io.Copy(w, body)
+	case mt == "text/html" || mt == "application/xhtml+xml":
+		err = rw.HTML(w, body, web.banner(a, entry))
+	case mt == "text/css":
+		var buf []byte
+		if buf, err = io.ReadAll(body); err == nil {
+			_, err = io.WriteString(w, rw.CSS(string(buf)))
+		}
+	default:
+		_, err = io.Copy(w, body)
+	}
+	if err != nil {
+		logger.Debug("replay %s failed: %v", target, err)
+	}
+}
+
+// banner returns the banner of a replayed page, with the capture time and
+// the original URL.
+func (web *web) banner(a *entity.Archive, entry replay.Entry) string {
+	html, ok := web.template.Render("banner", map[string]string{
+		"Detail":   template.Path(web.router, "archive", "id", strconv.Itoa(a.ID)),
+		"Captured": entry.Time.UTC().Format(time.RFC1123),
+		"Original": entry.URL,
+	})
+	if !ok {
+		return ""
+	}
+	return string(html)
+}
+
+// decode decodes the body of the content encoding, it returns the encoding
+// if it is not supported to decode.
+func decode(body io.Reader, encoding string) (io.Reader, string, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, "", nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		return zr, "", err
+	case "deflate":
+		zr, err := zlib.NewReader(body)
+		return zr, "", err
+	}
+	return body, encoding, nil
+}
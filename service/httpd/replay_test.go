@@ -0,0 +1,112 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/storage"
+)
+
+func warcRecord(uri, block string) string {
+	return fmt.Sprintf("WARC/1.0\r\nWARC-Type: response\r\nWARC-Date: 2023-01-02T03:04:05Z\r\nWARC-Target-URI: %s\r\nContent-Length: %d\r\n\r\n%s\r\n\r\n", uri, len(block), block)
+}
+
+func TestReplay(t *testing.T) {
+	root := t.TempDir()
+	os.Setenv("WAYBACK_STORAGE_DIR", root)
+	defer helper.Unsetenv("WAYBACK_STORAGE_DIR")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	warc := filepath.Join(root, "example.warc")
+	content := warcRecord("https://example.com/", "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<html><body><a href=\"/about\">about</a></body></html>") +
+		warcRecord("https://example.com/style.css", "HTTP/1.1 200 OK\r\nContent-Type: text/css\r\n\r\na { background: url(bg.png) }") +
+		warcRecord("https://example.com/old", "HTTP/1.1 301 Moved Permanently\r\nLocation: https://example.com/\r\nContent-Length: 0\r\n\r\n")
+	if err := os.WriteFile(warc, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	archive := &entity.Archive{
+		Source:    "https://example.com/",
+		Artifacts: []entity.Artifact{{Kind: "warc", Local: warc}},
+	}
+	if err := store.CreateArchive(archive); err != nil {
+		t.Fatalf("Unexpected create archive: %v", err)
+	}
+
+	ctx := context.Background()
+	server := httptest.NewServer(newWeb(ctx, store, pooling.New(ctx, 1)).handle())
+	defer server.Close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	prefix := "/archives/1/replay/"
+
+	var tests = []struct {
+		name     string
+		path     string
+		status   int
+		location string
+		want     []string
+	}{
+		{name: "detail page", path: "/archives/1", status: http.StatusOK, want: []string{`href="/archives/1/replay"`}},
+		{name: "source", path: "/archives/1/replay", status: http.StatusFound, location: prefix + "https/example.com/"},
+		{
+			name:   "page",
+			path:   prefix + "https/example.com/",
+			status: http.StatusOK,
+			want:   []string{`<a href="` + prefix + `https/example.com/about">`, `id="wayback-banner"`, "Mon, 02 Jan 2023 03:04:05 UTC", `href="/archives/1"`},
+		},
+		{name: "stylesheet", path: prefix + "https/example.com/style.css", status: http.StatusOK, want: []string{`url("` + prefix + `https/example.com/bg.png")`}},
+		{name: "redirect", path: prefix + "https/example.com/old", status: http.StatusMovedPermanently, location: prefix + "https/example.com/"},
+		{name: "not archived", path: prefix + "https/example.com/about", status: http.StatusNotFound},
+		{name: "unknown archive", path: "/archives/2/replay/https/example.com/", status: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := client.Get(server.URL + test.path)
+			if err != nil {
+				t.Fatalf("Unexpected request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Fatalf("Unexpected status code, got %d instead of %d", resp.StatusCode, test.status)
+			}
+			if loc := resp.Header.Get("Location"); loc != test.location {
+				t.Errorf("Unexpected location, got %s instead of %s", loc, test.location)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			for _, want := range test.want {
+				if !strings.Contains(string(body), want) {
+					t.Errorf("Unexpected body, %q not found in %q", want, body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/template"
+)
+
+// shareText returns the text to match URLs of the shared data, the title
+// is omitted since it does not contain URLs in practice.
+func shareText(values url.Values) string {
+	parts := []string{}
+	for _, k := range []string{"url", "text"} {
+		if v := strings.TrimSpace(values.Get(k)); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// showShare renders the page to confirm the data shared by the Web Share
+// Target API or the bookmarklet. It does not archive since it is a GET
+// request that may be sent by other sites.
+func (web *web) showShare(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("access share")
+
+	query := r.URL.Query()
+	web.render(w, http.StatusOK, "share", map[string]string{
+		"Title": query.Get("title"),
+		"Text":  shareText(query),
+	})
+}
+
+// share archives the shared URLs, and renders the results in a compact page.
+func (web *web) share(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logger.Error("parse form error, %v", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	text := shareText(r.PostForm)
+	if text == "" {
+		http.Redirect(w, r, template.Path(web.router, "share"), http.StatusSeeOther)
+		return
+	}
+	r.PostForm.Set("text", text)
+
+	ctx, cancel := context.WithTimeout(web.ctx, config.Opts.WaybackTimeout())
+	defer cancel()
+
+	if err := web.process(ctx, w, r, "shared"); err != nil {
+		logger.Error("httpd: process shared urls failed: %v", err)
+	}
+}
+
+// showBookmarklet renders the page of the bookmarklet, which opens the
+// share page of the current page in a popup window.
+func (web *web) showBookmarklet(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("access bookmarklet")
+
+	target, _ := json.Marshal(origin(r) + template.Path(web.router, "share"))
+	script := "javascript:void(window.open(" + string(target) +
+		"+'?url='+encodeURIComponent(location.href)+'&title='+encodeURIComponent(document.title)," +
+		"'wayback','width=480,height=600'))"
+	web.render(w, http.StatusOK, "bookmarklet", map[string]string{"Script": script})
+}
+
+// origin returns the scheme and host of the server that the request is sent
+// to, the scheme respects the X-Forwarded-Proto header of reverse proxies.
+func origin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/pooling"
+)
+
+func TestShareText(t *testing.T) {
+	var tests = []struct {
+		values url.Values
+		want   string
+	}{
+		{values: url.Values{}, want: ""},
+		{values: url.Values{"title": {"Example"}, "url": {"https://example.com"}}, want: "https://example.com"},
+		{values: url.Values{"text": {"Look https://example.org"}, "url": {" https://example.com "}}, want: "https://example.com\nLook https://example.org"},
+	}
+
+	for _, test := range tests {
+		if got := shareText(test.values); got != test.want {
+			t.Errorf("Unexpected share text, got %q instead of %q", got, test.want)
+		}
+	}
+}
+
+func TestShare(t *testing.T) {
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	ctx := context.Background()
+	server := httptest.NewServer(newWeb(ctx, nil, pooling.New(ctx, 1)).handle())
+	defer server.Close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	t.Run("manifest", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/manifest.json")
+		if err != nil {
+			t.Fatalf("Unexpected request: %v", err)
+		}
+		defer resp.Body.Close()
+		var manifest struct {
+			ShareTarget struct {
+				Action string            `json:"action"`
+				Method string            `json:"method"`
+				Params map[string]string `json:"params"`
+			} `json:"share_target"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+			t.Fatalf("Unexpected decode manifest: %v", err)
+		}
+		target := manifest.ShareTarget
+		if target.Action != "/share" || target.Method != http.MethodGet || target.Params["url"] != "url" || target.Params["text"] != "text" {
+			t.Errorf("Unexpected share target, got %+v", target)
+		}
+	})
+
+	var tests = []struct {
+		name     string
+		method   string
+		path     string
+		form     url.Values
+		status   int
+		location string
+		want     []string
+	}{
+		{
+			name:   "confirm",
+			method: http.MethodGet,
+			path:   "/share?" + url.Values{"title": {"<b>Example</b>"}, "text": {"see also"}, "url": {"https://example.com/?a=1&b=2"}}.Encode(),
+			status: http.StatusOK,
+			want:   []string{"Archive &lt;b&gt;Example&lt;/b&gt;", ">https://example.com/?a=1&amp;b=2\nsee also</textarea>", `action="/share"`},
+		},
+		{name: "share nothing", method: http.MethodPost, path: "/share", form: url.Values{"title": {"Example"}}, status: http.StatusSeeOther, location: "/share"},
+		{
+			name:   "bookmarklet",
+			method: http.MethodGet,
+			path:   "/bookmarklet",
+			status: http.StatusOK,
+			want:   []string{`href="javascript:void(window.open(&#34;` + server.URL + `/share&#34;+&#39;?url=&#39;+encodeURIComponent(location.href)`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.form.Encode()))
+			if err != nil {
+				t.Fatalf("Unexpected new request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Fatalf("Unexpected status code, got %d instead of %d", resp.StatusCode, test.status)
+			}
+			if loc := resp.Header.Get("Location"); loc != test.location {
+				t.Errorf("Unexpected location, got %s instead of %s", loc, test.location)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			for _, want := range test.want {
+				if !strings.Contains(string(body), want) {
+					t.Errorf("Unexpected body, %q not found in %q", want, body)
+				}
+			}
+		})
+	}
+}
@@ -33,14 +33,15 @@ var ErrServiceClosed = errors.New("httpd: Service closed")
 type Tor struct {
 	ctx   context.Context
 	pool  *pooling.Pool
-	store *storage.Storage
+	store storage.Storage
 
 	tor    *tor.Tor
 	server *http.Server
+	cert   *certificate
 }
 
 // New tor struct.
-func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Tor {
+func New(ctx context.Context, store storage.Storage, pool *pooling.Pool) *Tor {
 	if store == nil {
 		logger.Fatal("must initialize storage")
 	}
@@ -61,13 +62,12 @@ func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Tor {
 // Serve accepts incoming HTTP requests over Tor network, or open
 // a local port for proxy server by "WAYBACK_TOR_LOCAL_PORT" env.
 // Use "WAYBACK_TOR_PRIVKEY" to keep the Tor hidden service hostname.
+// The clear web server serves TLS if the certificate and key files are
+// set, and it also listens on "WAYBACK_LISTEN_SOCKET" if it is set.
 //
 // Serve always returns an error.
 func (t *Tor) Serve() error {
-	// Start tor with some defaults + elevated verbosity
-	logger.Info("starting and registering onion service, please wait a bit...")
-
-	handler := newWeb(t.ctx, t.pool).handle()
+	handler := newWeb(t.ctx, t.store, t.pool).handle()
 	server := &http.Server{
 		ReadTimeout:  5 * time.Minute,
 		WriteTimeout: 5 * time.Minute,
@@ -75,15 +75,42 @@ func (t *Tor) Serve() error {
 		Handler:      handler,
 	}
 
+	var listeners []net.Listener
 	switch {
 	case torExist() && t.torrc() != "":
+		// Start tor with some defaults + elevated verbosity
+		logger.Info("starting and registering onion service, please wait a bit...")
 		logger.Info("start a tor hidden server")
 		t.startTorServer(server)
 	default:
 		logger.Info("start a clear web server")
-		server.Addr = config.Opts.ListenAddr()
-		go startHTTPServer(server)
-		t.server = server
+		if config.Opts.EnabledTLS() {
+			cert, err := newCertificate(config.Opts.TLSCertFile(), config.Opts.TLSKeyFile())
+			if err != nil {
+				return err
+			}
+			t.cert = cert
+			server.TLSConfig = cert.tlsConfig()
+		}
+		ln, err := net.Listen("tcp", config.Opts.ListenAddr())
+		if err != nil {
+			return errors.Wrap(err, "listen failed")
+		}
+		listeners = append(listeners, ln)
+	}
+	if path := config.Opts.ListenSocket(); path != "" {
+		ln, err := listenUnix(path)
+		if err != nil {
+			closeListeners(listeners)
+			return errors.Wrap(err, "listen unix socket failed")
+		}
+		listeners = append(listeners, ln)
+	}
+
+	t.server = server
+	for _, ln := range listeners {
+		// Only the listen address serves TLS, the socket is for reverse proxies.
+		go startHTTPServer(server, ln, t.cert != nil && ln.Addr().Network() == "tcp")
 	}
 
 	// Block until context done
@@ -92,17 +119,36 @@ func (t *Tor) Serve() error {
 	return ErrServiceClosed
 }
 
-// Shutdown shuts down the Tor server
+// Reload reloads the TLS certificate from the files, e.g. on SIGHUP after the
+// certificate is renewed.
+func (t *Tor) Reload() error {
+	if t.cert == nil {
+		return nil
+	}
+	if err := t.cert.reload(); err != nil {
+		return err
+	}
+	logger.Info("reloaded tls certificate from %s", t.cert.certFile)
+	return nil
+}
+
+// Shutdown shuts down the Tor server gracefully, it stops accepting requests
+// and waits for in-flight requests up to "WAYBACK_SHUTDOWN_TIMEOUT", the
+// remaining connections are closed after that.
 func (t *Tor) Shutdown() error {
-	// Close onion service.
-	if t.tor != nil {
-		if err := t.tor.Close(); err != nil {
+	// Shutdown http server
+	if t.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), config.Opts.ShutdownTimeout())
+		defer cancel()
+		if err := t.server.Shutdown(ctx); err != nil {
+			logger.Warn("in-flight requests are not finished in %s, closing", config.Opts.ShutdownTimeout())
+			t.server.Close() // nolint:errcheck
 			return err
 		}
 	}
-	// Shutdown http server
-	if t.server != nil {
-		if err := t.server.Shutdown(t.ctx); err != nil {
+	// Close onion service.
+	if t.tor != nil {
+		if err := t.tor.Close(); err != nil {
 			return err
 		}
 	}
@@ -180,19 +226,33 @@ func (t *Tor) startTorServer(server *http.Server) {
 	logger.Info("please open a Tor capable browser and navigate to http://%v.onion", onion.ID)
 
 	go func() {
-		if err := server.Serve(onion); err != nil {
+		if err := server.Serve(onion); err != http.ErrServerClosed {
 			logger.Fatal("serve tor hidden service failed: %v", err)
 		}
 	}()
 }
 
-func startHTTPServer(server *http.Server) {
-	logger.Info(`Listening on "%s" without TLS`, color.BlueString(server.Addr))
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+func startHTTPServer(server *http.Server, ln net.Listener, withTLS bool) {
+	addr := color.BlueString(ln.Addr().String())
+	var err error
+	if withTLS {
+		logger.Info(`Listening on "%s" with TLS`, addr)
+		err = server.ServeTLS(ln, "", "")
+	} else {
+		logger.Info(`Listening on "%s" without TLS`, addr)
+		err = server.Serve(ln)
+	}
+	if err != http.ErrServerClosed {
 		logger.Fatal("Server failed to start: %v", err)
 	}
 }
 
+func closeListeners(listeners []net.Listener) {
+	for _, ln := range listeners {
+		ln.Close()
+	}
+}
+
 func torPortBusy() bool {
 	addr := net.JoinHostPort("127.0.0.1", "9050")
 	conn, err := net.DialTimeout("tcp", addr, time.Second)
@@ -0,0 +1,147 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/service"
+	"github.com/wabarc/wayback/storage"
+)
+
+// watchRequest represents the request body to watch a URL, the alerts are
+// posted to the webhook.
+type watchRequest struct {
+	URL      string `json:"url"`
+	Interval string `json:"interval,omitempty"`
+	Webhook  string `json:"webhook"`
+}
+
+// watchesResponse represents the response body of the watches.
+type watchesResponse struct {
+	Watches []entity.Watch `json:"watches"`
+}
+
+// watchPayload represents the body posted to the webhook of a watch once
+// the webpage changed, went dead or is alive again.
+type watchPayload struct {
+	Event string       `json:"event"`
+	Text  string       `json:"text"`
+	Watch entity.Watch `json:"watch"`
+}
+
+// owner returns the owner of the watches of the request, it is the id of
+// the token, or empty for anonymous requests.
+func owner(r *http.Request) string {
+	if token, ok := r.Context().Value(tokenKey{}).(*entity.Token); ok {
+		return token.ID
+	}
+	return ""
+}
+
+// watches returns the watches created through the API by the owner.
+func (web *web) watches(owner string) ([]entity.Watch, error) {
+	all, err := web.store.Watches()
+	if err != nil {
+		return nil, err
+	}
+	watches := []entity.Watch{}
+	for _, w := range all {
+		if w.Service == metrics.ServiceWeb && w.User == owner {
+			watches = append(watches, w)
+		}
+	}
+	return watches, nil
+}
+
+func (web *web) apiCreateWatch(w http.ResponseWriter, r *http.Request) {
+	logger.Info("api watch request start...")
+
+	var req watchRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	u, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidURL, fmt.Sprintf("invalid url: %q", req.URL))
+		return
+	}
+	if req.Webhook == "" {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidURL, "webhook is required")
+		return
+	}
+	if !validWebhook(w, req.Webhook) {
+		return
+	}
+	interval := service.DefWatchInterval
+	if req.Interval != "" {
+		if interval, err = service.ParseInterval(req.Interval); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, codeInvalidRequest, err.Error())
+			return
+		}
+	}
+
+	watch, err := service.AddWatch(web.store, u.String(), interval, metrics.ServiceWeb, owner(r), req.Webhook)
+	switch {
+	case errors.Is(err, service.ErrTooManyWatches):
+		writeError(w, http.StatusConflict, codeConflict, err.Error())
+	case err != nil:
+		logger.Error("add watch failed: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+	default:
+		w.Header().Set("Location", apiPrefix+"/watches/"+watch.ID)
+		writeJSON(w, http.StatusCreated, watch)
+	}
+}
+
+func (web *web) apiListWatches(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("api access watches")
+
+	watches, err := web.watches(owner(r))
+	if err != nil {
+		logger.Error("list watches failed: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, watchesResponse{Watches: watches})
+}
+
+func (web *web) apiRemoveWatch(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+	logger.Info("api remove watch %s", id)
+
+	watch, err := web.store.Watch(id)
+	if err == nil && (watch.Service != metrics.ServiceWeb || watch.User != owner(r)) {
+		err = storage.ErrWatchNotFound
+	}
+	if err == nil {
+		err = web.store.RemoveWatch(id)
+	}
+	switch {
+	case errors.Is(err, storage.ErrWatchNotFound):
+		writeError(w, http.StatusNotFound, codeNotFound, err.Error())
+	case err != nil:
+		logger.Error("remove watch failed: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// notify posts the alert of the watch to its webhook, the delivery id is
+// the id of the watch and the time of the check.
+func (web *web) notify(ctx context.Context, w *entity.Watch, text string) error {
+	payload := watchPayload{Event: watchEvent, Text: text, Watch: *w}
+	id := fmt.Sprintf("%s-%d", w.ID, w.CheckedAt.Unix())
+	return deliver(ctx, w.Chat, watchEvent, id, payload)
+}
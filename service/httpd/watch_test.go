@@ -0,0 +1,153 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/service"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestAPIWatches(t *testing.T) {
+	os.Setenv("WAYBACK_WEBHOOK_SECRET", "foo")
+	defer helper.Unsetenv("WAYBACK_WEBHOOK_SECRET")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	other, err := service.AddWatch(store, "https://example.org", time.Hour, "telegram", "42", "42")
+	if err != nil {
+		t.Fatalf("Unexpected add watch: %v", err)
+	}
+
+	ctx := context.Background()
+	pool := pooling.New(ctx, 1)
+	go pool.Roll()
+	defer pool.Close()
+
+	server := httptest.NewServer(newWeb(ctx, store, pool).handle())
+	defer server.Close()
+
+	do := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+apiPrefix+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected request: %v", err)
+		}
+		return resp
+	}
+
+	var tests = []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "without webhook", body: `{"url":"https://example.com"}`, status: http.StatusUnprocessableEntity},
+		{name: "invalid url", body: `{"url":"example","webhook":"https://example.net"}`, status: http.StatusUnprocessableEntity},
+		{name: "invalid interval", body: `{"url":"https://example.com","interval":"1m","webhook":"https://example.net"}`, status: http.StatusUnprocessableEntity},
+		{name: "created", body: `{"url":"https://example.com","interval":"weekly","webhook":"https://example.net"}`, status: http.StatusCreated},
+	}
+
+	var watch entity.Watch
+	for _, test := range tests {
+		resp := do(http.MethodPost, "/watches", test.body)
+		if resp.StatusCode != test.status {
+			t.Errorf("Unexpected status code of %s, got %d instead of %d", test.name, resp.StatusCode, test.status)
+		}
+		if resp.StatusCode == http.StatusCreated {
+			if err := json.NewDecoder(resp.Body).Decode(&watch); err != nil {
+				t.Fatalf("Unexpected decode watch: %v", err)
+			}
+			if loc := resp.Header.Get("Location"); loc != apiPrefix+"/watches/"+watch.ID {
+				t.Errorf("Unexpected location, got %s", loc)
+			}
+		}
+		resp.Body.Close()
+	}
+	if watch.Service != metrics.ServiceWeb || watch.Chat != "https://example.net" || watch.Every() != 7*24*time.Hour {
+		t.Errorf("Unexpected watch, got %#v", watch)
+	}
+
+	resp := do(http.MethodGet, "/watches", "")
+	var list watchesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("Unexpected decode watches: %v", err)
+	}
+	resp.Body.Close()
+	if len(list.Watches) != 1 || list.Watches[0].ID != watch.ID {
+		t.Errorf("Unexpected watches, got %#v", list.Watches)
+	}
+
+	for id, status := range map[string]int{other.ID: http.StatusNotFound, watch.ID: http.StatusNoContent} {
+		resp := do(http.MethodDelete, "/watches/"+id, "")
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Unexpected status code of removing %s, got %d instead of %d", id, resp.StatusCode, status)
+		}
+	}
+	if _, err := store.Watch(watch.ID); !errors.Is(err, storage.ErrWatchNotFound) {
+		t.Errorf("Unexpected watch not removed, got error %v", err)
+	}
+}
+
+func TestNotifyWatch(t *testing.T) {
+	allowLocalWebhooks(t)
+	os.Setenv("WAYBACK_WEBHOOK_SECRET", "foo")
+	defer helper.Unsetenv("WAYBACK_WEBHOOK_SECRET")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	delivered := make(chan watchPayload, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(headerEvent); got != watchEvent {
+			t.Errorf("Unexpected event, got %s instead of %s", got, watchEvent)
+		}
+		var payload watchPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Unexpected decode webhook payload: %v", err)
+		}
+		delivered <- payload
+	}))
+	defer hook.Close()
+
+	web := &web{ctx: context.Background()}
+	w := &entity.Watch{ID: "foo", URL: "https://example.com", Chat: hook.URL, CheckedAt: time.Now()}
+	if err := web.notify(context.Background(), w, "https://example.com changed."); err != nil {
+		t.Fatalf("Unexpected notify: %v", err)
+	}
+	payload := <-delivered
+	if payload.Event != watchEvent || payload.Text != "https://example.com changed." || payload.Watch.ID != "foo" {
+		t.Errorf("Unexpected webhook payload, got %#v", payload)
+	}
+}
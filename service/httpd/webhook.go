@@ -0,0 +1,149 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/errors"
+)
+
+const (
+	webhookEvent       = "job.finished"
+	watchEvent         = "watch.alert"
+	webhookTimeout     = 10 * time.Second
+	webhookMaxAttempts = 3
+)
+
+// Headers of the webhook request, the signature is "sha256=" followed by
+// the hex encoded HMAC-SHA256 of the timestamp and the body joined by a dot.
+const (
+	headerEvent     = "X-Wayback-Event"
+	headerDelivery  = "X-Wayback-Delivery"
+	headerTimestamp = "X-Wayback-Timestamp"
+	headerSignature = "X-Wayback-Signature"
+)
+
+// webhookClient posts the webhooks, it refuses to connect to the addresses
+// rejected by allowWebhookIP once they are resolved, so that a webhook can
+// not reach the internal network even through its DNS records, and it never
+// follows redirects.
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: webhookTimeout,
+			Control: controlWebhook,
+		}).DialContext,
+		TLSHandshakeTimeout: webhookTimeout,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// allowWebhookIP reports whether a webhook is allowed to connect to the ip,
+// it is replaced in tests to reach the local servers.
+var allowWebhookIP = publicIP
+
+// publicIP reports whether the ip is a public unicast address, which is not
+// a loopback, private, link-local (including the cloud metadata services),
+// multicast or unspecified address.
+func publicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast()
+}
+
+// controlWebhook checks the resolved address before the webhook client
+// connects to it.
+func controlWebhook(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Permanent(err)
+	}
+	if ip := net.ParseIP(host); ip == nil || !allowWebhookIP(ip) {
+		return errors.Permanent(errors.New("webhook address %s is not allowed", host))
+	}
+	return nil
+}
+
+// webhookPayload represents the body posted to the webhook once an async job finished.
+type webhookPayload struct {
+	Event string      `json:"event"`
+	Job   jobResponse `json:"job"`
+}
+
+// sign returns the signature of the body sent at the timestamp.
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp)) // nolint:errcheck
+	mac.Write([]byte("."))       // nolint:errcheck
+	mac.Write(body)              // nolint:errcheck
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver posts the payload of the event to the webhook, it retries with
+// backoff on network errors, server errors and rate limits. The id is the
+// delivery id, e.g. the id of the job.
+func deliver(ctx context.Context, hook, event, id string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	delay := time.Second
+	for attempt := 1; ; attempt++ {
+		err = post(ctx, hook, event, id, body)
+		if err == nil || errors.IsPermanent(err) || attempt == webhookMaxAttempts {
+			return err
+		}
+		logger.Warn("deliver webhook %s of %s failed, retrying: %v", event, id, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func post(ctx context.Context, hook, event, id string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook, bytes.NewReader(body))
+	if err != nil {
+		return errors.Permanent(err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", config.Opts.WaybackUserAgent())
+	req.Header.Set(headerEvent, event)
+	req.Header.Set(headerDelivery, id)
+	req.Header.Set(headerTimestamp, timestamp)
+	req.Header.Set(headerSignature, sign(config.Opts.WebhookSecret(), timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return errors.New("webhook responded %s", resp.Status)
+	case resp.StatusCode >= 300:
+		return errors.Permanent(errors.New("webhook responded %s", resp.Status))
+	}
+	return nil
+}
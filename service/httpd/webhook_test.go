@@ -0,0 +1,210 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package httpd // import "github.com/wabarc/wayback/service/httpd"
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/storage"
+)
+
+// allowLocalWebhooks lets the webhooks reach the local test servers.
+func allowLocalWebhooks(t *testing.T) {
+	allow := allowWebhookIP
+	allowWebhookIP = func(net.IP) bool { return true }
+	t.Cleanup(func() { allowWebhookIP = allow })
+}
+
+func TestDeliver(t *testing.T) {
+	allowLocalWebhooks(t)
+	os.Setenv("WAYBACK_WEBHOOK_SECRET", "foo")
+	defer helper.Unsetenv("WAYBACK_WEBHOOK_SECRET")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	var tests = []struct {
+		name     string
+		statuses []int
+		attempts int32
+		fail     bool
+	}{
+		{name: "delivered", statuses: []int{http.StatusOK}, attempts: 1},
+		{name: "retry on server error", statuses: []int{http.StatusBadGateway, http.StatusNoContent}, attempts: 2},
+		{name: "no retry on client error", statuses: []int{http.StatusNotFound}, attempts: 1, fail: true},
+		{name: "no redirect", statuses: []int{http.StatusFound}, attempts: 1, fail: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&attempts, 1)
+				body, _ := io.ReadAll(r.Body)
+				if got := r.Header.Get(headerSignature); got != sign("foo", r.Header.Get(headerTimestamp), body) {
+					t.Errorf("Unexpected signature, got %s", got)
+				}
+				if got := r.Header.Get(headerDelivery); got != "bar" {
+					t.Errorf("Unexpected delivery, got %s instead of bar", got)
+				}
+				if test.statuses[n-1] == http.StatusFound {
+					w.Header().Set("Location", "/redirected")
+				}
+				w.WriteHeader(test.statuses[n-1])
+			}))
+			defer server.Close()
+
+			payload := webhookPayload{Event: webhookEvent, Job: jobResponse{Job: pooling.Job{ID: "bar"}}}
+			err := deliver(context.Background(), server.URL, webhookEvent, "bar", payload)
+			if (err != nil) != test.fail {
+				t.Errorf("Unexpected deliver error: %v", err)
+			}
+			if attempts != test.attempts {
+				t.Errorf("Unexpected attempts, got %d instead of %d", attempts, test.attempts)
+			}
+		})
+	}
+}
+
+func TestDeliverPrivateAddress(t *testing.T) {
+	os.Setenv("WAYBACK_WEBHOOK_SECRET", "foo")
+	defer helper.Unsetenv("WAYBACK_WEBHOOK_SECRET")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+	}))
+	defer server.Close()
+
+	// The host name resolves to the loopback address of the server.
+	hook := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	if err := deliver(context.Background(), hook, webhookEvent, "bar", nil); err == nil {
+		t.Errorf("Unexpected deliver to %s, the address is not allowed", hook)
+	}
+	if attempts != 0 {
+		t.Errorf("Unexpected attempts, got %d instead of 0", attempts)
+	}
+
+	var tests = []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{ip: "127.0.0.1"},
+		{ip: "::1"},
+		{ip: "10.0.0.1"},
+		{ip: "172.16.0.1"},
+		{ip: "192.168.1.1"},
+		{ip: "169.254.169.254"},
+		{ip: "fe80::1"},
+		{ip: "fd00::1"},
+		{ip: "0.0.0.0"},
+		{ip: "::ffff:127.0.0.1"},
+		{ip: "224.0.0.1"},
+	}
+	for _, test := range tests {
+		if got := publicIP(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("Unexpected public ip of %s, got %t instead of %t", test.ip, got, test.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	if validWebhook(rec, "http://169.254.169.254/latest/meta-data/") {
+		t.Errorf("Unexpected valid webhook of the link-local address")
+	}
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Unexpected status code, got %d instead of %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestArchiveAsync(t *testing.T) {
+	allowLocalWebhooks(t)
+	os.Setenv("WAYBACK_WEBHOOK_SECRET", "foo")
+	defer helper.Unsetenv("WAYBACK_WEBHOOK_SECRET")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	delivered := make(chan webhookPayload, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Unexpected decode webhook payload: %v", err)
+		}
+		delivered <- payload
+	}))
+	defer hook.Close()
+
+	ctx := context.Background()
+	pool := pooling.New(ctx, 1)
+	go pool.Roll()
+	defer pool.Close()
+
+	server := httptest.NewServer(newWeb(ctx, store, pool).handle())
+	defer server.Close()
+
+	body := `{"urls":["https://example.com"],"webhook":"` + hook.URL + `"}`
+	resp, err := http.Post(server.URL+apiPrefix+"/archives", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Unexpected request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Unexpected status code, got %d instead of %d", resp.StatusCode, http.StatusAccepted)
+	}
+
+	var job jobResponse
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		t.Fatalf("Unexpected decode job: %v", err)
+	}
+	if loc := resp.Header.Get("Location"); loc != apiPrefix+"/jobs/"+job.ID {
+		t.Errorf("Unexpected location, got %s", loc)
+	}
+	if err := pool.Cancel(job.ID); err != nil {
+		t.Fatalf("Unexpected cancel job: %v", err)
+	}
+
+	select {
+	case payload := <-delivered:
+		if payload.Event != webhookEvent || payload.Job.ID != job.ID || payload.Job.State != pooling.StateCancelled {
+			t.Errorf("Unexpected webhook payload, got %#v", payload)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Unexpected webhook not delivered")
+	}
+}
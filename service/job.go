@@ -0,0 +1,85 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/pooling"
+)
+
+const (
+	MsgJobIDRequired = "Please send me a job ID."
+	MsgJobNotFound   = "Job not found."
+)
+
+// MsgWaybackQueued returns the reply text for a queued wayback request.
+func MsgWaybackQueued(id string) string {
+	return fmt.Sprintf("Queue...\nJob ID: %s", id)
+}
+
+// Owns reports whether the sender of the request is allowed to manage the
+// job, it is the user who sent the job from the same service, or an admin.
+// The jobs that are not sent by a user, e.g. the checks of the watches, are
+// managed by the admins only. Since every allowed sender is an admin of a
+// service without admin rules, only the configured admins manage the jobs
+// of the others.
+func (r *Request) Owns(job pooling.Job) bool {
+	if r.Role == RoleAdmin && configuredAdmin(r.Service) {
+		return true
+	}
+	return r.User != "" && job.User == r.User && job.Service == r.Service
+}
+
+// configuredAdmin reports whether the admins of the service are given by
+// the admin rules of the configuration.
+func configuredAdmin(service string) bool {
+	acl, err := ConfiguredACL()
+	if err != nil {
+		logger.Error("parse acl failed: %v", err)
+		return false
+	}
+	return acl.HasAdmins(service)
+}
+
+// JobStatus returns a reply text that describes the status of the job for
+// the given id, the job is not found if the sender does not own it.
+func JobStatus(pool *pooling.Pool, req *Request) string {
+	id := strings.TrimSpace(req.Args)
+	if id == "" {
+		return MsgJobIDRequired
+	}
+	job, ok := pool.Job(id)
+	if !ok || !req.Owns(job) {
+		return MsgJobNotFound
+	}
+	return job.String()
+}
+
+// CancelJob cancels the job for the given id and returns a reply text of
+// the result, the job is not found if the sender does not own it.
+func CancelJob(pool *pooling.Pool, req *Request) string {
+	id := strings.TrimSpace(req.Args)
+	if id == "" {
+		return MsgJobIDRequired
+	}
+	if job, ok := pool.Job(id); ok && !req.Owns(job) {
+		return MsgJobNotFound
+	}
+	err := pool.Cancel(id)
+	switch {
+	case err == nil:
+		return fmt.Sprintf("Job %s cancelled.", id)
+	case errors.Is(err, pooling.ErrJobNotFound):
+		return MsgJobNotFound
+	case errors.Is(err, pooling.ErrJobFinished):
+		return fmt.Sprintf("Job %s already finished.", id)
+	default:
+		return fmt.Sprintf("Cancel job %s failed: %v", id, err)
+	}
+}
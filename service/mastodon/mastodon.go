@@ -7,6 +7,7 @@ package mastodon // import "github.com/wabarc/wayback/service/mastodon"
 import (
 	"bytes"
 	"context"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -15,6 +16,7 @@ import (
 	"github.com/wabarc/logger"
 	"github.com/wabarc/wayback"
 	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
 	"github.com/wabarc/wayback/errors"
 	"github.com/wabarc/wayback/metrics"
 	"github.com/wabarc/wayback/pooling"
@@ -33,10 +35,12 @@ var ErrServiceClosed = errors.New("mastodon: Service closed")
 type Mastodon struct {
 	sync.RWMutex
 
-	ctx    context.Context
-	pool   *pooling.Pool
-	client *mastodon.Client
-	store  *storage.Storage
+	ctx      context.Context
+	pool     *pooling.Pool
+	client   *mastodon.Client
+	store    storage.Storage
+	acl      *service.ACL
+	commands *service.Commands
 
 	archiving map[mastodon.ID]bool
 
@@ -45,7 +49,7 @@ type Mastodon struct {
 }
 
 // New mastodon struct.
-func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Mastodon {
+func New(ctx context.Context, store storage.Storage, pool *pooling.Pool) *Mastodon {
 	if !config.Opts.PublishToMastodon() {
 		logger.Fatal("missing required environment variable")
 	}
@@ -65,11 +69,20 @@ func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Masto
 		ClientSecret: config.Opts.MastodonClientSecret(),
 		AccessToken:  config.Opts.MastodonAccessToken(),
 	})
+	acl, err := service.ConfiguredACL()
+	if err != nil {
+		logger.Fatal("parse access control lists failed: %v", err)
+	}
+	commands := service.DefaultCommands(pool, "")
+	service.RegisterWatchCommands(commands, store)
+
 	return &Mastodon{
-		ctx:    ctx,
-		pool:   pool,
-		client: client,
-		store:  store,
+		ctx:      ctx,
+		pool:     pool,
+		client:   client,
+		store:    store,
+		acl:      acl,
+		commands: commands,
 	}
 }
 
@@ -80,6 +93,7 @@ func (m *Mastodon) Serve() error {
 		return errors.New("Must initialize Mastodon client.")
 	}
 	logger.Info("Serving Mastodon instance: %s", config.Opts.MastodonServer())
+	service.RegisterNotifier(metrics.ServiceMastodon, service.NotifierFunc(m.notify))
 
 	// rcv, err := m.client.StreamingUser(m.ctx)
 	// if err != nil {
@@ -137,6 +151,8 @@ func (m *Mastodon) Serve() error {
 						m.Unlock()
 						metrics.IncrementWayback(metrics.ServiceMastodon, metrics.StatusRequest)
 						bucket := pooling.Bucket{
+							Service: metrics.ServiceMastodon,
+							User:    n.Status.Account.Acct,
 							Request: func(ctx context.Context) error {
 								if err := m.process(ctx, n.ID, n.Status); err != nil {
 									logger.Error("process failure, notification: %#v, error: %v", n, err)
@@ -145,9 +161,9 @@ func (m *Mastodon) Serve() error {
 								metrics.IncrementWayback(metrics.ServiceMastodon, metrics.StatusSuccess)
 								return nil
 							},
-							Fallback: func(ctx context.Context) error {
+							Fallback: func(ctx context.Context, err error) error {
 								pub := publish.NewMastodon(m.client)
-								pub.ToMastodon(ctx, service.MsgWaybackTimeout, string(n.Status.ID))
+								pub.ToMastodon(ctx, service.MsgWaybackFailed(err), string(n.Status.ID))
 								metrics.IncrementWayback(metrics.ServiceMastodon, metrics.StatusFailure)
 								return nil
 							},
@@ -180,6 +196,11 @@ func (m *Mastodon) process(ctx context.Context, id mastodon.ID, status *mastodon
 		logger.Warn("no status or conversation")
 		return errors.New("Mastodon: no status or conversation")
 	}
+	role, ok := m.acl.Authorize(subject(status.Account))
+	if !ok {
+		publish.NewMastodon(m.client).ToMastodon(ctx, service.MsgUnauthorized, string(status.ID))
+		return m.client.DismissNotification(ctx, id)
+	}
 	if inReplyToID, ok := status.InReplyToID.(string); ok {
 		logger.Debug("inReplyToID %s", inReplyToID)
 		if status, err = m.client.GetStatus(ctx, mastodon.ID(inReplyToID)); err != nil {
@@ -198,9 +219,21 @@ func (m *Mastodon) process(ctx context.Context, id mastodon.ID, status *mastodon
 		}
 	}()
 
-	// Process playback request if message has prefix `/playback`
-	if strings.Contains(text, config.PB_SLUG) {
-		return m.playback(status)
+	// Process command if message contains a word with prefix `/`, e.g. `/playback`
+	name, args := command(text)
+	if cmd, ok := m.commands.Lookup(name); ok {
+		if cmd.Name == service.CommandPlayback {
+			return m.playback(status)
+		}
+		req := &service.Request{Service: metrics.ServiceMastodon, User: status.Account.Acct, Chat: status.Account.Acct, Role: role, Prefix: "/", Args: args}
+		txt, err := m.commands.Run(ctx, cmd, req)
+		if err != nil {
+			return errors.Wrap(err, "mastodon: run command "+cmd.Name+" failed")
+		}
+		if txt != "" {
+			publish.NewMastodon(m.client).ToMastodon(ctx, txt, string(status.ID))
+		}
+		return nil
 	}
 
 	urls := service.MatchURL(text)
@@ -213,6 +246,7 @@ func (m *Mastodon) process(ctx context.Context, id mastodon.ID, status *mastodon
 
 	do := func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
 		logger.Debug("reduxer: %#v", rdx)
+		service.Record(m.store, cols, rdx, metrics.ServiceMastodon, status.Account.Acct)
 
 		// Reply and publish toot as public
 		ctx = context.WithValue(ctx, publish.FlagMastodon, m.client)
@@ -245,6 +279,38 @@ func (m *Mastodon) playback(status *mastodon.Status) error {
 	return nil
 }
 
+// notify sends the alert of a watched URL to the account of the watch by a mention.
+func (m *Mastodon) notify(ctx context.Context, w *entity.Watch, text string) error {
+	if !publish.NewMastodon(m.client).ToMastodon(ctx, "@"+w.Chat+" "+text, "") {
+		return errors.New("mastodon: send alert to %s failed", w.Chat)
+	}
+	return nil
+}
+
+// subject returns the subject of the account for the access control lists,
+// the server of a local account is the host of the configured instance.
+func subject(account mastodon.Account) service.Subject {
+	server := ""
+	if at := strings.LastIndex(account.Acct, "@"); at >= 0 {
+		server = account.Acct[at+1:]
+	} else if u, err := url.Parse(config.Opts.MastodonServer()); err == nil {
+		server = u.Hostname()
+	}
+	return service.Subject{Service: metrics.ServiceMastodon, User: account.Acct, Server: server}
+}
+
+// command returns the name and arguments of the command in the text, the
+// command may follow the mentions of a toot, e.g. "@wayback /playback <url>".
+func command(text string) (name, args string) {
+	fields := strings.Fields(text)
+	for i, field := range fields {
+		if strings.HasPrefix(field, "/") {
+			return service.ParseCommand("/", strings.Join(fields[i:], " "))
+		}
+	}
+	return "", ""
+}
+
 func textContent(s string) string {
 	doc, err := html.Parse(strings.NewReader(s))
 	if err != nil {
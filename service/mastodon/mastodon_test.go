@@ -66,7 +66,7 @@ func TestProcess(t *testing.T) {
 	pool := pooling.New(ctx, config.Opts.PoolingSize())
 	go pool.Roll()
 
-	m := New(ctx, &storage.Storage{}, pool)
+	m := New(ctx, &storage.Bolt{}, pool)
 	noti, err := m.client.GetNotifications(m.ctx, nil)
 	if err != nil {
 		t.Fatalf("Mastodon: Get notifications failure, err: %v", err)
@@ -139,7 +139,7 @@ func TestPlayback(t *testing.T) {
 	pool := pooling.New(ctx, config.Opts.PoolingSize())
 	go pool.Roll()
 
-	m := New(ctx, &storage.Storage{}, pool)
+	m := New(ctx, &storage.Bolt{}, pool)
 	noti, err := m.client.GetNotifications(m.ctx, nil)
 	if err != nil {
 		t.Fatalf("Mastodon: Get notifications failure, err: %v", err)
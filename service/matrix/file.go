@@ -0,0 +1,67 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package matrix // import "github.com/wabarc/wayback/service/matrix"
+
+import (
+	"context"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/service"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// files returns the file of the message, e.g. a file, an image or a video,
+// which is downloaded from the media repository of the homeserver on demand.
+// Encrypted files are not supported.
+func (m *Matrix) files(content *event.MessageEventContent) []service.File {
+	switch content.MsgType {
+	case event.MsgFile, event.MsgImage, event.MsgVideo, event.MsgAudio:
+	default:
+		return nil
+	}
+	uri, err := id.ParseContentURI(string(content.URL))
+	if err != nil {
+		logger.Warn("parse content uri of the file failed: %v", err)
+		return nil
+	}
+
+	name := content.FileName
+	if name == "" {
+		name = content.Body
+	}
+	var size int64
+	if content.Info != nil {
+		size = int64(content.Info.Size)
+	}
+	return []service.File{{
+		Name: name,
+		Size: size,
+		Open: func(ctx context.Context) (io.ReadCloser, error) {
+			return m.client.DownloadContext(ctx, uri)
+		},
+	}}
+}
+
+// archiveFiles archives the files of the message, and replies with the
+// digests and the IPFS links of them.
+func (m *Matrix) archiveFiles(ctx context.Context, ev *event.Event, files []service.File) error {
+	archived := service.ArchiveFiles(ctx, m.store, files, metrics.ServiceMatrix, ev.Sender.String())
+	body := strings.ReplaceAll(html.EscapeString(service.MsgArchivedFiles(archived)), "\n", "<br>")
+	if err := m.reply(ev, body); err != nil {
+		return errors.Wrap(err, "send to Matrix room failed")
+	}
+
+	// Mark message as receipt
+	if err := m.client.MarkRead(ev.RoomID, ev.ID); err != nil {
+		logger.Error("mark message as receipt failure: %v", err)
+	}
+	return nil
+}
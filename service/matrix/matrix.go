@@ -6,12 +6,14 @@ package matrix // import "github.com/wabarc/wayback/service/matrix"
 
 import (
 	"context"
+	"html"
 	"strings"
 	"sync"
 
 	"github.com/wabarc/logger"
 	"github.com/wabarc/wayback"
 	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
 	"github.com/wabarc/wayback/errors"
 	"github.com/wabarc/wayback/metrics"
 	"github.com/wabarc/wayback/pooling"
@@ -33,14 +35,16 @@ var ErrServiceClosed = errors.New("matrix: Service closed")
 type Matrix struct {
 	sync.RWMutex
 
-	ctx    context.Context
-	pool   *pooling.Pool
-	client *matrix.Client
-	store  *storage.Storage
+	ctx      context.Context
+	pool     *pooling.Pool
+	client   *matrix.Client
+	store    storage.Storage
+	acl      *service.ACL
+	commands *service.Commands
 }
 
 // New Matrix struct.
-func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Matrix {
+func New(ctx context.Context, store storage.Storage, pool *pooling.Pool) *Matrix {
 	if config.Opts.MatrixUserID() == "" || config.Opts.MatrixPassword() == "" || config.Opts.MatrixHomeserver() == "" {
 		logger.Fatal("missing required environment variable")
 	}
@@ -68,11 +72,22 @@ func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Matri
 		logger.Fatal("Login to Matrix got unpredictable error: %v", err)
 	}
 
+	acl, err := service.ConfiguredACL()
+	if err != nil {
+		logger.Fatal("parse access control lists failed: %v", err)
+	}
+
+	commands := service.DefaultCommands(pool, "")
+	service.RegisterWatchCommands(commands, store)
+	service.RegisterHistoryCommand(commands, store)
+
 	return &Matrix{
-		ctx:    ctx,
-		pool:   pool,
-		client: client,
-		store:  store,
+		ctx:      ctx,
+		pool:     pool,
+		client:   client,
+		store:    store,
+		acl:      acl,
+		commands: commands,
 	}
 }
 
@@ -83,6 +98,7 @@ func (m *Matrix) Serve() error {
 		return errors.New("Must initialize Matrix client.")
 	}
 	logger.Warn("Serving Matrix account: %s", config.Opts.MatrixUserID())
+	service.RegisterNotifier(metrics.ServiceMatrix, service.NotifierFunc(m.notify))
 
 	syncer := m.client.Syncer.(*matrix.DefaultSyncer)
 	// Listen join room invite event from user
@@ -90,6 +106,13 @@ func (m *Matrix) Serve() error {
 		ms := ev.Content.AsMember().Membership
 		if ms == event.MembershipInvite {
 			logger.Debug("StateMember event id: %s, event type: %s, event content: %v", ev.ID, ev.Type.Type, ev.Content.Raw)
+			if _, ok := m.acl.Authorize(subject(ev)); !ok {
+				// Reject the invitation
+				if _, err := m.client.LeaveRoom(ev.RoomID); err != nil {
+					logger.Error("reject invitation from sender failure, error: %v", err)
+				}
+				return
+			}
 			if _, err := m.client.JoinRoomByID(ev.RoomID); err != nil {
 				logger.Error("accept invitation from sender failure, error: %v", err)
 			}
@@ -105,22 +128,35 @@ func (m *Matrix) Serve() error {
 			if ev.Sender == id.UserID(config.Opts.MatrixUserID()) || ev.Unsigned.RedactedBecause != nil {
 				return
 			}
+			role, ok := m.acl.Authorize(subject(ev))
+			if !ok {
+				// nolint:errcheck
+				m.reply(ev, service.MsgUnauthorized)
+				return
+			}
+			if m.command(ev, role) {
+				return
+			}
 			metrics.IncrementWayback(metrics.ServiceMatrix, metrics.StatusRequest)
 			bucket := pooling.Bucket{
+				Service: metrics.ServiceMatrix,
+				User:    ev.Sender.String(),
 				Request: func(ctx context.Context) error {
 					if err := m.process(ctx, ev); err != nil {
 						logger.Error("process request failure, error: %v", err)
-						// nolint:errcheck
-						m.reply(ev, service.MsgWaybackRetrying)
+						if errors.IsRetryable(err) {
+							// nolint:errcheck
+							m.reply(ev, service.MsgWaybackRetrying)
+						}
 						return err
 					}
 					metrics.IncrementWayback(metrics.ServiceMatrix, metrics.StatusSuccess)
 					// m.destroyRoom(ev.RoomID)
 					return nil
 				},
-				Fallback: func(_ context.Context) error {
+				Fallback: func(_ context.Context, err error) error {
 					metrics.IncrementWayback(metrics.ServiceMatrix, metrics.StatusFailure)
-					return m.reply(ev, service.MsgWaybackTimeout)
+					return m.reply(ev, service.MsgWaybackFailed(err))
 				},
 			}
 			m.pool.Put(bucket)
@@ -166,7 +202,11 @@ func (m *Matrix) process(ctx context.Context, ev *event.Event) error {
 	}
 	logger.Debug("event id: %s, event type: %s, event content: %v", ev.ID, ev.Type.Type, ev.Content)
 
-	if content := ev.Content.Parsed.(*event.MessageEventContent); content.MsgType != event.MsgText {
+	content := ev.Content.Parsed.(*event.MessageEventContent)
+	if files := m.files(content); len(files) > 0 {
+		return m.archiveFiles(ctx, ev, files)
+	}
+	if content.MsgType != event.MsgText {
 		logger.Debug("only support text message, current msgtype: %v", content.MsgType)
 		return errors.New("Matrix: only support text message")
 	}
@@ -174,10 +214,6 @@ func (m *Matrix) process(ctx context.Context, ev *event.Event) error {
 	text := ev.Content.AsMessage().Body
 	logger.Debug("from: %s message: %s", ev.Sender, text)
 
-	if strings.Contains(text, config.PB_SLUG) {
-		return m.playback(ev)
-	}
-
 	urls := service.MatchURL(text)
 	if len(urls) == 0 {
 		logger.Warn("archives failure, URL no found.")
@@ -188,6 +224,7 @@ func (m *Matrix) process(ctx context.Context, ev *event.Event) error {
 
 	do := func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
 		logger.Debug("reduxer: %#v", rdx)
+		service.Record(m.store, cols, rdx, metrics.ServiceMatrix, ev.Sender.String())
 
 		body := render.ForReply(&render.Matrix{Cols: cols}).String()
 		if err := m.reply(ev, body); err != nil {
@@ -210,6 +247,50 @@ func (m *Matrix) process(ctx context.Context, ev *event.Event) error {
 	return service.Wayback(ctx, urls, do)
 }
 
+// command handles the message as a command if it is, and reports whether it is handled.
+func (m *Matrix) command(ev *event.Event, role service.Role) bool {
+	content, ok := ev.Content.Parsed.(*event.MessageEventContent)
+	if !ok || content.MsgType != event.MsgText {
+		return false
+	}
+	name, args := service.ParseCommand("/", content.Body)
+	cmd, ok := m.commands.Lookup(name)
+	if !ok {
+		return false
+	}
+	logger.Debug("from: %s command: %s", ev.Sender, cmd.Name)
+
+	if cmd.Name == service.CommandPlayback {
+		if err := m.playback(ev); err != nil {
+			logger.Error("playback failed: %v", err)
+		}
+		return true
+	}
+	req := &service.Request{Service: metrics.ServiceMatrix, User: ev.Sender.String(), Chat: ev.RoomID.String(), Role: role, Prefix: "/", Args: args}
+	text, err := m.commands.Run(m.ctx, cmd, req)
+	if err != nil {
+		logger.Error("run command %s failed: %v", cmd.Name, err)
+		return true
+	}
+	if text != "" {
+		body := strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+		if err := m.reply(ev, body); err != nil {
+			logger.Error("reply command %s failed: %v", cmd.Name, err)
+		}
+	}
+	return true
+}
+
+// subject returns the subject of the event for the access control lists.
+func subject(ev *event.Event) service.Subject {
+	return service.Subject{
+		Service: metrics.ServiceMatrix,
+		User:    ev.Sender.String(),
+		Chat:    ev.RoomID.String(),
+		Server:  ev.Sender.Homeserver(),
+	}
+}
+
 func (m *Matrix) playback(ev *event.Event) error {
 	text := ev.Content.AsMessage().Body
 	urls := service.MatchURL(text)
@@ -233,6 +314,13 @@ func (m *Matrix) playback(ev *event.Event) error {
 	return nil
 }
 
+// notify sends the alert of a watched URL to the room of the watch.
+func (m *Matrix) notify(_ context.Context, w *entity.Watch, text string) error {
+	content := &event.MessageEventContent{Body: text, MsgType: event.MsgText}
+	_, err := m.client.SendMessageEvent(id.RoomID(w.Chat), event.EventMessage, content)
+	return err
+}
+
 func (m *Matrix) reply(ev *event.Event, msg string) error {
 	content := &event.MessageEventContent{
 		FormattedBody: msg,
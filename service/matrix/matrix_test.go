@@ -123,7 +123,7 @@ func senderClient(t *testing.T) *Matrix {
 	go pool.Roll()
 	defer pool.Close()
 
-	return New(ctx, &storage.Storage{}, pool)
+	return New(ctx, &storage.Bolt{}, pool)
 }
 
 func recverClient(t *testing.T) *Matrix {
@@ -139,7 +139,7 @@ func recverClient(t *testing.T) *Matrix {
 	go pool.Roll()
 	defer pool.Close()
 
-	return New(ctx, &storage.Storage{}, pool)
+	return New(ctx, &storage.Bolt{}, pool)
 }
 
 // nolint:gocyclo
@@ -0,0 +1,40 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/storage"
+)
+
+// MsgPlaybackExpired is the reply text for a playback button that has expired.
+const MsgPlaybackExpired = "This button has expired, please resend the URLs."
+
+// ErrPlaybackExpired is returned if the playback callback data has expired or been removed.
+var ErrPlaybackExpired = errors.New("playback expired")
+
+// Playback returns the playback callback data of the given id, it returns
+// ErrPlaybackExpired if the data is older than the configured TTL or has
+// been removed. The expired data is removed at once rather than waiting for
+// the next sweep.
+func Playback(store storage.Storage, id int) (*entity.Playback, error) {
+	pb, err := store.Playback(id)
+	if errors.Is(err, storage.ErrPlaybackNotFound) {
+		return nil, ErrPlaybackExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pb.Expired(config.Opts.PlaybackTTL()) {
+		if err := store.RemovePlayback(uint64(id)); err != nil {
+			logger.Error("remove expired playback %d failed: %v", id, err)
+		}
+		return nil, ErrPlaybackExpired
+	}
+	return pb, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestPlayback(t *testing.T) {
+	os.Setenv("WAYBACK_PLAYBACK_TTL", "1")
+	defer helper.Unsetenv("WAYBACK_PLAYBACK_TTL")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	fresh := &entity.Playback{Source: "foo"}
+	expired := &entity.Playback{Source: "bar", CreatedAt: time.Now().Add(-2 * time.Hour)}
+	for _, pb := range []*entity.Playback{fresh, expired} {
+		if err := store.CreatePlayback(pb); err != nil {
+			t.Fatalf("Unexpected create playback: %v", err)
+		}
+	}
+
+	var tests = []struct {
+		name string
+		id   int
+		err  error
+	}{
+		{name: "fresh", id: fresh.ID, err: nil},
+		{name: "expired", id: expired.ID, err: ErrPlaybackExpired},
+		{name: "removed", id: 42, err: ErrPlaybackExpired},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Playback(store, test.id)
+			if !errors.Is(err, test.err) {
+				t.Errorf("Unexpected query playback, got %v instead of %v", err, test.err)
+			}
+		})
+	}
+
+	if _, err := store.Playback(expired.ID); !errors.Is(err, storage.ErrPlaybackNotFound) {
+		t.Errorf("Unexpected expired playback, got %v instead of %v", err, storage.ErrPlaybackNotFound)
+	}
+	if _, err := store.Playback(fresh.ID); err != nil {
+		t.Errorf("Unexpected fresh playback removed: %v", err)
+	}
+}
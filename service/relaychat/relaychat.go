@@ -7,11 +7,13 @@ package relaychat // import "github.com/wabarc/wayback/service/relaychat"
 import (
 	"context"
 	"crypto/tls"
+	"strings"
 	"sync"
 
 	"github.com/wabarc/logger"
 	"github.com/wabarc/wayback"
 	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
 	"github.com/wabarc/wayback/errors"
 	"github.com/wabarc/wayback/metrics"
 	"github.com/wabarc/wayback/pooling"
@@ -27,18 +29,23 @@ import (
 // ErrServiceClosed is returned by the Service's Serve method after a call to Shutdown.
 var ErrServiceClosed = errors.New("irc: Service closed")
 
+// commandPrefix is the prefix of the commands in IRC messages.
+const commandPrefix = "!"
+
 // IRC represents an IRC service in the application.
 type IRC struct {
 	sync.RWMutex
 
-	ctx   context.Context
-	pool  *pooling.Pool
-	conn  *irc.Connection
-	store *storage.Storage
+	ctx      context.Context
+	pool     *pooling.Pool
+	conn     *irc.Connection
+	store    storage.Storage
+	acl      *service.ACL
+	commands *service.Commands
 }
 
 // New IRC struct.
-func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *IRC {
+func New(ctx context.Context, store storage.Storage, pool *pooling.Pool) *IRC {
 	if config.Opts.IRCNick() == "" {
 		logger.Fatal("missing required environment variable")
 	}
@@ -60,11 +67,21 @@ func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *IRC {
 	conn.UseTLS = true
 	conn.TLSConfig = &tls.Config{InsecureSkipVerify: false, MinVersion: tls.VersionTLS12}
 
+	acl, err := service.ConfiguredACL()
+	if err != nil {
+		logger.Fatal("parse access control lists failed: %v", err)
+	}
+
+	commands := service.DefaultCommands(pool, "")
+	service.RegisterWatchCommands(commands, store)
+
 	return &IRC{
-		ctx:   ctx,
-		pool:  pool,
-		conn:  conn,
-		store: store,
+		ctx:      ctx,
+		pool:     pool,
+		conn:     conn,
+		store:    store,
+		acl:      acl,
+		commands: commands,
 	}
 }
 
@@ -75,14 +92,26 @@ func (i *IRC) Serve() error {
 		return errors.New("Must initialize IRC connection.")
 	}
 	logger.Info("Serving IRC instance: %s", config.Opts.IRCServer())
+	service.RegisterNotifier(metrics.ServiceIRC, service.NotifierFunc(i.notify))
 
 	if config.Opts.IRCChannel() != "" {
 		i.conn.AddCallback("001", func(ev *irc.Event) { i.conn.Join(config.Opts.IRCChannel()) })
 	}
 	i.conn.AddCallback("PRIVMSG", func(ev *irc.Event) {
 		go func(ev *irc.Event) {
+			role, ok := i.acl.Authorize(subject(ev))
+			if !ok {
+				i.conn.Privmsg(ev.Nick, service.MsgUnauthorized)
+				return
+			}
+			if i.command(ev, role) {
+				return
+			}
 			metrics.IncrementWayback(metrics.ServiceIRC, metrics.StatusRequest)
 			bucket := pooling.Bucket{
+				Service: metrics.ServiceIRC,
+				User:    ev.Nick,
+				URLs:    service.MatchURL(ev.MessageWithoutFormat()),
 				Request: func(ctx context.Context) error {
 					if err := i.process(ctx, ev); err != nil {
 						logger.Error("process failure, message: %s, error: %v", ev.Message(), err)
@@ -91,8 +120,8 @@ func (i *IRC) Serve() error {
 					metrics.IncrementWayback(metrics.ServiceIRC, metrics.StatusSuccess)
 					return nil
 				},
-				Fallback: func(_ context.Context) error {
-					i.conn.Privmsg(ev.Nick, service.MsgWaybackTimeout)
+				Fallback: func(_ context.Context, err error) error {
+					i.conn.Privmsg(ev.Nick, service.MsgWaybackFailed(err))
 					metrics.IncrementWayback(metrics.ServiceIRC, metrics.StatusFailure)
 					return nil
 				},
@@ -125,6 +154,56 @@ func (i *IRC) Shutdown() error {
 	return nil
 }
 
+// command handles the message as a command if it is, and reports whether it
+// is handled. Commands are prefixed with "!" since IRC clients take "/" for
+// their own commands, e.g. "!status <id>".
+func (i *IRC) command(ev *irc.Event, role service.Role) bool {
+	name, args := service.ParseCommand(commandPrefix, ev.MessageWithoutFormat())
+	cmd, ok := i.commands.Lookup(name)
+	if !ok {
+		return false
+	}
+	logger.Debug("from: %s command: %s", ev.Nick, cmd.Name)
+
+	chat := subject(ev).Chat
+	if chat == "" {
+		chat = ev.Nick
+	}
+	req := &service.Request{Service: metrics.ServiceIRC, User: ev.Nick, Chat: chat, Role: role, Prefix: commandPrefix, Args: args}
+	text, err := i.commands.Run(i.ctx, cmd, req)
+	if err != nil {
+		logger.Error("run command %s failed: %v", cmd.Name, err)
+		return true
+	}
+	// IRC messages are a single line.
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			i.conn.Privmsg(ev.Nick, line)
+		}
+	}
+	return true
+}
+
+// notify sends the alert of a watched URL to the channel or the nick of the watch.
+func (i *IRC) notify(_ context.Context, w *entity.Watch, text string) error {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			i.conn.Privmsg(w.Chat, line)
+		}
+	}
+	return nil
+}
+
+// subject returns the subject of the event for the access control lists,
+// the chat is the channel if the message is sent to a channel.
+func subject(ev *irc.Event) service.Subject {
+	s := service.Subject{Service: metrics.ServiceIRC, User: ev.Nick, Mask: ev.Source}
+	if len(ev.Arguments) > 0 && strings.HasPrefix(ev.Arguments[0], "#") {
+		s.Chat = ev.Arguments[0]
+	}
+	return s
+}
+
 func (i *IRC) process(ctx context.Context, ev *irc.Event) error {
 	if ev.Nick == "" || ev.Message() == "" {
 		logger.Warn("without nick or empty message")
@@ -142,6 +221,7 @@ func (i *IRC) process(ctx context.Context, ev *irc.Event) error {
 
 	do := func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
 		logger.Debug("reduxer: %#v", rdx)
+		service.Record(i.store, cols, rdx, metrics.ServiceIRC, ev.Nick)
 
 		replyText := render.ForReply(&render.Relaychat{Cols: cols}).String()
 
@@ -93,7 +93,7 @@ func TestProcess(t *testing.T) {
 	recvConn.AddCallback("PRIVMSG", func(ev *irc.Event) {
 		if ev.Nick == sender {
 			done <- true
-			i := New(context.Background(), &storage.Storage{}, pool)
+			i := New(context.Background(), &storage.Bolt{}, pool)
 			// Replace IRC connection to receive connection
 			i.conn = recvConn
 			if err = i.process(context.Background(), ev); err != nil {
@@ -191,7 +191,7 @@ func TestToIRCChannel(t *testing.T) {
 		if ev.Nick == sender {
 			done <- true
 			ctx := context.Background()
-			i := New(ctx, &storage.Storage{}, pool)
+			i := New(ctx, &storage.Bolt{}, pool)
 			// Replace IRC connection to receive connection
 			i.conn = recvConn
 			if err = i.process(ctx, ev); err != nil {
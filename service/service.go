@@ -6,6 +6,7 @@ package service // import "github.com/wabarc/wayback/service"
 
 import (
 	"context"
+	"fmt"
 	"net/url"
 
 	"github.com/wabarc/wayback"
@@ -18,6 +19,15 @@ const (
 	MsgWaybackTimeout  = "wayback timeout, please try later."
 )
 
+// MsgWaybackFailed returns the reply text for a failed wayback request,
+// permanent failures are reported along with their cause.
+func MsgWaybackFailed(err error) string {
+	if errors.IsPermanent(err) {
+		return fmt.Sprintf("wayback failed: %v", err)
+	}
+	return MsgWaybackTimeout
+}
+
 type doFunc func(cols []wayback.Collect, rdx reduxer.Reduxer) error
 
 // Wayback in a separate goroutine.
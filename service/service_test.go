@@ -15,6 +15,7 @@ import (
 	"github.com/wabarc/logger"
 	"github.com/wabarc/wayback"
 	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/errors"
 	"github.com/wabarc/wayback/reduxer"
 )
 
@@ -86,3 +87,35 @@ func TestWaybackWithoutReduxer(t *testing.T) {
 		t.Fatal("Unexpected wayback exceeded")
 	}
 }
+
+func TestMsgWaybackFailed(t *testing.T) {
+	var tests = []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "retryable",
+			err:  errors.Retryable(errors.New("some error")),
+			want: MsgWaybackTimeout,
+		},
+		{
+			name: "unclassified",
+			err:  errors.New("some error"),
+			want: MsgWaybackTimeout,
+		},
+		{
+			name: "permanent",
+			err:  errors.Permanent(errors.New("no such host")),
+			want: "wayback failed: no such host",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := MsgWaybackFailed(test.err); got != test.want {
+				t.Errorf("Unexpected message got %s instead of %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package slack // import "github.com/wabarc/wayback/service/slack"
+
+import (
+	"context"
+	"io"
+
+	"github.com/slack-go/slack/slackevents"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/service"
+)
+
+// files returns the files shared in the message, which are downloaded from
+// their private URLs with the bot token on demand.
+func (s *Slack) files(shared []slackevents.File) []service.File {
+	files := make([]service.File, 0, len(shared))
+	for _, f := range shared {
+		link := f.URLPrivateDownload
+		if link == "" {
+			continue
+		}
+		files = append(files, service.File{
+			Name: f.Name,
+			Size: int64(f.Size),
+			Open: func(ctx context.Context) (io.ReadCloser, error) {
+				r, w := io.Pipe()
+				go func() {
+					w.CloseWithError(s.bot.GetFileContext(ctx, link, w))
+				}()
+				return r, nil
+			},
+		})
+	}
+	return files
+}
+
+// archiveFiles enqueues a job that archives the files of the event, and
+// replies with the digests and the IPFS links of them.
+func (s *Slack) archiveFiles(ev *event) (err error) {
+	metrics.IncrementWayback(metrics.ServiceSlack, metrics.StatusRequest)
+	id := pooling.NewID()
+	ev, err = s.reply(ev, service.MsgWaybackQueued(id))
+	if err != nil {
+		logger.Error("reply queue failed: %v", err)
+		return
+	}
+	bucket := pooling.Bucket{
+		ID:      id,
+		Service: metrics.ServiceSlack,
+		User:    ev.User,
+		Request: func(ctx context.Context) error {
+			archived := service.ArchiveFiles(ctx, s.store, ev.Files, metrics.ServiceSlack, ev.User)
+			if _, err := s.edit(ev.Channel, ev.ThreadTimeStamp, service.MsgArchivedFiles(archived)); err != nil {
+				return err
+			}
+			metrics.IncrementWayback(metrics.ServiceSlack, metrics.StatusSuccess)
+			return nil
+		},
+		Fallback: func(_ context.Context, err error) error {
+			// nolint:errcheck
+			s.edit(ev.Channel, ev.ThreadTimeStamp, service.MsgWaybackFailed(err))
+			metrics.IncrementWayback(metrics.ServiceSlack, metrics.StatusFailure)
+			return nil
+		},
+	}
+	s.pool.Put(bucket)
+
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package slack // import "github.com/wabarc/wayback/service/slack"
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/slack-go/slack"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/service"
+	"github.com/wabarc/wayback/storage"
+)
+
+// history returns the blocks of a page of the archive history of the user,
+// along with the buttons to resend an archive and to show more. It returns
+// the results of the archive of the item instead, and uploads the artifacts
+// of it to the channel.
+func (s *Slack) history(user, channel, args string) []slack.Block {
+	h, err := service.ParseHistoryArgs(args)
+	if err != nil {
+		return textBlocks(fmt.Sprintf("Sorry, %v.", err))
+	}
+	if h.Item > 0 {
+		return s.historyItem(user, channel, h.Item)
+	}
+
+	page, err := service.History(s.store, metrics.ServiceSlack, user, h)
+	if err != nil {
+		logger.Error("query history failed: %v", err)
+		return nil
+	}
+
+	blocks := textBlocks(service.MsgHistory(page))
+	var buttons []slack.BlockElement
+	for _, a := range page.Archives {
+		buttons = append(buttons, historyButton("#"+strconv.Itoa(a.ID), service.HistoryArgs{Item: a.ID}))
+	}
+	if page.Next > 0 {
+		buttons = append(buttons, historyButton("More »", page.NextArgs()))
+	}
+	if len(buttons) > 0 {
+		blocks = append(blocks, slack.NewActionBlock("", buttons...))
+	}
+	return blocks
+}
+
+// historyAction replies to the user who pressed a history button with a
+// message that only the user can see.
+func (s *Slack) historyAction(callback slack.InteractionCallback, args string) {
+	subject := service.Subject{Service: metrics.ServiceSlack, User: callback.User.ID, Chat: callback.Container.ChannelID, Team: callback.Team.ID}
+	if _, ok := s.acl.Authorize(subject); !ok {
+		return
+	}
+	blocks := s.history(callback.User.ID, callback.Container.ChannelID, args)
+	if len(blocks) == 0 {
+		return
+	}
+	if _, err := s.bot.PostEphemeral(callback.Container.ChannelID, callback.User.ID, slack.MsgOptionBlocks(blocks...)); err != nil {
+		logger.Error("post history failed: %v", err)
+	}
+}
+
+// historyItem returns the blocks of the results of the archive, and uploads
+// the artifacts of it that are still on the local disk.
+func (s *Slack) historyItem(user, channel string, id int) []slack.Block {
+	a, err := service.HistoryItem(s.store, metrics.ServiceSlack, user, id)
+	if errors.Is(err, storage.ErrArchiveNotFound) {
+		return textBlocks("Archive not found.")
+	}
+	if err != nil {
+		logger.Error("query archive failed: %v", err)
+		return nil
+	}
+
+	go func() {
+		if err := service.UploadToSlack(s.bot, service.HistoryArtifact(a), channel, "", a.Source); err != nil {
+			logger.Error("upload artifacts of archive %d failed: %v", a.ID, err)
+		}
+	}()
+	return textBlocks(service.MsgHistoryItem(a))
+}
+
+// historyButton returns a button of the history command with the arguments,
+// the action id is unique in the message as Slack requires.
+func historyButton(text string, args service.HistoryArgs) slack.BlockElement {
+	return slack.NewButtonBlockElement(
+		service.HistoryPrefix+args.String(),
+		args.String(),
+		slack.NewTextBlockObject(slack.PlainTextType, text, false, false),
+	)
+}
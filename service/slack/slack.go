@@ -7,6 +7,7 @@ package slack // import "github.com/wabarc/wayback/service/slack"
 import (
 	"context"
 	"net/url"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/slack-go/slack"
@@ -15,6 +16,7 @@ import (
 	"github.com/wabarc/logger"
 	"github.com/wabarc/wayback"
 	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
 	"github.com/wabarc/wayback/errors"
 	"github.com/wabarc/wayback/metrics"
 	"github.com/wabarc/wayback/pooling"
@@ -57,16 +59,22 @@ type Slack struct {
 
 	bot    *slack.Client
 	client *socketmode.Client
-	store  *storage.Storage
+	store  storage.Storage
 	pool   *pooling.Pool
+	acl    *service.ACL
+
+	commands *service.Commands
 }
 
 type event struct {
 	User, Text, Channel, TimeStamp, ThreadTimeStamp string
+
+	// Files are the files shared in the message.
+	Files []service.File
 }
 
 // New Slack struct.
-func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Slack {
+func New(ctx context.Context, store storage.Storage, pool *pooling.Pool) *Slack {
 	if config.Opts.SlackBotToken() == "" {
 		logger.Fatal("missing required environment variable")
 	}
@@ -91,16 +99,28 @@ func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Slack
 		// socketmode.OptionLog(log.New(os.Stdout, "socketmode: ", log.Lshortfile|log.LstdFlags)),
 	)
 
+	acl, err := service.ConfiguredACL()
+	if err != nil {
+		logger.Fatal("parse access control lists failed: %v", err)
+	}
+
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
+	commands := service.DefaultCommands(pool, config.Opts.SlackHelptext())
+	service.RegisterWatchCommands(commands, store)
+	service.RegisterHistoryCommand(commands, store)
+
 	return &Slack{
 		ctx:    ctx,
 		bot:    bot,
 		client: client,
 		store:  store,
 		pool:   pool,
+		acl:    acl,
+
+		commands: commands,
 	}
 }
 
@@ -115,6 +135,7 @@ func (s *Slack) Serve() (err error) {
 		return err
 	}
 	logger.Info("authorized on account %s", color.BlueString(user.User))
+	service.RegisterNotifier(metrics.ServiceSlack, service.NotifierFunc(s.notify))
 
 	go func() {
 		for evt := range s.client.Events {
@@ -168,19 +189,17 @@ func (s *Slack) handleRequest(evt socketmode.Event) {
 		switch ev := innerEvent.Data.(type) {
 		case *slackevents.AppMentionEvent:
 			logger.Debug("channel mention message event: %+v", ev)
-			// nolint:errcheck
-			go s.process(&event{ev.User, ev.Text, ev.Channel, ev.TimeStamp, ev.ThreadTimeStamp})
+			go s.dispatch(&event{ev.User, ev.Text, ev.Channel, ev.TimeStamp, ev.ThreadTimeStamp, nil}, eventsAPIEvent.TeamID)
 		case *slackevents.MessageEvent:
 			logger.Debug("direct message event: %+v", ev)
 			// Message event https://api.slack.com/events/message
 			// Exclude message from bot, https://api.slack.com/events/message/bot_message
 			// Exclude message changed event
-			if ev.BotID != "" || ev.SubType != "" {
+			if ev.BotID != "" || (ev.SubType != "" && ev.SubType != "file_share") {
 				logger.Debug("skipped event from bot")
 				return
 			}
-			// nolint:errcheck
-			go s.process(&event{ev.User, ev.Text, ev.Channel, ev.TimeStamp, ev.ThreadTimeStamp})
+			go s.dispatch(&event{ev.User, ev.Text, ev.Channel, ev.TimeStamp, ev.ThreadTimeStamp, s.files(ev.Files)}, eventsAPIEvent.TeamID)
 		}
 	default:
 		logger.Warn("unsupported Events API event received")
@@ -201,15 +220,23 @@ func (s *Slack) handleButton(evt socketmode.Event) {
 	case slack.InteractionTypeBlockActions:
 		// See https://api.slack.com/apis/connections/socket-implement#button
 		if len(callback.ActionCallback.BlockActions) > 0 {
-			// Process wayback request from a playback action
 			block := callback.ActionCallback.BlockActions[0]
+			if strings.HasPrefix(block.ActionID, service.HistoryPrefix) {
+				logger.Debug("received history action: %+v", block)
+				go s.historyAction(callback, block.Value)
+				return
+			}
+			// Process wayback request from a playback action
 			logger.Debug("received wayback action: %+v", block)
-			// nolint:errcheck
-			go s.process(&event{callback.User.ID, block.Value, callback.Container.ChannelID, callback.Container.MessageTs, callback.Container.ThreadTs})
+			go s.dispatch(&event{callback.User.ID, block.Value, callback.Container.ChannelID, callback.Container.MessageTs, callback.Container.ThreadTs, nil}, callback.Team.ID)
 		}
 	case slack.InteractionTypeViewSubmission:
 		// See https://api.slack.com/apis/connections/socket-implement#modal
 		logger.Debug("received view submission: %+v", callback.View)
+		subject := service.Subject{Service: metrics.ServiceSlack, User: callback.User.ID, Chat: callback.View.ExternalID, Team: callback.Team.ID}
+		if _, ok := s.acl.Authorize(subject); !ok {
+			return
+		}
 		// nolint:errcheck
 		s.playback(callback.View.ExternalID, callback.View.State.Values[callbackKey][callbackKey].Value, callback.TriggerID)
 	}
@@ -224,45 +251,73 @@ func (s *Slack) handleCommand(evt socketmode.Event) {
 	logger.Debug("slash command received: %+v", cmd)
 
 	var payload interface{}
-	switch cmd.Command {
-	case "/help":
-		payload = map[string]interface{}{
-			"blocks": []slack.Block{
-				slack.NewSectionBlock(
-					&slack.TextBlockObject{
-						Type: slack.PlainTextType,
-						Text: config.Opts.SlackHelptext(),
-					},
-					nil, nil,
-				),
-			}}
-	case "/metrics":
-		stats := metrics.Gather.Export("wayback")
-		if config.Opts.EnabledMetrics() && stats != "" {
-			payload = map[string]interface{}{
-				"blocks": []slack.Block{
-					slack.NewSectionBlock(
-						&slack.TextBlockObject{
-							Type: slack.PlainTextType,
-							Text: stats,
-						},
-						nil, nil,
-					),
-				}}
-		}
-	case "/playback":
+	subject := service.Subject{Service: metrics.ServiceSlack, User: cmd.UserID, Chat: cmd.ChannelID, Team: cmd.TeamID}
+	role, allowed := s.acl.Authorize(subject)
+	command, ok := s.commands.Lookup(strings.TrimPrefix(cmd.Command, "/"))
+	switch {
+	case !allowed:
+		payload = textPayload(service.MsgUnauthorized)
+	case !ok:
+	case command.Name == service.CommandPlayback:
 		// nolint:errcheck
 		s.playback(cmd.ChannelID, cmd.Text, cmd.TriggerID)
+	case command.Name == service.CommandHistory:
+		if blocks := s.history(cmd.UserID, cmd.ChannelID, cmd.Text); len(blocks) > 0 {
+			payload = map[string]interface{}{"blocks": blocks}
+		}
 	default:
+		req := &service.Request{Service: metrics.ServiceSlack, User: cmd.UserID, Chat: cmd.ChannelID, Role: role, Prefix: "/", Args: cmd.Text}
+		text, err := s.commands.Run(s.ctx, command, req)
+		if err != nil {
+			logger.Error("run command %s failed: %v", command.Name, err)
+		}
+		if text != "" {
+			payload = textPayload(text)
+		}
 	}
 	s.client.Ack(*evt.Request, payload)
 }
 
+// dispatch processes the event if the sender is allowed by the access
+// control lists, or replies a refusal.
+func (s *Slack) dispatch(ev *event, team string) {
+	subject := service.Subject{Service: metrics.ServiceSlack, User: ev.User, Chat: ev.Channel, Team: team}
+	if _, ok := s.acl.Authorize(subject); !ok {
+		// nolint:errcheck
+		s.reply(ev, service.MsgUnauthorized)
+		return
+	}
+	// nolint:errcheck
+	s.process(ev)
+}
+
+func textPayload(text string) map[string]interface{} {
+	return map[string]interface{}{"blocks": textBlocks(text)}
+}
+
+func textBlocks(text string) []slack.Block {
+	return []slack.Block{
+		slack.NewSectionBlock(
+			&slack.TextBlockObject{
+				Type: slack.PlainTextType,
+				Text: text,
+			},
+			nil, nil,
+		),
+	}
+}
+
 func (s *Slack) process(ev *event) (err error) {
 	content := ev.Text
 	logger.Debug("content: %s", content)
 
 	urls := service.MatchURL(content)
+	if len(ev.Files) > 0 {
+		// The URLs in the text of the files are archived as well.
+		if err := s.archiveFiles(ev); err != nil || len(urls) == 0 {
+			return err
+		}
+	}
 
 	metrics.IncrementWayback(metrics.ServiceSlack, metrics.StatusRequest)
 	if len(urls) == 0 {
@@ -271,24 +326,31 @@ func (s *Slack) process(ev *event) (err error) {
 		return errors.New("URL no found")
 	}
 
-	ev, err = s.reply(ev, "Queue...")
+	id := pooling.NewID()
+	ev, err = s.reply(ev, service.MsgWaybackQueued(id))
 	if err != nil {
 		logger.Error("reply queue failed: %v", err)
 		return
 	}
 	bucket := pooling.Bucket{
+		ID:      id,
+		Service: metrics.ServiceSlack,
+		User:    ev.User,
+		URLs:    urls,
 		Request: func(ctx context.Context) error {
 			if err := s.wayback(ctx, ev, urls); err != nil {
 				logger.Error("archives failed: %v", err)
-				// nolint:errcheck
-				s.edit(ev.Channel, ev.ThreadTimeStamp, service.MsgWaybackRetrying)
+				if errors.IsRetryable(err) {
+					// nolint:errcheck
+					s.edit(ev.Channel, ev.ThreadTimeStamp, service.MsgWaybackRetrying)
+				}
 				return err
 			}
 			metrics.IncrementWayback(metrics.ServiceSlack, metrics.StatusSuccess)
 			return nil
 		},
-		Fallback: func(_ context.Context) error {
-			replyText := service.MsgWaybackTimeout
+		Fallback: func(_ context.Context, err error) error {
+			replyText := service.MsgWaybackFailed(err)
 			// nolint:errcheck
 			s.edit(ev.Channel, ev.ThreadTimeStamp, replyText)
 			metrics.IncrementWayback(metrics.ServiceSlack, metrics.StatusFailure)
@@ -309,6 +371,7 @@ func (s *Slack) wayback(ctx context.Context, ev *event, urls []*url.URL) error {
 
 	do := func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
 		logger.Debug("reduxer: %#v", rdx)
+		service.Record(s.store, cols, rdx, metrics.ServiceSlack, ev.User)
 
 		replyText := render.ForReply(&render.Slack{Cols: cols, Data: rdx}).String()
 		logger.Debug("reply text, %s", replyText)
@@ -448,6 +511,12 @@ func (s *Slack) reply(ev *event, text string, options ...slack.MsgOption) (*even
 	return ev, nil
 }
 
+// notify sends the alert of a watched URL to the channel of the watch.
+func (s *Slack) notify(ctx context.Context, w *entity.Watch, text string) error {
+	_, _, err := s.bot.PostMessageContext(ctx, w.Chat, slack.MsgOptionText(text, false), slack.MsgOptionDisableMarkdown())
+	return err
+}
+
 func (s *Slack) edit(channel, timestamp string, text string, options ...slack.MsgOption) (string, error) {
 	if text == "" && len(options) == 0 {
 		logger.Warn("text empty, skipped")
@@ -26,6 +26,7 @@ import (
 	"github.com/wabarc/helper"
 	"github.com/wabarc/wayback/config"
 	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/service"
 	// "github.com/wabarc/wayback/storage"
 )
 
@@ -170,7 +171,7 @@ func TestServe(t *testing.T) {
 	go pool.Roll()
 	defer pool.Close()
 
-	sl := &Slack{ctx: ctx, bot: bot, pool: pool, client: client}
+	sl := &Slack{ctx: ctx, bot: bot, pool: pool, client: client, commands: service.DefaultCommands(pool, "")}
 	time.AfterFunc(3*time.Second, func() {
 		sl.Shutdown()
 		cancel()
@@ -0,0 +1,86 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package telegram // import "github.com/wabarc/wayback/service/telegram"
+
+import (
+	"context"
+	"html"
+	"io"
+
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/service"
+
+	telegram "gopkg.in/telebot.v3"
+)
+
+// files returns the file attached to the message, e.g. a document, a photo
+// or a video, which is downloaded from the Bot API on demand.
+func (t *Telegram) files(m *telegram.Message) []service.File {
+	var file telegram.File
+	var name string
+	switch {
+	case m.Document != nil:
+		file, name = m.Document.File, m.Document.FileName
+	case m.Photo != nil:
+		file, name = m.Photo.File, "photo.jpg"
+	case m.Video != nil:
+		file, name = m.Video.File, m.Video.FileName
+	case m.Animation != nil:
+		file, name = m.Animation.File, m.Animation.FileName
+	case m.Audio != nil:
+		file, name = m.Audio.File, m.Audio.FileName
+	case m.Voice != nil:
+		file, name = m.Voice.File, "voice.ogg"
+	default:
+		return nil
+	}
+	if name == "" {
+		name = file.UniqueID
+	}
+
+	return []service.File{{
+		Name: name,
+		Size: int64(file.FileSize),
+		Open: func(_ context.Context) (io.ReadCloser, error) {
+			return t.bot.File(&file)
+		},
+	}}
+}
+
+// archiveFiles enqueues a job that archives the files of the message, and
+// replies with the digests and the IPFS links of them.
+func (t *Telegram) archiveFiles(message *telegram.Message, files []service.File) error {
+	metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusRequest)
+	id := pooling.NewID()
+	request, err := t.reply(message, service.MsgWaybackQueued(id))
+	if err != nil {
+		return errors.Wrap(err, "reply message failed")
+	}
+	bucket := pooling.Bucket{
+		ID:      id,
+		Service: metrics.ServiceTelegram,
+		User:    sender(message),
+		Request: func(ctx context.Context) error {
+			archived := service.ArchiveFiles(ctx, t.store, files, metrics.ServiceTelegram, sender(message))
+			opts := &telegram.SendOptions{DisableWebPagePreview: true}
+			if _, err := t.bot.Edit(request, html.EscapeString(service.MsgArchivedFiles(archived)), opts); err != nil {
+				return errors.Wrap(err, "telegram: update message failed")
+			}
+			metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusSuccess)
+			return nil
+		},
+		Fallback: func(_ context.Context, err error) error {
+			t.bot.Delete(request)                               // nolint:errcheck
+			t.bot.Reply(message, service.MsgWaybackFailed(err)) // nolint:errcheck
+			metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusFailure)
+			return nil
+		},
+	}
+	t.pool.Put(bucket)
+
+	return nil
+}
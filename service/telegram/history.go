@@ -0,0 +1,89 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package telegram // import "github.com/wabarc/wayback/service/telegram"
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/service"
+	"github.com/wabarc/wayback/storage"
+	telegram "gopkg.in/telebot.v3"
+)
+
+// history replies with a page of the archive history of the sender, along
+// with the buttons to resend an archive and to show more, or resends the
+// archive of the item.
+func (t *Telegram) history(message *telegram.Message, args string) error {
+	h, err := service.ParseHistoryArgs(args)
+	if err != nil {
+		t.reply(message, fmt.Sprintf("Sorry, %v.", err)) // nolint:errcheck
+		return nil
+	}
+	if h.Item > 0 {
+		return t.historyItem(message, h.Item)
+	}
+
+	page, err := service.History(t.store, metrics.ServiceTelegram, sender(message), h)
+	if err != nil {
+		return errors.Wrap(err, "telegram: query history failed")
+	}
+
+	var rows [][]telegram.InlineButton
+	items := []telegram.InlineButton{}
+	for _, a := range page.Archives {
+		items = append(items, telegram.InlineButton{
+			Text: "#" + strconv.Itoa(a.ID),
+			Data: service.HistoryPrefix + service.HistoryArgs{Item: a.ID}.String(),
+		})
+	}
+	if len(items) > 0 {
+		rows = append(rows, items)
+	}
+	if page.Next > 0 {
+		rows = append(rows, []telegram.InlineButton{{Text: "More »", Data: service.HistoryPrefix + page.NextArgs().String()}})
+	}
+
+	opts := &telegram.SendOptions{
+		DisableWebPagePreview: true,
+		ReplyMarkup:           &telegram.ReplyMarkup{InlineKeyboard: rows},
+	}
+	if _, err := t.bot.Reply(message, html.EscapeString(service.MsgHistory(page)), opts); err != nil {
+		return errors.Wrap(err, "telegram: send history failed")
+	}
+	return nil
+}
+
+// historyItem resends the results of the archive, and the artifacts of it
+// that are still on the local disk.
+func (t *Telegram) historyItem(message *telegram.Message, id int) error {
+	a, err := service.HistoryItem(t.store, metrics.ServiceTelegram, sender(message), id)
+	if errors.Is(err, storage.ErrArchiveNotFound) {
+		t.reply(message, "Archive not found.") // nolint:errcheck
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "telegram: query archive failed")
+	}
+
+	opts := &telegram.SendOptions{DisableWebPagePreview: true}
+	reply, err := t.bot.Reply(message, html.EscapeString(service.MsgHistoryItem(a)), opts)
+	if err != nil {
+		return errors.Wrap(err, "telegram: send archive failed")
+	}
+
+	album := service.UploadToTelegram(service.HistoryArtifact(a), html.EscapeString(a.Source))
+	if len(album) == 0 {
+		return nil
+	}
+	opts = &telegram.SendOptions{ReplyTo: reply, DisableNotification: true}
+	if _, err := t.bot.SendAlbum(message.Chat, album, opts); err != nil {
+		return errors.Wrap(err, "telegram: send artifacts failed")
+	}
+	return nil
+}
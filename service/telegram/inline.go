@@ -0,0 +1,277 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package telegram // import "github.com/wabarc/wayback/service/telegram"
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/publish"
+	"github.com/wabarc/wayback/reduxer"
+	"github.com/wabarc/wayback/service"
+	"github.com/wabarc/wayback/storage"
+	"github.com/wabarc/wayback/template/render"
+
+	telegram "gopkg.in/telebot.v3"
+)
+
+// inlineTimeout limits the playback of an inline query, since the user is
+// waiting for the results while typing.
+const inlineTimeout = 8 * time.Second
+
+// The playback results of inline queries are cached for a while, both by
+// the bot and by Telegram, since a query is sent on every keystroke.
+const (
+	inlineCacheTTL  = 5 * time.Minute
+	maxInlineCached = 256
+)
+
+// inlineCache caches the playback results of inline queries by the
+// normalized URLs, the zero value is ready to use.
+type inlineCache struct {
+	mu      sync.Mutex
+	entries map[string]inlineCached
+}
+
+type inlineCached struct {
+	text string
+	at   time.Time
+}
+
+// get returns the cached playback results of the key if not expired.
+func (c *inlineCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Since(e.at) > inlineCacheTTL {
+		return "", false
+	}
+	return e.text, true
+}
+
+// put caches the playback results of the key, the expired entries are
+// removed, or an arbitrary one if the cache is still full.
+func (c *inlineCache) put(key, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]inlineCached)
+	}
+	if len(c.entries) >= maxInlineCached {
+		for k, e := range c.entries {
+			if time.Since(e.at) > inlineCacheTTL {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) >= maxInlineCached {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[key] = inlineCached{text: text, at: time.Now()}
+}
+
+// inlineKey returns the cache key of the URLs of an inline query.
+func inlineKey(urls []*url.URL) string {
+	keys := make([]string, 0, len(urls))
+	for _, u := range urls {
+		keys = append(keys, storage.NormalizeURL(u.String()))
+	}
+	return strings.Join(keys, " ")
+}
+
+// query answers an inline query, e.g. "@bot https://example.com", with the
+// playback results of the URLs and an option to archive them. The chosen
+// results are reported back by Telegram if the inline feedback of the bot
+// is enabled, which is required to archive the URLs.
+func (t *Telegram) query(q *telegram.Query) error {
+	logger.Debug("inline query: %#v", q)
+
+	resp := &telegram.QueryResponse{Results: telegram.Results{}, IsPersonal: true}
+	if _, ok := t.acl.Authorize(querySubject(q.Sender)); !ok {
+		resp.Results = append(resp.Results, &telegram.ArticleResult{
+			ResultBase:  telegram.ResultBase{ID: "unauthorized"},
+			Title:       "Unauthorized",
+			Description: service.MsgUnauthorized,
+			Text:        service.MsgUnauthorized,
+		})
+		return t.bot.Answer(q, resp)
+	}
+
+	urls := service.ExcludeURL(service.MatchURL(q.Text), "t.me")
+	if len(urls) == 0 {
+		return t.bot.Answer(q, resp)
+	}
+	links := make([]string, 0, len(urls))
+	for _, u := range urls {
+		links = append(links, u.String())
+	}
+	description := strings.Join(links, " ")
+
+	resp.CacheTime = int(inlineCacheTTL.Seconds())
+	if text, err := t.inlinePlayback(urls); err != nil {
+		logger.Error("inline playback failed: %v", err)
+	} else {
+		playback := &telegram.ArticleResult{
+			ResultBase:  telegram.ResultBase{ID: metrics.InlinePlayback},
+			Title:       "Playback",
+			Description: description,
+		}
+		playback.SetContent(&telegram.InputTextMessageContent{
+			Text:           text,
+			ParseMode:      telegram.ModeHTML,
+			DisablePreview: true,
+		})
+		resp.Results = append(resp.Results, playback)
+	}
+
+	// Telegram reports the id of an inline message only if it has an inline
+	// keyboard, which is required to edit the message with the results.
+	archive := &telegram.ArticleResult{
+		ResultBase: telegram.ResultBase{
+			ID: metrics.InlineArchive,
+			ReplyMarkup: &telegram.ReplyMarkup{
+				InlineKeyboard: [][]telegram.InlineButton{{{Text: "source", URL: links[0]}}},
+			},
+		},
+		Title:       "Archive now",
+		Description: description,
+	}
+	archive.SetContent(&telegram.InputTextMessageContent{
+		Text:           "Archiving...\n" + strings.Join(links, "\n"),
+		DisablePreview: true,
+	})
+	resp.Results = append(resp.Results, archive)
+
+	return t.bot.Answer(q, resp)
+}
+
+// inlinePlayback returns the rendered playback results of the URLs of an
+// inline query, from the cache if they have been played back recently.
+func (t *Telegram) inlinePlayback(urls []*url.URL) (string, error) {
+	key := inlineKey(urls)
+	if text, ok := t.inline.get(key); ok {
+		return text, nil
+	}
+
+	metrics.IncrementPlayback(metrics.ServiceTelegram, metrics.StatusRequest)
+	ctx, cancel := context.WithTimeout(t.ctx, inlineTimeout)
+	defer cancel()
+	cols, err := wayback.Playback(ctx, urls...)
+	if err != nil {
+		metrics.IncrementPlayback(metrics.ServiceTelegram, metrics.StatusFailure)
+		return "", err
+	}
+	metrics.IncrementPlayback(metrics.ServiceTelegram, metrics.StatusSuccess)
+
+	text := render.ForReply(&render.Telegram{Cols: cols}).String()
+	t.inline.put(key, text)
+	return text, nil
+}
+
+// chosen handles an inline result chosen by the user, it enqueues a wayback
+// job for the archive option and edits the inline message with the results.
+func (t *Telegram) chosen(result *telegram.InlineResult) error {
+	logger.Debug("chosen inline result: %#v", result)
+	metrics.IncrementInline(metrics.ServiceTelegram, result.ResultID)
+
+	if result.ResultID != metrics.InlineArchive {
+		return nil
+	}
+	if result.MessageID == "" {
+		return errors.New("telegram: no inline message of the chosen result")
+	}
+	if _, ok := t.acl.Authorize(querySubject(result.Sender)); !ok {
+		return t.editInline(result, service.MsgUnauthorized)
+	}
+
+	urls := service.ExcludeURL(service.MatchURL(result.Query), "t.me")
+	if len(urls) == 0 {
+		return t.editInline(result, "URL no found.")
+	}
+
+	metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusRequest)
+	bucket := pooling.Bucket{
+		ID:      pooling.NewID(),
+		Service: metrics.ServiceTelegram,
+		User:    querySubject(result.Sender).User,
+		URLs:    urls,
+		Request: func(ctx context.Context) error {
+			if err := t.inlineWayback(ctx, result, urls); err != nil {
+				if errors.IsRetryable(err) {
+					t.editInline(result, service.MsgWaybackRetrying) // nolint:errcheck
+				}
+				return errors.Wrap(err, "archives failed")
+			}
+			metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusSuccess)
+			return nil
+		},
+		Fallback: func(_ context.Context, err error) error {
+			t.editInline(result, service.MsgWaybackFailed(err)) // nolint:errcheck
+			metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusFailure)
+			return nil
+		},
+	}
+	t.pool.Put(bucket)
+
+	return nil
+}
+
+func (t *Telegram) inlineWayback(ctx context.Context, result *telegram.InlineResult, urls []*url.URL) error {
+	do := func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
+		user := ""
+		if result.Sender != nil {
+			user = strconv.FormatInt(result.Sender.ID, 10)
+		}
+		service.Record(t.store, cols, rdx, metrics.ServiceTelegram, user)
+
+		replyText := render.ForReply(&render.Telegram{Cols: cols, Data: rdx}).String()
+		if err := t.editInline(result, replyText); err != nil {
+			return errors.Wrap(err, "telegram: update inline message failed")
+		}
+
+		ctx = context.WithValue(ctx, publish.FlagTelegram, t.bot)
+		ctx = context.WithValue(ctx, publish.PubBundle{}, rdx)
+		publish.To(ctx, cols, publish.FlagTelegram.String())
+		return nil
+	}
+
+	return service.Wayback(ctx, urls, do)
+}
+
+// editInline replaces the text of the inline message, and removes its inline keyboard.
+func (t *Telegram) editInline(result *telegram.InlineResult, text string) error {
+	opts := &telegram.SendOptions{DisableWebPagePreview: true}
+	_, err := t.bot.Edit(result, text, opts)
+	// Telegram replies true instead of the message for inline messages.
+	if err == nil || err == telegram.ErrTrueResult || err == telegram.ErrSameMessageContent {
+		return nil
+	}
+	logger.Error("edit inline message failed: %v", err)
+	return err
+}
+
+// querySubject returns the subject of the sender of an inline query for the
+// access control lists, the chat of an inline query is unknown.
+func querySubject(sender *telegram.User) service.Subject {
+	s := service.Subject{Service: metrics.ServiceTelegram}
+	if sender != nil {
+		s.User = strconv.FormatInt(sender.ID, 10)
+	}
+	return s
+}
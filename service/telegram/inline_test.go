@@ -0,0 +1,191 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package telegram // import "github.com/wabarc/wayback/service/telegram"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/service"
+	telegram "gopkg.in/telebot.v3"
+)
+
+type inlineResult struct {
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	ReplyMarkup map[string]interface{} `json:"reply_markup"`
+}
+
+func TestInline(t *testing.T) {
+	helper.Unsetenv("WAYBACK_TELEGRAM_TOKEN", "WAYBACK_TELEGRAM_CHANNEL", "WAYBACK_ACL_DENY")
+	os.Setenv("WAYBACK_TELEGRAM_TOKEN", token)
+	os.Setenv("WAYBACK_ACL_DENY", "telegram:user:666")
+	defer helper.Unsetenv("WAYBACK_ACL_DENY")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	// Fake Bot API server
+	var mu sync.Mutex
+	var answers [][]inlineResult
+	var edits []map[string]string
+	httpClient, mux, server := helper.MockServer()
+	defer server.Close()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		b, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch strings.TrimPrefix(r.URL.Path, prefix) {
+		case "getMe":
+			fmt.Fprintln(w, getMeJSON)
+		case "answerInlineQuery":
+			var dat struct {
+				Results []inlineResult `json:"results"`
+			}
+			json.Unmarshal(b, &dat) // nolint:errcheck
+			answers = append(answers, dat.Results)
+			fmt.Fprintln(w, `{"ok":true, "result":true}`)
+		case "editMessageText":
+			var dat map[string]string
+			json.Unmarshal(b, &dat) // nolint:errcheck
+			edits = append(edits, dat)
+			fmt.Fprintln(w, `{"ok":true, "result":true}`)
+		default:
+			t.Errorf("Unexpected request to the Bot API: %s", r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		}
+	})
+
+	tg, cancel, err := newTelegram(httpClient, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tg.store.Close()
+	defer cancel()
+	if tg.acl, err = service.ConfiguredACL(); err != nil {
+		t.Fatalf("Unexpected acl: %v", err)
+	}
+
+	var queries = []struct {
+		text   string
+		sender int64
+		ids    []string
+	}{
+		{text: "no urls", sender: 1, ids: []string{}},
+		{text: "https://example.com", sender: 666, ids: []string{"unauthorized"}},
+		{text: "https://example.com", sender: 1, ids: []string{metrics.InlineArchive}},
+	}
+	for i, test := range queries {
+		q := &telegram.Query{ID: "1", Text: test.text, Sender: &telegram.User{ID: test.sender}}
+		if err := tg.query(q); err != nil {
+			t.Fatalf("Unexpected answer inline query: %v", err)
+		}
+		if len(answers) != i+1 {
+			t.Fatalf("Unexpected answers, got %d instead of %d", len(answers), i+1)
+		}
+		ids := []string{}
+		for _, r := range answers[i] {
+			if r.Type != "article" {
+				t.Errorf("Unexpected result type, got %s instead of article", r.Type)
+			}
+			// Playback fails without network, so it is optional.
+			if r.ID == metrics.InlinePlayback {
+				continue
+			}
+			if r.ID == metrics.InlineArchive && r.ReplyMarkup == nil {
+				t.Errorf("Unexpected archive result without inline keyboard")
+			}
+			ids = append(ids, r.ID)
+		}
+		if strings.Join(ids, ",") != strings.Join(test.ids, ",") {
+			t.Errorf("Unexpected results of %q, got %v instead of %v", test.text, ids, test.ids)
+		}
+	}
+
+	// The cached playback results are answered without playing back again.
+	u, _ := url.Parse("https://example.com/")
+	tg.inline.put(inlineKey([]*url.URL{u}), "cached")
+	if err := tg.query(&telegram.Query{ID: "2", Text: "https://EXAMPLE.com", Sender: &telegram.User{ID: 1}}); err != nil {
+		t.Fatalf("Unexpected answer inline query: %v", err)
+	}
+	if last := answers[len(answers)-1]; len(last) == 0 || last[0].ID != metrics.InlinePlayback {
+		t.Errorf("Unexpected results of the cached playback, got %v", last)
+	}
+
+	var results = []struct {
+		result *telegram.InlineResult
+		text   string
+	}{
+		{result: &telegram.InlineResult{ResultID: metrics.InlinePlayback, Query: "https://example.com", MessageID: "inline-1", Sender: &telegram.User{ID: 1}}},
+		{result: &telegram.InlineResult{ResultID: metrics.InlineArchive, Query: "https://example.com", MessageID: "inline-2", Sender: &telegram.User{ID: 666}}, text: service.MsgUnauthorized},
+		{result: &telegram.InlineResult{ResultID: metrics.InlineArchive, Query: "no urls", MessageID: "inline-3", Sender: &telegram.User{ID: 1}}, text: "URL no found."},
+	}
+	for _, test := range results {
+		edits = nil
+		if err := tg.chosen(test.result); err != nil {
+			t.Fatalf("Unexpected handle chosen inline result: %v", err)
+		}
+		if test.text == "" {
+			if len(edits) != 0 {
+				t.Errorf("Unexpected edit inline message, got %v", edits)
+			}
+			continue
+		}
+		if len(edits) != 1 || edits[0]["inline_message_id"] != test.result.MessageID || edits[0]["text"] != test.text {
+			t.Errorf("Unexpected edit inline message, got %v instead of %s %q", edits, test.result.MessageID, test.text)
+		}
+	}
+
+	if err := tg.chosen(&telegram.InlineResult{ResultID: metrics.InlineArchive, Query: "https://example.com"}); err == nil {
+		t.Errorf("Unexpected handle chosen result without inline message, got nil instead of an error")
+	}
+}
+
+func TestInlineCache(t *testing.T) {
+	var c inlineCache
+	if _, ok := c.get("foo"); ok {
+		t.Errorf("Unexpected cached entry of an empty cache")
+	}
+
+	c.put("foo", "bar")
+	if text, ok := c.get("foo"); !ok || text != "bar" {
+		t.Errorf("Unexpected cached entry, got %q instead of bar", text)
+	}
+
+	c.entries["foo"] = inlineCached{text: "bar", at: time.Now().Add(-2 * inlineCacheTTL)}
+	if _, ok := c.get("foo"); ok {
+		t.Errorf("Unexpected expired entry")
+	}
+
+	for i := 0; i < maxInlineCached*2; i++ {
+		c.put(strconv.Itoa(i), "bar")
+	}
+	if len(c.entries) > maxInlineCached {
+		t.Errorf("Unexpected cached entries, got %d more than %d", len(c.entries), maxInlineCached)
+	}
+
+	a, _ := url.Parse("https://example.com/?utm_source=foo")
+	b, _ := url.Parse("HTTPS://Example.com")
+	if inlineKey([]*url.URL{a}) != inlineKey([]*url.URL{b}) {
+		t.Errorf("Unexpected cache keys of the same URL, got %q and %q", inlineKey([]*url.URL{a}), inlineKey([]*url.URL{b}))
+	}
+}
@@ -8,8 +8,8 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"html"
 	"net/url"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -44,13 +44,16 @@ var (
 type Telegram struct {
 	ctx context.Context
 
-	bot   *telegram.Bot
-	store *storage.Storage
-	pool  *pooling.Pool
+	bot      *telegram.Bot
+	store    storage.Storage
+	pool     *pooling.Pool
+	commands *service.Commands
+	acl      *service.ACL
+	inline   inlineCache
 }
 
 // New Telegram struct.
-func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Telegram {
+func New(ctx context.Context, store storage.Storage, pool *pooling.Pool) *Telegram {
 	if config.Opts.TelegramToken() == "" {
 		logger.Fatal("missing required environment variable")
 	}
@@ -60,11 +63,15 @@ func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Teleg
 	if pool == nil {
 		logger.Fatal("must initialize pooling")
 	}
+	var poller telegram.Poller = &telegram.LongPoller{Timeout: pollTick}
+	if config.Opts.EnabledTelegramWebhook() {
+		poller = newWebhook(config.Opts.TelegramWebhook(), config.Opts.TelegramToken(), config.Opts.TelegramWebhookSecret())
+	}
 	bot, err := telegram.NewBot(telegram.Settings{
 		Token: config.Opts.TelegramToken(),
 		// Verbose:   config.Opts.HasDebugMode(),
 		ParseMode: telegram.ModeHTML,
-		Poller:    &telegram.LongPoller{Timeout: pollTick},
+		Poller:    poller,
 		OnError: func(err error, _ telegram.Context) {
 			if err != nil {
 				logger.Warn(err.Error())
@@ -75,15 +82,26 @@ func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Teleg
 		logger.Fatal("create telegram bot instance failed: %v", err)
 	}
 
+	acl, err := service.ConfiguredACL()
+	if err != nil {
+		logger.Fatal("parse acl failed: %v", err)
+	}
+
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
+	commands := service.DefaultCommands(pool, config.Opts.TelegramHelptext())
+	service.RegisterWatchCommands(commands, store)
+	service.RegisterHistoryCommand(commands, store)
+
 	return &Telegram{
-		ctx:   ctx,
-		bot:   bot,
-		store: store,
-		pool:  pool,
+		ctx:      ctx,
+		bot:      bot,
+		store:    store,
+		pool:     pool,
+		commands: commands,
+		acl:      acl,
 	}
 }
 
@@ -103,9 +121,26 @@ func (t *Telegram) Serve() (err error) {
 	// Set bot commands
 	// nolint:errcheck
 	t.setCommands()
+	service.RegisterNotifier(metrics.ServiceTelegram, service.NotifierFunc(t.notify))
+
+	// Telegram refuses long polling while a webhook is set, e.g. by a previous run in webhook mode.
+	if _, ok := t.bot.Poller.(*webhook); !ok {
+		if err := t.bot.RemoveWebhook(); err != nil {
+			logger.Warn("remove telegram webhook failed: %v", err)
+		}
+	}
 
 	t.bot.Poller = telegram.NewMiddlewarePoller(t.bot.Poller, func(update *telegram.Update) bool {
 		switch {
+		case update.Callback != nil && update.Callback.Message != nil && strings.HasPrefix(update.Callback.Data, service.HistoryPrefix):
+			logger.Debug("history callback query: %#v", update.Callback)
+
+			// Process the history button on behalf of the user who pressed it.
+			callback := update.Callback
+			callback.Message.Text = "/" + service.CommandHistory + " " + strings.TrimPrefix(callback.Data, service.HistoryPrefix)
+			callback.Message.Sender = callback.Sender
+			t.bot.Respond(callback)        // nolint:errcheck
+			go t.process(callback.Message) // nolint:errcheck
 		case update.Callback != nil:
 			logger.Debug("callback query: %#v", update.Callback)
 
@@ -118,7 +153,13 @@ func (t *Telegram) Serve() (err error) {
 			}
 
 			// Query playback callback data from database
-			pb, err := t.store.Playback(id)
+			pb, err := service.Playback(t.store, id)
+			if errors.Is(err, service.ErrPlaybackExpired) {
+				logger.Debug("playback %d expired", id)
+				// nolint:errcheck
+				t.bot.Respond(callback, &telegram.CallbackResponse{Text: service.MsgPlaybackExpired, ShowAlert: true})
+				return false
+			}
 			if err != nil {
 				logger.Error("query playback data failed: %v", err)
 				metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusFailure)
@@ -132,8 +173,22 @@ func (t *Telegram) Serve() (err error) {
 				return false
 			}
 
+			// Process the callback message on behalf of the user who pressed the button.
 			callback.Message.Text = helper.Byte2String(data)
+			callback.Message.Sender = callback.Sender
 			go t.process(callback.Message) // nolint:errcheck
+		case update.Query != nil:
+			go func(q *telegram.Query) {
+				if err := t.query(q); err != nil {
+					logger.Error("answer inline query failed: %v", err)
+				}
+			}(update.Query)
+		case update.InlineResult != nil:
+			go func(r *telegram.InlineResult) {
+				if err := t.chosen(r); err != nil {
+					logger.Error("handle chosen inline result failed: %v", err)
+				}
+			}(update.InlineResult)
 		case update.Message != nil && update.Message.FromGroup():
 			transform(update.Message)
 			logger.Debug("message: %#v", update.Message)
@@ -141,7 +196,7 @@ func (t *Telegram) Serve() (err error) {
 			if update.Message.ReplyTo != nil {
 				update.Message.Text += update.Message.ReplyTo.Text
 			}
-			if !strings.Contains(update.Message.Text, "@"+t.bot.Me.Username) {
+			if !strings.Contains(update.Message.Text+update.Message.Caption, "@"+t.bot.Me.Username) {
 				return false
 			}
 			go t.process(update.Message) // nolint:errcheck
@@ -185,7 +240,13 @@ func (t *Telegram) process(message *telegram.Message) (err error) {
 	// the update will be split into multiple parts.
 	// Don't process parts of the forwarded message without text.
 	// if message.IsForwarded() && message.Caption == "" {
-	if message.IsForwarded() && content == "" {
+	files := t.files(message)
+	if message.IsForwarded() && content == "" && len(files) == 0 {
+		return nil
+	}
+	role, ok := t.acl.Authorize(subject(message))
+	if !ok {
+		t.reply(message, service.MsgUnauthorized) // nolint:errcheck
 		return nil
 	}
 	urls := service.ExcludeURL(service.MatchURL(content), "t.me")
@@ -194,71 +255,93 @@ func (t *Telegram) process(message *telegram.Message) (err error) {
 	// required user reply a message with URLs.
 	if message.IsReply() {
 		if message.ReplyTo.Sender.Username == t.bot.Me.Username {
-			content = "/playback" + content
+			content = "/playback " + content
 		}
 	}
 
-	command := command(content)
+	name, args := service.ParseCommand("/", content)
+	cmd, ok := t.commands.Lookup(name)
 	switch {
-	case command == "help", command == "start":
-		// nolint:errcheck
-		t.reply(message, config.Opts.TelegramHelptext())
-	case command == "playback":
+	case ok && cmd.Name == service.CommandPlayback:
 		return t.playback(message)
-	case command == "metrics":
-		stats := metrics.Gather.Export("wayback")
-		if config.Opts.EnabledMetrics() && stats != "" {
-			if _, err = t.reply(message, stats); err != nil {
-				return err
-			}
+	case ok && cmd.Name == service.CommandHistory:
+		return t.history(message, args)
+	case ok:
+		req := &service.Request{Service: metrics.ServiceTelegram, User: sender(message), Chat: subject(message).Chat, Role: role, Prefix: "/", Args: args}
+		text, err := t.commands.Run(t.ctx, cmd, req)
+		if err != nil {
+			return errors.Wrap(err, "telegram: run command "+cmd.Name+" failed")
 		}
-		return nil
-	case command != "":
+		if text != "" {
+			t.reply(message, text) // nolint:errcheck
+		}
+	case name != "":
 		fallback := t.commandFallback()
 		if fallback != "" {
 			fallback = fmt.Sprintf("\n\nAvailable commands:\n%s", fallback)
 		}
 		// nolint:errcheck
-		t.reply(message, fmt.Sprintf("/%s is an illegal command%s", command, fallback))
+		t.reply(message, fmt.Sprintf("/%s is an illegal command%s", name, fallback))
+	case len(files) > 0:
+		// The URLs in the caption of the files are archived as well.
+		if err := t.archiveFiles(message, files); err != nil || len(urls) == 0 {
+			return err
+		}
+		return t.archiveURLs(message, urls)
 	case len(urls) == 0:
 		logger.Warn("archives failure, URL no found.")
 		metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusRequest)
 		t.reply(message, "URL no found.") // nolint:errcheck
 	default:
-		metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusRequest)
-		request, err := t.reply(message, "Queue...")
-		if err != nil {
-			return errors.Wrap(err, "reply message failed")
-		}
-		bucket := pooling.Bucket{
-			Request: func(ctx context.Context) error {
-				_, err := t.bot.Edit(request, "Archiving...")
-				if err != nil && err != telegram.ErrSameMessageContent {
-					return errors.Wrap(err, "telegram: send archiving message failed")
-				}
+		return t.archiveURLs(message, urls)
+	}
+	return nil
+}
 
-				if err := t.wayback(ctx, request, urls); err != nil {
+// archiveURLs enqueues a job that archives the URLs of the message, and
+// replies with the results.
+func (t *Telegram) archiveURLs(message *telegram.Message, urls []*url.URL) error {
+	metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusRequest)
+	id := pooling.NewID()
+	request, err := t.reply(message, service.MsgWaybackQueued(id))
+	if err != nil {
+		return errors.Wrap(err, "reply message failed")
+	}
+	bucket := pooling.Bucket{
+		ID:      id,
+		Service: metrics.ServiceTelegram,
+		User:    sender(message),
+		URLs:    urls,
+		Request: func(ctx context.Context) error {
+			_, err := t.bot.Edit(request, "Archiving...")
+			if err != nil && err != telegram.ErrSameMessageContent {
+				return errors.Wrap(err, "telegram: send archiving message failed")
+			}
+
+			if err := t.wayback(ctx, message, request, urls); err != nil {
+				if errors.IsRetryable(err) {
 					// nolint:errcheck
 					t.bot.Edit(request, service.MsgWaybackRetrying)
-					return errors.Wrap(err, "archives failed")
 				}
-				metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusSuccess)
-				return nil
-			},
-			Fallback: func(_ context.Context) error {
-				t.bot.Delete(request)                           // nolint:errcheck
-				t.bot.Reply(message, service.MsgWaybackTimeout) // nolint:errcheck
-				metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusFailure)
-				return nil
-			},
-		}
-		t.pool.Put(bucket)
+				return errors.Wrap(err, "archives failed")
+			}
+			metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusSuccess)
+			return nil
+		},
+		Fallback: func(_ context.Context, err error) error {
+			t.bot.Delete(request)                               // nolint:errcheck
+			t.bot.Reply(message, service.MsgWaybackFailed(err)) // nolint:errcheck
+			metrics.IncrementWayback(metrics.ServiceTelegram, metrics.StatusFailure)
+			return nil
+		},
 	}
+	t.pool.Put(bucket)
 	return nil
 }
 
-func (t *Telegram) wayback(ctx context.Context, request *telegram.Message, urls []*url.URL) error {
+func (t *Telegram) wayback(ctx context.Context, message, request *telegram.Message, urls []*url.URL) error {
 	do := func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
+		service.Record(t.store, cols, rdx, metrics.ServiceTelegram, sender(message))
 		opts := &telegram.SendOptions{DisableWebPagePreview: true}
 		replyText := render.ForReply(&render.Telegram{Cols: cols, Data: rdx}).String()
 		logger.Debug("reply text, %s", replyText)
@@ -398,7 +481,7 @@ func (t *Telegram) getCommands() []telegram.Command {
 		maps[command.Text] = true
 	}
 
-	for _, command := range defaultCommands() {
+	for _, command := range t.defaultCommands() {
 		if maps[command.Text] {
 			continue
 		}
@@ -422,21 +505,12 @@ func (t *Telegram) setCommands() error {
 	return nil
 }
 
-func defaultCommands() []telegram.Command {
-	commands := []telegram.Command{
-		{
-			Text:        "help",
-			Description: "Show help information",
-		},
-		{
-			Text:        "playback",
-			Description: "Playback archived url",
-		},
-	}
-	if config.Opts.EnabledMetrics() {
+func (t *Telegram) defaultCommands() []telegram.Command {
+	commands := make([]telegram.Command, 0, len(t.commands.List()))
+	for _, cmd := range t.commands.List() {
 		commands = append(commands, telegram.Command{
-			Text:        "metrics",
-			Description: "Show service metrics",
+			Text:        cmd.Name,
+			Description: cmd.Description,
 		})
 	}
 
@@ -447,25 +521,32 @@ func callbackPrefix() string {
 	return ":wayback "
 }
 
-func command(message string) string {
-	matchCmd := func(str string) string {
-		re := regexp.MustCompile(`(?m)^\/\w+`)
-		for _, match := range re.FindAllString(str, -1) {
-			return strings.TrimLeft(match, "/")
-		}
+// notify sends the alert of a watched URL to the chat of the watch.
+func (t *Telegram) notify(_ context.Context, w *entity.Watch, text string) error {
+	id, err := strconv.ParseInt(w.Chat, 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "telegram: invalid chat of watch")
+	}
+	opts := &telegram.SendOptions{DisableWebPagePreview: true}
+	_, err = t.bot.Send(&telegram.Chat{ID: id}, html.EscapeString(text), opts)
+	return err
+}
+
+// sender returns the identifier of the user who sent the message.
+func sender(m *telegram.Message) string {
+	if m == nil || m.Sender == nil {
 		return ""
 	}
+	return strconv.FormatInt(m.Sender.ID, 10)
+}
 
-	switch {
-	case strings.HasPrefix(message, "/help"), strings.HasPrefix(message, "/start"):
-		return "help"
-	case strings.HasPrefix(message, "/playback"):
-		return "playback"
-	case strings.HasPrefix(message, "/metrics"):
-		return "metrics"
-	default:
-		return matchCmd(message)
+// subject returns the subject of the message for the access control lists.
+func subject(m *telegram.Message) service.Subject {
+	s := service.Subject{Service: metrics.ServiceTelegram, User: sender(m)}
+	if m != nil && m.Chat != nil {
+		s.Chat = strconv.FormatInt(m.Chat.ID, 10)
 	}
+	return s
 }
 
 func transform(m *telegram.Message) {
@@ -144,7 +144,7 @@ func handle(mux *http.ServeMux, updatesJSON string) {
 			fmt.Fprintln(w, getChatJSON)
 		case "getMyCommands":
 			fmt.Fprintln(w, getMyCommandsJSON)
-		case "setMyCommands":
+		case "setMyCommands", "deleteWebhook":
 			fmt.Fprintln(w, `{"ok":true, "result":true}`)
 		case "getUpdates":
 			if count == 0 {
@@ -154,7 +154,7 @@ func handle(mux *http.ServeMux, updatesJSON string) {
 				fmt.Fprintln(w, `{"ok":true, "result":null}`)
 			}
 		case "sendMessage":
-			if text == "Queue..." || strings.Contains(text, config.SlotName("ia")) {
+			if strings.HasPrefix(text, "Queue...") || strings.Contains(text, config.SlotName("ia")) {
 				fmt.Fprintln(w, replyJSON)
 			} else {
 				fmt.Fprintln(w, sendMessageJSON)
@@ -198,7 +198,7 @@ func newTelegram(client *http.Client, endpoint string) (tg *Telegram, cancel con
 	pool := pooling.New(ctx, config.Opts.PoolingSize())
 	go pool.Roll()
 
-	tg = &Telegram{ctx: ctx, bot: bot, pool: pool, store: store}
+	tg = &Telegram{ctx: ctx, bot: bot, pool: pool, store: store, commands: service.DefaultCommands(pool, "")}
 
 	return tg, cancel, nil
 }
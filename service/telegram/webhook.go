@@ -0,0 +1,104 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package telegram // import "github.com/wabarc/wayback/service/telegram"
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/service"
+
+	telegram "gopkg.in/telebot.v3"
+)
+
+// headerSecretToken is the header of the secret token in the requests sent by
+// the Telegram Bot API to the webhook.
+const headerSecretToken = "X-Telegram-Bot-Api-Secret-Token"
+
+// maxUpdateSize is the maximum size of an update pushed to the webhook.
+const maxUpdateSize = 1 << 20
+
+// webhook is a poller that receives the updates pushed by the Telegram Bot
+// API to the HTTP server, as an alternative to long polling.
+type webhook struct {
+	url     string
+	path    string
+	secret  string
+	updates chan telegram.Update
+}
+
+// newWebhook returns a webhook poller served by the HTTP server at endpoint.
+// The secret defaults to a digest of the bot token, so that every instance of
+// the bot shares the same webhook.
+func newWebhook(endpoint, token, secret string) *webhook {
+	if secret == "" {
+		sum := sha256.Sum256([]byte(token))
+		secret = hex.EncodeToString(sum[:])
+	}
+	// The path is derived from the secret instead of containing it, since
+	// paths tend to be written to the access logs.
+	sum := sha256.Sum256([]byte("path:" + secret))
+	path := service.WebhookPrefix + "telegram/" + hex.EncodeToString(sum[:16])
+
+	return &webhook{
+		url:     endpoint + path,
+		path:    path,
+		secret:  secret,
+		updates: make(chan telegram.Update),
+	}
+}
+
+// Poll registers the webhook to the HTTP server and the Telegram Bot API, and
+// sends the received updates to dest until stop is closed.
+func (h *webhook) Poll(b *telegram.Bot, dest chan telegram.Update, stop chan struct{}) {
+	service.RegisterWebhook(h.path, h)
+	defer service.UnregisterWebhook(h.path)
+
+	params := map[string]string{"url": h.url, "secret_token": h.secret}
+	if _, err := b.Raw("setWebhook", params); err != nil {
+		logger.Error("set telegram webhook failed: %v", err)
+	} else {
+		logger.Info("receiving telegram updates from webhook %s", h.url)
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case update := <-h.updates:
+			dest <- update
+		}
+	}
+}
+
+// ServeHTTP verifies the secret token of the request and hands the update
+// over to the poller.
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get(headerSecretToken)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.secret)) != 1 {
+		logger.Warn("telegram webhook request with invalid secret token from %s", r.RemoteAddr)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	var update telegram.Update
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateSize)).Decode(&update); err != nil {
+		logger.Warn("decode telegram update failed: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case h.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		// Telegram retries the update on failure.
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package telegram // import "github.com/wabarc/wayback/service/telegram"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/service"
+)
+
+func TestNewWebhook(t *testing.T) {
+	h := newWebhook("https://example.com", token, "")
+	if h.secret == "" || strings.Contains(h.path, h.secret) {
+		t.Fatalf("Unexpected webhook secret %q of path %q", h.secret, h.path)
+	}
+	if !strings.HasPrefix(h.url, "https://example.com"+service.WebhookPrefix+"telegram/") {
+		t.Fatalf("Unexpected webhook url, got %s", h.url)
+	}
+	if got := newWebhook("https://example.org", token, ""); got.secret != h.secret || got.path != h.path {
+		t.Errorf("Unexpected webhook of the same token, got %s instead of %s", got.path, h.path)
+	}
+	if got := newWebhook("https://example.com", token, "foo"); got.secret != "foo" || got.path == h.path {
+		t.Errorf("Unexpected webhook of the configured secret, got %q %s", got.secret, got.path)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	helper.Unsetenv("WAYBACK_TELEGRAM_TOKEN", "WAYBACK_TELEGRAM_CHANNEL")
+	os.Setenv("WAYBACK_TELEGRAM_TOKEN", token)
+	os.Setenv("WAYBACK_TELEGRAM_WEBHOOK", "https://example.com")
+	os.Setenv("WAYBACK_TELEGRAM_WEBHOOK_SECRET", "secret")
+	defer helper.Unsetenv("WAYBACK_TELEGRAM_WEBHOOK", "WAYBACK_TELEGRAM_WEBHOOK_SECRET")
+
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	// Fake Bot API server
+	registered := make(chan map[string]string, 1)
+	replied := make(chan string, 1)
+	httpClient, mux, server := helper.MockServer()
+	defer server.Close()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		b, _ := io.ReadAll(r.Body)
+		var dat map[string]interface{}
+		json.Unmarshal(b, &dat) // nolint:errcheck
+
+		switch strings.TrimPrefix(r.URL.Path, prefix) {
+		case "getMe":
+			fmt.Fprintln(w, getMeJSON)
+		case "getChat":
+			fmt.Fprintln(w, getChatJSON)
+		case "getMyCommands":
+			fmt.Fprintln(w, getMyCommandsJSON)
+		case "setMyCommands":
+			fmt.Fprintln(w, `{"ok":true, "result":true}`)
+		case "setWebhook":
+			url, _ := dat["url"].(string)
+			secret, _ := dat["secret_token"].(string)
+			registered <- map[string]string{"url": url, "secret_token": secret}
+			fmt.Fprintln(w, `{"ok":true, "result":true}`)
+		case "sendMessage":
+			text, _ := dat["text"].(string)
+			replied <- text
+			fmt.Fprintln(w, sendMessageJSON)
+		default:
+			t.Errorf("Unexpected request to the Bot API: %s", r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		}
+	})
+
+	tg, cancel, err := newTelegram(httpClient, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tg.store.Close()
+	defer cancel()
+	hook := newWebhook(config.Opts.TelegramWebhook(), token, config.Opts.TelegramWebhookSecret())
+	tg.bot.Poller = hook
+	go tg.Serve() // nolint:errcheck
+
+	var params map[string]string
+	select {
+	case params = <-registered:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Unexpected webhook not registered to the Bot API")
+	}
+	if params["url"] != hook.url || params["secret_token"] != "secret" {
+		t.Fatalf("Unexpected webhook params, got %v", params)
+	}
+	handler, ok := service.Webhook(hook.path)
+	if !ok {
+		t.Fatalf("Unexpected webhook not registered to the HTTP server")
+	}
+
+	update := `{"update_id":1,"message":{"message_id":1001,"text":"/status foo","from":{"id":1000001,"first_name":"Somebody"},"chat":{"id":1000001,"type":"private"}}}`
+	var tests = []struct {
+		secret string
+		body   string
+		status int
+	}{
+		{secret: "", body: update, status: http.StatusForbidden},
+		{secret: "wrong", body: update, status: http.StatusForbidden},
+		{secret: "secret", body: "{", status: http.StatusBadRequest},
+		{secret: "secret", body: update, status: http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, hook.path, strings.NewReader(test.body))
+		if test.secret != "" {
+			req.Header.Set(headerSecretToken, test.secret)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("Unexpected status code with secret %q, got %d instead of %d", test.secret, w.Code, test.status)
+		}
+	}
+
+	select {
+	case text := <-replied:
+		if text != service.MsgJobNotFound {
+			t.Errorf("Unexpected reply, got %q instead of %q", text, service.MsgJobNotFound)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Unexpected update from the webhook not processed")
+	}
+
+	tg.Shutdown()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := service.Webhook(hook.path); !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Unexpected webhook registered to the HTTP server after shutdown")
+}
@@ -35,7 +35,8 @@ type Twitter struct {
 	ctx    context.Context
 	pool   *pooling.Pool
 	client *twitter.Client
-	store  *storage.Storage
+	store  storage.Storage
+	acl    *service.ACL
 
 	archiving map[string]bool
 
@@ -43,7 +44,7 @@ type Twitter struct {
 }
 
 // New returns Twitter struct.
-func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Twitter {
+func New(ctx context.Context, store storage.Storage, pool *pooling.Pool) *Twitter {
 	if !config.Opts.PublishToTwitter() {
 		logger.Fatal("missing required environment variable")
 	}
@@ -62,11 +63,17 @@ func New(ctx context.Context, store *storage.Storage, pool *pooling.Pool) *Twitt
 	httpClient := oauth.Client(oauth1.NoContext, token)
 	client := twitter.NewClient(httpClient)
 
+	acl, err := service.ConfiguredACL()
+	if err != nil {
+		logger.Fatal("parse access control lists failed: %v", err)
+	}
+
 	return &Twitter{
 		ctx:    ctx,
 		pool:   pool,
 		client: client,
 		store:  store,
+		acl:    acl,
 	}
 }
 
@@ -105,6 +112,8 @@ func (t *Twitter) Serve() error {
 					go func(event twitter.DirectMessageEvent) {
 						metrics.IncrementWayback(metrics.ServiceTwitter, metrics.StatusRequest)
 						bucket := pooling.Bucket{
+							Service: metrics.ServiceTwitter,
+							User:    event.Message.SenderID,
 							Request: func(ctx context.Context) error {
 								if err := t.process(ctx, event); err != nil {
 									logger.Error("process failure, message: %#v, error: %v", event.Message, err)
@@ -113,8 +122,8 @@ func (t *Twitter) Serve() error {
 								metrics.IncrementWayback(metrics.ServiceTwitter, metrics.StatusSuccess)
 								return nil
 							},
-							Fallback: func(_ context.Context) error {
-								t.reply(event, service.MsgWaybackTimeout) // nolint:errcheck
+							Fallback: func(_ context.Context, err error) error {
+								t.reply(event, service.MsgWaybackFailed(err)) // nolint:errcheck
 								metrics.IncrementWayback(metrics.ServiceTwitter, metrics.StatusFailure)
 								return nil
 							},
@@ -167,6 +176,12 @@ func (t *Twitter) process(ctx context.Context, event twitter.DirectMessageEvent)
 		t.Unlock()
 	}()
 
+	if _, ok := t.acl.Authorize(service.Subject{Service: metrics.ServiceTwitter, User: msg.SenderID}); !ok {
+		// nolint:errcheck
+		t.reply(event, service.MsgUnauthorized)
+		return nil
+	}
+
 	urls := service.MatchURL(text)
 	if len(urls) == 0 {
 		logger.Warn("archives failure, URL no found.")
@@ -175,6 +190,7 @@ func (t *Twitter) process(ctx context.Context, event twitter.DirectMessageEvent)
 
 	do := func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
 		logger.Debug("reduxer: %#v", rdx)
+		service.Record(t.store, cols, rdx, metrics.ServiceTwitter, msg.SenderID)
 
 		replyText := render.ForReply(&render.Twitter{Cols: cols}).String()
 		logger.Debug("reply text, %s", replyText)
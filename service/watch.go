@@ -0,0 +1,493 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-shiori/go-readability"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback"
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/reduxer"
+	"github.com/wabarc/wayback/storage"
+)
+
+const (
+	// DefWatchInterval is the interval of a watch if it is not given.
+	DefWatchInterval = 24 * time.Hour
+	// MinWatchInterval is the minimum interval of a watch.
+	MinWatchInterval = time.Hour
+
+	// maxWatches is the maximum number of watches of a chat, or of a user
+	// of the web service.
+	maxWatches = 50
+	// maxProbeSize is the maximum size of a webpage to compare.
+	maxProbeSize = 16 << 20
+	probeTimeout = time.Minute
+)
+
+// ErrTooManyWatches is returned if a chat watches too many URLs.
+var ErrTooManyWatches = errors.New("too many watches, the limit is %d", maxWatches)
+
+// watchTick is the interval to look for the watches that are due.
+var watchTick = time.Minute
+
+// intervals are the names of the common intervals of watches.
+var intervals = []struct {
+	name string
+	d    time.Duration
+}{
+	{"hourly", time.Hour},
+	{"daily", 24 * time.Hour},
+	{"weekly", 7 * 24 * time.Hour},
+}
+
+// ParseInterval parses the interval of a watch, it is one of hourly, daily
+// and weekly, or a duration such as "6h". It must not be less than MinWatchInterval.
+func ParseInterval(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, i := range intervals {
+		if i.name == s {
+			return i.d, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.New("invalid interval %q, it should be hourly, daily, weekly or a duration like 6h", s)
+	}
+	if d < MinWatchInterval {
+		return 0, errors.New("interval %s is less than %s", d, MinWatchInterval)
+	}
+	return d, nil
+}
+
+// watchInterval returns the interval given by the last field of the /watch
+// arguments, or DefWatchInterval if the field is a URL. It returns an error if
+// the field is neither a URL nor an interval.
+func watchInterval(fields []string) (time.Duration, error) {
+	if len(fields) < 2 {
+		return DefWatchInterval, nil
+	}
+	last := fields[len(fields)-1]
+	if len(MatchURL(last)) > 0 {
+		return DefWatchInterval, nil
+	}
+	return ParseInterval(last)
+}
+
+// FormatInterval returns the name of the interval, or the duration if it has no name.
+func FormatInterval(d time.Duration) string {
+	for _, i := range intervals {
+		if i.d == d {
+			return i.name
+		}
+	}
+	return "every " + d.String()
+}
+
+// WatchID returns the id of the watch of the URL in the chat, a URL is
+// watched once in a chat.
+func WatchID(svc, chat, uri string) string {
+	sum := sha256.Sum256([]byte(svc + "\n" + chat + "\n" + storage.NormalizeURL(uri)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Watches returns the watches of the chat of the service, the oldest first.
+func Watches(store storage.Storage, svc, chat string) ([]entity.Watch, error) {
+	all, err := store.Watches()
+	if err != nil {
+		return nil, err
+	}
+	watches := []entity.Watch{}
+	for _, w := range all {
+		if w.Service == svc && w.Chat == chat {
+			watches = append(watches, w)
+		}
+	}
+	return watches, nil
+}
+
+// AddWatch watches the URL for the chat of the service, it updates the
+// interval of the URL if the chat has watched it.
+func AddWatch(store storage.Storage, uri string, interval time.Duration, svc, user, chat string) (*entity.Watch, error) {
+	id := WatchID(svc, chat, uri)
+	w, err := store.Watch(id)
+	switch {
+	case errors.Is(err, storage.ErrWatchNotFound):
+		n, err := countWatches(store, svc, user, chat)
+		if err != nil {
+			return nil, err
+		}
+		if n >= maxWatches {
+			return nil, ErrTooManyWatches
+		}
+		w = &entity.Watch{ID: id, URL: uri, Service: svc, User: user, Chat: chat, CreatedAt: time.Now()}
+	case err != nil:
+		return nil, err
+	}
+	w.Interval = int64(interval / time.Second)
+
+	if err := store.CreateWatch(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// countWatches returns the number of watches counted toward the limit of the
+// chat, the watches of the web service are counted by the user since their
+// chats are the webhooks.
+func countWatches(store storage.Storage, svc, user, chat string) (int, error) {
+	all, err := store.Watches()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, w := range all {
+		switch {
+		case w.Service != svc:
+		case svc == metrics.ServiceWeb && w.User == user, svc != metrics.ServiceWeb && w.Chat == chat:
+			n++
+		}
+	}
+	return n, nil
+}
+
+// RemoveWatch stops watching a URL for the chat of the service, the URL is
+// given by the id of the watch or the URL itself.
+func RemoveWatch(store storage.Storage, svc, chat, key string) (*entity.Watch, error) {
+	watches, err := Watches(store, svc, chat)
+	if err != nil {
+		return nil, err
+	}
+	normalized := storage.NormalizeURL(key)
+	for _, w := range watches {
+		if w.ID == key || storage.NormalizeURL(w.URL) == normalized {
+			return &w, store.RemoveWatch(w.ID)
+		}
+	}
+	return nil, storage.ErrWatchNotFound
+}
+
+// RegisterWatchCommands registers the commands to manage the watches of the
+// chat, they are not supported by the services without chats.
+func RegisterWatchCommands(c *Commands, store storage.Storage) {
+	if store == nil {
+		return
+	}
+	c.Register(&Command{
+		Name:        CommandWatch,
+		Description: "Re-archive a URL on an interval and alert on changes",
+		Args: []Arg{
+			{Name: "url", Description: "URLs to watch", Required: true},
+			{Name: "interval", Description: "hourly, daily, weekly or a duration like 6h"},
+		},
+		Handler: func(_ context.Context, req *Request) (string, error) {
+			if req.Chat == "" {
+				return MsgWatchUnsupported, nil
+			}
+			urls := MatchURL(req.Args)
+			if len(urls) == 0 {
+				return "Please send me a URL to watch...", nil
+			}
+			interval, err := watchInterval(req.Fields())
+			if err != nil {
+				return fmt.Sprintf("Sorry, %v.", err), nil
+			}
+			lines := make([]string, 0, len(urls))
+			for _, u := range urls {
+				w, err := AddWatch(store, u.String(), interval, req.Service, req.User, req.Chat)
+				if errors.Is(err, ErrTooManyWatches) {
+					lines = append(lines, fmt.Sprintf("Sorry, %v.", err))
+					break
+				}
+				if err != nil {
+					return "", errors.Wrap(err, "add watch failed")
+				}
+				lines = append(lines, fmt.Sprintf("Watching %s %s, id: %s", w.URL, FormatInterval(w.Every()), w.ID))
+			}
+			return strings.Join(lines, "\n"), nil
+		},
+	})
+	c.Register(&Command{
+		Name:        CommandUnwatch,
+		Description: "Stop watching a URL",
+		Args:        []Arg{{Name: "id", Description: "Watch ID or URL", Required: true}},
+		Handler: func(_ context.Context, req *Request) (string, error) {
+			if req.Chat == "" {
+				return MsgWatchUnsupported, nil
+			}
+			w, err := RemoveWatch(store, req.Service, req.Chat, req.Fields()[0])
+			if errors.Is(err, storage.ErrWatchNotFound) {
+				return "Watch not found.", nil
+			}
+			if err != nil {
+				return "", errors.Wrap(err, "remove watch failed")
+			}
+			return "Stopped watching " + w.URL, nil
+		},
+	})
+	c.Register(&Command{
+		Name:        CommandWatches,
+		Description: "List the watched URLs",
+		Handler: func(_ context.Context, req *Request) (string, error) {
+			if req.Chat == "" {
+				return MsgWatchUnsupported, nil
+			}
+			watches, err := Watches(store, req.Service, req.Chat)
+			if err != nil {
+				return "", errors.Wrap(err, "list watches failed")
+			}
+			if len(watches) == 0 {
+				return "No watched URLs.", nil
+			}
+			lines := make([]string, 0, len(watches))
+			for _, w := range watches {
+				lines = append(lines, fmt.Sprintf("%s %s (%s, %s)", w.ID, w.URL, FormatInterval(w.Every()), watchState(&w)))
+			}
+			return strings.Join(lines, "\n"), nil
+		},
+	})
+}
+
+func watchState(w *entity.Watch) string {
+	switch {
+	case !w.Checked():
+		return "not checked yet"
+	case w.Alive():
+		return "checked at " + w.CheckedAt.UTC().Format(time.RFC3339)
+	default:
+		return "dead since " + w.CheckedAt.UTC().Format(time.RFC3339)
+	}
+}
+
+// Notifier sends an alert of a watched URL to the chat of the watch.
+type Notifier interface {
+	Notify(ctx context.Context, w *entity.Watch, text string) error
+}
+
+// NotifierFunc is an adapter to use a function as a Notifier.
+type NotifierFunc func(ctx context.Context, w *entity.Watch, text string) error
+
+// Notify calls f(ctx, w, text).
+func (f NotifierFunc) Notify(ctx context.Context, w *entity.Watch, text string) error {
+	return f(ctx, w, text)
+}
+
+// notifiers holds the notifiers of the services, keyed by the service names.
+var notifiers = struct {
+	sync.RWMutex
+	m map[string]Notifier
+}{m: make(map[string]Notifier)}
+
+// RegisterNotifier registers the notifier of the service, the services
+// register it when they start.
+func RegisterNotifier(svc string, n Notifier) {
+	notifiers.Lock()
+	notifiers.m[svc] = n
+	notifiers.Unlock()
+}
+
+func notify(ctx context.Context, w *entity.Watch, text string) {
+	notifiers.RLock()
+	n, ok := notifiers.m[w.Service]
+	notifiers.RUnlock()
+	if !ok {
+		logger.Warn("no notifier of service %s for watch %s", w.Service, w.ID)
+		return
+	}
+	if err := n.Notify(ctx, w, text); err != nil {
+		logger.Error("notify watch %s failed: %v", w.ID, err)
+	}
+}
+
+// watcher schedules the checks of the watches, a watch is scheduled once
+// until its check finished.
+type watcher struct {
+	store storage.Storage
+	pool  *pooling.Pool
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+// ScheduleWatches puts the checks of the watches that are due to the pool
+// periodically until the context is done. A check re-archives the URL, and
+// alerts the chat if the webpage changed or went dead since the last check.
+func ScheduleWatches(ctx context.Context, store storage.Storage, pool *pooling.Pool) {
+	wt := &watcher{store: store, pool: pool, pending: make(map[string]bool)}
+
+	ticker := time.NewTicker(watchTick)
+	defer ticker.Stop()
+	for {
+		wt.schedule(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (wt *watcher) schedule(now time.Time) {
+	watches, err := wt.store.Watches()
+	if err != nil {
+		logger.Error("list watches failed: %v", err)
+		return
+	}
+
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+	for _, w := range watches {
+		if !w.Due(now) || wt.pending[w.ID] {
+			continue
+		}
+		u, err := url.Parse(w.URL)
+		if err != nil {
+			logger.Error("invalid url of watch %s: %v", w.ID, err)
+			continue
+		}
+		id := w.ID
+		wt.pending[id] = true
+		wt.pool.Put(pooling.Bucket{
+			Service: w.Service,
+			URLs:    []*url.URL{u},
+			Request: func(ctx context.Context) error {
+				return checkWatch(ctx, wt.store, id)
+			},
+			Fallback: func(_ context.Context, err error) error {
+				logger.Error("check watch %s failed: %v", id, err)
+				return nil
+			},
+			// Done is called in every terminal state, including a cancelled job.
+			Done: func(pooling.Job) {
+				wt.done(id)
+			},
+		})
+	}
+}
+
+func (wt *watcher) done(id string) {
+	wt.mu.Lock()
+	delete(wt.pending, id)
+	wt.mu.Unlock()
+}
+
+// checkWatch compares the webpage of the watch with the last check, and
+// re-archives it if it is alive. The state of the check is saved before
+// archiving, so that a retry of a failed archiving does not alert twice.
+func checkWatch(ctx context.Context, store storage.Storage, id string) error {
+	w, err := store.Watch(id)
+	if errors.Is(err, storage.ErrWatchNotFound) {
+		// Removed after scheduled.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return errors.Permanent(err)
+	}
+
+	last := *w
+	status, digest, err := probe(ctx, u)
+	w.Status, w.CheckedAt = status, time.Now()
+	if digest != "" {
+		w.Digest = digest
+	}
+
+	var alert string
+	switch {
+	case !w.Alive() && (!last.Checked() || last.Alive()):
+		reason := fmt.Sprintf("status %d", status)
+		if err != nil {
+			reason = err.Error()
+		}
+		alert = fmt.Sprintf("%s went dead: %s", w.URL, reason)
+	case !w.Alive():
+		// Still dead, alerted at the first failed check.
+	case last.Checked() && !last.Alive():
+		alert = fmt.Sprintf("%s is alive again.", w.URL)
+	case last.Digest != "" && last.Digest != w.Digest:
+		alert = fmt.Sprintf("%s changed.", w.URL)
+	}
+	if err := store.CreateWatch(w); err != nil {
+		return errors.Wrap(err, "save watch failed")
+	}
+	logger.Debug("checked watch %s, status: %d, alert: %q", w.ID, w.Status, alert)
+
+	if !w.Alive() {
+		if alert != "" {
+			notify(ctx, w, alert)
+		}
+		return nil
+	}
+
+	do := func(cols []wayback.Collect, rdx reduxer.Reduxer) error {
+		Record(store, cols, rdx, w.Service, w.User)
+		if alert != "" {
+			lines := []string{alert}
+			for _, col := range cols {
+				lines = append(lines, fmt.Sprintf("%s: %s", config.SlotName(col.Arc), col.Dst))
+			}
+			notify(ctx, w, strings.Join(lines, "\n"))
+			alert = ""
+		}
+		return nil
+	}
+	err = Wayback(ctx, []*url.URL{u}, do)
+	if err != nil && alert != "" {
+		// Alert without the archived links, the archiving is retried.
+		notify(ctx, w, alert)
+	}
+	return err
+}
+
+// probe fetches the webpage, and returns the status code and the digest of
+// the readable text of it, or the digest of the body if it has no readable text.
+func probe(ctx context.Context, u *url.URL) (status int, digest string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("User-Agent", config.Opts.WaybackUserAgent())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeSize))
+	if err != nil {
+		return resp.StatusCode, "", err
+	}
+	content := body
+	if article, err := readability.FromReader(bytes.NewReader(body), u); err == nil {
+		if text := strings.Join(strings.Fields(article.TextContent), " "); text != "" {
+			content = []byte(text)
+		}
+	}
+	sum := sha256.Sum256(content)
+	return resp.StatusCode, hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,292 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/metrics"
+	"github.com/wabarc/wayback/pooling"
+	"github.com/wabarc/wayback/storage"
+)
+
+func TestParseInterval(t *testing.T) {
+	var tests = []struct {
+		s    string
+		want time.Duration
+		fail bool
+	}{
+		{s: "daily", want: 24 * time.Hour},
+		{s: " Weekly ", want: 7 * 24 * time.Hour},
+		{s: "6h", want: 6 * time.Hour},
+		{s: "30m", fail: true},
+		{s: "monthly", fail: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			got, err := ParseInterval(test.s)
+			if (err != nil) != test.fail {
+				t.Fatalf("Unexpected parse interval error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Unexpected interval, got %s instead of %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWatchCommands(t *testing.T) {
+	os.Clearenv()
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	c := DefaultCommands(pooling.New(ctx, 1), "")
+	RegisterWatchCommands(c, store)
+
+	id := WatchID("telegram", "42", "https://example.com")
+	other := WatchID("telegram", "42", "https://example.org")
+	var tests = []struct {
+		name string
+		req  *Request
+		want string
+	}{
+		{name: CommandWatches, req: &Request{Prefix: "/"}, want: MsgWatchUnsupported},
+		{name: CommandWatches, req: &Request{Prefix: "/", Chat: "42"}, want: "No watched URLs."},
+		{name: CommandWatch, req: &Request{Prefix: "/", Chat: "42", Args: "no urls"}, want: "Please send me a URL to watch..."},
+		{name: CommandWatch, req: &Request{Prefix: "/", Chat: "42", Args: "https://example.com 10m"}, want: "Sorry, interval 10m0s is less than 1h0m0s."},
+		{name: CommandWatch, req: &Request{Prefix: "/", Chat: "42", Args: "https://example.com"}, want: "Watching https://example.com daily, id: " + id},
+		{name: CommandWatch, req: &Request{Prefix: "/", Chat: "42", Args: "https://example.com https://example.org"}, want: "Watching https://example.com daily, id: " + id + "\nWatching https://example.org daily, id: " + other},
+		{name: CommandWatch, req: &Request{Prefix: "/", Chat: "42", Args: "https://example.com montly"}, want: `Sorry, invalid interval "montly", it should be hourly, daily, weekly or a duration like 6h.`},
+		{name: CommandUnwatch, req: &Request{Prefix: "/", Chat: "42", Args: other}, want: "Stopped watching https://example.org"},
+		{name: CommandWatch, req: &Request{Prefix: "/", Chat: "42", Args: "https://example.com weekly"}, want: "Watching https://example.com weekly, id: " + id},
+		{name: CommandWatches, req: &Request{Prefix: "/", Chat: "42"}, want: id + " https://example.com (weekly, not checked yet)"},
+		{name: CommandWatches, req: &Request{Prefix: "/", Chat: "43"}, want: "No watched URLs."},
+		{name: CommandUnwatch, req: &Request{Prefix: "/", Chat: "43", Args: id}, want: "Watch not found."},
+		{name: CommandUnwatch, req: &Request{Prefix: "/", Chat: "42", Args: "https://example.com/"}, want: "Stopped watching https://example.com"},
+		{name: CommandWatches, req: &Request{Prefix: "/", Chat: "42"}, want: "No watched URLs."},
+	}
+
+	for _, test := range tests {
+		test.req.Service = "telegram"
+		cmd, ok := c.Lookup(test.name)
+		if !ok {
+			t.Fatalf("Unexpected lookup command %s, not found", test.name)
+		}
+		got, err := c.Run(ctx, cmd, test.req)
+		if err != nil {
+			t.Fatalf("Unexpected run command %s: %v", test.name, err)
+		}
+		if got != test.want {
+			t.Errorf("Unexpected reply of %s %s, got %q instead of %q", test.name, test.req.Args, got, test.want)
+		}
+	}
+}
+
+func TestCheckWatch(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("WAYBACK_ENABLE_IA", "false")
+	os.Setenv("WAYBACK_ENABLE_IS", "false")
+	os.Setenv("WAYBACK_ENABLE_IP", "false")
+	os.Setenv("WAYBACK_ENABLE_PH", "false")
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	status, content := http.StatusOK, "foo"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("<html><body><p>" + content + "</p></body></html>")) // nolint:errcheck
+	}))
+	defer server.Close()
+
+	alerts := make(chan string, 1)
+	RegisterNotifier("test", NotifierFunc(func(_ context.Context, w *entity.Watch, text string) error {
+		if w.Chat != "42" {
+			t.Errorf("Unexpected chat of watch, got %s instead of 42", w.Chat)
+		}
+		alerts <- text
+		return nil
+	}))
+
+	w, err := AddWatch(store, server.URL, time.Hour, "test", "foo", "42")
+	if err != nil {
+		t.Fatalf("Unexpected add watch: %v", err)
+	}
+
+	var tests = []struct {
+		name    string
+		status  int
+		content string
+		alert   string
+	}{
+		{name: "first check", status: http.StatusOK, content: "foo"},
+		{name: "unchanged", status: http.StatusOK, content: "foo"},
+		{name: "changed", status: http.StatusOK, content: "bar", alert: server.URL + " changed."},
+		{name: "went dead", status: http.StatusNotFound, content: "bar", alert: server.URL + " went dead: status 404"},
+		{name: "still dead", status: http.StatusGone, content: "bar"},
+		{name: "alive again", status: http.StatusOK, content: "bar", alert: server.URL + " is alive again."},
+	}
+
+	for _, test := range tests {
+		status, content = test.status, test.content
+		checkWatch(context.Background(), store, w.ID) // nolint:errcheck
+
+		select {
+		case got := <-alerts:
+			if test.alert == "" || !strings.HasPrefix(got, test.alert) {
+				t.Errorf("Unexpected alert of %s, got %q instead of %q", test.name, got, test.alert)
+			}
+		default:
+			if test.alert != "" {
+				t.Errorf("Unexpected no alert of %s, want %q", test.name, test.alert)
+			}
+		}
+
+		got, err := store.Watch(w.ID)
+		if err != nil {
+			t.Fatalf("Unexpected get watch: %v", err)
+		}
+		if got.Status != test.status || !got.Checked() {
+			t.Errorf("Unexpected state of %s, got status %d checked at %s", test.name, got.Status, got.CheckedAt)
+		}
+	}
+
+	if err := store.RemoveWatch(w.ID); err != nil {
+		t.Fatalf("Unexpected remove watch: %v", err)
+	}
+	if err := checkWatch(context.Background(), store, w.ID); err != nil {
+		t.Errorf("Unexpected check removed watch: %v", err)
+	}
+}
+
+func TestScheduleCancelledWatch(t *testing.T) {
+	os.Clearenv()
+	var err error
+	parser := config.NewParser()
+	if config.Opts, err = parser.ParseEnvironmentVariables(); err != nil {
+		t.Fatalf("Parse environment variables or flags failed, error: %v", err)
+	}
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	w, err := AddWatch(store, "https://example.com", time.Hour, "test", "foo", "42")
+	if err != nil {
+		t.Fatalf("Unexpected add watch: %v", err)
+	}
+
+	ctx := context.Background()
+	pool := pooling.New(ctx, 1)
+	defer pool.Close()
+
+	wt := &watcher{store: store, pool: pool, pending: make(map[string]bool)}
+	wt.schedule(time.Now())
+	jobs := pool.Jobs()
+	if len(jobs) != 1 {
+		t.Fatalf("Unexpected scheduled jobs, got %d instead of 1", len(jobs))
+	}
+	wt.schedule(time.Now())
+	if n := len(pool.Jobs()); n != 1 {
+		t.Fatalf("Unexpected pending watch scheduled again, got %d jobs", n)
+	}
+
+	// Cancel the job before it runs, e.g. by the cancel command.
+	if err := pool.Cancel(jobs[0].ID); err != nil {
+		t.Fatalf("Unexpected cancel job: %v", err)
+	}
+	go pool.Roll()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		wt.mu.Lock()
+		pending := wt.pending[w.ID]
+		wt.mu.Unlock()
+		if !pending {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Unexpected watch still pending after its job was cancelled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	wt.schedule(time.Now())
+	if n := len(pool.Jobs()); n != 2 {
+		t.Errorf("Unexpected cancelled watch not rescheduled, got %d jobs instead of 2", n)
+	}
+}
+
+func TestAddWatchLimit(t *testing.T) {
+	store, err := storage.Open(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer store.Close()
+
+	// The watches of the web service are limited by the user, whatever
+	// the webhooks they are sent to.
+	for i := 0; i < maxWatches; i++ {
+		uri := fmt.Sprintf("https://example.com/%d", i)
+		webhook := fmt.Sprintf("https://example.org/%d", i)
+		if _, err := AddWatch(store, uri, time.Hour, metrics.ServiceWeb, "foo", webhook); err != nil {
+			t.Fatalf("Unexpected add watch: %v", err)
+		}
+	}
+
+	var tests = []struct {
+		name string
+		svc  string
+		user string
+		chat string
+		err  error
+	}{
+		{name: "web user over limit", svc: metrics.ServiceWeb, user: "foo", chat: "https://example.net", err: ErrTooManyWatches},
+		{name: "web watch updated", svc: metrics.ServiceWeb, user: "foo", chat: "https://example.org/0"},
+		{name: "other web user", svc: metrics.ServiceWeb, user: "bar", chat: "https://example.net"},
+		{name: "other service", svc: "test", user: "foo", chat: "https://example.net"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := AddWatch(store, "https://example.com/0", time.Hour, test.svc, test.user, test.chat)
+			if !errors.Is(err, test.err) {
+				t.Errorf("Unexpected add watch, got %v instead of %v", err, test.err)
+			}
+		})
+	}
+}
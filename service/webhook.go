@@ -0,0 +1,44 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package service // import "github.com/wabarc/wayback/service"
+
+import (
+	"net/http"
+	"sync"
+)
+
+// WebhookPrefix is the path prefix of the webhooks served by the HTTP server.
+const WebhookPrefix = "/webhooks/"
+
+// webhooks holds the handlers of the updates pushed by the chat platforms,
+// keyed by their paths. The services register the handlers when they start
+// and the HTTP server routes the requests to them.
+var webhooks = struct {
+	sync.RWMutex
+	handlers map[string]http.Handler
+}{handlers: make(map[string]http.Handler)}
+
+// RegisterWebhook registers the handler of the webhook path, the path should
+// contain a secret to keep it from being guessed, e.g. "/webhooks/telegram/<secret>".
+func RegisterWebhook(path string, handler http.Handler) {
+	webhooks.Lock()
+	webhooks.handlers[path] = handler
+	webhooks.Unlock()
+}
+
+// UnregisterWebhook removes the handler of the webhook path.
+func UnregisterWebhook(path string) {
+	webhooks.Lock()
+	delete(webhooks.handlers, path)
+	webhooks.Unlock()
+}
+
+// Webhook returns the handler of the webhook path.
+func Webhook(path string) (http.Handler, bool) {
+	webhooks.RLock()
+	defer webhooks.RUnlock()
+	handler, ok := webhooks.handlers[path]
+	return handler, ok
+}
@@ -0,0 +1,560 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the secondary indexes for archives, their keys end with the id
+// of the archive in order to iterate in chronological order.
+const (
+	archiveURLIndex    = entity.EntityArchive + "-url"
+	archiveDomainIndex = entity.EntityArchive + "-domain"
+	archiveUserIndex   = entity.EntityArchive + "-user"
+	archiveDateIndex   = entity.EntityArchive + "-date"
+)
+
+// archiveTextBucket is the bucket of the article text of archives, by the
+// id of the archive.
+const archiveTextBucket = entity.EntityArchive + "-text"
+
+// Statuses of the archive query.
+const (
+	// ArchiveSucceeded matches the archives that any slot succeeded, or
+	// the given slot succeeded.
+	ArchiveSucceeded = "succeeded"
+	// ArchiveFailed matches the archives that no slot succeeded, or the
+	// given slot failed.
+	ArchiveFailed = "failed"
+)
+
+// ErrArchiveNotFound is returned if the archive does not exist.
+var ErrArchiveNotFound = errors.New("archive not found")
+
+var sep = []byte{0}
+
+// ArchiveQuery represents the filters to search the archive history, the
+// zero value matches all archives.
+type ArchiveQuery struct {
+	// URL matches the archives of the URL after normalizing.
+	URL string
+	// Domain matches the archives of the domain.
+	Domain string
+	// Service and User match the archives requested by the user of the service.
+	Service string
+	User    string
+	// From and To match the archives created within the time range.
+	From time.Time
+	To   time.Time
+	// Slot matches the archives that have a result of the slot.
+	Slot string
+	// Status is ArchiveSucceeded or ArchiveFailed.
+	Status string
+	// Text matches the archives that every word of it is contained in
+	// the title or the article text, case-insensitively.
+	Text string
+	// Before matches the archives with an id less than it, used for paging.
+	Before int
+	// Limit is the maximum number of archives, all of them if not positive.
+	Limit int
+}
+
+// normalize converts the filters to the form stored in the database.
+func (q ArchiveQuery) normalize() ArchiveQuery {
+	if q.URL != "" {
+		q.URL = NormalizeURL(q.URL)
+	}
+	q.Domain = strings.TrimPrefix(strings.ToLower(q.Domain), "www.")
+	return q
+}
+
+// terms returns the lowercased words of the text filter.
+func (q ArchiveQuery) terms() []string {
+	return strings.Fields(strings.ToLower(q.Text))
+}
+
+// match reports whether the archive matches the filters, the text is the
+// article text of the archive. The query must be normalized.
+func (q ArchiveQuery) match(a *entity.Archive, text string) bool {
+	switch {
+	case q.URL != "" && a.URL != q.URL,
+		q.Domain != "" && a.Domain != q.Domain,
+		q.Service != "" && a.Service != q.Service,
+		q.User != "" && a.User != q.User,
+		!q.From.IsZero() && a.CreatedAt.Before(q.From),
+		!q.To.IsZero() && a.CreatedAt.After(q.To),
+		q.Before > 0 && a.ID >= q.Before:
+		return false
+	}
+	if !q.matchResults(a.Results) {
+		return false
+	}
+	title, text := strings.ToLower(a.Title), strings.ToLower(text)
+	for _, term := range q.terms() {
+		if !strings.Contains(title, term) && !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchResults reports whether the results match the slot and status filters.
+func (q ArchiveQuery) matchResults(results []entity.Result) bool {
+	if q.Slot == "" && q.Status == "" {
+		return true
+	}
+	found, succeeded := false, false
+	for _, r := range results {
+		if q.Slot != "" && r.Slot != q.Slot {
+			continue
+		}
+		found = true
+		succeeded = succeeded || r.Succeeded()
+	}
+	switch q.Status {
+	case ArchiveSucceeded:
+		return succeeded
+	case ArchiveFailed:
+		return (q.Slot == "" || found) && !succeeded
+	}
+	return found
+}
+
+// CreateArchive creates an archive history entry, and fills the id, the
+// normalized URL and domain of it.
+func (s *Bolt) CreateArchive(a *entity.Archive) error {
+	a.URL = NormalizeURL(a.Source)
+	a.Domain = domainOf(a.URL)
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(helper.String2Byte(entity.EntityArchive))
+		id, err := b.NextSequence()
+		if err != nil {
+			logger.Error("generate id for archive failed: %v", err)
+			return err
+		}
+		a.ID = int(id)
+
+		return putArchive(tx, a)
+	})
+}
+
+// putArchive puts the archive and its index entries, the stale index
+// entries of an existing archive with the same id are removed.
+func putArchive(tx *bolt.Tx, a *entity.Archive) error {
+	if old, err := archive(tx, a.ID); err == nil {
+		for name, k := range archiveIndexes(old) {
+			if err := tx.Bucket(helper.String2Byte(name)).Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+
+	buf, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(helper.String2Byte(entity.EntityArchive)).Put(itob(a.ID), buf); err != nil {
+		return err
+	}
+
+	for name, k := range archiveIndexes(a) {
+		if err := tx.Bucket(helper.String2Byte(name)).Put(k, nil); err != nil {
+			return err
+		}
+	}
+
+	b := tx.Bucket(helper.String2Byte(archiveTextBucket))
+	if a.Text == "" {
+		return b.Delete(itob(a.ID))
+	}
+	return b.Put(itob(a.ID), helper.String2Byte(a.Text))
+}
+
+// archiveIndexes returns the index keys of the archive by the bucket names.
+func archiveIndexes(a *entity.Archive) map[string][]byte {
+	key := itob(a.ID)
+	return map[string][]byte{
+		archiveURLIndex:    indexKey(key, a.URL),
+		archiveDomainIndex: indexKey(key, a.Domain),
+		archiveUserIndex:   indexKey(key, a.Service, a.User),
+		archiveDateIndex:   append(timeKey(a.CreatedAt), key...),
+	}
+}
+
+// Archive returns the archive of the given id.
+func (s *Bolt) Archive(id int) (*entity.Archive, error) {
+	var a *entity.Archive
+
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		a, err = archive(tx, id)
+		return err
+	})
+
+	return a, err
+}
+
+// ArchivesByURL returns the archive history of the given URL, the most recent first.
+// It returns all of them if limit is not positive.
+func (s *Bolt) ArchivesByURL(uri string, limit int) ([]entity.Archive, error) {
+	return s.archivesByIndex(archiveURLIndex, indexKey(nil, NormalizeURL(uri)), limit)
+}
+
+// ArchivesByDomain returns the archive history of the given domain, the most recent first.
+// It returns all of them if limit is not positive.
+func (s *Bolt) ArchivesByDomain(domain string, limit int) ([]entity.Archive, error) {
+	return s.archivesByIndex(archiveDomainIndex, indexKey(nil, strings.TrimPrefix(strings.ToLower(domain), "www.")), limit)
+}
+
+// ArchivesByUser returns the archive history requested by the user of the given service,
+// the most recent first. It returns all of them if limit is not positive.
+func (s *Bolt) ArchivesByUser(service, user string, limit int) ([]entity.Archive, error) {
+	return s.archivesByIndex(archiveUserIndex, indexKey(nil, service, user), limit)
+}
+
+// RecentArchives returns the most recent archives.
+// It returns all of them if limit is not positive.
+func (s *Bolt) RecentArchives(limit int) ([]entity.Archive, error) {
+	archives := []entity.Archive{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(helper.String2Byte(entity.EntityArchive))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if limit > 0 && len(archives) >= limit {
+				break
+			}
+			var a entity.Archive
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			archives = append(archives, a)
+		}
+		return nil
+	})
+
+	return archives, err
+}
+
+// ArchivesBetween returns archives created within the given time range, the
+// most recent first. A zero bound leaves the range open on that side. It
+// returns all of them if limit is not positive.
+func (s *Bolt) ArchivesBetween(from, to time.Time, limit int) ([]entity.Archive, error) {
+	archives := []entity.Archive{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(helper.String2Byte(archiveDateIndex))
+		if b == nil {
+			return nil
+		}
+		lower, upper := timeRange(from, to)
+		c := b.Cursor()
+		for k := seekLast(c, upper); k != nil && bytes.Compare(k, lower) >= 0; k, _ = c.Prev() {
+			if limit > 0 && len(archives) >= limit {
+				break
+			}
+			a, err := archive(tx, idOf(k))
+			if err != nil {
+				return err
+			}
+			archives = append(archives, *a)
+		}
+		return nil
+	})
+
+	return archives, err
+}
+
+// SearchArchives returns the archives that match the query, the most recent
+// first. It seeks through the index of the URL, user, domain or time range
+// filter if any of them is set, or scans all the archives otherwise.
+func (s *Bolt) SearchArchives(q ArchiveQuery) ([]entity.Archive, error) {
+	return s.searchArchives(q, candidates)
+}
+
+// searchArchives returns the archives that match the query, the keys of the
+// archives to check are iterated by the function that iterate returns.
+func (s *Bolt) searchArchives(q ArchiveQuery, iterate func(*bolt.Tx, ArchiveQuery) func() []byte) ([]entity.Archive, error) {
+	archives := []entity.Archive{}
+	q = q.normalize()
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(helper.String2Byte(entity.EntityArchive))
+		if b == nil {
+			return nil
+		}
+		texts := tx.Bucket(helper.String2Byte(archiveTextBucket))
+		next := iterate(tx, q)
+		for k := next(); k != nil; k = next() {
+			if q.Limit > 0 && len(archives) >= q.Limit {
+				break
+			}
+			v := b.Get(k)
+			if v == nil {
+				continue
+			}
+			var a entity.Archive
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			var text string
+			if texts != nil && q.Text != "" {
+				text = string(texts.Get(k))
+			}
+			if q.match(&a, text) {
+				archives = append(archives, a)
+			}
+		}
+		return nil
+	})
+
+	return archives, err
+}
+
+// candidates returns the function to iterate the ids of the archives that
+// may match the query from the most recent, through the most selective
+// index of the filters. The query must be normalized.
+func candidates(tx *bolt.Tx, q ArchiveQuery) func() []byte {
+	switch {
+	case q.URL != "":
+		return indexed(tx, archiveURLIndex, indexKey(nil, q.URL), q.Before)
+	case q.Service != "" && q.User != "":
+		return indexed(tx, archiveUserIndex, indexKey(nil, q.Service, q.User), q.Before)
+	case q.Domain != "":
+		return indexed(tx, archiveDomainIndex, indexKey(nil, q.Domain), q.Before)
+	case !q.From.IsZero() || !q.To.IsZero():
+		return between(tx, q)
+	}
+	return scan(tx, q)
+}
+
+// scan iterates the ids of all the archives before the id of the query.
+func scan(tx *bolt.Tx, q ArchiveQuery) func() []byte {
+	c := tx.Bucket(helper.String2Byte(entity.EntityArchive)).Cursor()
+	k, _ := c.Last()
+	if q.Before > 0 {
+		if k, _ = c.Seek(itob(q.Before)); k == nil {
+			k, _ = c.Last()
+		} else {
+			k, _ = c.Prev()
+		}
+	}
+	return func() []byte {
+		id := k
+		if id != nil {
+			k, _ = c.Prev()
+		}
+		return id
+	}
+}
+
+// indexed iterates the ids of the archives in the index bucket that have
+// the key prefix, before the given id if it is positive.
+func indexed(tx *bolt.Tx, name string, prefix []byte, before int) func() []byte {
+	b := tx.Bucket(helper.String2Byte(name))
+	if b == nil {
+		return func() []byte { return nil }
+	}
+	c := b.Cursor()
+	var k []byte
+	switch {
+	case before <= 0:
+		k = seekLast(c, prefix)
+	default:
+		if k, _ = c.Seek(append(append([]byte{}, prefix...), itob(before)...)); k == nil {
+			k, _ = c.Last()
+		} else {
+			k, _ = c.Prev()
+		}
+	}
+	return func() []byte {
+		if k == nil || !bytes.HasPrefix(k, prefix) {
+			return nil
+		}
+		id := itob(idOf(k))
+		k, _ = c.Prev()
+		return id
+	}
+}
+
+// between iterates the ids of the archives created within the time range of
+// the query. The date index is ordered by the creation time rather than the
+// id, so the ids in the range are sorted before iterating.
+func between(tx *bolt.Tx, q ArchiveQuery) func() []byte {
+	ids := []int{}
+	if b := tx.Bucket(helper.String2Byte(archiveDateIndex)); b != nil {
+		c := b.Cursor()
+		lower, upper := timeRange(q.From, q.To)
+		for k := seekLast(c, upper); k != nil && bytes.Compare(k, lower) >= 0; k, _ = c.Prev() {
+			if id := idOf(k); q.Before <= 0 || id < q.Before {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	return func() []byte {
+		if len(ids) == 0 {
+			return nil
+		}
+		id := itob(ids[0])
+		ids = ids[1:]
+		return id
+	}
+}
+
+func (s *Bolt) archivesByIndex(name string, prefix []byte, limit int) ([]entity.Archive, error) {
+	archives := []entity.Archive{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(helper.String2Byte(name))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k := seekLast(c, prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Prev() {
+			if limit > 0 && len(archives) >= limit {
+				break
+			}
+			a, err := archive(tx, idOf(k))
+			if err != nil {
+				return err
+			}
+			archives = append(archives, *a)
+		}
+		return nil
+	})
+
+	return archives, err
+}
+
+func archive(tx *bolt.Tx, id int) (*entity.Archive, error) {
+	b := tx.Bucket(helper.String2Byte(entity.EntityArchive))
+	if b == nil {
+		return nil, ErrArchiveNotFound
+	}
+	v := b.Get(itob(id))
+	if v == nil {
+		return nil, ErrArchiveNotFound
+	}
+
+	var a entity.Archive
+	if err := json.Unmarshal(v, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// seekLast moves the cursor to the last key that has the given prefix, or
+// the last key before it if there is no such key.
+func seekLast(c *bolt.Cursor, prefix []byte) []byte {
+	upper := append(append([]byte{}, prefix...), bytes.Repeat([]byte{0xff}, 9)...)
+	if k, _ := c.Seek(upper); k == nil {
+		k, _ = c.Last()
+		return k
+	}
+	k, _ := c.Prev()
+	return k
+}
+
+// indexKey returns the key of an index for the given fields, with the
+// id appended if it is not empty.
+func indexKey(id []byte, fields ...string) []byte {
+	var key []byte
+	for _, field := range fields {
+		key = append(key, field...)
+		key = append(key, sep...)
+	}
+	return append(key, id...)
+}
+
+// timeRange returns the bounds of the keys of the date index within the time
+// range, a zero time leaves the range open on that side.
+func timeRange(from, to time.Time) (lower, upper []byte) {
+	if !from.IsZero() {
+		lower = timeKey(from)
+	}
+	if upper = timeKey(to); to.IsZero() {
+		upper = bytes.Repeat([]byte{0xff}, 8)
+	}
+	return lower, upper
+}
+
+func timeKey(t time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	return b
+}
+
+func idOf(key []byte) int {
+	return int(binary.BigEndian.Uint64(key[len(key)-8:]))
+}
+
+// trackingParams are the query parameters that do not change the content of a webpage.
+var trackingParams = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content", "fbclid", "gclid"}
+
+// NormalizeURL returns the normalized form of the given URL, that the URLs
+// referring to the same webpage are considered equal. The scheme and host are
+// lowercased, the default port, fragment, trailing slash and tracking query
+// parameters are removed, and the rest of the query parameters are sorted.
+func NormalizeURL(s string) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || u.Host == "" {
+		return s
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "/" {
+		u.Path = ""
+		u.RawPath = ""
+	} else if strings.HasSuffix(u.Path, "/") {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = strings.TrimSuffix(u.RawPath, "/")
+	}
+
+	query := u.Query()
+	for _, param := range trackingParams {
+		query.Del(param)
+	}
+	for _, values := range query {
+		sort.Strings(values)
+	}
+	// Encode sorts by key.
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func domainOf(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
@@ -0,0 +1,306 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	var tests = []struct {
+		url  string
+		want string
+	}{
+		{url: "https://example.com", want: "https://example.com"},
+		{url: "https://example.com/", want: "https://example.com"},
+		{url: "HTTPS://Example.COM:443/foo/", want: "https://example.com/foo"},
+		{url: "http://example.com:8080/foo#bar", want: "http://example.com:8080/foo"},
+		{url: "https://example.com/?b=2&a=1&utm_source=foo", want: "https://example.com?a=1&b=2"},
+		{url: "not a url", want: "not a url"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			if got := NormalizeURL(test.url); got != test.want {
+				t.Errorf("Unexpected normalize url, got %s instead of %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestArchives(t *testing.T) {
+	conform(t, func(t *testing.T, s Storage) {
+		if _, err := s.Archive(1); !errors.Is(err, ErrArchiveNotFound) {
+			t.Fatalf("Unexpected query archive, got %v instead of %v", err, ErrArchiveNotFound)
+		}
+		if archives, err := s.RecentArchives(0); err != nil || len(archives) != 0 {
+			t.Fatalf("Unexpected recent archives, got %d, error: %v", len(archives), err)
+		}
+
+		now := time.Now()
+		fixtures := []struct {
+			source  string
+			service string
+			user    string
+		}{
+			{source: "https://example.com/", service: "telegram", user: "foo"},
+			{source: "https://www.example.com/foo", service: "telegram", user: "bar"},
+			{source: "https://example.org", service: "discord", user: "foo"},
+			{source: "https://EXAMPLE.com#top", service: "telegram", user: "foo"},
+		}
+		for i, f := range fixtures {
+			a := &entity.Archive{
+				Source:    f.source,
+				Title:     "Example Domain",
+				Results:   []entity.Result{{Slot: "ia", Dst: "https://web.archive.org/"}},
+				Service:   f.service,
+				User:      f.user,
+				CreatedAt: now.Add(time.Duration(i) * time.Hour),
+			}
+			if err := s.CreateArchive(a); err != nil {
+				t.Fatalf("Unexpected create archive: %v", err)
+			}
+			if a.ID != i+1 {
+				t.Errorf("Unexpected archive id, got %d instead of %d", a.ID, i+1)
+			}
+		}
+
+		a, err := s.Archive(2)
+		if err != nil {
+			t.Fatalf("Unexpected query archive: %v", err)
+		}
+		if a.URL != "https://www.example.com/foo" || a.Domain != "example.com" || a.Title != "Example Domain" || len(a.Results) != 1 {
+			t.Errorf("Unexpected archive, got %#v", a)
+		}
+
+		var tests = []struct {
+			name  string
+			query func() ([]entity.Archive, error)
+			ids   []int
+		}{
+			{
+				name:  "by url",
+				query: func() ([]entity.Archive, error) { return s.ArchivesByURL("https://example.com", 0) },
+				ids:   []int{4, 1},
+			},
+			{
+				name:  "by url with limit",
+				query: func() ([]entity.Archive, error) { return s.ArchivesByURL("https://example.com/", 1) },
+				ids:   []int{4},
+			},
+			{
+				name:  "by domain",
+				query: func() ([]entity.Archive, error) { return s.ArchivesByDomain("www.example.com", 0) },
+				ids:   []int{4, 2, 1},
+			},
+			{
+				name:  "by user",
+				query: func() ([]entity.Archive, error) { return s.ArchivesByUser("telegram", "foo", 0) },
+				ids:   []int{4, 1},
+			},
+			{
+				name:  "by nonexistent user",
+				query: func() ([]entity.Archive, error) { return s.ArchivesByUser("telegram", "fo", 0) },
+				ids:   []int{},
+			},
+			{
+				name:  "recent",
+				query: func() ([]entity.Archive, error) { return s.RecentArchives(3) },
+				ids:   []int{4, 3, 2},
+			},
+			{
+				name: "between",
+				query: func() ([]entity.Archive, error) {
+					return s.ArchivesBetween(now.Add(time.Hour), now.Add(2*time.Hour), 0)
+				},
+				ids: []int{3, 2},
+			},
+			{
+				name: "between since",
+				query: func() ([]entity.Archive, error) {
+					return s.ArchivesBetween(now.Add(2*time.Hour), time.Time{}, 0)
+				},
+				ids: []int{4, 3},
+			},
+			{
+				name: "between until",
+				query: func() ([]entity.Archive, error) {
+					return s.ArchivesBetween(time.Time{}, now.Add(time.Hour), 0)
+				},
+				ids: []int{2, 1},
+			},
+			{
+				name: "between any time",
+				query: func() ([]entity.Archive, error) {
+					return s.ArchivesBetween(time.Time{}, time.Time{}, 3)
+				},
+				ids: []int{4, 3, 2},
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				archives, err := test.query()
+				if err != nil {
+					t.Fatalf("Unexpected query archives: %v", err)
+				}
+				ids := []int{}
+				for _, a := range archives {
+					ids = append(ids, a.ID)
+				}
+				if len(ids) != len(test.ids) {
+					t.Fatalf("Unexpected archives, got %v instead of %v", ids, test.ids)
+				}
+				for i := range ids {
+					if ids[i] != test.ids[i] {
+						t.Fatalf("Unexpected archives, got %v instead of %v", ids, test.ids)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestSearchArchives(t *testing.T) {
+	conform(t, func(t *testing.T, s Storage) {
+		now := time.Now()
+		fixtures := []entity.Archive{
+			{Source: "https://example.com/", Title: "Example Domain", Text: "This domain is for use in illustrative examples.", Service: "telegram", User: "foo",
+				Results: []entity.Result{{Slot: "ia", Dst: "https://web.archive.org/web/example.com"}, {Slot: "is", Dst: "timeout"}}},
+			{Source: "https://example.org/news", Title: "Breaking News", Text: "100% of the news_letter", Service: "discord", User: "bar",
+				Results: []entity.Result{{Slot: "ia", Dst: "failed"}}},
+			{Source: "https://www.example.com/", Title: "Example Domain", Service: "httpd",
+				Results: []entity.Result{{Slot: "is", Dst: "https://archive.today/abc"}}},
+		}
+		for i := range fixtures {
+			fixtures[i].CreatedAt = now.Add(time.Duration(i) * time.Hour)
+			if err := s.CreateArchive(&fixtures[i]); err != nil {
+				t.Fatalf("Unexpected create archive: %v", err)
+			}
+		}
+
+		var tests = []struct {
+			name  string
+			query ArchiveQuery
+			want  []int
+		}{
+			{name: "all", query: ArchiveQuery{}, want: []int{3, 2, 1}},
+			{name: "limit", query: ArchiveQuery{Limit: 2}, want: []int{3, 2}},
+			{name: "before", query: ArchiveQuery{Before: 3, Limit: 1}, want: []int{2}},
+			{name: "before beyond", query: ArchiveQuery{Before: 10}, want: []int{3, 2, 1}},
+			{name: "url", query: ArchiveQuery{URL: "HTTPS://example.com/#top"}, want: []int{1}},
+			{name: "domain", query: ArchiveQuery{Domain: "www.Example.com"}, want: []int{3, 1}},
+			{name: "user", query: ArchiveQuery{Service: "telegram", User: "foo"}, want: []int{1}},
+			{name: "time range", query: ArchiveQuery{From: now.Add(30 * time.Minute), To: now.Add(90 * time.Minute)}, want: []int{2}},
+			{name: "slot", query: ArchiveQuery{Slot: "is"}, want: []int{3, 1}},
+			{name: "succeeded", query: ArchiveQuery{Status: ArchiveSucceeded}, want: []int{3, 1}},
+			{name: "failed", query: ArchiveQuery{Status: ArchiveFailed}, want: []int{2}},
+			{name: "slot failed", query: ArchiveQuery{Slot: "is", Status: ArchiveFailed}, want: []int{1}},
+			{name: "slot succeeded with limit", query: ArchiveQuery{Slot: "is", Status: ArchiveSucceeded, Limit: 1}, want: []int{3}},
+			{name: "title", query: ArchiveQuery{Text: "example DOMAIN"}, want: []int{3, 1}},
+			{name: "article text", query: ArchiveQuery{Text: "illustrative domain"}, want: []int{1}},
+			{name: "wildcards", query: ArchiveQuery{Text: "100% news_"}, want: []int{2}},
+			{name: "escaped wildcards", query: ArchiveQuery{Text: "1_0"}, want: []int{}},
+			{name: "no match", query: ArchiveQuery{Domain: "example.com", Service: "discord"}, want: []int{}},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				archives, err := s.SearchArchives(test.query)
+				if err != nil {
+					t.Fatalf("Unexpected search archives: %v", err)
+				}
+				got := []int{}
+				for _, a := range archives {
+					got = append(got, a.ID)
+				}
+				if fmt.Sprint(got) != fmt.Sprint(test.want) {
+					t.Errorf("Unexpected archives, got %v instead of %v", got, test.want)
+				}
+			})
+		}
+	})
+}
+
+func TestSearchArchivesIndexes(t *testing.T) {
+	s, err := OpenBolt(filepath.Join(t.TempDir(), "wayback.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer s.Close()
+
+	// The creation time is not in the order of the ids, as the archives
+	// imported from an export.
+	now := time.Now()
+	for i := 0; i < 60; i++ {
+		a := entity.Archive{
+			Source:    fmt.Sprintf("https://%s/%d", []string{"example.com", "www.example.org", "example.net"}[i%3], i%4),
+			Title:     []string{"Example Domain", "Breaking News"}[i%2],
+			Service:   []string{"telegram", "discord"}[i%2],
+			User:      []string{"foo", "bar", "baz"}[i%3],
+			CreatedAt: now.Add(time.Duration((i*7)%60) * time.Minute),
+			Results:   []entity.Result{{Slot: "ia", Dst: []string{"https://web.archive.org/web/example", "failed"}[i%2]}},
+		}
+		if err := s.CreateArchive(&a); err != nil {
+			t.Fatalf("Unexpected create archive: %v", err)
+		}
+	}
+
+	var tests = []struct {
+		name  string
+		query ArchiveQuery
+	}{
+		{name: "url", query: ArchiveQuery{URL: "https://example.com/0"}},
+		{name: "url before", query: ArchiveQuery{URL: "https://example.com/0", Before: 30}},
+		{name: "url before beyond", query: ArchiveQuery{URL: "https://example.com/0", Before: 100}},
+		{name: "url with limit", query: ArchiveQuery{URL: "https://www.example.org/1", Limit: 2}},
+		{name: "url and user", query: ArchiveQuery{URL: "https://example.com/0", Service: "telegram", User: "foo"}},
+		{name: "user", query: ArchiveQuery{Service: "discord", User: "baz"}},
+		{name: "user before with limit", query: ArchiveQuery{Service: "discord", User: "baz", Before: 40, Limit: 3}},
+		{name: "user and text", query: ArchiveQuery{Service: "telegram", User: "foo", Text: "example"}},
+		{name: "unknown user", query: ArchiveQuery{Service: "slack", User: "foo"}},
+		{name: "domain", query: ArchiveQuery{Domain: "example.org"}},
+		{name: "domain before", query: ArchiveQuery{Domain: "www.example.org", Before: 20}},
+		{name: "domain and status", query: ArchiveQuery{Domain: "example.net", Status: ArchiveFailed}},
+		{name: "time range", query: ArchiveQuery{From: now.Add(10 * time.Minute), To: now.Add(30 * time.Minute)}},
+		{name: "time range before with limit", query: ArchiveQuery{From: now.Add(10 * time.Minute), To: now.Add(30 * time.Minute), Before: 40, Limit: 4}},
+		{name: "from", query: ArchiveQuery{From: now.Add(50 * time.Minute)}},
+		{name: "to", query: ArchiveQuery{To: now.Add(5 * time.Minute)}},
+		{name: "service", query: ArchiveQuery{Service: "telegram", Limit: 5}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := s.SearchArchives(test.query)
+			if err != nil {
+				t.Fatalf("Unexpected search archives: %v", err)
+			}
+			want, err := s.searchArchives(test.query, scan)
+			if err != nil {
+				t.Fatalf("Unexpected scan archives: %v", err)
+			}
+			if len(want) == 0 && test.name != "unknown user" {
+				t.Fatalf("Unexpected empty fixtures of the query")
+			}
+			if fmt.Sprint(ids(got)) != fmt.Sprint(ids(want)) {
+				t.Errorf("Unexpected archives, got %v instead of %v", ids(got), ids(want))
+			}
+		})
+	}
+}
+
+func ids(archives []entity.Archive) []int {
+	ids := []int{}
+	for _, a := range archives {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
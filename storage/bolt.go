@@ -0,0 +1,55 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/errors"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt implements the Storage using a bolt database.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens a bolt database in given path, and migrate its schema
+// to the latest version. It is the caller's responsibility to close it.
+func OpenBolt(path string) (*Bolt, error) {
+	s, err := openBolt(path, false)
+	if err != nil {
+		logger.Error("open bolt database failed: %v", err)
+		return nil, err
+	}
+	if _, err := s.Migrate(); err != nil {
+		s.Close()
+		return nil, errors.Wrap(err, "migrate bolt database failed")
+	}
+	return s, nil
+}
+
+func openBolt(path string, readOnly bool) (*Bolt, error) {
+	opts := &bolt.Options{ReadOnly: readOnly}
+	if readOnly {
+		// Do not wait for the lock held by a running daemon service.
+		opts.Timeout = time.Second
+	}
+	db, err := bolt.Open(path, 0600, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+// Close the bolt database
+func (s *Bolt) Close() error {
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return errors.New("database not found.")
+}
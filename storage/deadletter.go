@@ -0,0 +1,106 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrDeadLetterNotFound is returned if the dead letter does not exist.
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter returns the dead letter of the given id.
+func (s *Bolt) DeadLetter(id string) (*entity.DeadLetter, error) {
+	var dl entity.DeadLetter
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(helper.String2Byte(entity.EntityDeadLetter))
+		if b == nil {
+			return ErrDeadLetterNotFound
+		}
+		v := b.Get(helper.String2Byte(id))
+		if v == nil {
+			return ErrDeadLetterNotFound
+		}
+		return json.Unmarshal(v, &dl)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dl, nil
+}
+
+// DeadLetters returns all dead letters, the most recent first.
+func (s *Bolt) DeadLetters() ([]entity.DeadLetter, error) {
+	dls := []entity.DeadLetter{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(helper.String2Byte(entity.EntityDeadLetter))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var dl entity.DeadLetter
+			if err := json.Unmarshal(v, &dl); err != nil {
+				return err
+			}
+			dls = append(dls, dl)
+			return nil
+		})
+	})
+
+	sort.Slice(dls, func(i, j int) bool {
+		return dls[i].CreatedAt.After(dls[j].CreatedAt)
+	})
+
+	return dls, err
+}
+
+// CreateDeadLetter creates a dead letter, it replaces the existing one
+// with the same id.
+func (s *Bolt) CreateDeadLetter(dl *entity.DeadLetter) error {
+	buf, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(helper.String2Byte(entity.EntityDeadLetter))
+		logger.Debug("putting data to bucket, id: %s, urls: %v", dl.ID, dl.URLs)
+
+		return b.Put(helper.String2Byte(dl.ID), buf)
+	})
+}
+
+// RemoveDeadLetter removes a dead letter by id.
+func (s *Bolt) RemoveDeadLetter(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(helper.String2Byte(entity.EntityDeadLetter))
+		if b == nil || b.Get(helper.String2Byte(id)) == nil {
+			return ErrDeadLetterNotFound
+		}
+		return b.Delete(helper.String2Byte(id))
+	})
+}
+
+// PurgeDeadLetters removes all dead letters.
+func (s *Bolt) PurgeDeadLetters() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		name := helper.String2Byte(entity.EntityDeadLetter)
+		if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		_, err := tx.CreateBucket(name)
+		return err
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+)
+
+func TestDeadLetter(t *testing.T) {
+	conform(t, func(t *testing.T, s Storage) {
+		if _, err := s.DeadLetter("foo"); !errors.Is(err, ErrDeadLetterNotFound) {
+			t.Fatalf("Unexpected query dead letter, got %v instead of %v", err, ErrDeadLetterNotFound)
+		}
+
+		now := time.Now()
+		for i, id := range []string{"foo", "bar"} {
+			dl := &entity.DeadLetter{
+				ID:        id,
+				Service:   "telegram",
+				URLs:      []string{"https://example.com"},
+				Attempts:  []entity.Attempt{{StartedAt: now, FinishedAt: now, Error: "some error"}},
+				CreatedAt: now.Add(time.Duration(i) * time.Second),
+			}
+			if err := s.CreateDeadLetter(dl); err != nil {
+				t.Fatalf("Unexpected create dead letter, error: %v", err)
+			}
+		}
+
+		dl, err := s.DeadLetter("foo")
+		if err != nil {
+			t.Fatalf("Unexpected query dead letter, error: %v", err)
+		}
+		if dl.Service != "telegram" || len(dl.URLs) != 1 || len(dl.Attempts) != 1 {
+			t.Errorf("Unexpected dead letter, got %#v", dl)
+		}
+
+		dls, err := s.DeadLetters()
+		if err != nil {
+			t.Fatalf("Unexpected list dead letters, error: %v", err)
+		}
+		if len(dls) != 2 || dls[0].ID != "bar" {
+			t.Fatalf("Unexpected dead letters, got %#v", dls)
+		}
+
+		if err := s.RemoveDeadLetter("foo"); err != nil {
+			t.Fatalf("Unexpected remove dead letter, error: %v", err)
+		}
+		if err := s.RemoveDeadLetter("foo"); !errors.Is(err, ErrDeadLetterNotFound) {
+			t.Errorf("Unexpected remove dead letter, got %v instead of %v", err, ErrDeadLetterNotFound)
+		}
+
+		if err := s.PurgeDeadLetters(); err != nil {
+			t.Fatalf("Unexpected purge dead letters, error: %v", err)
+		}
+		if dls, _ := s.DeadLetters(); len(dls) != 0 {
+			t.Errorf("Unexpected dead letters after purge, got %d instead of 0", len(dls))
+		}
+	})
+}
@@ -4,5 +4,9 @@
 
 /*
 Package storage implements a set of functions to interact with the database.
+
+The Storage interface is implemented by a bolt database and an SQLite
+database using a pure Go driver, chosen by the `WAYBACK_DATABASE_DRIVER`
+configuration. Every driver must pass the same conformance tests.
 */
 package storage // import "github.com/wabarc/wayback/storage"
@@ -0,0 +1,218 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// maxRecordSize is the maximum size of a line of the JSON Lines to import.
+const maxRecordSize = 16 << 20
+
+// ErrUnknownRecord is returned if the kind of record to import is unknown.
+var ErrUnknownRecord = errors.New("unknown record kind")
+
+// Record represents a line of the JSON Lines exported from the database,
+// it is independent of the driver that the data can be moved between drivers.
+type Record struct {
+	// Kind is the entity name of the data, e.g. playback, archive.
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+// recordEncoder writes records in JSON Lines.
+type recordEncoder struct {
+	enc *json.Encoder
+}
+
+func newRecordEncoder(w io.Writer) *recordEncoder {
+	return &recordEncoder{enc: json.NewEncoder(w)}
+}
+
+func (e *recordEncoder) encode(kind string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return e.enc.Encode(Record{Kind: kind, Data: data})
+}
+
+// importer puts a record with its id kept, it replaces the existing one.
+type importer struct {
+	playback   func(pb *entity.Playback) error
+	deadLetter func(dl *entity.DeadLetter) error
+	archive    func(a *entity.Archive) error
+	token      func(t *entity.Token) error
+	watch      func(w *entity.Watch) error
+}
+
+// decodeRecords reads records in JSON Lines, and puts them by the importer.
+// It returns the number of records imported.
+func decodeRecords(r io.Reader, im importer) (n int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return n, errors.Wrap(err, fmt.Sprintf("decode line %d failed", line))
+		}
+		if err := rec.put(im); err != nil {
+			return n, errors.Wrap(err, fmt.Sprintf("import line %d failed", line))
+		}
+		n++
+	}
+	return n, scanner.Err()
+}
+
+func (rec Record) put(im importer) error {
+	switch rec.Kind {
+	case entity.EntityPlayback:
+		var pb entity.Playback
+		if err := json.Unmarshal(rec.Data, &pb); err != nil {
+			return err
+		}
+		if pb.CreatedAt.IsZero() {
+			pb.CreatedAt = time.Now()
+		}
+		return im.playback(&pb)
+	case entity.EntityDeadLetter:
+		var dl entity.DeadLetter
+		if err := json.Unmarshal(rec.Data, &dl); err != nil {
+			return err
+		}
+		return im.deadLetter(&dl)
+	case entity.EntityArchive:
+		var a entity.Archive
+		if err := json.Unmarshal(rec.Data, &a); err != nil {
+			return err
+		}
+		return im.archive(&a)
+	case entity.EntityToken:
+		var t entity.Token
+		if err := json.Unmarshal(rec.Data, &t); err != nil {
+			return err
+		}
+		if t.ID == "" {
+			return errors.New("invalid token id")
+		}
+		return im.token(&t)
+	case entity.EntityWatch:
+		var w entity.Watch
+		if err := json.Unmarshal(rec.Data, &w); err != nil {
+			return err
+		}
+		if w.ID == "" {
+			return errors.New("invalid watch id")
+		}
+		return im.watch(&w)
+	}
+	return errors.Wrap(ErrUnknownRecord, rec.Kind)
+}
+
+// Backup writes a consistent copy of the database to w, it does not block
+// other reads and writes.
+func (s *Bolt) Backup(w io.Writer) (int64, error) {
+	var n int64
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// Export writes all the records to w in JSON Lines, from a consistent view
+// of the database.
+func (s *Bolt) Export(w io.Writer) error {
+	enc := newRecordEncoder(w)
+
+	return s.db.View(func(tx *bolt.Tx) error {
+		for _, name := range []string{entity.EntityPlayback, entity.EntityDeadLetter, entity.EntityArchive, entity.EntityToken, entity.EntityWatch} {
+			err := tx.Bucket(helper.String2Byte(name)).ForEach(func(_, v []byte) error {
+				return enc.encode(name, json.RawMessage(v))
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Import reads records in JSON Lines from r in a single transaction, the
+// records keep their ids and replace the existing ones with the same ids.
+// It returns the number of records imported.
+func (s *Bolt) Import(r io.Reader) (n int, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		im := importer{
+			playback: func(pb *entity.Playback) error {
+				b := tx.Bucket(helper.String2Byte(entity.EntityPlayback))
+				if err := forwardSequence(b, pb.ID); err != nil {
+					return err
+				}
+				buf, err := json.Marshal(pb)
+				if err != nil {
+					return err
+				}
+				return b.Put(itob(pb.ID), buf)
+			},
+			deadLetter: func(dl *entity.DeadLetter) error {
+				buf, err := json.Marshal(dl)
+				if err != nil {
+					return err
+				}
+				return tx.Bucket(helper.String2Byte(entity.EntityDeadLetter)).Put(helper.String2Byte(dl.ID), buf)
+			},
+			archive: func(a *entity.Archive) error {
+				if err := forwardSequence(tx.Bucket(helper.String2Byte(entity.EntityArchive)), a.ID); err != nil {
+					return err
+				}
+				return putArchive(tx, a)
+			},
+			token: func(t *entity.Token) error {
+				buf, err := json.Marshal(t)
+				if err != nil {
+					return err
+				}
+				return tx.Bucket(helper.String2Byte(entity.EntityToken)).Put(helper.String2Byte(t.ID), buf)
+			},
+			watch: func(w *entity.Watch) error {
+				buf, err := json.Marshal(w)
+				if err != nil {
+					return err
+				}
+				return tx.Bucket(helper.String2Byte(entity.EntityWatch)).Put(helper.String2Byte(w.ID), buf)
+			},
+		}
+		n, err = decodeRecords(r, im)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// forwardSequence makes sure the next sequence of the bucket is greater than the given id.
+func forwardSequence(b *bolt.Bucket, id int) error {
+	if id <= 0 {
+		return errors.New("invalid id %d", id)
+	}
+	if b.Sequence() >= uint64(id) {
+		return nil
+	}
+	return b.SetSequence(uint64(id))
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+)
+
+func seed(t *testing.T, s Storage) {
+	if err := s.CreatePlayback(&entity.Playback{Source: "foo"}); err != nil {
+		t.Fatalf("Unexpected create playback: %v", err)
+	}
+	dl := &entity.DeadLetter{ID: "bar", Service: "telegram", URLs: []string{"https://example.com"}, CreatedAt: time.Now()}
+	if err := s.CreateDeadLetter(dl); err != nil {
+		t.Fatalf("Unexpected create dead letter: %v", err)
+	}
+	for _, source := range []string{"https://example.com", "https://example.org"} {
+		a := &entity.Archive{Source: source, Service: "telegram", User: "42", Results: []entity.Result{{Slot: "ia", Dst: "https://web.archive.org/"}}}
+		if err := s.CreateArchive(a); err != nil {
+			t.Fatalf("Unexpected create archive: %v", err)
+		}
+	}
+	token := &entity.Token{ID: "baz", Name: "ci", Digest: "digest", Scopes: []string{entity.ScopeArchive}, CreatedAt: time.Now()}
+	if err := s.CreateToken(token); err != nil {
+		t.Fatalf("Unexpected create token: %v", err)
+	}
+	watch := &entity.Watch{ID: "qux", URL: "https://example.com", Interval: 86400, Service: "telegram", Chat: "42", CreatedAt: time.Now()}
+	if err := s.CreateWatch(watch); err != nil {
+		t.Fatalf("Unexpected create watch: %v", err)
+	}
+}
+
+func verify(t *testing.T, s Storage) {
+	if pb, err := s.Playback(1); err != nil || pb.Source != "foo" || pb.CreatedAt.IsZero() {
+		t.Errorf("Unexpected playback, got %#v, error: %v", pb, err)
+	}
+	if dl, err := s.DeadLetter("bar"); err != nil || len(dl.URLs) != 1 {
+		t.Errorf("Unexpected dead letter, got %#v, error: %v", dl, err)
+	}
+	archives, err := s.ArchivesByUser("telegram", "42", 0)
+	if err != nil || len(archives) != 2 {
+		t.Fatalf("Unexpected archives, got %d, error: %v", len(archives), err)
+	}
+	if archives[0].ID != 2 || archives[0].Domain != "example.org" || len(archives[0].Results) != 1 {
+		t.Errorf("Unexpected archive, got %#v", archives[0])
+	}
+	if archives, _ := s.ArchivesByDomain("example.com", 0); len(archives) != 1 {
+		t.Errorf("Unexpected archives by domain, got %d instead of 1", len(archives))
+	}
+	if token, err := s.Token("baz"); err != nil || token.Digest != "digest" || len(token.Scopes) != 1 {
+		t.Errorf("Unexpected token, got %#v, error: %v", token, err)
+	}
+	if w, err := s.Watch("qux"); err != nil || w.Interval != 86400 || w.Chat != "42" {
+		t.Errorf("Unexpected watch, got %#v, error: %v", w, err)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	for from, open := range drivers {
+		src, err := open(filepath.Join(t.TempDir(), "wayback.db"))
+		if err != nil {
+			t.Fatalf("Unexpected open a %s db: %v", from, err)
+		}
+		defer src.Close()
+		seed(t, src)
+
+		var buf bytes.Buffer
+		if err := src.Export(&buf); err != nil {
+			t.Fatalf("Unexpected export %s db: %v", from, err)
+		}
+		if lines := strings.Count(buf.String(), "\n"); lines != 6 {
+			t.Fatalf("Unexpected exported records, got %d instead of 6", lines)
+		}
+		exported := buf.String()
+
+		t.Run(from, func(t *testing.T) {
+			conform(t, func(t *testing.T, s Storage) {
+				n, err := s.Import(strings.NewReader(exported))
+				if err != nil {
+					t.Fatalf("Unexpected import: %v", err)
+				}
+				if n != 6 {
+					t.Errorf("Unexpected imported records, got %d instead of 6", n)
+				}
+				verify(t, s)
+
+				// Importing again replaces the records with the same ids.
+				if _, err := s.Import(strings.NewReader(exported)); err != nil {
+					t.Fatalf("Unexpected import again: %v", err)
+				}
+				verify(t, s)
+
+				// The sequence continues after the imported ids.
+				a := &entity.Archive{Source: "https://example.net"}
+				if err := s.CreateArchive(a); err != nil || a.ID != 3 {
+					t.Errorf("Unexpected create archive after import, got id %d, error: %v", a.ID, err)
+				}
+			})
+		})
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	conform(t, func(t *testing.T, s Storage) {
+		input := `{"kind":"playback","data":{"id":1,"source":"foo"}}` + "\n" + `{"kind":"unknown","data":{}}` + "\n"
+		if _, err := s.Import(strings.NewReader(input)); !errors.Is(err, ErrUnknownRecord) {
+			t.Fatalf("Unexpected import unknown record, got %v instead of %v", err, ErrUnknownRecord)
+		}
+		// The import is rolled back.
+		if _, err := s.Playback(1); !errors.Is(err, ErrPlaybackNotFound) {
+			t.Errorf("Unexpected playback after failed import, got %v instead of %v", err, ErrPlaybackNotFound)
+		}
+	})
+}
+
+func TestBackup(t *testing.T) {
+	for name, open := range drivers {
+		open := open
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := open(filepath.Join(dir, "wayback.db"))
+			if err != nil {
+				t.Fatalf("Unexpected open a %s db: %v", name, err)
+			}
+			defer s.Close()
+			seed(t, s)
+
+			path := filepath.Join(dir, "backup.db")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatalf("Unexpected create backup file: %v", err)
+			}
+			n, err := s.Backup(f)
+			f.Close()
+			if err != nil || n == 0 {
+				t.Fatalf("Unexpected backup, wrote %d bytes, error: %v", n, err)
+			}
+
+			backup, err := open(path)
+			if err != nil {
+				t.Fatalf("Unexpected open backup: %v", err)
+			}
+			defer backup.Close()
+			verify(t, backup)
+		})
+	}
+}
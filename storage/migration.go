@@ -0,0 +1,284 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	metaBucket = "meta"
+	versionKey = "version"
+)
+
+// ErrSchemaTooNew is returned if the database is created by a newer version of the application.
+var ErrSchemaTooNew = errors.New("database schema is newer than supported, please upgrade wayback")
+
+// Migration represents a step to upgrade the database schema, it is
+// implemented by every driver.
+type Migration struct {
+	Version int
+	Name    string
+
+	bolt   func(tx *bolt.Tx) error
+	sqlite string
+}
+
+// migrations are the ordered steps to upgrade the database schema,
+// append new steps to the end and never change the existing ones.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create playback bucket",
+		bolt:    createBuckets(entity.EntityPlayback),
+		sqlite: `CREATE TABLE playback (
+			id     INTEGER PRIMARY KEY AUTOINCREMENT,
+			source TEXT NOT NULL
+		);`,
+	},
+	{
+		Version: 2,
+		Name:    "create dead letter bucket",
+		bolt:    createBuckets(entity.EntityDeadLetter),
+		sqlite: `CREATE TABLE dead_letter (
+			id         TEXT PRIMARY KEY,
+			service    TEXT NOT NULL,
+			urls       TEXT NOT NULL,
+			attempts   TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+	},
+	{
+		Version: 3,
+		Name:    "create archive buckets and indexes",
+		bolt:    createBuckets(entity.EntityArchive, archiveURLIndex, archiveDomainIndex, archiveUserIndex, archiveDateIndex),
+		sqlite: `CREATE TABLE archive (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			source     TEXT NOT NULL,
+			url        TEXT NOT NULL,
+			domain     TEXT NOT NULL,
+			results    TEXT NOT NULL,
+			artifacts  TEXT NOT NULL,
+			service    TEXT NOT NULL,
+			user       TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX archive_url ON archive (url, id);
+		CREATE INDEX archive_domain ON archive (domain, id);
+		CREATE INDEX archive_user ON archive (service, user, id);
+		CREATE INDEX archive_created_at ON archive (created_at, id);`,
+	},
+	{
+		Version: 4,
+		Name:    "add creation time to playbacks",
+		bolt:    timestampPlaybacks,
+		sqlite: `ALTER TABLE playback ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+		UPDATE playback SET created_at = strftime('%Y-%m-%dT%H:%M:%S', 'now') || '.000000000Z';
+		CREATE INDEX playback_created_at ON playback (created_at);`,
+	},
+	{
+		Version: 5,
+		Name:    "create token bucket",
+		bolt:    createBuckets(entity.EntityToken),
+		sqlite: `CREATE TABLE token (
+			id         TEXT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			digest     TEXT NOT NULL,
+			scopes     TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+	},
+	{
+		Version: 6,
+		Name:    "add title to archives",
+		bolt:    func(*bolt.Tx) error { return nil }, // archives are stored as JSON
+		sqlite:  `ALTER TABLE archive ADD COLUMN title TEXT NOT NULL DEFAULT '';`,
+	},
+	{
+		Version: 7,
+		Name:    "add article text to archives",
+		bolt:    createBuckets(archiveTextBucket),
+		sqlite:  `ALTER TABLE archive ADD COLUMN text TEXT NOT NULL DEFAULT '';`,
+	},
+	{
+		Version: 8,
+		Name:    "create watch bucket",
+		bolt:    createBuckets(entity.EntityWatch),
+		sqlite: `CREATE TABLE watch (
+			id         TEXT PRIMARY KEY,
+			url        TEXT NOT NULL,
+			interval   INTEGER NOT NULL,
+			service    TEXT NOT NULL,
+			user       TEXT NOT NULL,
+			chat       TEXT NOT NULL,
+			digest     TEXT NOT NULL,
+			status     INTEGER NOT NULL,
+			checked_at TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+	},
+}
+
+func createBuckets(names ...string) func(tx *bolt.Tx) error {
+	return func(tx *bolt.Tx) error {
+		for _, name := range names {
+			if _, err := tx.CreateBucketIfNotExists(helper.String2Byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// timestampPlaybacks converts the raw source of playbacks to the JSON of
+// the entity, with the creation time set to now.
+func timestampPlaybacks(tx *bolt.Tx) error {
+	b := tx.Bucket(helper.String2Byte(entity.EntityPlayback))
+	pbs := map[string][]byte{}
+	now := time.Now()
+	err := b.ForEach(func(k, v []byte) error {
+		buf, err := json.Marshal(entity.Playback{ID: idOf(k), Source: helper.Byte2String(v), CreatedAt: now})
+		if err != nil {
+			return err
+		}
+		pbs[string(k)] = buf
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for k, v := range pbs {
+		if err := b.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the latest version of the database schema.
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Version returns the current version of the database schema.
+func (s *Bolt) Version() (version int, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx)
+		return nil
+	})
+	return
+}
+
+// Pending returns the migrations that have not been applied to the database.
+func (s *Bolt) Pending() ([]Migration, error) {
+	version, err := s.Version()
+	if err != nil {
+		return nil, err
+	}
+	return pending(version)
+}
+
+// Migrate applies the pending migrations in a single transaction, a snapshot
+// of an existing database is taken before that. It returns the path of the
+// snapshot, which is empty if there is nothing to migrate or the database is new.
+func (s *Bolt) Migrate() (backup string, err error) {
+	pending, err := s.Pending()
+	if err != nil || len(pending) == 0 {
+		return "", err
+	}
+
+	version, err := s.Version()
+	if err != nil {
+		return "", err
+	}
+	if !s.empty() {
+		backup = backupPath(s.db.Path(), version)
+		if err := s.snapshot(backup); err != nil {
+			return "", errors.Wrap(err, "take snapshot failed")
+		}
+		logger.Info("database snapshot saved to %s", backup)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		for _, m := range pending {
+			logger.Info("migrating database to version %d: %s", m.Version, m.Name)
+			if err := m.bolt(tx); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("migrate to version %d failed", m.Version))
+			}
+		}
+		return setSchemaVersion(tx, pending[len(pending)-1].Version)
+	})
+
+	return backup, err
+}
+
+// snapshot writes a consistent copy of the database to the given path.
+func (s *Bolt) snapshot(path string) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
+
+// empty reports whether the database has no buckets.
+func (s *Bolt) empty() bool {
+	empty := true
+	// nolint:errcheck
+	s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, _ *bolt.Bucket) error {
+			empty = false
+			return nil
+		})
+	})
+	return empty
+}
+
+// pending returns the migrations newer than the given version.
+func pending(version int) ([]Migration, error) {
+	if version > SchemaVersion() {
+		return nil, ErrSchemaTooNew
+	}
+
+	pending := []Migration{}
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// backupPath returns the path of the snapshot taken before migrating from the given version.
+func backupPath(path string, version int) string {
+	return fmt.Sprintf("%s.v%d.%s.bak", path, version, time.Now().Format("20060102150405"))
+}
+
+func schemaVersion(tx *bolt.Tx) int {
+	b := tx.Bucket(helper.String2Byte(metaBucket))
+	if b == nil {
+		return 0
+	}
+	v := b.Get(helper.String2Byte(versionKey))
+	if len(v) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(v))
+}
+
+func setSchemaVersion(tx *bolt.Tx, version int) error {
+	b, err := tx.CreateBucketIfNotExists(helper.String2Byte(metaBucket))
+	if err != nil {
+		return err
+	}
+	return b.Put(helper.String2Byte(versionKey), itob(version))
+}
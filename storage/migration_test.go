@@ -0,0 +1,179 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMigrateNewDatabase(t *testing.T) {
+	for name, open := range drivers {
+		open := open
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := open(filepath.Join(dir, "wayback.db"))
+			if err != nil {
+				t.Fatalf("Unexpected open a %s db: %v", name, err)
+			}
+			defer s.Close()
+
+			version, err := s.Version()
+			if err != nil {
+				t.Fatalf("Unexpected query version: %v", err)
+			}
+			if version != SchemaVersion() {
+				t.Errorf("Unexpected schema version, got %d instead of %d", version, SchemaVersion())
+			}
+			if pending, _ := s.Pending(); len(pending) != 0 {
+				t.Errorf("Unexpected pending migrations, got %d instead of 0", len(pending))
+			}
+			if files, _ := filepath.Glob(filepath.Join(dir, "*.bak")); len(files) != 0 {
+				t.Errorf("Unexpected snapshot for new database, got %v", files)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	dir := t.TempDir()
+	dbpath := filepath.Join(dir, "wayback.db")
+
+	// A database created before schema versioning.
+	db, err := bolt.Open(dbpath, 0600, nil)
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(helper.String2Byte(entity.EntityPlayback))
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(1), []byte("foo"))
+	})
+	if err != nil {
+		t.Fatalf("Unexpected put playback: %v", err)
+	}
+	db.Close()
+
+	ro, err := OpenReadOnly(dbpath)
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db read-only: %v", err)
+	}
+	pending, err := ro.Pending()
+	if err != nil {
+		t.Fatalf("Unexpected query pending migrations: %v", err)
+	}
+	if len(pending) != len(migrations) {
+		t.Errorf("Unexpected pending migrations, got %d instead of %d", len(pending), len(migrations))
+	}
+	ro.Close()
+
+	s, err := OpenBolt(dbpath)
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	defer s.Close()
+
+	if version, _ := s.Version(); version != SchemaVersion() {
+		t.Errorf("Unexpected schema version, got %d instead of %d", version, SchemaVersion())
+	}
+	if pb, err := s.Playback(1); err != nil || pb.Source != "foo" || pb.CreatedAt.IsZero() {
+		t.Errorf("Unexpected playback after migration, got %#v, error: %v", pb, err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "wayback.db.v0.*.bak"))
+	if len(files) != 1 {
+		t.Fatalf("Unexpected snapshot, got %v", files)
+	}
+	if _, err := os.Stat(files[0]); err != nil {
+		t.Errorf("Unexpected snapshot file: %v", err)
+	}
+}
+
+func TestMigrateNewerDatabase(t *testing.T) {
+	dbpath := filepath.Join(t.TempDir(), "wayback.db")
+
+	db, err := bolt.Open(dbpath, 0600, nil)
+	if err != nil {
+		t.Fatalf("Unexpected open a bolt db: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return setSchemaVersion(tx, SchemaVersion()+1)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected set schema version: %v", err)
+	}
+	db.Close()
+
+	if _, err := OpenBolt(dbpath); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Unexpected open a newer database, got %v instead of %v", err, ErrSchemaTooNew)
+	}
+}
+
+func TestMigrateSQLiteDatabase(t *testing.T) {
+	dir := t.TempDir()
+	dbpath := filepath.Join(dir, "wayback.sqlite")
+
+	// A database of the first version.
+	s, err := openSQLite(dbpath, false)
+	if err != nil {
+		t.Fatalf("Unexpected open a sqlite db: %v", err)
+	}
+	if _, err := s.db.Exec(migrations[0].sqlite + `INSERT INTO playback (source) VALUES ('foo'); PRAGMA user_version = 1;`); err != nil {
+		t.Fatalf("Unexpected create playback table: %v", err)
+	}
+	s.Close()
+
+	s, err = OpenSQLite(dbpath)
+	if err != nil {
+		t.Fatalf("Unexpected migrate a sqlite db: %v", err)
+	}
+	defer s.Close()
+
+	if version, _ := s.Version(); version != SchemaVersion() {
+		t.Errorf("Unexpected schema version, got %d instead of %d", version, SchemaVersion())
+	}
+	if pb, err := s.Playback(1); err != nil || pb.Source != "foo" || pb.CreatedAt.IsZero() {
+		t.Errorf("Unexpected playback after migrating, got %#v, error: %v", pb, err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.v1.*.bak"))
+	if len(files) != 1 {
+		t.Fatalf("Unexpected snapshot files, got %v", files)
+	}
+
+	// The snapshot keeps the database before migrating.
+	snapshot, err := openSQLite(files[0], true)
+	if err != nil {
+		t.Fatalf("Unexpected open snapshot: %v", err)
+	}
+	defer snapshot.Close()
+	if version, _ := snapshot.Version(); version != 1 {
+		t.Errorf("Unexpected snapshot version, got %d instead of 1", version)
+	}
+}
+
+func TestMigrateNewerSQLiteDatabase(t *testing.T) {
+	dbpath := filepath.Join(t.TempDir(), "wayback.sqlite")
+
+	s, err := openSQLite(dbpath, false)
+	if err != nil {
+		t.Fatalf("Unexpected open a sqlite db: %v", err)
+	}
+	if _, err := s.db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, SchemaVersion()+1)); err != nil {
+		t.Fatalf("Unexpected set schema version: %v", err)
+	}
+	s.Close()
+
+	if _, err := OpenSQLite(dbpath); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Unexpected open a newer database, got %v instead of %v", err, ErrSchemaTooNew)
+	}
+}
@@ -0,0 +1,778 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+
+	_ "modernc.org/sqlite" // register the pure Go SQLite driver
+)
+
+// timeLayout is the layout of the time stored in SQLite, it is in UTC with
+// a fixed width that the lexical order is the chronological order.
+const timeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// SQLite implements the Storage using an SQLite database, the lists in the
+// entities are stored as JSON text to be queried by the JSON functions.
+type SQLite struct {
+	db   *sql.DB
+	path string
+}
+
+// OpenSQLite opens an SQLite database in given path, and migrate its schema
+// to the latest version. It is the caller's responsibility to close it.
+func OpenSQLite(path string) (*SQLite, error) {
+	s, err := openSQLite(path, false)
+	if err != nil {
+		logger.Error("open sqlite database failed: %v", err)
+		return nil, err
+	}
+	if _, err := s.Migrate(); err != nil {
+		s.Close()
+		return nil, errors.Wrap(err, "migrate sqlite database failed")
+	}
+	return s, nil
+}
+
+func openSQLite(path string, readOnly bool) (*SQLite, error) {
+	// The write-ahead log allows other tools to read while the daemon is writing.
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	if readOnly {
+		dsn = "file:" + path + "?mode=ro&_pragma=busy_timeout(5000)"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLite{db: db, path: path}, nil
+}
+
+// Close the SQLite database
+func (s *SQLite) Close() error {
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return errors.New("database not found.")
+}
+
+// Playback returns playback data of the given id.
+func (s *SQLite) Playback(id int) (*entity.Playback, error) {
+	pb := entity.Playback{ID: id}
+	var createdAt string
+
+	err := s.db.QueryRow(`SELECT source, created_at FROM playback WHERE id = ?`, id).Scan(&pb.Source, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrPlaybackNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pb.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+
+	return &pb, nil
+}
+
+// CreatePlayback creates a playback callback data.
+func (s *SQLite) CreatePlayback(pb *entity.Playback) error {
+	if pb.CreatedAt.IsZero() {
+		pb.CreatedAt = time.Now()
+	}
+
+	res, err := s.db.Exec(`INSERT INTO playback (source, created_at) VALUES (?, ?)`, pb.Source, formatTime(pb.CreatedAt))
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		logger.Error("generate id for playback failed: %v", err)
+		return err
+	}
+	logger.Debug("inserted playback, id: %d, value: %s", id, pb.Source)
+	pb.ID = int(id)
+
+	return nil
+}
+
+// RemovePlayback removes a playback callback entry by id, it does nothing
+// if the entry does not exist.
+func (s *SQLite) RemovePlayback(id uint64) error {
+	_, err := s.db.Exec(`DELETE FROM playback WHERE id = ?`, id)
+	return err
+}
+
+// RemoveExpiredPlaybacks removes the playback callback entries created
+// before the given time, and returns the number of them.
+func (s *SQLite) RemoveExpiredPlaybacks(before time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM playback WHERE created_at < ?`, formatTime(before))
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// DeadLetter returns the dead letter of the given id.
+func (s *SQLite) DeadLetter(id string) (*entity.DeadLetter, error) {
+	dls, err := s.deadLetters(`WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(dls) == 0 {
+		return nil, ErrDeadLetterNotFound
+	}
+	return &dls[0], nil
+}
+
+// DeadLetters returns all dead letters, the most recent first.
+func (s *SQLite) DeadLetters() ([]entity.DeadLetter, error) {
+	return s.deadLetters(`ORDER BY created_at DESC`)
+}
+
+// CreateDeadLetter creates a dead letter, it replaces the existing one
+// with the same id.
+func (s *SQLite) CreateDeadLetter(dl *entity.DeadLetter) error {
+	logger.Debug("inserting dead letter, id: %s, urls: %v", dl.ID, dl.URLs)
+
+	return putDeadLetter(s.db, dl)
+}
+
+// RemoveDeadLetter removes a dead letter by id.
+func (s *SQLite) RemoveDeadLetter(id string) error {
+	res, err := s.db.Exec(`DELETE FROM dead_letter WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// PurgeDeadLetters removes all dead letters.
+func (s *SQLite) PurgeDeadLetters() error {
+	_, err := s.db.Exec(`DELETE FROM dead_letter`)
+	return err
+}
+
+func (s *SQLite) deadLetters(clause string, args ...interface{}) ([]entity.DeadLetter, error) {
+	return scanDeadLetters(s.db.Query(`SELECT id, service, urls, attempts, created_at FROM dead_letter `+clause, args...))
+}
+
+func scanDeadLetters(rows *sql.Rows, err error) ([]entity.DeadLetter, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dls := []entity.DeadLetter{}
+	for rows.Next() {
+		var dl entity.DeadLetter
+		var urls, attempts, createdAt string
+		if err := rows.Scan(&dl.ID, &dl.Service, &urls, &attempts, &createdAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(urls), &dl.URLs); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(attempts), &dl.Attempts); err != nil {
+			return nil, err
+		}
+		if dl.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, err
+		}
+		dls = append(dls, dl)
+	}
+
+	return dls, rows.Err()
+}
+
+// Token returns the API token of the given id.
+func (s *SQLite) Token(id string) (*entity.Token, error) {
+	tokens, err := scanTokens(s.db.Query(`SELECT id, name, digest, scopes, created_at FROM token WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrTokenNotFound
+	}
+	return &tokens[0], nil
+}
+
+// Tokens returns all API tokens, the most recent first.
+func (s *SQLite) Tokens() ([]entity.Token, error) {
+	return scanTokens(s.db.Query(`SELECT id, name, digest, scopes, created_at FROM token ORDER BY created_at DESC`))
+}
+
+// CreateToken creates an API token, it replaces the existing one with the same id.
+func (s *SQLite) CreateToken(t *entity.Token) error {
+	logger.Debug("inserting token, id: %s, scopes: %v", t.ID, t.Scopes)
+
+	return putToken(s.db, t)
+}
+
+// RemoveToken removes an API token by id.
+func (s *SQLite) RemoveToken(id string) error {
+	res, err := s.db.Exec(`DELETE FROM token WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// Watch returns the URL watch of the given id.
+func (s *SQLite) Watch(id string) (*entity.Watch, error) {
+	watches, err := scanWatches(s.db.Query(`SELECT `+watchColumns+` FROM watch WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if len(watches) == 0 {
+		return nil, ErrWatchNotFound
+	}
+	return &watches[0], nil
+}
+
+// Watches returns all URL watches, the oldest first.
+func (s *SQLite) Watches() ([]entity.Watch, error) {
+	return scanWatches(s.db.Query(`SELECT ` + watchColumns + ` FROM watch ORDER BY created_at, rowid`))
+}
+
+// CreateWatch creates a URL watch, it replaces the existing one with the same id.
+func (s *SQLite) CreateWatch(w *entity.Watch) error {
+	logger.Debug("inserting watch, id: %s, url: %s", w.ID, w.URL)
+
+	return putWatch(s.db, w)
+}
+
+// RemoveWatch removes a URL watch by id.
+func (s *SQLite) RemoveWatch(id string) error {
+	res, err := s.db.Exec(`DELETE FROM watch WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrWatchNotFound
+	}
+	return nil
+}
+
+func scanTokens(rows *sql.Rows, err error) ([]entity.Token, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []entity.Token{}
+	for rows.Next() {
+		var t entity.Token
+		var scopes, createdAt string
+		if err := rows.Scan(&t.ID, &t.Name, &t.Digest, &scopes, &createdAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(scopes), &t.Scopes); err != nil {
+			return nil, err
+		}
+		if t.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+// CreateArchive creates an archive history entry, and fills the id, the
+// normalized URL and domain of it.
+func (s *SQLite) CreateArchive(a *entity.Archive) error {
+	a.URL = NormalizeURL(a.Source)
+	a.Domain = domainOf(a.URL)
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+
+	res, err := putArchiveRow(s.db, a)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		logger.Error("generate id for archive failed: %v", err)
+		return err
+	}
+	a.ID = int(id)
+
+	return nil
+}
+
+// Archive returns the archive of the given id.
+func (s *SQLite) Archive(id int) (*entity.Archive, error) {
+	archives, err := s.archives(`WHERE id = ?`, 0, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(archives) == 0 {
+		return nil, ErrArchiveNotFound
+	}
+	return &archives[0], nil
+}
+
+// ArchivesByURL returns the archive history of the given URL, the most recent first.
+// It returns all of them if limit is not positive.
+func (s *SQLite) ArchivesByURL(uri string, limit int) ([]entity.Archive, error) {
+	return s.archives(`WHERE url = ? ORDER BY id DESC`, limit, NormalizeURL(uri))
+}
+
+// ArchivesByDomain returns the archive history of the given domain, the most recent first.
+// It returns all of them if limit is not positive.
+func (s *SQLite) ArchivesByDomain(domain string, limit int) ([]entity.Archive, error) {
+	domain = strings.TrimPrefix(strings.ToLower(domain), "www.")
+	return s.archives(`WHERE domain = ? ORDER BY id DESC`, limit, domain)
+}
+
+// ArchivesByUser returns the archive history requested by the user of the given service,
+// the most recent first. It returns all of them if limit is not positive.
+func (s *SQLite) ArchivesByUser(service, user string, limit int) ([]entity.Archive, error) {
+	return s.archives(`WHERE service = ? AND user = ? ORDER BY id DESC`, limit, service, user)
+}
+
+// RecentArchives returns the most recent archives.
+// It returns all of them if limit is not positive.
+func (s *SQLite) RecentArchives(limit int) ([]entity.Archive, error) {
+	return s.archives(`ORDER BY id DESC`, limit)
+}
+
+// ArchivesBetween returns archives created within the given time range, the
+// most recent first. A zero bound leaves the range open on that side. It
+// returns all of them if limit is not positive.
+func (s *SQLite) ArchivesBetween(from, to time.Time, limit int) ([]entity.Archive, error) {
+	conds := []string{`1 = 1`}
+	var args []interface{}
+	if !from.IsZero() {
+		conds, args = append(conds, `created_at >= ?`), append(args, formatTime(from))
+	}
+	if !to.IsZero() {
+		conds, args = append(conds, `created_at <= ?`), append(args, formatTime(to))
+	}
+	return s.archives(`WHERE `+strings.Join(conds, ` AND `)+` ORDER BY created_at DESC, id DESC`, limit, args...)
+}
+
+// SearchArchives returns the archives that match the query, the most recent first.
+func (s *SQLite) SearchArchives(q ArchiveQuery) ([]entity.Archive, error) {
+	q = q.normalize()
+
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg ...interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg...)
+	}
+	if q.URL != "" {
+		add(`url = ?`, q.URL)
+	}
+	if q.Domain != "" {
+		add(`domain = ?`, q.Domain)
+	}
+	if q.Service != "" {
+		add(`service = ?`, q.Service)
+	}
+	if q.User != "" {
+		add(`user = ?`, q.User)
+	}
+	if !q.From.IsZero() {
+		add(`created_at >= ?`, formatTime(q.From))
+	}
+	if !q.To.IsZero() {
+		add(`created_at <= ?`, formatTime(q.To))
+	}
+	if q.Before > 0 {
+		add(`id < ?`, q.Before)
+	}
+	for _, term := range q.terms() {
+		pattern := "%" + likeEscaper.Replace(term) + "%"
+		add(`(title LIKE ? ESCAPE '\' OR text LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	clause := ``
+	if len(conds) > 0 {
+		clause = `WHERE ` + strings.Join(conds, ` AND `) + ` `
+	}
+
+	// The slot and status are filtered after decoding the results.
+	filtered := q.Slot != "" || q.Status != ""
+	limit := q.Limit
+	if filtered {
+		limit = 0
+	}
+	archives, err := s.archives(clause+`ORDER BY id DESC`, limit, args...)
+	if err != nil || !filtered {
+		return archives, err
+	}
+	matched := []entity.Archive{}
+	for _, a := range archives {
+		if q.Limit > 0 && len(matched) >= q.Limit {
+			break
+		}
+		if q.matchResults(a.Results) {
+			matched = append(matched, a)
+		}
+	}
+	return matched, nil
+}
+
+// likeEscaper escapes the wildcards of the LIKE operator.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *SQLite) archives(clause string, limit int, args ...interface{}) ([]entity.Archive, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	query := `SELECT id, source, url, domain, title, results, artifacts, service, user, created_at FROM archive ` + clause + ` LIMIT ?`
+	return scanArchives(s.db.Query(query, append(args, limit)...))
+}
+
+func scanArchives(rows *sql.Rows, err error) ([]entity.Archive, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	archives := []entity.Archive{}
+	for rows.Next() {
+		var a entity.Archive
+		var results, artifacts, createdAt string
+		if err := rows.Scan(&a.ID, &a.Source, &a.URL, &a.Domain, &a.Title, &results, &artifacts, &a.Service, &a.User, &createdAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(results), &a.Results); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(artifacts), &a.Artifacts); err != nil {
+			return nil, err
+		}
+		if a.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, err
+		}
+		archives = append(archives, a)
+	}
+
+	return archives, rows.Err()
+}
+
+// execer executes a statement in a database or a transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func putDeadLetter(db execer, dl *entity.DeadLetter) error {
+	urls, err := json.Marshal(dl.URLs)
+	if err != nil {
+		return err
+	}
+	attempts, err := json.Marshal(dl.Attempts)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		`INSERT OR REPLACE INTO dead_letter (id, service, urls, attempts, created_at) VALUES (?, ?, ?, ?, ?)`,
+		dl.ID, dl.Service, string(urls), string(attempts), formatTime(dl.CreatedAt),
+	)
+	return err
+}
+
+func putToken(db execer, t *entity.Token) error {
+	scopes, err := json.Marshal(t.Scopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		`INSERT OR REPLACE INTO token (id, name, digest, scopes, created_at) VALUES (?, ?, ?, ?, ?)`,
+		t.ID, t.Name, t.Digest, string(scopes), formatTime(t.CreatedAt),
+	)
+	return err
+}
+
+const watchColumns = `id, url, interval, service, user, chat, digest, status, checked_at, created_at`
+
+func scanWatches(rows *sql.Rows, err error) ([]entity.Watch, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watches := []entity.Watch{}
+	for rows.Next() {
+		var w entity.Watch
+		var checkedAt, createdAt string
+		if err := rows.Scan(&w.ID, &w.URL, &w.Interval, &w.Service, &w.User, &w.Chat, &w.Digest, &w.Status, &checkedAt, &createdAt); err != nil {
+			return nil, err
+		}
+		if w.CheckedAt, err = parseTime(checkedAt); err != nil {
+			return nil, err
+		}
+		if w.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, err
+		}
+		watches = append(watches, w)
+	}
+
+	return watches, rows.Err()
+}
+
+func putWatch(db execer, w *entity.Watch) error {
+	_, err := db.Exec(
+		`INSERT OR REPLACE INTO watch (`+watchColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.ID, w.URL, w.Interval, w.Service, w.User, w.Chat, w.Digest, w.Status, formatTime(w.CheckedAt), formatTime(w.CreatedAt),
+	)
+	return err
+}
+
+// putArchiveRow inserts the archive, or replaces the existing one if the id is not zero.
+func putArchiveRow(db execer, a *entity.Archive) (sql.Result, error) {
+	results, err := json.Marshal(a.Results)
+	if err != nil {
+		return nil, err
+	}
+	artifacts, err := json.Marshal(a.Artifacts)
+	if err != nil {
+		return nil, err
+	}
+
+	var id interface{}
+	if a.ID > 0 {
+		id = a.ID
+	}
+	return db.Exec(
+		`INSERT OR REPLACE INTO archive (id, source, url, domain, title, text, results, artifacts, service, user, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, a.Source, a.URL, a.Domain, a.Title, a.Text, string(results), string(artifacts), a.Service, a.User, formatTime(a.CreatedAt),
+	)
+}
+
+// Backup writes a consistent copy of the database to w, it does not block
+// other reads and writes.
+func (s *SQLite) Backup(w io.Writer) (int64, error) {
+	dir, err := os.MkdirTemp("", "wayback-backup-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "wayback.sqlite")
+	if _, err := s.db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return io.Copy(w, f)
+}
+
+// Export writes all the records to w in JSON Lines, from a consistent view
+// of the database.
+func (s *SQLite) Export(w io.Writer) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	enc := newRecordEncoder(w)
+	rows, err := tx.Query(`SELECT id, source, created_at FROM playback ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pb entity.Playback
+		var createdAt string
+		if err := rows.Scan(&pb.ID, &pb.Source, &createdAt); err != nil {
+			return err
+		}
+		if pb.CreatedAt, err = parseTime(createdAt); err != nil {
+			return err
+		}
+		if err := enc.encode(entity.EntityPlayback, pb); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	dls, err := scanDeadLetters(tx.Query(`SELECT id, service, urls, attempts, created_at FROM dead_letter ORDER BY id`))
+	if err != nil {
+		return err
+	}
+	for _, dl := range dls {
+		if err := enc.encode(entity.EntityDeadLetter, dl); err != nil {
+			return err
+		}
+	}
+
+	archives, err := scanArchives(tx.Query(`SELECT id, source, url, domain, title, results, artifacts, service, user, created_at FROM archive ORDER BY id`))
+	if err != nil {
+		return err
+	}
+	for _, a := range archives {
+		if err := enc.encode(entity.EntityArchive, a); err != nil {
+			return err
+		}
+	}
+
+	tokens, err := scanTokens(tx.Query(`SELECT id, name, digest, scopes, created_at FROM token ORDER BY id`))
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if err := enc.encode(entity.EntityToken, t); err != nil {
+			return err
+		}
+	}
+
+	watches, err := scanWatches(tx.Query(`SELECT ` + watchColumns + ` FROM watch ORDER BY id`))
+	if err != nil {
+		return err
+	}
+	for _, w := range watches {
+		if err := enc.encode(entity.EntityWatch, w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Import reads records in JSON Lines from r in a single transaction, the
+// records keep their ids and replace the existing ones with the same ids.
+// It returns the number of records imported.
+func (s *SQLite) Import(r io.Reader) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	im := importer{
+		playback: func(pb *entity.Playback) error {
+			if pb.ID <= 0 {
+				return errors.New("invalid id %d", pb.ID)
+			}
+			_, err := tx.Exec(`INSERT OR REPLACE INTO playback (id, source, created_at) VALUES (?, ?, ?)`, pb.ID, pb.Source, formatTime(pb.CreatedAt))
+			return err
+		},
+		deadLetter: func(dl *entity.DeadLetter) error {
+			return putDeadLetter(tx, dl)
+		},
+		archive: func(a *entity.Archive) error {
+			if a.ID <= 0 {
+				return errors.New("invalid id %d", a.ID)
+			}
+			_, err := putArchiveRow(tx, a)
+			return err
+		},
+		token: func(t *entity.Token) error {
+			return putToken(tx, t)
+		},
+		watch: func(w *entity.Watch) error {
+			return putWatch(tx, w)
+		},
+	}
+	n, err := decodeRecords(r, im)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
+
+// Version returns the current version of the database schema.
+func (s *SQLite) Version() (version int, err error) {
+	err = s.db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return
+}
+
+// Pending returns the migrations that have not been applied to the database.
+func (s *SQLite) Pending() ([]Migration, error) {
+	version, err := s.Version()
+	if err != nil {
+		return nil, err
+	}
+	return pending(version)
+}
+
+// Migrate applies the pending migrations in a single transaction, a snapshot
+// of an existing database is taken before that. It returns the path of the
+// snapshot, which is empty if there is nothing to migrate or the database is new.
+func (s *SQLite) Migrate() (backup string, err error) {
+	pending, err := s.Pending()
+	if err != nil || len(pending) == 0 {
+		return "", err
+	}
+
+	version, err := s.Version()
+	if err != nil {
+		return "", err
+	}
+	if version > 0 {
+		backup = backupPath(s.path, version)
+		if _, err := s.db.Exec(`VACUUM INTO ?`, backup); err != nil {
+			return "", errors.Wrap(err, "take snapshot failed")
+		}
+		logger.Info("database snapshot saved to %s", backup)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	for _, m := range pending {
+		logger.Info("migrating database to version %d: %s", m.Version, m.Name)
+		if _, err := tx.Exec(m.sqlite); err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("migrate to version %d failed", m.Version))
+		}
+	}
+	// PRAGMA does not support bound parameters.
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, pending[len(pending)-1].Version)); err != nil {
+		return "", err
+	}
+
+	return backup, tx.Commit()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(timeLayout, s)
+	if err != nil {
+		return t, err
+	}
+	return t.Local(), nil
+}
@@ -6,39 +6,145 @@ package storage // import "github.com/wabarc/wayback/storage"
 
 import (
 	"encoding/binary"
+	"io"
+	"time"
 
-	"github.com/wabarc/logger"
 	"github.com/wabarc/wayback/config"
+	"github.com/wabarc/wayback/entity"
 	"github.com/wabarc/wayback/errors"
+)
 
-	bolt "go.etcd.io/bbolt"
+// Supported database drivers.
+const (
+	DriverBolt   = "bolt"
+	DriverSQLite = "sqlite"
 )
 
+// ErrUnsupportedDriver is returned if the database driver is unknown.
+var ErrUnsupportedDriver = errors.New("unsupported database driver")
+
 // Storage handles all operations related to the database.
-type Storage struct {
-	db *bolt.DB
+type Storage interface {
+	// Playback returns playback data of the given id.
+	Playback(id int) (*entity.Playback, error)
+	// CreatePlayback creates a playback callback data.
+	CreatePlayback(pb *entity.Playback) error
+	// RemovePlayback removes a playback callback entry by id.
+	RemovePlayback(id uint64) error
+	// RemoveExpiredPlaybacks removes the playback callback entries created
+	// before the given time, and returns the number of them.
+	RemoveExpiredPlaybacks(before time.Time) (int, error)
+
+	// DeadLetter returns the dead letter of the given id.
+	DeadLetter(id string) (*entity.DeadLetter, error)
+	// DeadLetters returns all dead letters, the most recent first.
+	DeadLetters() ([]entity.DeadLetter, error)
+	// CreateDeadLetter creates a dead letter, it replaces the existing one with the same id.
+	CreateDeadLetter(dl *entity.DeadLetter) error
+	// RemoveDeadLetter removes a dead letter by id.
+	RemoveDeadLetter(id string) error
+	// PurgeDeadLetters removes all dead letters.
+	PurgeDeadLetters() error
+
+	// CreateArchive creates an archive history entry, and fills the id,
+	// the normalized URL and domain of it.
+	CreateArchive(a *entity.Archive) error
+	// Archive returns the archive of the given id.
+	Archive(id int) (*entity.Archive, error)
+	// ArchivesByURL returns the archive history of the given URL.
+	ArchivesByURL(uri string, limit int) ([]entity.Archive, error)
+	// ArchivesByDomain returns the archive history of the given domain.
+	ArchivesByDomain(domain string, limit int) ([]entity.Archive, error)
+	// ArchivesByUser returns the archive history requested by the user of the given service.
+	ArchivesByUser(service, user string, limit int) ([]entity.Archive, error)
+	// RecentArchives returns the most recent archives.
+	RecentArchives(limit int) ([]entity.Archive, error)
+	// ArchivesBetween returns archives created within the given time range.
+	ArchivesBetween(from, to time.Time, limit int) ([]entity.Archive, error)
+	// SearchArchives returns the archives that match the query, the most recent first.
+	SearchArchives(q ArchiveQuery) ([]entity.Archive, error)
+
+	// Token returns the API token of the given id.
+	Token(id string) (*entity.Token, error)
+	// Tokens returns all API tokens, the most recent first.
+	Tokens() ([]entity.Token, error)
+	// CreateToken creates an API token, it replaces the existing one with the same id.
+	CreateToken(t *entity.Token) error
+	// RemoveToken removes an API token by id.
+	RemoveToken(id string) error
+
+	// Watch returns the URL watch of the given id.
+	Watch(id string) (*entity.Watch, error)
+	// Watches returns all URL watches, the oldest first.
+	Watches() ([]entity.Watch, error)
+	// CreateWatch creates a URL watch, it replaces the existing one with the same id.
+	CreateWatch(w *entity.Watch) error
+	// RemoveWatch removes a URL watch by id.
+	RemoveWatch(id string) error
+
+	// Backup writes a consistent copy of the database to w, it does not
+	// block other reads and writes.
+	Backup(w io.Writer) (int64, error)
+	// Export writes all the records to w in JSON Lines.
+	Export(w io.Writer) error
+	// Import reads records in JSON Lines from r in a single transaction,
+	// and returns the number of records imported.
+	Import(r io.Reader) (int, error)
+
+	// Version returns the current version of the database schema.
+	Version() (int, error)
+	// Pending returns the migrations that have not been applied to the database.
+	Pending() ([]Migration, error)
+	// Migrate applies the pending migrations, and returns the path of
+	// the snapshot taken before that.
+	Migrate() (backup string, err error)
+
+	// Close the database.
+	Close() error
+}
+
+var (
+	_ Storage = (*Bolt)(nil)
+	_ Storage = (*SQLite)(nil)
+)
+
+// Open a database of the configured driver in given path, and migrate
+// its schema to the latest version. The path defaults to the configured
+// one if empty. It is the caller's responsibility to close it.
+func Open(path string) (Storage, error) {
+	if path == "" {
+		path = config.Opts.DatabasePathname()
+	}
+	switch driver() {
+	case DriverBolt:
+		return OpenBolt(path)
+	case DriverSQLite:
+		return OpenSQLite(path)
+	}
+	return nil, ErrUnsupportedDriver
 }
 
-// Open a bolt database on current directory in given path.
-// It is the caller's responsibility to close it.
-func Open(path string) (*Storage, error) {
+// OpenReadOnly opens a database of the configured driver in read-only mode
+// without migrating, e.g. to inspect its schema. It is the caller's
+// responsibility to close it.
+func OpenReadOnly(path string) (Storage, error) {
 	if path == "" {
-		path = config.Opts.BoltPathname()
+		path = config.Opts.DatabasePathname()
 	}
-	db, err := bolt.Open(path, 0600, nil)
-	if err != nil {
-		logger.Fatal("open bolt database failed: %v", err)
-		return nil, err
+	switch driver() {
+	case DriverBolt:
+		return openBolt(path, true)
+	case DriverSQLite:
+		return openSQLite(path, true)
 	}
-	return &Storage{db: db}, nil
+	return nil, ErrUnsupportedDriver
 }
 
-// Close the bolt database
-func (s *Storage) Close() error {
-	if s.db != nil {
-		return s.db.Close()
+func driver() string {
+	if config.Opts == nil || config.Opts.DatabaseDriver() == "" {
+		return DriverBolt
 	}
-	return errors.New("database not found.")
+	return config.Opts.DatabaseDriver()
 }
 
 func itob(v int) []byte {
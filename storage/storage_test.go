@@ -5,13 +5,28 @@
 package storage // import "github.com/wabarc/wayback/storage"
 
 import (
-	"os"
 	"path/filepath"
-
-	"github.com/wabarc/helper"
+	"testing"
 )
 
-func tmpPath() string {
-	r := helper.RandString(5, "lower")
-	return filepath.Join(os.TempDir(), r)
+// drivers opens the database of every driver, the tests run by conform
+// make up the conformance suite that each driver must pass.
+var drivers = map[string]func(path string) (Storage, error){
+	DriverBolt:   func(path string) (Storage, error) { return OpenBolt(path) },
+	DriverSQLite: func(path string) (Storage, error) { return OpenSQLite(path) },
+}
+
+func conform(t *testing.T, test func(t *testing.T, s Storage)) {
+	for name, open := range drivers {
+		open := open
+		t.Run(name, func(t *testing.T) {
+			s, err := open(filepath.Join(t.TempDir(), "wayback.db"))
+			if err != nil {
+				t.Fatalf("Unexpected open a %s db: %v", name, err)
+			}
+			defer s.Close()
+
+			test(t, s)
+		})
+	}
 }
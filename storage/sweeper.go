@@ -0,0 +1,45 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"context"
+	"time"
+
+	"github.com/wabarc/logger"
+)
+
+// maxSweepInterval is the maximum interval between two sweeps.
+const maxSweepInterval = time.Hour
+
+// SweepPlaybacks removes the playback callback entries older than the TTL
+// periodically until the context is done, it returns at once if the TTL is
+// not positive.
+func SweepPlaybacks(ctx context.Context, s Storage, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	interval := ttl
+	if interval > maxSweepInterval {
+		interval = maxSweepInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := s.RemoveExpiredPlaybacks(time.Now().Add(-ttl))
+		if err != nil {
+			logger.Error("remove expired playbacks failed: %v", err)
+		} else if n > 0 {
+			logger.Info("removed %d expired playbacks", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
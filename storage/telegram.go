@@ -5,53 +5,42 @@
 package storage // import "github.com/wabarc/wayback/storage"
 
 import (
-	"bytes"
+	"encoding/json"
+	"time"
 
 	"github.com/wabarc/helper"
 	"github.com/wabarc/logger"
 	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
 	bolt "go.etcd.io/bbolt"
 )
 
-func (s *Storage) createPlaybackBucket() error {
-	tx, err := s.db.Begin(true)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback() //nolint:errcheck
-
-	_, err = tx.CreateBucketIfNotExists(helper.String2Byte(entity.EntityPlayback))
-	if err != nil {
-		return err
-	}
-
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
-}
+// ErrPlaybackNotFound is returned if the playback does not exist, e.g. it has been removed after expired.
+var ErrPlaybackNotFound = errors.New("playback not found")
 
 // Playback returns playback data of the given id.
-func (s *Storage) Playback(id int) (*entity.Playback, error) {
+func (s *Bolt) Playback(id int) (*entity.Playback, error) {
 	var pb entity.Playback
 
 	err := s.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket(helper.String2Byte(entity.EntityPlayback))
 		v := b.Get(itob(id))
-		pb.Source = helper.Byte2String(v)
-		pb.ID = id
-		return nil
+		if v == nil {
+			return ErrPlaybackNotFound
+		}
+		return json.Unmarshal(v, &pb)
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return &pb, err
+	return &pb, nil
 }
 
 // CreatePlayback creates a playback callback data.
-func (s *Storage) CreatePlayback(pb *entity.Playback) error {
-	if err := s.createPlaybackBucket(); err != nil {
-		logger.Error("create playback buckte failed: %v", err)
-		return err
+func (s *Bolt) CreatePlayback(pb *entity.Playback) error {
+	if pb.CreatedAt.IsZero() {
+		pb.CreatedAt = time.Now()
 	}
 
 	return s.db.Update(func(tx *bolt.Tx) (err error) {
@@ -64,13 +53,53 @@ func (s *Storage) CreatePlayback(pb *entity.Playback) error {
 		logger.Debug("putting data to bucket, id: %d, value: %s", id, pb.Source)
 
 		pb.ID = int(id)
-		buf := bytes.NewBufferString(pb.Source).Bytes()
+		buf, err := json.Marshal(pb)
+		if err != nil {
+			return err
+		}
 
 		return b.Put(itob(pb.ID), buf)
 	})
 }
 
-// RemovePlayback removes a playback callback entry by id.
-func (s *Storage) RemovePlayback(id uint64) error {
-	return nil
+// RemovePlayback removes a playback callback entry by id, it does nothing
+// if the entry does not exist.
+func (s *Bolt) RemovePlayback(id uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(helper.String2Byte(entity.EntityPlayback)).Delete(itob(int(id)))
+	})
+}
+
+// RemoveExpiredPlaybacks removes the playback callback entries created
+// before the given time, and returns the number of them.
+func (s *Bolt) RemoveExpiredPlaybacks(before time.Time) (n int, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(helper.String2Byte(entity.EntityPlayback))
+		expired := [][]byte{}
+		err := b.ForEach(func(k, v []byte) error {
+			var pb entity.Playback
+			if err := json.Unmarshal(v, &pb); err != nil {
+				return err
+			}
+			if pb.CreatedAt.Before(before) {
+				expired = append(expired, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Deleting keys within ForEach is not allowed.
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(expired)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
 }
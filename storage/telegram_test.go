@@ -5,69 +5,116 @@
 package storage // import "github.com/wabarc/wayback/storage"
 
 import (
-	"os"
+	"context"
 	"testing"
+	"time"
 
 	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
 )
 
 func TestCreatePlayback(t *testing.T) {
-	dbpath := tmpPath()
-	defer os.Remove(dbpath)
+	conform(t, func(t *testing.T, s Storage) {
+		pb := &entity.Playback{Source: ":wayback https://example.com"}
+		err := s.CreatePlayback(pb)
+		if err != nil {
+			t.Fatalf("Unexpected create playback, error: %v", err)
+		}
+	})
+}
 
-	s, err := Open(dbpath)
-	if err != nil {
-		t.Fatalf("Unexpected open a bolt db: %v", err)
-	}
-	defer s.Close()
+func TestPlayback(t *testing.T) {
+	conform(t, func(t *testing.T, s Storage) {
+		dt := ":wayback https://example.com"
+		pb := &entity.Playback{Source: dt}
+		err := s.CreatePlayback(pb)
+		if err != nil {
+			t.Fatalf("Unexpected create playback, error: %v", err)
+		}
 
-	pb := &entity.Playback{Source: ":wayback https://example.com"}
-	err = s.CreatePlayback(pb)
-	if err != nil {
-		t.Fatalf("Unexpected create playback, error: %v", err)
-	}
+		pb, err = s.Playback(pb.ID)
+		if err != nil {
+			t.Fatalf("Unexpected query playback, error: %v", err)
+		}
+		if pb.ID == 0 {
+			t.Errorf("Unexpected query playback, got %d instead of grather than 0", pb.ID)
+		}
+		if pb.Source != dt {
+			t.Errorf("Unexpected query playback, got %s instead of %s", pb.Source, dt)
+		}
+	})
 }
 
-func TestPlayback(t *testing.T) {
-	dbpath := tmpPath()
-	defer os.Remove(dbpath)
+func TestRemovePlayback(t *testing.T) {
+	conform(t, func(t *testing.T, s Storage) {
+		if s.RemovePlayback(0) != nil {
+			t.Error("Unexpected remove playback data")
+		}
 
-	s, err := Open(dbpath)
-	if err != nil {
-		t.Fatalf("Unexpected open a bolt db: %v", err)
-	}
-	defer s.Close()
+		pb := &entity.Playback{Source: ":wayback https://example.com"}
+		if err := s.CreatePlayback(pb); err != nil {
+			t.Fatalf("Unexpected create playback, error: %v", err)
+		}
+		if err := s.RemovePlayback(uint64(pb.ID)); err != nil {
+			t.Fatalf("Unexpected remove playback, error: %v", err)
+		}
+		if _, err := s.Playback(pb.ID); !errors.Is(err, ErrPlaybackNotFound) {
+			t.Errorf("Unexpected query removed playback, got %v instead of %v", err, ErrPlaybackNotFound)
+		}
+	})
+}
 
-	dt := ":wayback https://example.com"
-	pb := &entity.Playback{Source: dt}
-	err = s.CreatePlayback(pb)
-	if err != nil {
-		t.Fatalf("Unexpected create playback, error: %v", err)
-	}
+func TestRemoveExpiredPlaybacks(t *testing.T) {
+	conform(t, func(t *testing.T, s Storage) {
+		now := time.Now()
+		for _, age := range []time.Duration{3 * time.Hour, 2 * time.Hour, time.Minute} {
+			pb := &entity.Playback{Source: "foo", CreatedAt: now.Add(-age)}
+			if err := s.CreatePlayback(pb); err != nil {
+				t.Fatalf("Unexpected create playback, error: %v", err)
+			}
+		}
 
-	pb, err = s.Playback(pb.ID)
-	if err != nil {
-		t.Fatalf("Unexpected query playback, error: %v", err)
-	}
-	if pb.ID == 0 {
-		t.Errorf("Unexpected query playback, got %d instead of grather than 0", pb.ID)
-	}
-	if pb.Source != dt {
-		t.Errorf("Unexpected query playback, got %s instead of %s", pb.Source, dt)
-	}
+		n, err := s.RemoveExpiredPlaybacks(now.Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("Unexpected remove expired playbacks, error: %v", err)
+		}
+		if n != 2 {
+			t.Errorf("Unexpected removed playbacks, got %d instead of 2", n)
+		}
+		if _, err := s.Playback(1); !errors.Is(err, ErrPlaybackNotFound) {
+			t.Errorf("Unexpected query expired playback, got %v instead of %v", err, ErrPlaybackNotFound)
+		}
+		if pb, err := s.Playback(3); err != nil || pb.Expired(time.Hour) {
+			t.Errorf("Unexpected query playback, got %#v, error: %v", pb, err)
+		}
+	})
 }
 
-func TestRemovePlayback(t *testing.T) {
-	dbpath := tmpPath()
-	defer os.Remove(dbpath)
+func TestSweepPlaybacks(t *testing.T) {
+	conform(t, func(t *testing.T, s Storage) {
+		pb := &entity.Playback{Source: "foo", CreatedAt: time.Now().Add(-time.Hour)}
+		if err := s.CreatePlayback(pb); err != nil {
+			t.Fatalf("Unexpected create playback, error: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			SweepPlaybacks(ctx, s, time.Minute)
+			close(done)
+		}()
 
-	s, err := Open(dbpath)
-	if err != nil {
-		t.Fatalf("Unexpected open a bolt db: %v", err)
-	}
-	defer s.Close()
+		for i := 0; i < 100; i++ {
+			if _, err := s.Playback(pb.ID); errors.Is(err, ErrPlaybackNotFound) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+		<-done
 
-	if s.RemovePlayback(0) != nil {
-		t.Error("Unexpected remove playback data")
-	}
+		if _, err := s.Playback(pb.ID); !errors.Is(err, ErrPlaybackNotFound) {
+			t.Errorf("Unexpected query expired playback, got %v instead of %v", err, ErrPlaybackNotFound)
+		}
+	})
 }
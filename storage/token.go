@@ -0,0 +1,84 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrTokenNotFound is returned if the API token does not exist.
+var ErrTokenNotFound = errors.New("token not found")
+
+// Token returns the API token of the given id.
+func (s *Bolt) Token(id string) (*entity.Token, error) {
+	var t entity.Token
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(helper.String2Byte(entity.EntityToken)).Get(helper.String2Byte(id))
+		if v == nil {
+			return ErrTokenNotFound
+		}
+		return json.Unmarshal(v, &t)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Tokens returns all API tokens, the most recent first.
+func (s *Bolt) Tokens() ([]entity.Token, error) {
+	tokens := []entity.Token{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(helper.String2Byte(entity.EntityToken)).ForEach(func(_, v []byte) error {
+			var t entity.Token
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			tokens = append(tokens, t)
+			return nil
+		})
+	})
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	return tokens, err
+}
+
+// CreateToken creates an API token, it replaces the existing one with the same id.
+func (s *Bolt) CreateToken(t *entity.Token) error {
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		logger.Debug("putting data to bucket, id: %s, scopes: %v", t.ID, t.Scopes)
+
+		return tx.Bucket(helper.String2Byte(entity.EntityToken)).Put(helper.String2Byte(t.ID), buf)
+	})
+}
+
+// RemoveToken removes an API token by id.
+func (s *Bolt) RemoveToken(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(helper.String2Byte(entity.EntityToken))
+		if b.Get(helper.String2Byte(id)) == nil {
+			return ErrTokenNotFound
+		}
+		return b.Delete(helper.String2Byte(id))
+	})
+}
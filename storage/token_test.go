@@ -0,0 +1,58 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+)
+
+func TestToken(t *testing.T) {
+	conform(t, func(t *testing.T, s Storage) {
+		if _, err := s.Token("foo"); !errors.Is(err, ErrTokenNotFound) {
+			t.Fatalf("Unexpected query token, got %v instead of %v", err, ErrTokenNotFound)
+		}
+
+		now := time.Now()
+		for i, id := range []string{"foo", "bar"} {
+			token := &entity.Token{
+				ID:        id,
+				Name:      "ci",
+				Digest:    "digest-" + id,
+				Scopes:    []string{entity.ScopeArchive, entity.ScopePlayback},
+				CreatedAt: now.Add(time.Duration(i) * time.Second),
+			}
+			if err := s.CreateToken(token); err != nil {
+				t.Fatalf("Unexpected create token, error: %v", err)
+			}
+		}
+
+		token, err := s.Token("foo")
+		if err != nil {
+			t.Fatalf("Unexpected query token, error: %v", err)
+		}
+		if token.Name != "ci" || token.Digest != "digest-foo" || len(token.Scopes) != 2 {
+			t.Errorf("Unexpected token, got %#v", token)
+		}
+
+		tokens, err := s.Tokens()
+		if err != nil {
+			t.Fatalf("Unexpected list tokens, error: %v", err)
+		}
+		if len(tokens) != 2 || tokens[0].ID != "bar" {
+			t.Fatalf("Unexpected tokens, got %#v", tokens)
+		}
+
+		if err := s.RemoveToken("foo"); err != nil {
+			t.Fatalf("Unexpected remove token, error: %v", err)
+		}
+		if err := s.RemoveToken("foo"); !errors.Is(err, ErrTokenNotFound) {
+			t.Errorf("Unexpected remove token, got %v instead of %v", err, ErrTokenNotFound)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrWatchNotFound is returned if the URL watch does not exist.
+var ErrWatchNotFound = errors.New("watch not found")
+
+// Watch returns the URL watch of the given id.
+func (s *Bolt) Watch(id string) (*entity.Watch, error) {
+	var w entity.Watch
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(helper.String2Byte(entity.EntityWatch)).Get(helper.String2Byte(id))
+		if v == nil {
+			return ErrWatchNotFound
+		}
+		return json.Unmarshal(v, &w)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// Watches returns all URL watches, the oldest first.
+func (s *Bolt) Watches() ([]entity.Watch, error) {
+	watches := []entity.Watch{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(helper.String2Byte(entity.EntityWatch)).ForEach(func(_, v []byte) error {
+			var w entity.Watch
+			if err := json.Unmarshal(v, &w); err != nil {
+				return err
+			}
+			watches = append(watches, w)
+			return nil
+		})
+	})
+
+	sort.SliceStable(watches, func(i, j int) bool {
+		return watches[i].CreatedAt.Before(watches[j].CreatedAt)
+	})
+
+	return watches, err
+}
+
+// CreateWatch creates a URL watch, it replaces the existing one with the same id.
+func (s *Bolt) CreateWatch(w *entity.Watch) error {
+	buf, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		logger.Debug("putting data to bucket, id: %s, url: %s", w.ID, w.URL)
+
+		return tx.Bucket(helper.String2Byte(entity.EntityWatch)).Put(helper.String2Byte(w.ID), buf)
+	})
+}
+
+// RemoveWatch removes a URL watch by id.
+func (s *Bolt) RemoveWatch(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(helper.String2Byte(entity.EntityWatch))
+		if b.Get(helper.String2Byte(id)) == nil {
+			return ErrWatchNotFound
+		}
+		return b.Delete(helper.String2Byte(id))
+	})
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package storage // import "github.com/wabarc/wayback/storage"
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wabarc/wayback/entity"
+	"github.com/wabarc/wayback/errors"
+)
+
+func TestWatch(t *testing.T) {
+	conform(t, func(t *testing.T, s Storage) {
+		if _, err := s.Watch("foo"); !errors.Is(err, ErrWatchNotFound) {
+			t.Fatalf("Unexpected query watch, got %v instead of %v", err, ErrWatchNotFound)
+		}
+
+		now := time.Now()
+		for i, id := range []string{"foo", "bar"} {
+			w := &entity.Watch{
+				ID:        id,
+				URL:       "https://example.com/" + id,
+				Interval:  3600,
+				Service:   "telegram",
+				User:      "42",
+				Chat:      "-100",
+				CreatedAt: now.Add(time.Duration(i) * time.Second),
+			}
+			if err := s.CreateWatch(w); err != nil {
+				t.Fatalf("Unexpected create watch, error: %v", err)
+			}
+		}
+
+		w, err := s.Watch("foo")
+		if err != nil {
+			t.Fatalf("Unexpected query watch, error: %v", err)
+		}
+		if w.URL != "https://example.com/foo" || w.Interval != 3600 || w.Chat != "-100" || w.Checked() {
+			t.Errorf("Unexpected watch, got %#v", w)
+		}
+
+		// Replacing the watch keeps the state of the last check.
+		w.Digest, w.Status, w.CheckedAt = "digest", 200, now
+		if err := s.CreateWatch(w); err != nil {
+			t.Fatalf("Unexpected update watch, error: %v", err)
+		}
+		if w, err = s.Watch("foo"); err != nil || w.Digest != "digest" || !w.Alive() || w.Due(now) {
+			t.Errorf("Unexpected updated watch, got %#v, error: %v", w, err)
+		}
+
+		watches, err := s.Watches()
+		if err != nil {
+			t.Fatalf("Unexpected list watches, error: %v", err)
+		}
+		if len(watches) != 2 || watches[0].ID != "foo" {
+			t.Fatalf("Unexpected watches, got %#v", watches)
+		}
+
+		if err := s.RemoveWatch("foo"); err != nil {
+			t.Fatalf("Unexpected remove watch, error: %v", err)
+		}
+		if err := s.RemoveWatch("foo"); !errors.Is(err, ErrWatchNotFound) {
+			t.Errorf("Unexpected remove watch, got %v instead of %v", err, ErrWatchNotFound)
+		}
+	})
+}
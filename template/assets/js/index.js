@@ -58,11 +58,79 @@ var render = function (collects) {
   archived.innerHTML = html + archived.innerHTML;
 };
 
+// progress renders the results of an async job incrementally, with the
+// progress events streamed from the server.
+var progress = function (location) {
+  "use strict";
+  var archived = document.getElementById('archived'),
+    source = new EventSource(location + '/events'),
+    rows = {};
+
+  var row = function (src, slot) {
+    var key = src + ' ' + slot;
+    if (!rows[key]) {
+      var ul = document.createElement('ul'),
+        li = document.createElement('li'),
+        dst = document.createElement('li');
+      ul.className = 'row';
+      li.className = 'src';
+      li.title = src;
+      li.textContent = src;
+      dst.className = 'dst';
+      dst.textContent = slot ? slot + ': archiving...' : 'capturing...';
+      ul.appendChild(li);
+      ul.appendChild(dst);
+      archived.insertBefore(ul, archived.firstChild);
+      rows[key] = dst;
+    }
+    return rows[key];
+  };
+
+  source.addEventListener('reduxed', function (e) {
+    var ev = JSON.parse(e.data);
+    row(ev.src, '').textContent = ev.error ? 'capture failed: ' + ev.error : 'captured';
+  });
+  source.addEventListener('archived', function (e) {
+    var ev = JSON.parse(e.data),
+      dst = row(ev.src, ev.slot),
+      a = document.createElement('a');
+    dst.textContent = '';
+    if (ev.error) {
+      dst.title = ev.error;
+      dst.textContent = ev.slot + ': ' + ev.error;
+      return;
+    }
+    a.href = ev.dst;
+    a.target = 'blank';
+    a.textContent = ev.dst;
+    dst.title = ev.dst;
+    dst.appendChild(a);
+  });
+  source.addEventListener('done', function (e) {
+    var ev = JSON.parse(e.data);
+    if (ev.state !== 'succeeded') {
+      row('', ev.state).textContent = ev.state + (ev.error ? ': ' + ev.error : '');
+    }
+    unblock();
+  });
+  // The server ends the stream once the job and its publishing finished.
+  source.addEventListener('end', function () {
+    source.close();
+    unblock();
+  });
+  source.onerror = function () {
+    if (source.readyState === EventSource.CLOSED) {
+      unblock();
+    }
+  };
+};
+
 var post = function (url) {
   "use strict";
   var http = new XMLHttpRequest(),
     params = new URLSearchParams(),
-    text = document.getElementById('text').value;
+    text = document.getElementById('text').value,
+    async = url === "/wayback" && typeof EventSource !== "undefined";
   if (!text || text.length === 0) {
     return;
   }
@@ -75,7 +143,14 @@ var post = function (url) {
   http.open("POST", url, true);
   http.setRequestHeader("Content-Type", "application/x-www-form-urlencoded");
   http.onreadystatechange = function () {
-    if (http.readyState === 4 && http.status === 200) {
+    if (http.readyState !== 4) {
+      return;
+    }
+    if (http.status === 202 && http.getResponseHeader("Location")) {
+      progress(http.getResponseHeader("Location"));
+      return;
+    }
+    if (http.status === 200) {
       if (http.response !== undefined && http.response) {
         var collects = JSON.parse(http.response)
         render(collects);
@@ -85,6 +160,9 @@ var post = function (url) {
   };
   params.append("text", text);
   params.append("data-type", "json");
+  if (async) {
+    params.append("async", "true");
+  }
   http.send(params);
 }
 
@@ -50,7 +50,7 @@ self.addEventListener("fetch", (event) => {
   if (event.request.url !== '') {
     try {
       const url = new URL(event.request.url)
-      if (url.pathname.match('^.*(\/w|\/healthcheck|\/version|\/metrics)$')) {
+      if (url.pathname.match('^.*(\/w|\/share|\/bookmarklet|\/healthcheck|\/version|\/metrics)$')) {
         return false
       }
     } catch (_) { }
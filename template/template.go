@@ -67,7 +67,6 @@ func (t *Template) ParseTemplates() error {
 		return err
 	}
 
-	var templateContents strings.Builder
 	for _, entry := range entries {
 		filename := entry.Name()
 		fileData, err := templateFiles.ReadFile("views/" + filename)
@@ -77,8 +76,7 @@ func (t *Template) ParseTemplates() error {
 		}
 		logger.Debug("parsing: %s", filename)
 
-		templateContents.Write(fileData)
-		t.templates[filename] = template.Must(template.New("web").Funcs(t.funcMap.wrap()).Parse(templateContents.String()))
+		t.templates[filename] = template.Must(template.New("web").Funcs(t.funcMap.wrap()).Parse(string(fileData)))
 	}
 
 	return nil
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 
 	"github.com/wabarc/logger"
@@ -16,6 +17,7 @@ import (
 	"github.com/wabarc/rivet/ipfs"
 	"github.com/wabarc/wayback/config"
 	"github.com/wabarc/wayback/errors"
+	"github.com/wabarc/wayback/progress"
 	"github.com/wabarc/wayback/reduxer"
 	"golang.org/x/sync/errgroup"
 
@@ -64,38 +66,72 @@ type PH struct {
 // Waybacker is the interface that wraps the basic Wayback method.
 //
 // Wayback wayback *url.URL from struct of the implementations to the Wayback Machine.
-// It returns the result of string from the upstream services.
+// It returns the result of string from the upstream services, and a classified
+// error if the upstream services failed, annotated with the HTTP status if reported.
 type Waybacker interface {
-	Wayback(reduxer.Reduxer) string
+	Wayback(reduxer.Reduxer) (string, error)
 }
 
 // Wayback implements the standard Waybacker interface:
 // it reads URL from the IA and returns archived URL as a string.
-func (i IA) Wayback(_ reduxer.Reduxer) string {
+func (i IA) Wayback(_ reduxer.Reduxer) (string, error) {
 	arc := &ia.Archiver{}
 	dst, err := arc.Wayback(i.ctx, i.URL)
 	if err != nil {
 		logger.Error("wayback %s to Internet Archive failed: %v", i.URL.String(), err)
-		return fmt.Sprint(err)
+		return "", errors.Classify(errors.ParseStatus(err))
 	}
-	return dst
+	return dst, nil
 }
 
 // Wayback implements the standard Waybacker interface:
 // it reads URL from the IS and returns archived URL as a string.
-func (i IS) Wayback(_ reduxer.Reduxer) string {
+func (i IS) Wayback(_ reduxer.Reduxer) (string, error) {
 	arc := &is.Archiver{}
 	dst, err := arc.Wayback(i.ctx, i.URL)
 	if err != nil {
 		logger.Error("wayback %s to archive.today failed: %v", i.URL.String(), err)
-		return fmt.Sprint(err)
+		return "", errors.Classify(errors.ParseStatus(err))
 	}
-	return dst
+	return dst, nil
 }
 
 // Wayback implements the standard Waybacker interface:
 // it reads URL from the IP and returns archived URL as a string.
-func (i IP) Wayback(rdx reduxer.Reduxer) string {
+func (i IP) Wayback(rdx reduxer.Reduxer) (string, error) {
+	arc := &ip.Shaft{Hold: pinning()}
+	uri := i.URL.String()
+	ctx := i.ctx
+
+	// If there is bundled HTML, it is utilized as the basis for IPFS
+	// archiving and is sent to obelisk to crawl the rest of the page.
+	if bundle, ok := rdx.Load(reduxer.Src(uri)); ok {
+		shot := bundle.Shots()
+		buf, err := os.ReadFile(fmt.Sprint(shot.HTML))
+		if err == nil {
+			ctx = arc.WithInput(ctx, buf)
+		}
+	}
+
+	dst, err := arc.Wayback(ctx, i.URL)
+	if err != nil {
+		logger.Error("wayback %s to IPFS failed: %v", i.URL.String(), err)
+		return "", errors.Classify(errors.ParseStatus(err))
+	}
+	// rivet always links the webpage on the ipfs.io gateway.
+	if cid := strings.TrimPrefix(dst, "https://ipfs.io/ipfs/"); cid != dst {
+		return ipfsLink(cid), nil
+	}
+	return dst, nil
+}
+
+// ipfsLink returns the URL of the content of the cid on the configured IPFS gateway.
+func ipfsLink(cid string) string {
+	return config.Opts.IPFSGateway() + "/ipfs/" + cid
+}
+
+// pinning returns the IPFS pinning service of the configuration.
+func pinning() ipfs.Pinning {
 	opts := []ipfs.PinningOption{
 		ipfs.Mode(ipfs.Remote),
 	}
@@ -114,31 +150,38 @@ func (i IP) Wayback(rdx reduxer.Reduxer) string {
 		secret := config.Opts.IPFSSecret()
 		opts = append(opts, ipfs.Uses(target), ipfs.Apikey(apikey), ipfs.Secret(secret))
 	}
-	arc := &ip.Shaft{Hold: ipfs.Options(opts...)}
-	uri := i.URL.String()
-	ctx := i.ctx
+	return ipfs.Options(opts...)
+}
 
-	// If there is bundled HTML, it is utilized as the basis for IPFS
-	// archiving and is sent to obelisk to crawl the rest of the page.
-	if bundle, ok := rdx.Load(reduxer.Src(uri)); ok {
-		shot := bundle.Shots()
-		buf, err := os.ReadFile(fmt.Sprint(shot.HTML))
-		if err == nil {
-			ctx = arc.WithInput(ctx, buf)
-		}
+// PinFile pins the file of the path to IPFS with the pinning service of the
+// IP slot, and returns the URL of the file on the configured IPFS gateway.
+func PinFile(path string) (string, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
 	}
 
-	dst, err := arc.Wayback(ctx, i.URL)
+	var cid string
+	hold := pinning()
+	switch hold.Mode {
+	case ipfs.Local:
+		cid, err = (&ipfs.Locally{Pinning: hold}).Pin(buf)
+	default:
+		cid, err = (&ipfs.Remotely{Pinning: hold}).Pin(buf)
+	}
 	if err != nil {
-		logger.Error("wayback %s to IPFS failed: %v", i.URL.String(), err)
-		return fmt.Sprint(err)
+		logger.Error("pin file %s to IPFS failed: %v", path, err)
+		return "", errors.Classify(errors.ParseStatus(err))
 	}
-	return dst
+	if cid == "" {
+		return "", errors.New("pin file %s to IPFS failed: cid empty", path)
+	}
+	return ipfsLink(cid), nil
 }
 
 // Wayback implements the standard Waybacker interface:
 // it reads URL from the PH and returns archived URL as a string.
-func (i PH) Wayback(rdx reduxer.Reduxer) string {
+func (i PH) Wayback(rdx reduxer.Reduxer) (string, error) {
 	arc := &ph.Archiver{}
 	uri := i.URL.String()
 	ctx := i.ctx
@@ -154,12 +197,12 @@ func (i PH) Wayback(rdx reduxer.Reduxer) string {
 	dst, err := arc.Wayback(ctx, i.URL)
 	if err != nil {
 		logger.Error("wayback %s to telegra.ph failed: %v", i.URL.String(), err)
-		return fmt.Sprint(err)
+		return "", errors.Classify(errors.ParseStatus(err))
 	}
-	return dst
+	return dst, nil
 }
 
-func wayback(w Waybacker, r reduxer.Reduxer) string {
+func wayback(w Waybacker, r reduxer.Reduxer) (string, error) {
 	return w.Wayback(r)
 }
 
@@ -175,6 +218,7 @@ func Wayback(ctx context.Context, rdx reduxer.Reduxer, urls ...*url.URL) ([]Coll
 
 	mu := sync.Mutex{}
 	cols := []Collect{}
+	errs := []error{}
 	g, ctx := errgroup.WithContext(ctx)
 	for _, input := range urls {
 		for slot, arc := range config.Opts.Slots() {
@@ -188,21 +232,33 @@ func Wayback(ctx context.Context, rdx reduxer.Reduxer, urls ...*url.URL) ([]Coll
 
 				uri := input.String()
 				var col Collect
+				var err error
 				switch slot {
 				case config.SLOT_IA:
-					col.Dst = wayback(IA{URL: input, ctx: ctx}, rdx)
+					col.Dst, err = wayback(IA{URL: input, ctx: ctx}, rdx)
 				case config.SLOT_IS:
-					col.Dst = wayback(IS{URL: input, ctx: ctx}, rdx)
+					col.Dst, err = wayback(IS{URL: input, ctx: ctx}, rdx)
 				case config.SLOT_IP:
-					col.Dst = wayback(IP{URL: input, ctx: ctx}, rdx)
+					col.Dst, err = wayback(IP{URL: input, ctx: ctx}, rdx)
 				case config.SLOT_PH:
-					col.Dst = wayback(PH{URL: input, ctx: ctx}, rdx)
+					col.Dst, err = wayback(PH{URL: input, ctx: ctx}, rdx)
+				}
+				if err != nil {
+					col.Dst = fmt.Sprint(err)
 				}
 				col.Src = uri
 				col.Arc = slot
 				col.Ext = slot
+				event := progress.Event{Kind: progress.Archived, Src: uri, Slot: slot, Dst: col.Dst}
+				if err != nil {
+					event.Dst, event.Error = "", err.Error()
+				}
+				progress.Report(ctx, event)
 				mu.Lock()
 				cols = append(cols, col)
+				if err != nil {
+					errs = append(errs, err)
+				}
 				mu.Unlock()
 				return nil
 			})
@@ -216,6 +272,17 @@ func Wayback(ctx context.Context, rdx reduxer.Reduxer, urls ...*url.URL) ([]Coll
 		return cols, errors.New("archiving failed: no cols")
 	}
 
+	// Reports failure only if all slots failed, it is retryable if any of
+	// the failures is retryable.
+	if len(errs) == len(cols) {
+		for _, err := range errs {
+			if errors.IsRetryable(err) {
+				return cols, errors.Retryable(errors.Wrap(err, "archiving failed"))
+			}
+		}
+		return cols, errors.Permanent(errors.Wrap(errs[0], "archiving failed"))
+	}
+
 	return cols, nil
 }
 